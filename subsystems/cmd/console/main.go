@@ -18,17 +18,28 @@ import (
 	"github.com/holla2040/arturo/internal/console"
 	"github.com/holla2040/arturo/internal/mockpump"
 	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/redisacl"
+	"github.com/holla2040/arturo/internal/signkeys"
+	"github.com/holla2040/arturo/internal/streams"
+	"github.com/holla2040/arturo/internal/transport"
 	"github.com/redis/go-redis/v9"
 )
 
 const firmwareVersion = "1.0.0-mock"
 
 func main() {
+	transportName := flag.String("transport", "redis", "Message bus: redis or mqtt")
 	redisAddr := flag.String("redis", "localhost:6379", "Redis address")
+	redisUser := flag.String("redis-user", "", "Redis ACL user for all mock stations, e.g. controller (empty = no AUTH)")
+	redisPasswordFile := flag.String("redis-password-file", "", "File holding the Redis ACL user's password")
+	mqttBroker := flag.String("mqtt", "tcp://localhost:1883", "MQTT broker URL when -transport mqtt")
+	mqttUser := flag.String("mqtt-user", "", "MQTT user name for all mock stations (empty = anonymous)")
+	mqttPasswordFile := flag.String("mqtt-password-file", "", "File holding the MQTT user's password")
 	stationsFlag := flag.String("stations", "1,2,3,4", "Comma-separated station numbers to mock (e.g. 2,3,4)")
 	failRate := flag.Float64("fail-rate", 0.0, "Probability of random command failure (0.0-1.0)")
 	cooldownHours := flag.Float64("cooldown-hours", 4.0, "Simulated hours to reach base temperature")
 	httpAddr := flag.String("http", ":8001", "HTTP address for web UI")
+	signingKeys := flag.String("signing-keys", "", "Controller's signing key file; stations in it sign what they send and check commands (empty = no signing)")
 	regenTime := flag.Float64("regen-time", 0, "End-to-end regen duration in minutes (0 = use default/env). Raw regen is ~113 min; e.g. -regen-time=5 for ~5 min. Overrides ARTURO_REGEN_TIME.")
 	flag.Parse()
 
@@ -43,14 +54,59 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
-	defer rdb.Close()
-
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to Redis at %s: %v\n", *redisAddr, err)
+	var bus transport.Transport
+	switch *transportName {
+	case "redis":
+		redisOpts := &redis.Options{Addr: *redisAddr}
+		if *redisUser != "" {
+			password, err := redisacl.ReadPasswordFile(*redisPasswordFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read Redis password: %v\n", err)
+				os.Exit(1)
+			}
+			redisOpts.Username, redisOpts.Password = *redisUser, password
+		}
+		rdb := redis.NewClient(redisOpts)
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to Redis at %s: %v\n", *redisAddr, err)
+			os.Exit(1)
+		}
+		log.Printf("Connected to Redis at %s", *redisAddr)
+		bus = transport.NewRedis(rdb)
+	case "mqtt":
+		// One session consumes every mock station's command stream.
+		opts := transport.MQTTOptions{Broker: *mqttBroker, ClientID: "arturo-console"}
+		if *mqttUser != "" {
+			password, err := redisacl.ReadPasswordFile(*mqttPasswordFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read MQTT password: %v\n", err)
+				os.Exit(1)
+			}
+			opts.Username, opts.Password = *mqttUser, password
+		}
+		m, err := transport.NewMQTT(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to MQTT broker: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Connected to MQTT broker at %s", *mqttBroker)
+		bus = m
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -transport %q: must be redis or mqtt\n", *transportName)
 		os.Exit(1)
 	}
-	log.Printf("Connected to Redis at %s", *redisAddr)
+	var verifier *protocol.Verifier
+	if *signingKeys != "" {
+		keys, err := signkeys.Load(*signingKeys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load signing keys: %v\n", err)
+			os.Exit(1)
+		}
+		bus = transport.SignMessages(bus, keys.Current)
+		verifier = protocol.NewVerifier(keys.Lookup, false, 0)
+		log.Printf("Signing messages for stations in %s", *signingKeys)
+	}
+	defer bus.Close()
 
 	// Create mock stations
 	var wg sync.WaitGroup
@@ -68,7 +124,8 @@ func main() {
 		}
 		online := true
 		s := &mockStation{
-			rdb:      rdb,
+			bus:      bus,
+			verifier: verifier,
 			instance: inst,
 			deviceID: dev,
 			pump:     pump,
@@ -92,7 +149,7 @@ func main() {
 	}
 
 	// Build console handler
-	handler, runMonitor := console.Handler(stationInfos, rdb)
+	handler, runMonitor := console.Handler(stationInfos, bus)
 	runMonitor(ctx)
 
 	// Start HTTP server
@@ -178,7 +235,8 @@ func parseStations(s string) ([]int, error) {
 // ── Mock Station ──
 
 type mockStation struct {
-	rdb      *redis.Client
+	bus      transport.Transport
+	verifier *protocol.Verifier // nil = commands not checked
 	instance string
 	deviceID string
 	pump     *mockpump.Pump
@@ -221,7 +279,12 @@ func (s *mockStation) source() protocol.Source {
 }
 
 func (s *mockStation) heartbeatLoop(ctx context.Context) {
+	// Say hello once, before the first heartbeat, like the firmware does
+	// on connect.
+	helloSent := false
 	if *s.online {
+		s.sendHello(ctx, true)
+		helloSent = true
 		s.sendHeartbeat(ctx)
 	}
 
@@ -234,12 +297,52 @@ func (s *mockStation) heartbeatLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			if *s.online {
+				if !helloSent {
+					s.sendHello(ctx, true)
+					helloSent = true
+				}
 				s.sendHeartbeat(ctx)
 			}
 		}
 	}
 }
 
+// mockMessageTypes and mockFeatures are what the mock station advertises
+// in its service.hello: it honors dedup, expiry and batches but has no raw
+// passthrough or OTA.
+var (
+	mockMessageTypes = []string{
+		protocol.TypeDeviceCommandRequest,
+		protocol.TypeDeviceCommandResponse,
+		protocol.TypeDeviceCommandBatchRequest,
+		protocol.TypeDeviceCommandBatchResponse,
+		protocol.TypeServiceHeartbeat,
+		protocol.TypeServiceHello,
+		protocol.TypeTestStateUpdate,
+	}
+	mockFeatures = []string{protocol.FeatureCommandDedup, protocol.FeatureCommandExpiry, protocol.FeatureBatchCommands}
+)
+
+func (s *mockStation) sendHello(ctx context.Context, request bool) {
+	msg, err := protocol.BuildHello(s.source(), mockMessageTypes, mockFeatures, firmwareVersion, request)
+	if err != nil {
+		log.Printf("[%s] hello build error: %v", s.instance, err)
+		return
+	}
+
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[%s] hello marshal error: %v", s.instance, err)
+		return
+	}
+
+	if err := s.bus.Publish(ctx, transport.ChannelHello, msgJSON); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[%s] hello publish error: %v", s.instance, err)
+		}
+	}
+}
+
 func (s *mockStation) sendHeartbeat(ctx context.Context) {
 	uptime := int64(time.Since(s.startUp).Seconds())
 	cmdProcessed := 0
@@ -270,7 +373,7 @@ func (s *mockStation) sendHeartbeat(ctx context.Context) {
 		return
 	}
 
-	if err := s.rdb.Publish(ctx, "events:heartbeat", string(msgJSON)).Err(); err != nil {
+	if err := s.bus.Publish(ctx, transport.ChannelHeartbeat, msgJSON); err != nil {
 		if ctx.Err() == nil {
 			log.Printf("[%s] heartbeat publish error: %v", s.instance, err)
 		}
@@ -278,10 +381,9 @@ func (s *mockStation) sendHeartbeat(ctx context.Context) {
 }
 
 func (s *mockStation) presenceLoop(ctx context.Context) {
-	key := "device:" + s.instance + ":alive"
 	wasOnline := *s.online
 	if wasOnline {
-		s.rdb.Set(ctx, key, "1", 15*time.Second)
+		s.bus.SetAlive(ctx, s.instance, 15*time.Second)
 	}
 
 	ticker := time.NewTicker(3 * time.Second)
@@ -294,69 +396,93 @@ func (s *mockStation) presenceLoop(ctx context.Context) {
 		case <-ticker.C:
 			on := *s.online
 			if on {
-				s.rdb.Set(ctx, key, "1", 15*time.Second)
+				s.bus.SetAlive(ctx, s.instance, 15*time.Second)
 			} else if wasOnline {
 				// Transitioning to offline — remove alive key immediately
-				s.rdb.Del(ctx, key)
+				s.bus.ClearAlive(ctx, s.instance)
 			}
 			wasOnline = on
 		}
 	}
 }
 
+// commandLoop reads the station's command stream like the firmware does:
+// as the station consumer group, acknowledging each command once handled.
+// While the mock is offline it stops reading, so commands wait for it.
 func (s *mockStation) commandLoop(ctx context.Context) {
-	channel := "commands:" + s.instance
-
-	for {
-		if ctx.Err() != nil {
-			return
+	consumer := s.bus.Consume(transport.CommandStream(s.instance), transport.StationGroup, s.instance, "0", time.Second)
+
+	for ctx.Err() == nil {
+		if !*s.online {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+			consumer.Recover()
+			continue
 		}
 
-		sub := s.rdb.Subscribe(ctx, channel)
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-ch:
-					if !ok {
-						log.Printf("[%s] command subscription closed, reconnecting...", s.instance)
-						return
-					}
-					if !*s.online {
-						continue
-					}
-					s.handleCommand(ctx, msg.Payload)
-				}
+		msgs, err := consumer.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
 			}
-		}()
-
-		// Back off before retrying
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(2 * time.Second):
+			log.Printf("[%s] command stream: %v; retrying", s.instance, err)
+			consumer.Recover()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+		for _, m := range msgs {
+			s.handleCommand(ctx, m.Data)
+			consumer.Ack(ctx, m.ID)
 		}
 	}
 }
 
-func (s *mockStation) handleCommand(ctx context.Context, msgJSON string) {
-	parsed, err := protocol.Parse([]byte(msgJSON))
+func (s *mockStation) handleCommand(ctx context.Context, msgJSON []byte) {
+	parsed, err := protocol.Parse(msgJSON)
 	if err != nil {
 		log.Printf("[%s] parse error: %v", s.instance, err)
 		return
 	}
+	if s.verifier != nil {
+		if err := s.verifier.Verify(parsed, s.instance); err != nil {
+			log.Printf("[%s] dropping %s: %v", s.instance, parsed.Envelope.Type, err)
+			return
+		}
+	}
+	if streams.Expired(parsed, time.Now()) {
+		log.Printf("[%s] dropping expired command %s", s.instance, parsed.Envelope.CorrelationID)
+		return
+	}
+	if cid := parsed.Envelope.CorrelationID; cid != "" {
+		first, err := s.bus.Claim(ctx, s.instance, cid)
+		if err != nil {
+			log.Printf("[%s] dedup claim: %v", s.instance, err)
+			return
+		}
+		if !first {
+			log.Printf("[%s] skipping already executed command %s", s.instance, cid)
+			return
+		}
+	}
 
 	switch parsed.Envelope.Type {
 	case protocol.TypeDeviceCommandRequest:
 		s.handleDeviceCommandRequest(ctx, parsed)
+	case protocol.TypeDeviceCommandBatchRequest:
+		s.handleBatchRequest(ctx, parsed)
 	case protocol.TypeTestStateUpdate:
 		s.handleTestStateUpdate(parsed)
 	case protocol.TypeSystemOTARequest:
 		log.Printf("[%s] OTA request received (not supported in mock station, ignoring)", s.instance)
+	case protocol.TypeServiceHello:
+		s.handleHello(ctx, parsed)
 	default:
 		log.Printf("[%s] unknown message type: %q", s.instance, parsed.Envelope.Type)
 	}
@@ -389,6 +515,52 @@ func (s *mockStation) handleDeviceCommandRequest(ctx context.Context, parsed *pr
 	}
 }
 
+// handleBatchRequest runs each command of a batch in order against the mock
+// pump and answers with one device.command.batch_response.
+func (s *mockStation) handleBatchRequest(ctx context.Context, parsed *protocol.Message) {
+	batch, err := protocol.ParseBatchRequest(parsed)
+	if err != nil {
+		log.Printf("[%s] batch parse error: %v", s.instance, err)
+		return
+	}
+
+	start := time.Now()
+	var payload protocol.BatchResponsePayload
+	for _, c := range batch.Commands {
+		itemStart := time.Now()
+		result := protocol.CommandResponsePayload{DeviceID: c.DeviceID, CommandName: c.CommandName}
+		if c.DeviceID != s.deviceID {
+			result.Error = &protocol.Error{Code: protocol.ErrCodeDeviceNotFound, Message: fmt.Sprintf("unknown device: %s", c.DeviceID)}
+		} else if response, ok := s.pump.HandleCommand(c.CommandName); ok {
+			result.Success = true
+			result.Response = &response
+		} else {
+			result.Error = &protocol.Error{Code: protocol.ErrCodeCommandFailed, Message: response}
+		}
+		durationMs := int(time.Since(itemStart).Milliseconds())
+		result.DurationMs = &durationMs
+		payload.Results = append(payload.Results, result)
+	}
+	durationMs := int(time.Since(start).Milliseconds())
+	payload.DurationMs = &durationMs
+
+	s.reply(ctx, parsed, protocol.TypeDeviceCommandBatchResponse, payload)
+}
+
+func (s *mockStation) handleHello(ctx context.Context, parsed *protocol.Message) {
+	hello, err := protocol.ParseHello(parsed)
+	if err != nil {
+		log.Printf("[%s] hello parse error: %v", s.instance, err)
+		return
+	}
+
+	log.Printf("[%s] hello from %s (%s, request=%t)",
+		s.instance, parsed.Envelope.Source.Instance, parsed.Envelope.SchemaVersion, hello.Request)
+	if hello.Request {
+		s.sendHello(ctx, false)
+	}
+}
+
 func (s *mockStation) handleTestStateUpdate(parsed *protocol.Message) {
 	tsu, err := protocol.ParseTestStateUpdate(parsed)
 	if err != nil {
@@ -411,8 +583,12 @@ func (s *mockStation) sendResponse(ctx context.Context, req *protocol.Message, c
 		Error:       respErr,
 		DurationMs:  &durationMs,
 	}
+	s.reply(ctx, req, protocol.TypeDeviceCommandResponse, payload)
+}
 
-	msg, err := protocol.NewMessage(s.source(), protocol.TypeDeviceCommandResponse, payload)
+// reply sends a msgType response carrying payload to req's reply_to stream.
+func (s *mockStation) reply(ctx context.Context, req *protocol.Message, msgType string, payload interface{}) {
+	msg, err := protocol.NewMessage(s.source(), msgType, payload)
 	if err != nil {
 		log.Printf("[%s] response build error: %v", s.instance, err)
 		return
@@ -432,9 +608,9 @@ func (s *mockStation) sendResponse(ctx context.Context, req *protocol.Message, c
 		return
 	}
 
-	if err := s.rdb.Publish(ctx, replyTo, string(msgJSON)).Err(); err != nil {
+	if err := s.bus.Reply(ctx, replyTo, msgJSON); err != nil {
 		if ctx.Err() == nil {
-			log.Printf("[%s] response PUBLISH error: %v", s.instance, err)
+			log.Printf("[%s] response error: %v", s.instance, err)
 		}
 	}
 }
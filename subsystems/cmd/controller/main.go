@@ -1,27 +1,42 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/holla2040/arturo/internal/api"
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/backup"
 	"github.com/holla2040/arturo/internal/estop"
 	"github.com/holla2040/arturo/internal/poller"
 	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/redisacl"
 	"github.com/holla2040/arturo/internal/redishealth"
 	"github.com/holla2040/arturo/internal/registry"
+	"github.com/holla2040/arturo/internal/retention"
+	"github.com/holla2040/arturo/internal/scan"
+	"github.com/holla2040/arturo/internal/scheduler"
+	"github.com/holla2040/arturo/internal/signkeys"
 	"github.com/holla2040/arturo/internal/store"
+	"github.com/holla2040/arturo/internal/streams"
 	"github.com/holla2040/arturo/internal/testmanager"
+	"github.com/holla2040/arturo/internal/tlscert"
+	"github.com/holla2040/arturo/internal/transport"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -39,43 +54,190 @@ func main() {
 		runSendCommand()
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestoreCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		runUserCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "acl" {
+		runACLCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		runAPIKeyCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		runKeysCommand()
+		return
+	}
 
 	// Server mode
+	transportName := flag.String("transport", "redis", "Message bus: redis or mqtt")
 	redisAddr := flag.String("redis", "localhost:6379", "Redis address")
+	redisUser := flag.String("redis-user", "", "Redis ACL user (empty = no AUTH)")
+	redisPasswordFile := flag.String("redis-password-file", "", "File holding the Redis ACL user's password")
+	mqttBroker := flag.String("mqtt", "tcp://localhost:1883", "MQTT broker URL when -transport mqtt")
+	mqttUser := flag.String("mqtt-user", "", "MQTT user name (empty = anonymous)")
+	mqttPasswordFile := flag.String("mqtt-password-file", "", "File holding the MQTT user's password")
+	validateSchema := flag.Bool("validate-schema", false, "Check every inbound message against the JSON schemas and log non-conforming ones")
+	signingKeys := flag.String("signing-keys", "", "Per-station envelope signing key file from \"controller keys\", for stations run by Go processes; firmware does not sign (empty = no signing)")
+	requireSignatures := flag.Bool("require-signatures", false, "Drop unsigned messages, including from stations without a signing key (so every firmware station)")
+	replayWindow := flag.Duration("replay-window", protocol.DefaultReplayWindow, "Maximum clock skew and replay cache lifetime for signed messages")
 	listenAddr := flag.String("listen", ":8002", "HTTP listen address")
 	dbPath := flag.String("db", "arturo.db", "SQLite database path")
+	dsn := flag.String("dsn", "", "Database DSN; a postgres:// URL selects PostgreSQL (overrides -db)")
 	scriptsDir := flag.String("scripts", "scripts", "Directory containing .art test scripts")
+	production := flag.Bool("production", false, "Only run approved script registry versions")
+	maxPause := flag.Duration("max-pause", 0, "Maximum test pause before automatic action (0 = unlimited)")
+	pauseTimeoutAction := flag.String("pause-timeout-action", testmanager.PauseTimeoutTerminate, "Action when -max-pause elapses: resume or terminate")
+	deviceProfiles := flag.String("device-profiles", "", "Device profiles whose safe_state commands are sent on pause/terminate/abort, e.g. PUMP-01=profiles/pumps/cti_onboard.yaml (station/DEVICE= for one station)")
+	retentionRaw := flag.Duration("retention-raw", retention.DefaultPolicy().Raw, "Keep raw temperature/pump status log rows outside test runs this long")
+	retentionAggregate := flag.Duration("retention-aggregate", retention.DefaultPolicy().Aggregate, "Keep 1-minute telemetry aggregates this long")
+	retentionInterval := flag.Duration("retention-interval", retention.DefaultPolicy().Interval, "How often the telemetry retention job runs")
+	backupDir := flag.String("backup-dir", backup.DefaultConfig().Dir, "Directory for online SQLite backups (empty = disabled)")
+	backupInterval := flag.Duration("backup-interval", backup.DefaultConfig().Interval, "Time between scheduled backups (0 = on demand only)")
+	backupKeep := flag.Int("backup-keep", backup.DefaultConfig().Keep, "Number of backups to keep (0 = keep all)")
+	authKey := flag.String("auth-key", "auth.key", "Session token signing key file (created if missing)")
+	sessionTTL := flag.Duration("session-ttl", 12*time.Hour, "How long a login session lasts")
+	noAuth := flag.Bool("no-auth", false, "Disable authentication and trust the X-Employee-ID header (development only)")
+	scanFormats := flag.String("scan-formats", "", "YAML barcode formats for scan input (empty = built-in defaults)")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; with -tls-key serves HTTPS and WSS")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Generate a self-signed certificate for -tls-cert/-tls-key if they do not exist")
+	commandRate := flag.Float64("command-rate", 0, "Device commands per second sent to each station; safety commands, then script and operator commands, then poller telemetry go first (0 = unlimited)")
+	pollRegen := flag.Duration("poll-regen", poller.DefaultIntervals().Regen, "Station poll interval while a pump regenerates")
+	pollRunning := flag.Duration("poll-running", poller.DefaultIntervals().Running, "Station poll interval while a pump is on")
+	pollIdle := flag.Duration("poll-idle", poller.DefaultIntervals().Idle, "Station poll interval while every pump is off")
+	pollMaxBackoff := flag.Duration("poll-max-backoff", poller.DefaultIntervals().MaxBackoff, "Longest poll interval for a station whose polls keep failing")
+	resources := flag.String("resources", "", "Shared resources scripts may ACQUIRE, e.g. rough_line,purge_gas=2 (default capacity 1)")
 	flag.Parse()
 
+	if *requireSignatures && *signingKeys == "" {
+		log.Fatalf("-require-signatures needs -signing-keys")
+	}
+	if *pauseTimeoutAction != testmanager.PauseTimeoutResume && *pauseTimeoutAction != testmanager.PauseTimeoutTerminate {
+		log.Fatalf("Invalid -pause-timeout-action %q: must be resume or terminate", *pauseTimeoutAction)
+	}
+	resourceConfigs, err := testmanager.ParseResources(*resources)
+	if err != nil {
+		log.Fatalf("Invalid -resources: %v", err)
+	}
+	safeStates, err := testmanager.LoadSafeStates(*deviceProfiles)
+	if err != nil {
+		log.Fatalf("Invalid -device-profiles: %v", err)
+	}
+
 	// Context for graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// Initialize Redis
-	rdb := redis.NewClient(&redis.Options{Addr: *redisAddr})
-	defer rdb.Close()
-
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis at %s: %v", *redisAddr, err)
+	// Connect to the message bus
+	var bus transport.Transport
+	var rdb *redis.Client // Redis transport only
+	switch *transportName {
+	case "redis":
+		redisOpts, err := redisOptions(*redisAddr, *redisUser, *redisPasswordFile)
+		if err != nil {
+			log.Fatalf("Invalid Redis credentials: %v", err)
+		}
+		rdb = redis.NewClient(redisOpts)
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis at %s: %v", *redisAddr, err)
+		}
+		if *redisUser != "" {
+			log.Printf("Connected to Redis at %s as %s", *redisAddr, *redisUser)
+		} else {
+			log.Printf("Connected to Redis at %s", *redisAddr)
+		}
+		bus = transport.NewRedis(rdb)
+	case "mqtt":
+		opts, err := mqttOptions(*mqttBroker, *mqttUser, *mqttPasswordFile)
+		if err != nil {
+			log.Fatalf("Invalid MQTT credentials: %v", err)
+		}
+		m, err := transport.NewMQTT(opts)
+		if err != nil {
+			log.Fatalf("Failed to connect to MQTT broker: %v", err)
+		}
+		log.Printf("Connected to MQTT broker at %s", *mqttBroker)
+		bus = m
+	default:
+		log.Fatalf("Invalid -transport %q: must be redis or mqtt", *transportName)
+	}
+	if *validateSchema {
+		bus = transport.CheckSchema(bus, func(m transport.Message, err error) {
+			log.Printf("Schema: non-conforming message on %s: %v", m.Channel, err)
+		})
+		log.Printf("Checking inbound messages against the v1 JSON schemas")
+	}
+	var verifier *protocol.Verifier // nil = signatures not checked
+	if *signingKeys != "" {
+		keys, err := signkeys.Load(*signingKeys)
+		if err != nil {
+			log.Fatalf("Failed to load signing keys: %v", err)
+		}
+		bus = transport.SignMessages(bus, keys.Current)
+		verifier = protocol.NewVerifier(keys.Lookup, *requireSignatures, *replayWindow)
+		if *requireSignatures {
+			log.Printf("Signing messages for %d stations from %s; unsigned messages are dropped", len(keys.Stations), *signingKeys)
+		} else {
+			log.Printf("Signing messages for %d stations from %s", len(keys.Stations), *signingKeys)
+		}
 	}
-	log.Printf("Connected to Redis at %s", *redisAddr)
+	defer bus.Close()
 
-	// Initialize SQLite store
-	db, err := store.New(*dbPath)
+	// Initialize store (SQLite unless -dsn names PostgreSQL)
+	if *dsn == "" {
+		*dsn = *dbPath
+	}
+	db, err := store.New(*dsn)
 	if err != nil {
-		log.Fatalf("Failed to open database at %s: %v", *dbPath, err)
+		log.Fatalf("Failed to open database at %s: %v", redactDSN(*dsn), err)
 	}
 	defer db.Close()
-	log.Printf("Opened database at %s", *dbPath)
+	log.Printf("Opened database at %s", redactDSN(*dsn))
 
 	// Initialize components
 	reg := registry.New()
 	dispatcher := api.NewResponseDispatcher()
 	wsHub := api.NewHub()
 
-	// Test manager for test lifecycle
-	testMgr := testmanager.New(ctx, db, wsHub, rdb, serverSource)
-	log.Println("Test manager initialized")
+	// Command sender: a per-station queue with priority lanes that paces
+	// commands to -command-rate and coalesces duplicate queries
+	sender := scheduler.New(transport.NewSender(bus), dispatcher, *commandRate)
+	if *commandRate > 0 {
+		log.Printf("Sending at most %g commands/s to each station", *commandRate)
+	}
+
+	// Test manager for test lifecycle; script routers share the dispatcher
+	testMgr := testmanager.New(ctx, db, wsHub, bus, sender, dispatcher, serverSource)
+	testMgr.SetRequireApprovedScripts(*production)
+	testMgr.SetPausePolicy(testmanager.PausePolicy{MaxDuration: *maxPause, OnTimeout: *pauseTimeoutAction})
+	testMgr.SetStationFeatures(reg.Supports)
+	testMgr.SetSafeStates(safeStates)
+	for device, cfg := range safeStates {
+		log.Printf("Safe-state commands for %s: %+v", device, cfg)
+	}
+	testMgr.SetResources(resourceConfigs)
+	for _, rc := range resourceConfigs {
+		log.Printf("Shared resource %s (capacity %d)", rc.Name, rc.Capacity)
+	}
+	if *production {
+		log.Println("Test manager initialized (production mode: approved scripts only)")
+	} else {
+		log.Println("Test manager initialized")
+	}
+	if *maxPause > 0 {
+		log.Printf("Paused tests auto-%s after %s", *pauseTimeoutAction, *maxPause)
+	}
 
 	// E-stop coordinator with callback to broadcast via WebSocket and stop all tests
 	estopCoord := estop.New(func(state estop.State) {
@@ -84,21 +246,21 @@ func main() {
 		testMgr.EmergencyStopAll()
 	})
 
-	// Redis command sender
-	sender := &redisCommandSender{rdb: rdb}
-
-	// Redis health monitor
-	redisMon := redishealth.New(rdb,
-		redishealth.WithInterval(5*time.Second),
-		redishealth.WithOnDown(func() {
-			log.Println("Redis connection lost — API commands will return 503")
-			wsHub.BroadcastEvent("redis_health", map[string]string{"status": "disconnected"})
-		}),
-		redishealth.WithOnUp(func() {
-			log.Println("Redis connection restored — API commands available")
-			wsHub.BroadcastEvent("redis_health", map[string]string{"status": "connected"})
-		}),
-	)
+	// Redis health monitor (the MQTT client reconnects on its own)
+	var redisMon *redishealth.Monitor
+	if rdb != nil {
+		redisMon = redishealth.New(rdb,
+			redishealth.WithInterval(5*time.Second),
+			redishealth.WithOnDown(func() {
+				log.Println("Redis connection lost — API commands will return 503")
+				wsHub.BroadcastEvent("redis_health", map[string]string{"status": "disconnected"})
+			}),
+			redishealth.WithOnUp(func() {
+				log.Println("Redis connection restored — API commands available")
+				wsHub.BroadcastEvent("redis_health", map[string]string{"status": "connected"})
+			}),
+		)
+	}
 
 	// Resolve scripts directory to absolute path
 	absScriptsDir, err := filepath.Abs(*scriptsDir)
@@ -107,17 +269,81 @@ func main() {
 		absScriptsDir = *scriptsDir
 	}
 
+	// Telemetry retention for the continuous poller logs
+	retentionJob := retention.New(db, retention.Policy{
+		Raw:       *retentionRaw,
+		Aggregate: *retentionAggregate,
+		Interval:  *retentionInterval,
+	})
+	log.Printf("Telemetry retention: raw %s, 1-minute aggregates %s, every %s",
+		*retentionRaw, *retentionAggregate, *retentionInterval)
+
+	// Station poller: each online station polled in its own goroutine
+	stationPoller := poller.New(serverSource, sender, dispatcher, reg, wsHub, db)
+	stationPoller.SetIntervals(poller.Intervals{Regen: *pollRegen, Running: *pollRunning, Idle: *pollIdle, MaxBackoff: *pollMaxBackoff})
+
 	// HTTP handler
 	handler := &api.Handler{
-		Registry:    reg,
-		Store:       db,
-		Estop:       estopCoord,
-		Dispatcher:  dispatcher,
-		Sender:      sender,
-		Source:      serverSource,
-		RedisHealth: redisMon,
-		TestMgr:     testMgr,
-		ScriptsDir:  absScriptsDir,
+		Registry:   reg,
+		Store:      db,
+		Estop:      estopCoord,
+		Dispatcher: dispatcher,
+		Sender:     sender,
+		Source:     serverSource,
+		Retention:  retentionJob,
+		Queues:     sender,
+		Poller:     stationPoller,
+		TestMgr:    testMgr,
+		ScriptsDir: absScriptsDir,
+	}
+	if redisMon != nil {
+		handler.RedisHealth = redisMon
+	}
+
+	// Authentication: PIN/password login issues signed session tokens
+	if *noAuth {
+		log.Println("WARNING: authentication disabled (-no-auth); any client can act as any employee")
+	} else {
+		key, err := auth.LoadOrCreateKey(*authKey)
+		if err != nil {
+			log.Fatalf("Failed to load auth key: %v", err)
+		}
+		handler.Auth = auth.NewSigner(key, *sessionTTL)
+		log.Printf("Authentication enabled: key %s, sessions last %s", *authKey, *sessionTTL)
+	}
+
+	// WebSocket connections need a session token or API key like the API
+	if handler.Auth != nil {
+		wsHub.Authenticate = handler.AuthenticateWebSocket
+	}
+
+	// Barcode scan input: badge login and RMA lookup
+	formats := scan.DefaultFormats()
+	if *scanFormats != "" {
+		if formats, err = scan.LoadFormats(*scanFormats); err != nil {
+			log.Fatalf("Failed to load scan formats: %v", err)
+		}
+	}
+	if handler.Scanner, err = scan.NewParser(formats); err != nil {
+		log.Fatalf("Invalid scan formats: %v", err)
+	}
+	if *scanFormats != "" {
+		log.Printf("Scan formats loaded from %s (%d formats)", *scanFormats, len(formats))
+	}
+
+	// Online database backups (PostgreSQL deployments use pg_dump instead)
+	var backupMgr *backup.Manager
+	if *backupDir != "" && db.Dialect() == "sqlite" {
+		backupMgr, err = backup.New(db, backup.Config{
+			Dir:      *backupDir,
+			Interval: *backupInterval,
+			Keep:     *backupKeep,
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up backups: %v", err)
+		}
+		handler.Backups = backupMgr
+		log.Printf("Database backups: %s every %s, keeping %d", *backupDir, *backupInterval, *backupKeep)
 	}
 
 	mux := http.NewServeMux()
@@ -133,27 +359,56 @@ func main() {
 		Handler: mux,
 	}
 
+	// TLS: a deployed certificate, or a self-signed one for the LAN
+	if *tlsSelfSigned {
+		if *tlsCert == "" {
+			*tlsCert = "tls.crt"
+		}
+		if *tlsKey == "" {
+			*tlsKey = "tls.key"
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
+	if *tlsSelfSigned {
+		created, err := tlscert.LoadOrCreate(*tlsCert, *tlsKey, tlscert.LocalHosts())
+		if err != nil {
+			log.Fatalf("Failed to set up TLS certificate: %v", err)
+		}
+		if created {
+			log.Printf("Generated self-signed TLS certificate %s; give it to terminals with -controller-ca", *tlsCert)
+		}
+	}
+
 	var wg sync.WaitGroup
 
 	// 1. Heartbeat listener
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runHeartbeatListener(ctx, rdb, reg, wsHub, testMgr)
+		runHeartbeatListener(ctx, bus, verifier, reg, wsHub, testMgr)
+	}()
+
+	// 1a. Hello listener (station protocol version and capabilities)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runHelloListener(ctx, bus, verifier, reg)
 	}()
 
 	// 2. E-stop listener
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runEstopListener(ctx, rdb, estopCoord, wsHub)
+		runEstopListener(ctx, bus, verifier, estopCoord, wsHub)
 	}()
 
 	// 3. Response listener
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runResponseListener(ctx, rdb, dispatcher, wsHub)
+		runResponseListener(ctx, bus, verifier, dispatcher, wsHub)
 	}()
 
 	// 4. Health check ticker
@@ -171,66 +426,61 @@ func main() {
 	}()
 
 	// 6. Redis health monitor
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		redisMon.Run(ctx)
-	}()
+	if redisMon != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			redisMon.Run(ctx)
+		}()
+	}
 
 	// 7. HTTP server
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		log.Printf("HTTP server listening on %s", *listenAddr)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if *tlsCert != "" {
+			log.Printf("HTTPS server listening on %s (certificate %s)", *listenAddr, *tlsCert)
+			err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			log.Printf("HTTP server listening on %s", *listenAddr)
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
 
-	// 8. Station poller (background status + temperature queries)
+	// 8. Station poller (background status + temperature queries per station)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		stationPoller := poller.New(serverSource, sender, dispatcher, reg, wsHub, db)
 		stationPoller.Run(ctx)
 	}()
 
-	// 9. Temperature log pruner (12-hour rolling window)
+	// 9. Telemetry retention (downsample + prune temperature/pump status logs)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		cutoff := 12 * time.Hour
-
-		// Prune immediately on startup
-		if count, err := db.PruneTemperatureLog(time.Now().Add(-cutoff)); err != nil {
-			log.Printf("temperature pruner: startup error: %v", err)
-		} else if count > 0 {
-			log.Printf("temperature pruner: startup pruned %d rows", count)
-		}
-
-		ticker := time.NewTicker(10 * time.Minute)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if count, err := db.PruneTemperatureLog(time.Now().Add(-cutoff)); err != nil {
-					log.Printf("temperature pruner: %v", err)
-				} else if count > 0 {
-					log.Printf("temperature pruner: pruned %d rows", count)
-				}
-			}
-		}
+		retentionJob.Run(ctx)
 	}()
 
 	// 10. Test control listener (station UI buttons → test manager)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		runTestControlListener(ctx, rdb, testMgr)
+		runTestControlListener(ctx, bus, verifier, testMgr)
 	}()
 
+	// 11. Scheduled database backups
+	if backupMgr != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			backupMgr.Run(ctx)
+		}()
+	}
+
 	// Wait for shutdown signal
 	<-ctx.Done()
 	log.Println("Shutting down...")
@@ -245,141 +495,112 @@ func main() {
 }
 
 // runHeartbeatListener subscribes to heartbeat events and updates the registry.
-// It automatically re-subscribes if the connection drops.
-func runHeartbeatListener(ctx context.Context, rdb *redis.Client, reg *registry.Registry, hub *api.Hub, testMgr *testmanager.TestManager) {
-	for {
-		if ctx.Err() != nil {
+// It automatically re-subscribes if the connection drops. Stations that
+// haven't introduced themselves with service.hello are asked to.
+func runHeartbeatListener(ctx context.Context, bus transport.Transport, verifier *protocol.Verifier, reg *registry.Registry, hub *api.Hub, testMgr *testmanager.TestManager) {
+	transport.Listen(ctx, bus, func(msg transport.Message) {
+		parsed, err := protocol.Parse(msg.Data)
+		if err != nil {
+			log.Printf("heartbeat: parse error: %v", err)
 			return
 		}
-
-		sub := rdb.Subscribe(ctx, "events:heartbeat")
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-ch:
-					if !ok {
-						log.Println("heartbeat: subscription channel closed, reconnecting...")
-						return
-					}
-					parsed, err := protocol.Parse([]byte(msg.Payload))
-					if err != nil {
-						log.Printf("heartbeat: parse error: %v", err)
-						continue
-					}
-					payload, err := protocol.ParseHeartbeat(parsed)
-					if err != nil {
-						log.Printf("heartbeat: payload error: %v", err)
-						continue
-					}
-					reg.UpdateFromHeartbeat(parsed.Envelope.Source.Instance, payload)
-					testMgr.HandleHeartbeat(parsed.Envelope.Source.Instance)
-					hub.BroadcastEvent("heartbeat", payload)
-				}
-			}
-		}()
-
-		// Back off before retrying
-		select {
-		case <-ctx.Done():
+		if !verified(verifier, "heartbeat", parsed) {
 			return
-		case <-time.After(2 * time.Second):
 		}
-	}
+		payload, err := protocol.ParseHeartbeat(parsed)
+		if err != nil {
+			log.Printf("heartbeat: payload error: %v", err)
+			return
+		}
+		instance := parsed.Envelope.Source.Instance
+		reg.UpdateFromHeartbeat(instance, payload)
+		reg.SetProtocolVersion(instance, parsed.Envelope.SchemaVersion)
+		testMgr.HandleHeartbeat(instance)
+		hub.BroadcastEvent("heartbeat", payload)
+
+		if reg.ShouldRequestHello(instance, time.Now()) {
+			sendHello(ctx, bus, instance, true)
+		}
+	}, transport.ChannelHeartbeat)
 }
 
-// runEstopListener subscribes to emergency stop events.
-// It automatically re-subscribes if the connection drops.
-func runEstopListener(ctx context.Context, rdb *redis.Client, coord *estop.Coordinator, hub *api.Hub) {
-	for {
-		if ctx.Err() != nil {
+// runHelloListener records the protocol version and capabilities stations
+// announce on events:hello, answering those that ask with the controller's
+// own hello. A station on another major version is still recorded so the
+// mismatch shows up in the API.
+func runHelloListener(ctx context.Context, bus transport.Transport, verifier *protocol.Verifier, reg *registry.Registry) {
+	transport.Listen(ctx, bus, func(msg transport.Message) {
+		parsed, err := protocol.Parse(msg.Data)
+		if err != nil {
+			log.Printf("hello: parse error: %v", err)
 			return
 		}
-
-		sub := rdb.Subscribe(ctx, "events:emergency_stop")
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-ch:
-					if !ok {
-						log.Println("estop: subscription channel closed, reconnecting...")
-						return
-					}
-					parsed, err := protocol.Parse([]byte(msg.Payload))
-					if err != nil {
-						log.Printf("estop: parse error: %v", err)
-						continue
-					}
-					if err := coord.HandleMessage(parsed); err != nil {
-						log.Printf("estop: handle error: %v", err)
-					}
-				}
-			}
-		}()
-
-		// Back off before retrying
-		select {
-		case <-ctx.Done():
+		if !verified(verifier, "hello", parsed) {
+			return
+		}
+		payload, err := protocol.ParseHello(parsed)
+		if err != nil {
+			log.Printf("hello: payload error: %v", err)
 			return
-		case <-time.After(2 * time.Second):
 		}
+		instance := parsed.Envelope.Source.Instance
+		if err := protocol.CheckSchemaVersion(parsed.Envelope.SchemaVersion); err != nil {
+			log.Printf("hello: station %s: %v", instance, err)
+		}
+		reg.UpdateFromHello(instance, parsed.Envelope.SchemaVersion, payload)
+		log.Printf("hello: station %s speaks %s, features %v", instance, parsed.Envelope.SchemaVersion, payload.Features)
+
+		if payload.Request {
+			sendHello(ctx, bus, instance, false)
+		}
+	}, transport.ChannelHello)
+}
+
+// sendHello sends the controller's service.hello to a station's command
+// stream. request asks the station to answer with its own.
+func sendHello(ctx context.Context, bus transport.Streams, instance string, request bool) {
+	msg, err := protocol.BuildHello(serverSource, protocol.ValidMessageTypes, nil, serverSource.Version, request)
+	if err != nil {
+		log.Printf("hello: build: %v", err)
+		return
+	}
+	if err := transport.NewSender(bus).SendCommand(ctx, transport.CommandStream(instance), msg); err != nil {
+		log.Printf("hello: send to %s: %v", instance, err)
 	}
 }
 
-// runResponseListener subscribes to the response channel for command responses.
+// runEstopListener subscribes to emergency stop events.
 // It automatically re-subscribes if the connection drops.
-func runResponseListener(ctx context.Context, rdb *redis.Client, dispatcher *api.ResponseDispatcher, hub *api.Hub) {
-	channel := "responses:" + serverSource.Instance
-
-	for {
-		if ctx.Err() != nil {
+func runEstopListener(ctx context.Context, bus transport.PubSub, verifier *protocol.Verifier, coord *estop.Coordinator, hub *api.Hub) {
+	transport.Listen(ctx, bus, func(msg transport.Message) {
+		parsed, err := protocol.Parse(msg.Data)
+		if err != nil {
+			log.Printf("estop: parse error: %v", err)
 			return
 		}
+		if !verified(verifier, "estop", parsed) {
+			return
+		}
+		if err := coord.HandleMessage(parsed); err != nil {
+			log.Printf("estop: handle error: %v", err)
+		}
+	}, transport.ChannelEmergencyStop)
+}
 
-		sub := rdb.Subscribe(ctx, channel)
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-ch:
-					if !ok {
-						log.Println("response listener: subscription channel closed, reconnecting...")
-						return
-					}
-					parsed, err := protocol.Parse([]byte(msg.Payload))
-					if err != nil {
-						log.Printf("response listener: parse error: %v", err)
-						continue
-					}
-					dispatched := dispatcher.Dispatch(parsed)
-					hub.BroadcastEvent("command_response", parsed.Payload)
-					if !dispatched {
-						log.Printf("response listener: no waiter for correlation_id=%s", parsed.Envelope.CorrelationID)
-					}
-				}
-			}
-		}()
-
-		// Back off before retrying
-		select {
-		case <-ctx.Done():
+// runResponseListener dispatches responses on the controller's response
+// stream to their waiters (API handlers, the poller, script routers) and
+// broadcasts each one to WebSocket clients.
+func runResponseListener(ctx context.Context, bus transport.Streams, verifier *protocol.Verifier, dispatcher *api.ResponseDispatcher, hub *api.Hub) {
+	transport.ListenResponses(ctx, bus, serverSource.Instance, func(msg *protocol.Message) {
+		if !verified(verifier, "response listener", msg) {
 			return
-		case <-time.After(2 * time.Second):
 		}
-	}
+		dispatched := dispatcher.Dispatch(msg)
+		hub.BroadcastEvent("command_response", msg.Payload)
+		if !dispatched {
+			log.Printf("response listener: no waiter for correlation_id=%s", msg.Envelope.CorrelationID)
+		}
+	})
 }
 
 // runHealthChecker periodically checks station health.
@@ -422,89 +643,673 @@ func runHealthChecker(ctx context.Context, reg *registry.Registry, hub *api.Hub,
 	}
 }
 
-// runTestControlListener subscribes to test control events from station UIs.
-// Stations publish to events:test.control when operator presses pause/terminate/abort.
-func runTestControlListener(ctx context.Context, rdb *redis.Client, testMgr *testmanager.TestManager) {
-	for {
-		if ctx.Err() != nil {
+// runTestControlListener subscribes to test control requests from station
+// UIs. Stations publish to events:test.control when the operator presses
+// pause/continue/terminate/abort; each request is validated, applied, and
+// answered with a test.control.response on the station's command stream.
+func runTestControlListener(ctx context.Context, bus transport.Transport, verifier *protocol.Verifier, testMgr *testmanager.TestManager) {
+	sender := transport.NewSender(bus)
+	transport.Listen(ctx, bus, func(msg transport.Message) {
+		parsed, err := protocol.Parse(msg.Data)
+		if err != nil {
+			log.Printf("test.control: parse error: %v", err)
+			return
+		}
+		if !verified(verifier, "test.control", parsed) {
+			return
+		}
+
+		reply := testMgr.HandleControlRequest(parsed)
+		if reply.Error != nil {
+			log.Printf("test.control: %s %q: %s: %s", reply.StationInstance, reply.Action, reply.Error.Code, reply.Error.Message)
+		}
+		if reply.StationInstance == "" {
 			return
 		}
 
-		sub := rdb.Subscribe(ctx, "events:test.control")
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case msg, ok := <-ch:
-					if !ok {
-						log.Println("test.control: subscription channel closed, reconnecting...")
-						return
-					}
-					parsed, err := protocol.Parse([]byte(msg.Payload))
-					if err != nil {
-						log.Printf("test.control: parse error: %v", err)
-						continue
-					}
-
-					var payload struct {
-						StationInstance string `json:"station_instance"`
-						Action          string `json:"action"`
-					}
-					if err := json.Unmarshal(parsed.Payload, &payload); err != nil {
-						log.Printf("test.control: payload error: %v", err)
-						continue
-					}
-
-					employeeID := "station-ui"
-					station := payload.StationInstance
-
-					switch payload.Action {
-					case "pause":
-						if err := testMgr.PauseTest(station, employeeID); err != nil {
-							log.Printf("test.control: pause %s: %v", station, err)
-						}
-					case "continue":
-						if err := testMgr.ResumeTest(station, employeeID); err != nil {
-							log.Printf("test.control: resume %s: %v", station, err)
-						}
-					case "terminate":
-						if err := testMgr.TerminateTest(station, employeeID, "station UI"); err != nil {
-							log.Printf("test.control: terminate %s: %v", station, err)
-						}
-					case "abort":
-						if err := testMgr.AbortTest(station, employeeID); err != nil {
-							log.Printf("test.control: abort %s: %v", station, err)
-						}
-					default:
-						log.Printf("test.control: unknown action %q from %s", payload.Action, station)
-					}
+		resp, err := protocol.BuildTestControlResponse(serverSource, reply.StationInstance, reply.Action, reply.Error)
+		if err != nil {
+			log.Printf("test.control: build response: %v", err)
+			return
+		}
+		if err := sender.SendCommand(ctx, transport.CommandStream(reply.StationInstance), resp); err != nil {
+			log.Printf("test.control: send response to %s: %v", reply.StationInstance, err)
+		}
+	}, transport.ChannelTestControl)
+}
+
+// verified checks a message from a station against its signing keys,
+// logging why it is dropped. Every message passes when verifier is nil.
+func verified(verifier *protocol.Verifier, listener string, msg *protocol.Message) bool {
+	if verifier == nil {
+		return true
+	}
+	if err := verifier.Verify(msg, msg.Envelope.Source.Instance); err != nil {
+		hint := ""
+		if errors.Is(err, protocol.ErrUnsigned) {
+			hint = " (station firmware does not sign; remove firmware stations from the key file)"
+		}
+		log.Printf("%s: dropped %s %s: %v%s", listener, msg.Envelope.Type, msg.Envelope.ID, err, hint)
+		return false
+	}
+	return true
+}
+
+// --- "migrate" subcommand ---
+
+func runMigrateCommand() {
+	migrateFlags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := migrateFlags.String("db", "arturo.db", "SQLite database path")
+	dsn := migrateFlags.String("dsn", "", "database DSN; a postgres:// URL selects PostgreSQL (overrides -db)")
+	to := migrateFlags.Int("to", -1, "target schema version (default: latest for up, required for down)")
+	dryRun := migrateFlags.Bool("dry-run", false, "print the migrations that would run without applying them")
+	migrateFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller migrate [flags] [status|up|down]\n")
+		migrateFlags.PrintDefaults()
+	}
+
+	migrateFlags.Parse(os.Args[2:])
+
+	action := "status"
+	if migrateFlags.NArg() > 0 {
+		action = migrateFlags.Arg(0)
+	}
+
+	if *dsn == "" {
+		*dsn = *dbPath
+	}
+	db, err := store.Open(*dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database at %s: %v\n", redactDSN(*dsn), err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch action {
+	case "status":
+		statuses, err := db.SchemaStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading schema status: %v\n", err)
+			os.Exit(1)
+		}
+		current, _ := db.SchemaVersion()
+		fmt.Printf("%s: schema version %d (latest %d)\n", redactDSN(*dsn), current, store.LatestSchemaVersion())
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied"
+				if st.AppliedAt != nil {
+					state += " " + st.AppliedAt.Local().Format(time.RFC3339)
 				}
 			}
-		}()
+			fmt.Printf("  %3d  %-30s %s\n", st.Version, st.Name, state)
+		}
+		return
+	case "up":
+		if *to < 0 {
+			*to = store.LatestSchemaVersion()
+		}
+	case "down":
+		if *to < 0 {
+			fmt.Fprintf(os.Stderr, "Error: migrate down requires -to\n")
+			os.Exit(1)
+		}
+	default:
+		migrateFlags.Usage()
+		os.Exit(1)
+	}
 
-		select {
-		case <-ctx.Done():
+	if *dryRun {
+		steps, err := db.PlanMigration(*to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error planning migration: %v\n", err)
+			os.Exit(1)
+		}
+		if len(steps) == 0 {
+			fmt.Println("Nothing to do")
 			return
-		case <-time.After(2 * time.Second):
 		}
+		for _, step := range steps {
+			fmt.Printf("-- %d %s (%s)\n%s\n\n", step.Version, step.Name, step.Direction, strings.TrimSpace(step.SQL))
+		}
+		return
+	}
+
+	steps, err := db.MigrateTo(*to)
+	for _, step := range steps {
+		fmt.Printf("%-4s %3d  %s\n", step.Direction, step.Version, step.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to do")
 	}
 }
 
-// redisCommandSender implements api.CommandSender using Redis PUBLISH.
-type redisCommandSender struct {
-	rdb *redis.Client
+// --- "restore" subcommand ---
+
+// runRestoreCommand replaces the database with a backup. The backup is
+// integrity-checked, copied next to the database, and checked again before
+// the swap; the replaced database is kept with a .pre-restore suffix. The
+// controller must be stopped first.
+func runRestoreCommand() {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := restoreFlags.String("db", "arturo.db", "SQLite database path to replace")
+	restoreFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller restore [flags] <backup.db>\n")
+		fmt.Fprintf(os.Stderr, "Stop the controller before restoring.\n")
+		restoreFlags.PrintDefaults()
+	}
+
+	restoreFlags.Parse(os.Args[2:])
+	if restoreFlags.NArg() != 1 {
+		restoreFlags.Usage()
+		os.Exit(1)
+	}
+	src := restoreFlags.Arg(0)
+
+	version, err := store.CheckIntegrity(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: backup rejected: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: integrity ok, schema version %d\n", src, version)
+
+	staged := *dbPath + ".restore"
+	if err := copyFile(src, staged); err != nil {
+		os.Remove(staged)
+		fmt.Fprintf(os.Stderr, "Error staging backup: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := store.CheckIntegrity(staged); err != nil {
+		os.Remove(staged)
+		fmt.Fprintf(os.Stderr, "Error: staged copy rejected: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Move the current database and any journal files aside together.
+	aside := fmt.Sprintf("%s.pre-restore-%s", *dbPath, time.Now().UTC().Format("20060102T150405Z"))
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		if _, err := os.Stat(*dbPath + suffix); err != nil {
+			continue
+		}
+		if err := os.Rename(*dbPath+suffix, aside+suffix); err != nil {
+			os.Remove(staged)
+			fmt.Fprintf(os.Stderr, "Error moving %s aside: %v\n", *dbPath+suffix, err)
+			os.Exit(1)
+		}
+	}
+	if err := os.Rename(staged, *dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error installing restored database: %v (previous database is at %s)\n", err, aside)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored %s from %s (previous database kept at %s)\n", *dbPath, src, aside)
+	if version < store.LatestSchemaVersion() {
+		fmt.Printf("The controller will migrate it from version %d to %d on startup.\n", version, store.LatestSchemaVersion())
+	}
+}
+
+// copyFile copies src to dst and syncs dst to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// redactDSN hides the password in a postgres:// DSN for logging.
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	return u.Redacted()
+}
+
+// --- "user" subcommand ---
+
+// runUserCommand manages employee accounts: their role, badge code, and the
+// PIN or password they log in with. It is how the first admin is created.
+func runUserCommand() {
+	userFlags := flag.NewFlagSet("user", flag.ExitOnError)
+	dbPath := userFlags.String("db", "arturo.db", "SQLite database path")
+	dsn := userFlags.String("dsn", "", "database DSN; a postgres:// URL selects PostgreSQL (overrides -db)")
+	name := userFlags.String("name", "", "employee name (required for a new employee)")
+	role := userFlags.String("role", "", "role: operator, engineer, or admin")
+	badge := userFlags.String("badge", "", "badge code scanned to log in")
+	userFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller user [flags] list\n")
+		fmt.Fprintf(os.Stderr, "       controller user [flags] set <employee-id>   (reads the new PIN or password from stdin)\n")
+		userFlags.PrintDefaults()
+	}
+
+	userFlags.Parse(os.Args[2:])
+	if userFlags.NArg() == 0 {
+		userFlags.Usage()
+		os.Exit(1)
+	}
+
+	if *dsn == "" {
+		*dsn = *dbPath
+	}
+	db, err := store.New(*dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database at %s: %v\n", redactDSN(*dsn), err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch userFlags.Arg(0) {
+	case "list":
+		employees, err := db.ListEmployees()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range employees {
+			login := "no login"
+			if hash, _ := db.GetEmployeeCredential(e.ID); hash != "" {
+				login = "login"
+			}
+			fmt.Printf("%-16s %-10s %-9s %s\n", e.ID, e.Role, login, e.Name)
+		}
+	case "set":
+		if userFlags.NArg() != 2 {
+			userFlags.Usage()
+			os.Exit(1)
+		}
+		if err := setUser(db, userFlags.Arg(1), *name, *role, *badge); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		userFlags.Usage()
+		os.Exit(1)
+	}
 }
 
-func (s *redisCommandSender) SendCommand(ctx context.Context, channel string, msg *protocol.Message) error {
-	msgJSON, err := json.Marshal(msg)
+func setUser(db *store.SQLStore, id, name, role, badge string) error {
+	if role != "" {
+		if _, err := auth.ParseRole(role); err != nil {
+			return err
+		}
+	}
+	emp, err := db.GetEmployee(id)
+	if err != nil {
+		return err
+	}
+	if emp == nil && name == "" {
+		return fmt.Errorf("employee %s does not exist; -name is required to create it", id)
+	}
+
+	fmt.Fprintf(os.Stderr, "New PIN or password for %s (empty to keep): ", id)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	var hash string
+	if secret := strings.TrimRight(line, "\r\n"); secret != "" {
+		if hash, err = auth.HashCredential(secret); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if name != "" {
+		if err := db.UpsertEmployee(id, name); err != nil {
+			return err
+		}
+	}
+	if role != "" {
+		if err := db.SetEmployeeRole(id, role); err != nil {
+			return err
+		}
+	}
+	if hash != "" {
+		if err := db.SetEmployeeCredential(id, hash); err != nil {
+			return err
+		}
+	}
+	if badge != "" {
+		if err := db.SetEmployeeBadgeHash(id, auth.HashBadge(badge)); err != nil {
+			return fmt.Errorf("setting badge: %w", err)
+		}
+	}
+
+	emp, err = db.GetEmployee(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s (%s)\n", emp.ID, emp.Name, emp.Role)
+	return nil
+}
+
+// --- "apikey" subcommand ---
+
+// runAPIKeyCommand manages API keys for scripts and integrations. A key acts
+// as an existing employee, limited to its scopes.
+func runAPIKeyCommand() {
+	keyFlags := flag.NewFlagSet("apikey", flag.ExitOnError)
+	dbPath := keyFlags.String("db", "arturo.db", "SQLite database path")
+	dsn := keyFlags.String("dsn", "", "database DSN; a postgres:// URL selects PostgreSQL (overrides -db)")
+	name := keyFlags.String("name", "", "what the key is for (required to create)")
+	employee := keyFlags.String("employee", "", "employee the key acts as (required to create)")
+	scopes := keyFlags.String("scopes", "read", "comma-separated scopes: read, rmas, tests, commands, scripts, admin")
+	keyFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller apikey [flags] list\n")
+		fmt.Fprintf(os.Stderr, "       controller apikey [flags] create   (prints the key once)\n")
+		fmt.Fprintf(os.Stderr, "       controller apikey [flags] revoke <key-id>\n")
+		keyFlags.PrintDefaults()
+	}
+
+	keyFlags.Parse(os.Args[2:])
+	if keyFlags.NArg() == 0 {
+		keyFlags.Usage()
+		os.Exit(1)
+	}
+
+	if *dsn == "" {
+		*dsn = *dbPath
+	}
+	db, err := store.New(*dsn)
 	if err != nil {
-		return fmt.Errorf("marshal command: %w", err)
+		fmt.Fprintf(os.Stderr, "Error opening database at %s: %v\n", redactDSN(*dsn), err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch keyFlags.Arg(0) {
+	case "list":
+		keys, err := db.ListAPIKeys()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, k := range keys {
+			state := "active"
+			if k.RevokedAt != nil {
+				state = "revoked"
+			}
+			fmt.Printf("%-14s %-8s %-16s %-24s %s\n", k.ID, state, k.EmployeeID, strings.Join(k.Scopes, ","), k.Name)
+		}
+	case "create":
+		if err := createAPIKey(db, *name, *employee, *scopes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "revoke":
+		if keyFlags.NArg() != 2 {
+			keyFlags.Usage()
+			os.Exit(1)
+		}
+		if err := db.RevokeAPIKey(keyFlags.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("revoked %s\n", keyFlags.Arg(1))
+	default:
+		keyFlags.Usage()
+		os.Exit(1)
 	}
-	return s.rdb.Publish(ctx, channel, string(msgJSON)).Err()
+}
+
+func createAPIKey(db *store.SQLStore, name, employeeID, scopeList string) error {
+	if name == "" || employeeID == "" {
+		return fmt.Errorf("-name and -employee are required")
+	}
+	scopes, err := auth.ParseScopes(scopeList)
+	if err != nil {
+		return err
+	}
+	emp, err := db.GetEmployee(employeeID)
+	if err != nil {
+		return err
+	}
+	if emp == nil {
+		return fmt.Errorf("employee %s does not exist; create it with controller user set", employeeID)
+	}
+
+	id, secret, key, err := auth.NewAPIKey()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	if err := db.CreateAPIKey(id, name, employeeID, names, auth.HashAPIKey(secret)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "API key %s for %s (%s); it is not shown again:\n", id, employeeID, strings.Join(names, ","))
+	fmt.Println(key)
+	return nil
+}
+
+// redisOptions returns client options for addr, authenticating as user
+// with the password in passwordFile when user is set.
+func redisOptions(addr, user, passwordFile string) (*redis.Options, error) {
+	opts := &redis.Options{Addr: addr}
+	if user == "" {
+		return opts, nil
+	}
+	if passwordFile == "" {
+		return nil, fmt.Errorf("-redis-user needs -redis-password-file")
+	}
+	password, err := redisacl.ReadPasswordFile(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	opts.Username, opts.Password = user, password
+	return opts, nil
+}
+
+// mqttOptions returns MQTT transport options for broker, authenticating
+// as user with the password in passwordFile when user is set.
+func mqttOptions(broker, user, passwordFile string) (transport.MQTTOptions, error) {
+	opts := transport.MQTTOptions{Broker: broker, ClientID: serverSource.Instance}
+	if user == "" {
+		return opts, nil
+	}
+	if passwordFile == "" {
+		return opts, fmt.Errorf("-mqtt-user needs -mqtt-password-file")
+	}
+	password, err := redisacl.ReadPasswordFile(passwordFile)
+	if err != nil {
+		return opts, err
+	}
+	opts.Username, opts.Password = user, password
+	return opts, nil
+}
+
+// --- "acl" subcommand ---
+
+// runACLCommand maintains the Redis ACL file: the controller and monitor
+// users and one user per station, limited to that station's channels and
+// presence key. New and rotated passwords are printed once, in the .env
+// form station firmware is built with.
+func runACLCommand() {
+	aclFlags := flag.NewFlagSet("acl", flag.ExitOnError)
+	file := aclFlags.String("file", "redis-acl.conf", "ACL file to update (created if missing)")
+	stations := aclFlags.String("stations", "", "comma-separated station instances to add")
+	fromRedis := aclFlags.Bool("from-redis", false, "also add every station with a live presence key in Redis")
+	remove := aclFlags.String("remove", "", "comma-separated users to remove")
+	rotate := aclFlags.String("rotate", "", "comma-separated users (or all) to give a new password; old ones stay valid")
+	retire := aclFlags.String("retire", "", "comma-separated users (or all) whose old passwords are dropped")
+	controllerInstance := aclFlags.String("controller-instance", serverSource.Instance, "controller instance whose responses channel stations reply on")
+	apply := aclFlags.Bool("apply", false, "run ACL LOAD on the Redis server afterwards (its aclfile must be -file)")
+	redisAddr := aclFlags.String("redis", "localhost:6379", "Redis address for -from-redis and -apply")
+	redisUser := aclFlags.String("redis-user", "", "Redis ACL user for -from-redis and -apply")
+	redisPasswordFile := aclFlags.String("redis-password-file", "", "file holding the Redis ACL user's password")
+	aclFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller acl [flags]\n")
+		fmt.Fprintf(os.Stderr, "  Rotation: -rotate station-01, reflash the station, then -retire station-01.\n")
+		aclFlags.PrintDefaults()
+	}
+	aclFlags.Parse(os.Args[2:])
+	if aclFlags.NArg() != 0 {
+		aclFlags.Usage()
+		os.Exit(1)
+	}
+
+	if err := updateACL(*file, *stations, *fromRedis, *remove, *rotate, *retire, *controllerInstance, *apply,
+		*redisAddr, *redisUser, *redisPasswordFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func updateACL(file, stations string, fromRedis bool, remove, rotate, retire, controllerInstance string, apply bool,
+	redisAddr, redisUser, redisPasswordFile string) error {
+	f, err := redisacl.Load(file)
+	if err != nil {
+		return err
+	}
+	plan := redisacl.Plan{
+		ControllerInstance: controllerInstance,
+		Stations:           splitList(stations),
+		Remove:             splitList(remove),
+		Rotate:             splitList(rotate),
+		Retire:             splitList(retire),
+	}
+
+	var rdb *redis.Client
+	if fromRedis || apply {
+		opts, err := redisOptions(redisAddr, redisUser, redisPasswordFile)
+		if err != nil {
+			return err
+		}
+		rdb = redis.NewClient(opts)
+		defer rdb.Close()
+	}
+	ctx := context.Background()
+	if fromRedis {
+		iter := rdb.Scan(ctx, 0, "device:*:alive", 100).Iterator()
+		for iter.Next(ctx) {
+			instance := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), "device:"), ":alive")
+			plan.Stations = append(plan.Stations, instance)
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("listing stations in Redis at %s: %w", redisAddr, err)
+		}
+	}
+
+	created, err := f.Apply(plan)
+	if err != nil {
+		return err
+	}
+	if err := f.Save(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s (%d users)\n", file, len(f.Users))
+
+	names := make([]string, 0, len(created))
+	for name := range created {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("# %s\nREDIS_USERNAME=%s\nREDIS_PASSWORD=%s\n\n", name, name, created[name])
+	}
+	if len(names) > 0 {
+		fmt.Fprintln(os.Stderr, "New passwords are shown once; put them in each station's .env and the controller's -redis-password-file.")
+	}
+
+	if apply {
+		if err := rdb.Do(ctx, "ACL", "LOAD").Err(); err != nil {
+			return fmt.Errorf("ACL LOAD on %s: %w", redisAddr, err)
+		}
+		fmt.Fprintf(os.Stderr, "Reloaded ACLs on %s\n", redisAddr)
+	}
+	return nil
+}
+
+// --- "keys" subcommand ---
+
+// runKeysCommand maintains the envelope signing key file: one or more keys
+// per station. Signing stations are Go processes, such as console mock
+// stations, that load the same file; station firmware does not sign, so
+// firmware stations must stay out of it.
+func runKeysCommand() {
+	keysFlags := flag.NewFlagSet("keys", flag.ExitOnError)
+	file := keysFlags.String("file", "signing-keys.conf", "key file to update (created if missing)")
+	stations := keysFlags.String("stations", "", "comma-separated station instances to add")
+	remove := keysFlags.String("remove", "", "comma-separated stations to remove")
+	rotate := keysFlags.String("rotate", "", "comma-separated stations (or all) to give a new key; old ones stay valid")
+	retire := keysFlags.String("retire", "", "comma-separated stations (or all) whose old keys are dropped")
+	keysFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: controller keys [flags]\n")
+		fmt.Fprintf(os.Stderr, "  Only list stations run by Go processes that load this file (console -signing-keys);\n")
+		fmt.Fprintf(os.Stderr, "  station firmware does not sign, and the controller drops unsigned messages from listed stations.\n")
+		fmt.Fprintf(os.Stderr, "  Rotation: -rotate station-01, restart the controller and the station's process with the new file, then -retire station-01.\n")
+		keysFlags.PrintDefaults()
+	}
+	keysFlags.Parse(os.Args[2:])
+	if keysFlags.NArg() != 0 {
+		keysFlags.Usage()
+		os.Exit(1)
+	}
+
+	if err := updateKeys(*file, *stations, *remove, *rotate, *retire); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func updateKeys(file, stations, remove, rotate, retire string) error {
+	f, err := signkeys.Load(file)
+	if err != nil {
+		return err
+	}
+	created, err := f.Apply(signkeys.Plan{
+		Stations: splitList(stations),
+		Remove:   splitList(remove),
+		Rotate:   splitList(rotate),
+		Retire:   splitList(retire),
+	})
+	if err != nil {
+		return err
+	}
+	if err := f.Save(file); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s (%d stations)\n", file, len(f.Stations))
+
+	names := make([]string, 0, len(created))
+	for name := range created {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		fmt.Fprintf(os.Stderr, "New keys for %s; restart the controller and the processes running those stations with -signing-keys %s.\n", strings.Join(names, ", "), file)
+	}
+	return nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
 }
 
 // --- Legacy "send" subcommand ---
@@ -516,6 +1321,8 @@ func runSendCommand() {
 	cmd := sendFlags.String("cmd", "", "command string (required)")
 	timeout := sendFlags.Int("timeout", 5000, "timeout in milliseconds")
 	redisAddr := sendFlags.String("redis", "localhost:6379", "Redis address")
+	redisUser := sendFlags.String("redis-user", "", "Redis ACL user (empty = no AUTH)")
+	redisPasswordFile := sendFlags.String("redis-password-file", "", "file holding the Redis ACL user's password")
 
 	sendFlags.Parse(os.Args[2:])
 
@@ -537,15 +1344,12 @@ func runSendCommand() {
 		os.Exit(1)
 	}
 
-	msgJSON, err := json.Marshal(msg)
+	redisOpts, err := redisOptions(*redisAddr, *redisUser, *redisPasswordFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling message: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-
-	rdb := redis.NewClient(&redis.Options{
-		Addr: *redisAddr,
-	})
+	rdb := redis.NewClient(redisOpts)
 	defer rdb.Close()
 
 	ctx := context.Background()
@@ -555,22 +1359,14 @@ func runSendCommand() {
 		os.Exit(1)
 	}
 
-	cmdChannel := "commands:" + *station
-	if err := rdb.Publish(ctx, cmdChannel, string(msgJSON)).Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error sending command to %s: %v\n", cmdChannel, err)
-		os.Exit(1)
-	}
-
-	fmt.Printf("Sent command to %s\n", cmdChannel)
+	cmdStream := streams.CommandStream(*station)
+	fmt.Printf("Sending command to %s\n", cmdStream)
 	fmt.Printf("  device:         %s\n", *device)
 	fmt.Printf("  command:        %s\n", *cmd)
 	fmt.Printf("  correlation_id: %s\n", msg.Envelope.CorrelationID)
 	fmt.Printf("  timeout:        %dms\n", *timeout)
 
-	responseStream := msg.Envelope.ReplyTo
-	timeoutDur := time.Duration(*timeout) * time.Millisecond
-
-	resp, err := waitForResponse(ctx, rdb, responseStream, msg.Envelope.CorrelationID, timeoutDur)
+	resp, err := streams.Request(ctx, rdb, cmdStream, msg, time.Duration(*timeout)*time.Millisecond)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
 		os.Exit(1)
@@ -601,32 +1397,3 @@ func runSendCommand() {
 		os.Exit(1)
 	}
 }
-
-func waitForResponse(ctx context.Context, rdb *redis.Client, channel, correlationID string, timeout time.Duration) (*protocol.Message, error) {
-	sub := rdb.Subscribe(ctx, channel)
-	defer sub.Close()
-
-	ch := sub.Channel()
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	for {
-		select {
-		case msg, ok := <-ch:
-			if !ok {
-				return nil, fmt.Errorf("subscription channel closed")
-			}
-			parsed, err := protocol.Parse([]byte(msg.Payload))
-			if err != nil {
-				continue
-			}
-			if parsed.Envelope.CorrelationID == correlationID {
-				return parsed, nil
-			}
-		case <-timer.C:
-			return nil, fmt.Errorf("timeout waiting for response (correlation_id=%s)", correlationID)
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		}
-	}
-}
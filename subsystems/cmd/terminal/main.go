@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"log"
 	"net/http"
@@ -10,18 +11,49 @@ import (
 	"time"
 
 	"github.com/holla2040/arturo/internal/terminal"
+	"github.com/holla2040/arturo/internal/tlscert"
 )
 
 func main() {
 	listenAddr := flag.String("listen", ":8000", "HTTP listen address")
 	controllerURL := flag.String("controller", "http://localhost:8002", "Controller URL to proxy to")
 	devMode := flag.Bool("dev", false, "serve static files from disk with live reload")
+	controllerCA := flag.String("controller-ca", "", "PEM certificate to trust for an https:// controller, e.g. its self-signed tls.crt")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file; with -tls-key serves HTTPS to browsers")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "Generate a self-signed certificate for -tls-cert/-tls-key if they do not exist")
 	flag.Parse()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	handler := terminal.Handler(*controllerURL, *devMode)
+	var transport http.RoundTripper
+	if *controllerCA != "" {
+		pool, err := tlscert.LoadCertPool(*controllerCA)
+		if err != nil {
+			log.Fatalf("Failed to load controller CA: %v", err)
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+		transport = t
+	}
+
+	handler := terminal.Handler(*controllerURL, *devMode, transport)
+
+	if *tlsSelfSigned {
+		if *tlsCert == "" {
+			*tlsCert = "terminal.crt"
+		}
+		if *tlsKey == "" {
+			*tlsKey = "terminal.key"
+		}
+		if _, err := tlscert.LoadOrCreate(*tlsCert, *tlsKey, tlscert.LocalHosts()); err != nil {
+			log.Fatalf("Failed to set up TLS certificate: %v", err)
+		}
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be given together")
+	}
 
 	server := &http.Server{
 		Addr:    *listenAddr,
@@ -34,8 +66,15 @@ func main() {
 	}
 
 	go func() {
-		log.Printf("terminal listening on %s (controller: %s, mode: %s)", *listenAddr, *controllerURL, mode)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if *tlsCert != "" {
+			log.Printf("terminal listening on %s with TLS (controller: %s, mode: %s)", *listenAddr, *controllerURL, mode)
+			err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			log.Printf("terminal listening on %s (controller: %s, mode: %s)", *listenAddr, *controllerURL, mode)
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
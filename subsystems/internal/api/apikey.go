@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/store"
+)
+
+// routeScopes maps each route that identifies its caller to the API key
+// scope that grants it. Routes not listed here, such as signing test runs,
+// need a person and refuse API keys.
+var routeScopes = map[string]auth.Scope{
+	"GET /auth/session": auth.ScopeRead,
+	"GET /ws":           auth.ScopeRead,
+
+	"GET /devices":                       auth.ScopeRead,
+	"GET /devices/{id}":                  auth.ScopeRead,
+	"GET /stations":                      auth.ScopeRead,
+	"GET /stations/{id}/state":           auth.ScopeRead,
+	"GET /stations/{id}/temperatures":    auth.ScopeRead,
+	"GET /stations/{id}/regen-curve.csv": auth.ScopeRead,
+	"GET /test-runs":                     auth.ScopeRead,
+	"GET /test-runs/{id}/temperatures":   auth.ScopeRead,
+	"GET /test-runs/{id}/events":         auth.ScopeRead,
+	"GET /test-runs/{id}/review":         auth.ScopeRead,
+	"GET /search":                        auth.ScopeRead,
+	"GET /reports/{id}/csv":              auth.ScopeRead,
+	"GET /reports/{id}/json":             auth.ScopeRead,
+	"GET /reports/{id}/pdf":              auth.ScopeRead,
+	"GET /rmas":                          auth.ScopeRead,
+	"GET /rmas/search":                   auth.ScopeRead,
+	"GET /rmas/{id}":                     auth.ScopeRead,
+	"GET /rmas/{id}/artifact":            auth.ScopeRead,
+	"GET /rmas/{id}/pdf":                 auth.ScopeRead,
+	"GET /rmas/{rmaId}/runs/{runId}/csv": auth.ScopeRead,
+	"GET /scripts":                       auth.ScopeRead,
+	"GET /scripts/versions":              auth.ScopeRead,
+	"GET /scripts/{id}":                  auth.ScopeRead,
+
+	"POST /scan":            auth.ScopeRMAs,
+	"POST /rmas":            auth.ScopeRMAs,
+	"POST /rmas/{id}/close": auth.ScopeRMAs,
+
+	"POST /stations/{id}/test/start":     auth.ScopeTests,
+	"POST /stations/{id}/test/pause":     auth.ScopeTests,
+	"POST /stations/{id}/test/resume":    auth.ScopeTests,
+	"POST /stations/{id}/test/terminate": auth.ScopeTests,
+	"POST /stations/{id}/test/abort":     auth.ScopeTests,
+
+	"POST /devices/{id}/command":  auth.ScopeCommands,
+	"POST /stations/{id}/command": auth.ScopeCommands,
+	"POST /stations/{id}/batch":   auth.ScopeCommands,
+	"POST /ota":                   auth.ScopeCommands,
+
+	"POST /scripts":              auth.ScopeScripts,
+	"POST /scripts/{id}/approve": auth.ScopeScripts,
+
+	"GET /admin/backups":          auth.ScopeAdmin,
+	"POST /admin/backups":         auth.ScopeAdmin,
+	"GET /admin/backups/{name}":   auth.ScopeAdmin,
+	"GET /admin/employees":        auth.ScopeAdmin,
+	"PUT /admin/employees/{id}":   auth.ScopeAdmin,
+	"GET /admin/login-failures":   auth.ScopeAdmin,
+	"GET /admin/audit":            auth.ScopeAdmin,
+	"GET /admin/audit/export":     auth.ScopeAdmin,
+	"GET /admin/audit/verify":     auth.ScopeAdmin,
+	"GET /admin/api-keys":         auth.ScopeAdmin,
+	"POST /admin/api-keys":        auth.ScopeAdmin,
+	"DELETE /admin/api-keys/{id}": auth.ScopeAdmin,
+}
+
+// checkAPIKey validates an API key and that one of its scopes grants the
+// request's route. On failure it returns a nil key and the status and
+// message to send.
+func (h *Handler) checkAPIKey(r *http.Request, token string) (*store.APIKey, int, string) {
+	id, secret, ok := auth.SplitAPIKey(token)
+	if !ok {
+		return nil, http.StatusUnauthorized, "invalid API key"
+	}
+	key, err := h.Store.GetAPIKey(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "failed to get API key"
+	}
+	hash, err := h.Store.GetAPIKeySecretHash(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "failed to get API key"
+	}
+	if key == nil || key.RevokedAt != nil || !auth.CheckAPIKey(hash, secret) {
+		addr := remoteHost(r)
+		log.Printf("auth: rejected API key %q from %s", id, addr)
+		if err := h.Store.RecordLoginFailure("", addr, "bad API key "+id); err != nil {
+			log.Printf("auth: failed to record login failure: %v", err)
+		}
+		return nil, http.StatusUnauthorized, "invalid API key"
+	}
+
+	scope, ok := routeScopes[r.Pattern]
+	if !ok {
+		return nil, http.StatusForbidden, "not available to API keys"
+	}
+	if !auth.HasScope(apiKeyScopes(key), scope) {
+		return nil, http.StatusForbidden, "API key lacks the " + string(scope) + " scope"
+	}
+	if err := h.Store.TouchAPIKey(id); err != nil {
+		log.Printf("auth: failed to record API key use: %v", err)
+	}
+	return key, 0, ""
+}
+
+func apiKeyScopes(key *store.APIKey) []auth.Scope {
+	scopes := make([]auth.Scope, len(key.Scopes))
+	for i, s := range key.Scopes {
+		scopes[i] = auth.Scope(s)
+	}
+	return scopes
+}
+
+// AuthenticateWebSocket checks a WebSocket upgrade request. Browsers cannot
+// set headers on WebSocket connections, so the session token or API key
+// may also be passed as the "token" query parameter. With authentication
+// disabled every connection is accepted.
+func (h *Handler) AuthenticateWebSocket(r *http.Request) error {
+	if h.Auth == nil {
+		return nil
+	}
+	if emp, _, msg := h.identify(r, requestToken(r)); emp == nil {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// apiKeyRequest is the JSON body for POST /admin/api-keys. Scopes is a
+// comma-separated list.
+type apiKeyRequest struct {
+	Name       string `json:"name"`
+	EmployeeID string `json:"employee_id"`
+	Scopes     string `json:"scopes"`
+}
+
+// apiKeyResponse is the response for POST /admin/api-keys. Key is only
+// ever shown here.
+type apiKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey *store.APIKey `json:"api_key"`
+}
+
+func (h *Handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	keys, err := h.Store.ListAPIKeys()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list API keys"})
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// createAPIKey issues an API key acting as an existing employee, usually a
+// service account created for the integration.
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.EmployeeID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name and employee_id are required"})
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	emp, err := h.Store.GetEmployee(req.EmployeeID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	if emp == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "employee " + req.EmployeeID + " does not exist"})
+		return
+	}
+
+	id, secret, key, err := auth.NewAPIKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to generate API key"})
+		return
+	}
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = string(s)
+	}
+	if err := h.Store.CreateAPIKey(id, req.Name, req.EmployeeID, names, auth.HashAPIKey(secret)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to store API key"})
+		return
+	}
+	created, err := h.Store.GetAPIKey(id)
+	if err != nil || created == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get API key"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiKeyResponse{Key: key, APIKey: created})
+}
+
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	id := r.PathValue("id")
+	if err := h.Store.RevokeAPIKey(id); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "API key not found"})
+		return
+	}
+	key, err := h.Store.GetAPIKey(id)
+	if err != nil || key == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get API key"})
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
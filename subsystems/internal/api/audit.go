@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/scan"
+	"github.com/holla2040/arturo/internal/store"
+)
+
+// maxAuditBody is the largest JSON request body copied into the audit log.
+// Larger or non-JSON bodies are recorded by size only.
+const maxAuditBody = 64 << 10
+
+// redactedParams are body fields never written to the audit log: anything
+// that is, or could be, a credential. The log is append-only, so a leaked
+// credential could never be removed. Matched case-insensitively.
+var redactedParams = map[string]bool{
+	"password":   true,
+	"pin":        true,
+	"badge":      true,
+	"credential": true,
+	"secret":     true,
+	"token":      true,
+	"key":        true,
+	"api_key":    true,
+}
+
+// auditKey is the context key for the *auditRecord of an audited request.
+type auditKey struct{}
+
+// auditRecord carries what a handler learns about the caller back to the
+// audit middleware.
+type auditRecord struct {
+	employeeID string
+}
+
+// setAuditEmployee records who an audited request was made by, once the
+// handler has authenticated them.
+func setAuditEmployee(r *http.Request, employeeID string) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		rec.employeeID = employeeID
+	}
+}
+
+// auditWriter captures the status and, for failures, the error message of
+// a response.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (aw *auditWriter) WriteHeader(status int) {
+	aw.status = status
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *auditWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	if aw.status >= 400 && aw.body.Len() < 1024 {
+		aw.body.Write(b)
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// result returns the error message of a failed response.
+func (aw *auditWriter) result() string {
+	if aw.status < 400 {
+		return ""
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(aw.body.Bytes(), &body) == nil && body.Error != "" {
+		return body.Error
+	}
+	return http.StatusText(aw.status)
+}
+
+// audited wraps a handler that changes state so every call, allowed or
+// not, is appended to the audit log.
+func (h *Handler) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &auditRecord{}
+		if h.Auth == nil {
+			rec.employeeID = getEmployeeID(r)
+		}
+		params := h.auditParams(r)
+
+		aw := &auditWriter{ResponseWriter: w}
+		next(aw, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+
+		entry := store.AuditEntry{
+			EmployeeID: rec.employeeID,
+			RemoteAddr: remoteHost(r),
+			Method:     r.Method,
+			Endpoint:   r.Pattern,
+			Path:       r.URL.Path,
+			Params:     params,
+			Status:     aw.status,
+			Result:     aw.result(),
+		}
+		if err := h.Store.AppendAudit(&entry); err != nil {
+			log.Printf("audit: failed to record %s by %q: %v", r.URL.Path, rec.employeeID, err)
+		}
+	}
+}
+
+// auditParams returns the request's query and body parameters as a JSON
+// object, leaving the body for the handler to read.
+func (h *Handler) auditParams(r *http.Request) string {
+	params := map[string]any{}
+	if q := r.URL.Query(); len(q) > 0 {
+		query := map[string]string{}
+		for k := range q {
+			query[k] = q.Get(k)
+		}
+		params["query"] = query
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case r.Body == nil || r.Body == http.NoBody:
+	case mediaType == "application/json" || mediaType == "":
+		buf, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buf), r.Body))
+		var body map[string]any
+		if err != nil || len(buf) > maxAuditBody || json.Unmarshal(buf, &body) != nil {
+			params["body_bytes"] = r.ContentLength
+			break
+		}
+		for k := range body {
+			if redactedParams[strings.ToLower(k)] {
+				body[k] = "[redacted]"
+			}
+		}
+		// A scanned badge is a credential like a password.
+		if p, ok := body["payload"].(string); ok && h.Scanner != nil && h.Scanner.Parse(p).Kind == scan.KindBadge {
+			body["payload"] = "[redacted]"
+		}
+		if len(body) > 0 {
+			params["body"] = body
+		}
+	default:
+		params["content_type"] = mediaType
+		params["body_bytes"] = r.ContentLength
+	}
+
+	data, _ := json.Marshal(params)
+	return string(data)
+}
+
+// parseAuditFilter reads the filters shared by the audit log endpoints.
+func parseAuditFilter(w http.ResponseWriter, r *http.Request) (store.AuditFilter, bool) {
+	page, since, ok := parseListPage(w, r)
+	if !ok {
+		return store.AuditFilter{}, false
+	}
+	params := r.URL.Query()
+	f := store.AuditFilter{
+		Page:       page,
+		EmployeeID: params.Get("employee"),
+		Endpoint:   params.Get("endpoint"),
+		Since:      since,
+	}
+	if v := params.Get("until"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid until: use RFC 3339 or YYYY-MM-DD"})
+			return f, false
+		}
+		f.Until = &t
+	}
+	return f, true
+}
+
+// listAuditLog returns audit entries oldest first.
+func (h *Handler) listAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	f, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+	entries, next, err := h.Store.QueryAuditLog(f)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query audit log"})
+		return
+	}
+	writeList(w, r, entries, next)
+}
+
+// exportAuditLog downloads audit entries as CSV (the default) or JSON for
+// quality audits. The hashes are included so the export can be checked
+// against the chain.
+func (h *Handler) exportAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	f, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" && format != "json" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv or json"})
+		return
+	}
+	entries, _, err := h.Store.QueryAuditLog(f)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query audit log"})
+		return
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102T150405Z")
+	if format == "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "timestamp", "employee_id", "remote_addr", "method", "endpoint", "path", "params", "status", "result", "prev_hash", "hash"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(e.ID, 10), e.Timestamp.Format(time.RFC3339Nano), e.EmployeeID, e.RemoteAddr,
+			e.Method, e.Endpoint, e.Path, e.Params, strconv.Itoa(e.Status), e.Result, e.PrevHash, e.Hash,
+		})
+	}
+	cw.Flush()
+}
+
+// auditVerifyResponse is the response for GET /admin/audit/verify.
+type auditVerifyResponse struct {
+	OK       bool   `json:"ok"`
+	Entries  int    `json:"entries"`
+	BrokenID int64  `json:"broken_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// verifyAuditLog checks the audit log's hash chain end to end.
+func (h *Handler) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	n, err := h.Store.VerifyAuditLog()
+	var chainErr *store.AuditChainError
+	switch {
+	case errors.As(err, &chainErr):
+		writeJSON(w, http.StatusOK, auditVerifyResponse{Entries: n, BrokenID: chainErr.ID, Error: chainErr.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to verify audit log"})
+	default:
+		writeJSON(w, http.StatusOK, auditVerifyResponse{OK: true, Entries: n})
+	}
+}
@@ -2,87 +2,373 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/holla2040/arturo/internal/auth"
 	"github.com/holla2040/arturo/internal/store"
 )
 
-// loginRequest is the JSON body for POST /auth/login.
+// loginRequest is the JSON body for POST /auth/login. Name is only used
+// when authentication is disabled, to name a new employee.
 type loginRequest struct {
 	EmployeeID string `json:"employee_id"`
+	Password   string `json:"password"`
 	Name       string `json:"name"`
 }
 
-// handleLogin upserts an employee and returns their info.
+// loginResponse is the response for POST /auth/login.
+type loginResponse struct {
+	Token     string          `json:"token,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Employee  *store.Employee `json:"employee"`
+}
+
+// handleLogin checks an employee's PIN or password and returns a session
+// token to send as "Authorization: Bearer <token>". Failed attempts are
+// recorded in login_failures. With authentication disabled it upserts the
+// employee, as before, and returns no token.
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 		return
 	}
-	if req.EmployeeID == "" || req.Name == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "employee_id and name are required"})
+
+	if h.Auth == nil {
+		h.legacyLogin(w, r, req)
 		return
 	}
 
-	if err := h.Store.UpsertEmployee(req.EmployeeID, req.Name); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create employee"})
+	if req.EmployeeID == "" || req.Password == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "employee_id and password are required"})
 		return
 	}
 
 	emp, err := h.Store.GetEmployee(req.EmployeeID)
-	if err != nil || emp == nil {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	hash, err := h.Store.GetEmployeeCredential(req.EmployeeID)
+	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, emp)
+	if !auth.CheckCredential(hash, req.Password) {
+		reason := "bad credential"
+		if emp == nil {
+			reason = "unknown employee"
+		} else if hash == "" {
+			reason = "no credential"
+		}
+		addr := remoteHost(r)
+		log.Printf("auth: failed login for %q from %s: %s", req.EmployeeID, addr, reason)
+		if err := h.Store.RecordLoginFailure(req.EmployeeID, addr, reason); err != nil {
+			log.Printf("auth: failed to record login failure: %v", err)
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid employee ID or password"})
+		return
+	}
+
+	setAuditEmployee(r, emp.ID)
+	token, exp := h.Auth.Issue(emp.ID)
+	writeJSON(w, http.StatusOK, loginResponse{Token: token, ExpiresAt: &exp, Employee: emp})
 }
 
-// handleSession returns info about the current session based on X-Employee-ID header.
-func (h *Handler) handleSession(w http.ResponseWriter, r *http.Request) {
-	employeeID := r.Header.Get("X-Employee-ID")
-	if employeeID == "" {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "X-Employee-ID header required"})
+// legacyLogin accepts any employee ID when authentication is disabled,
+// creating the employee if needed. Name defaults to the existing name, or
+// the ID for a new employee.
+func (h *Handler) legacyLogin(w http.ResponseWriter, r *http.Request, req loginRequest) {
+	if req.EmployeeID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "employee_id is required"})
 		return
 	}
 
-	emp, err := h.Store.GetEmployee(employeeID)
+	emp, err := h.Store.GetEmployee(req.EmployeeID)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
 		return
 	}
-	if emp == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "employee not found"})
+	if req.Name == "" && emp != nil {
+		req.Name = emp.Name
+	} else if req.Name == "" {
+		req.Name = req.EmployeeID
+	}
+	if err := h.Store.UpsertEmployee(req.EmployeeID, req.Name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create employee"})
 		return
 	}
 
+	emp, err = h.Store.GetEmployee(req.EmployeeID)
+	if err != nil || emp == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+
+	setAuditEmployee(r, emp.ID)
+	writeJSON(w, http.StatusOK, loginResponse{Employee: emp})
+}
+
+// handleSession returns the employee the request is authenticated as.
+func (h *Handler) handleSession(w http.ResponseWriter, r *http.Request) {
+	emp, ok := requireEmployee(h, w, r)
+	if !ok {
+		return
+	}
 	writeJSON(w, http.StatusOK, emp)
 }
 
 // getEmployeeID extracts the employee ID from the X-Employee-ID header.
-// Returns empty string if not set.
+// Returns empty string if not set. It is only trusted when authentication
+// is disabled.
 func getEmployeeID(r *http.Request) string {
 	return r.Header.Get("X-Employee-ID")
 }
 
-// requireEmployee is a middleware helper that checks for X-Employee-ID header.
+// bearerToken extracts the session token from the Authorization header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requireEmployee identifies the caller, who must be at least an operator.
 func requireEmployee(h *Handler, w http.ResponseWriter, r *http.Request) (*store.Employee, bool) {
-	employeeID := getEmployeeID(r)
-	if employeeID == "" {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "X-Employee-ID header required"})
+	return requireRole(h, w, r, auth.RoleOperator)
+}
+
+// requireRole identifies the caller from their session token or API key and
+// checks they hold at least role. With authentication disabled the
+// X-Employee-ID header identifies the caller and roles are not checked.
+func requireRole(h *Handler, w http.ResponseWriter, r *http.Request, role auth.Role) (*store.Employee, bool) {
+	emp, status, msg := h.identify(r, bearerToken(r))
+	if emp == nil {
+		writeJSON(w, status, map[string]string{"error": msg})
 		return nil, false
 	}
+	if h.Auth != nil && !auth.Role(emp.Role).Allows(role) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": string(role) + " role required"})
+		return nil, false
+	}
+	setAuditEmployee(r, emp.ID)
+	return emp, true
+}
+
+// identify resolves the caller from token, a session token or API key, or
+// from the X-Employee-ID header when authentication is disabled. On
+// failure it returns a nil employee and the status and message to send.
+func (h *Handler) identify(r *http.Request, token string) (*store.Employee, int, string) {
+	employeeID := getEmployeeID(r)
+	var claims auth.Claims
+	switch {
+	case h.Auth != nil && auth.IsAPIKey(token):
+		key, status, msg := h.checkAPIKey(r, token)
+		if key == nil {
+			return nil, status, msg
+		}
+		employeeID = key.EmployeeID
+	case h.Auth != nil:
+		var err error
+		claims, err = h.Auth.Verify(token)
+		if err != nil {
+			msg := "authentication required"
+			if errors.Is(err, auth.ErrExpiredToken) {
+				msg = "session expired"
+			}
+			return nil, http.StatusUnauthorized, msg
+		}
+		employeeID = claims.EmployeeID
+	case employeeID == "":
+		return nil, http.StatusUnauthorized, "X-Employee-ID header required"
+	}
 
 	emp, err := h.Store.GetEmployee(employeeID)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
-		return nil, false
+		return nil, http.StatusInternalServerError, "failed to get employee"
 	}
 	if emp == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "employee not found"})
-		return nil, false
+		if h.Auth != nil {
+			return nil, http.StatusUnauthorized, "employee no longer exists"
+		}
+		return nil, http.StatusNotFound, "employee not found"
+	}
+	// A badge session holds at most the role its token was capped at.
+	emp.Role = string(auth.Role(emp.Role).Cap(claims.MaxRole))
+	return emp, 0, ""
+}
+
+// authorize is requireRole for endpoints that were open before
+// authentication existed: with authentication disabled it lets every
+// request through.
+func authorize(h *Handler, w http.ResponseWriter, r *http.Request, role auth.Role) bool {
+	if h.Auth == nil {
+		return true
 	}
+	_, ok := requireRole(h, w, r, role)
+	return ok
+}
 
-	return emp, true
+// authenticated wraps a handler that reads data so that, with
+// authentication enabled, only signed-in employees and API keys with the
+// read scope reach it. Downloads opened in a new browser tab cannot set
+// headers, so the token may also be passed as the "token" query parameter.
+func (h *Handler) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.Auth != nil {
+			emp, status, msg := h.identify(r, requestToken(r))
+			if emp == nil {
+				writeJSON(w, status, map[string]string{"error": msg})
+				return
+			}
+			if !auth.Role(emp.Role).Allows(auth.RoleOperator) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": string(auth.RoleOperator) + " role required"})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// requestToken returns the bearer token, or failing that the "token" query
+// parameter.
+func requestToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// remoteHost returns the client address without its port. Requests through
+// the terminal's proxy also carry the X-Forwarded-For chain it added.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		host += " (forwarded for " + fwd + ")"
+	}
+	return host
+}
+
+// ---------------------------------------------------------------------------
+// Employee administration
+// ---------------------------------------------------------------------------
+
+// employeeRequest is the JSON body for PUT /admin/employees/{id}. Empty
+// fields are left unchanged; a new employee needs a name.
+type employeeRequest struct {
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Password string `json:"password"`
+	Badge    string `json:"badge"`
+}
+
+func (h *Handler) listEmployees(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	employees, err := h.Store.ListEmployees()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list employees"})
+		return
+	}
+	writeJSON(w, http.StatusOK, employees)
+}
+
+// putEmployee creates or updates an employee's name, role, credential, and
+// badge code.
+func (h *Handler) putEmployee(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	id := r.PathValue("id")
+
+	var req employeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.Role != "" {
+		if _, err := auth.ParseRole(req.Role); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	var hash string
+	if req.Password != "" {
+		var err error
+		if hash, err = auth.HashCredential(req.Password); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	emp, err := h.Store.GetEmployee(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	if emp == nil && req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required for a new employee"})
+		return
+	}
+
+	if req.Name != "" {
+		err = h.Store.UpsertEmployee(id, req.Name)
+	}
+	if err == nil && req.Role != "" {
+		err = h.Store.SetEmployeeRole(id, req.Role)
+	}
+	if err == nil && hash != "" {
+		err = h.Store.SetEmployeeCredential(id, hash)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update employee"})
+		return
+	}
+	if req.Badge != "" {
+		if err := h.Store.SetEmployeeBadgeHash(id, auth.HashBadge(req.Badge)); err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "badge code already assigned"})
+			return
+		}
+	}
+
+	emp, err = h.Store.GetEmployee(id)
+	if err != nil || emp == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	writeJSON(w, http.StatusOK, emp)
+}
+
+// listLoginFailures returns failed logins, newest first. since defaults to
+// the last 7 days.
+func (h *Handler) listLoginFailures(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	since := time.Now().Add(-7 * 24 * time.Hour)
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since: use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		since = t
+	}
+	failures, err := h.Store.QueryLoginFailures(since)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query login failures"})
+		return
+	}
+	writeJSON(w, http.StatusOK, failures)
 }
@@ -3,24 +3,35 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/holla2040/arturo/internal/artifact"
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/backup"
 	"github.com/holla2040/arturo/internal/estop"
+	"github.com/holla2040/arturo/internal/poller"
 	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/redishealth"
 	"github.com/holla2040/arturo/internal/registry"
 	"github.com/holla2040/arturo/internal/report"
+	"github.com/holla2040/arturo/internal/retention"
+	"github.com/holla2040/arturo/internal/scan"
+	"github.com/holla2040/arturo/internal/scheduler"
 	"github.com/holla2040/arturo/internal/store"
 	"github.com/holla2040/arturo/internal/testmanager"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 // CommandSender abstracts the Redis PUBLISH operation for testability.
@@ -46,6 +57,20 @@ type stationCommandRequest struct {
 	Raw        bool              `json:"raw,omitempty"`
 }
 
+// batchRequest is the JSON body for POST /stations/{id}/batch.
+type batchRequest struct {
+	Commands  []batchCommandRequest `json:"commands"`
+	TimeoutMs int                   `json:"timeout_ms,omitempty"`
+}
+
+// batchCommandRequest is one command in a batchRequest.
+type batchCommandRequest struct {
+	DeviceID   string            `json:"device_id"`
+	Command    string            `json:"command"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	TimeoutMs  int               `json:"timeout_ms,omitempty"`
+}
+
 // otaRequest is the JSON body for POST /ota.
 type otaRequest struct {
 	Station     string `json:"station"`
@@ -61,78 +86,143 @@ type RedisHealthChecker interface {
 	GetStatus() redishealth.Status
 }
 
+// RetentionReporter provides telemetry retention job metrics.
+type RetentionReporter interface {
+	Stats() retention.Stats
+}
+
+// CommandQueueReporter provides the per-station command queues.
+type CommandQueueReporter interface {
+	Status() []scheduler.QueueStatus
+}
+
+// PollerReporter provides the station poller's per-station metrics.
+type PollerReporter interface {
+	Stats() []poller.StationStats
+}
+
+// BackupManager creates, lists, and serves database backups.
+type BackupManager interface {
+	BackupNow() (backup.Info, error)
+	List() ([]backup.Info, error)
+	Open(name string) (*os.File, backup.Info, error)
+}
+
 // systemStatus is the response for GET /system/status.
 type systemStatus struct {
-	StationCount int                `json:"station_count"`
-	DeviceCount  int                `json:"device_count"`
-	EstopState   estop.State        `json:"estop_state"`
-	RedisHealth  *redishealth.Status `json:"redis_health,omitempty"`
+	StationCount  int                          `json:"station_count"`
+	DeviceCount   int                          `json:"device_count"`
+	EstopState    estop.State                  `json:"estop_state"`
+	RedisHealth   *redishealth.Status          `json:"redis_health,omitempty"`
+	Retention     *retention.Stats             `json:"retention,omitempty"`
+	Resources     []testmanager.ResourceStatus `json:"resources,omitempty"`
+	CommandQueues []scheduler.QueueStatus      `json:"command_queues,omitempty"`
 }
 
 // Handler holds all dependencies for HTTP request handling.
 type Handler struct {
 	Registry    *registry.Registry
-	Store       *store.Store
+	Store       store.Store
 	Estop       *estop.Coordinator
 	Dispatcher  *ResponseDispatcher
 	Sender      CommandSender
 	Source      protocol.Source
 	RedisHealth RedisHealthChecker       // nil means no health checking
+	Retention   RetentionReporter        // nil means no retention metrics
+	Queues      CommandQueueReporter     // nil means commands are not scheduled
+	Poller      PollerReporter           // nil means no poll metrics
+	Backups     BackupManager            // nil means backups disabled
+	Auth        *auth.Signer             // nil means authentication disabled (X-Employee-ID trusted)
+	Scanner     *scan.Parser             // nil means scan input disabled
 	TestMgr     *testmanager.TestManager // nil means no test management
 	ReportDir   string                   // local report storage (e.g., /var/lib/arturo/reports)
 	SMBMountDir string                   // CIFS mount point (e.g., /mnt/reports)
 	ScriptsDir  string                   // directory containing .art scripts
 }
 
-// RegisterRoutes adds all API routes to the given ServeMux.
+// RegisterRoutes adds all API routes to the given ServeMux. Requests that
+// change state, and database downloads, are recorded in the audit log.
+// With authentication enabled, reads of station, test, and RMA data need a
+// signed-in employee or an API key with the read scope; only login, scan,
+// and the system status and poller endpoints are open.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Existing routes
-	mux.HandleFunc("GET /devices", h.listDevices)
-	mux.HandleFunc("GET /devices/{id}", h.getDevice)
-	mux.HandleFunc("POST /devices/{id}/command", h.sendCommand)
-	mux.HandleFunc("GET /stations", h.listStations)
+	mux.HandleFunc("GET /devices", h.authenticated(h.listDevices))
+	mux.HandleFunc("GET /devices/{id}", h.authenticated(h.getDevice))
+	mux.HandleFunc("POST /devices/{id}/command", h.audited(h.sendCommand))
+	mux.HandleFunc("GET /stations", h.authenticated(h.listStations))
 	mux.HandleFunc("GET /system/status", h.getSystemStatus)
-	mux.HandleFunc("GET /test-runs", h.listTestRuns)
-	mux.HandleFunc("GET /reports/{id}/csv", h.exportCSV)
-	mux.HandleFunc("GET /reports/{id}/json", h.exportJSON)
-	mux.HandleFunc("GET /reports/{id}/pdf", h.exportPDF)
-	mux.HandleFunc("POST /ota", h.triggerOTA)
+	mux.HandleFunc("GET /system/poller", h.getPollerStats)
+	mux.HandleFunc("GET /test-runs", h.authenticated(h.listTestRuns))
+	mux.HandleFunc("GET /search", h.authenticated(h.search))
+	mux.HandleFunc("GET /reports/{id}/csv", h.authenticated(h.exportCSV))
+	mux.HandleFunc("GET /reports/{id}/json", h.authenticated(h.exportJSON))
+	mux.HandleFunc("GET /reports/{id}/pdf", h.authenticated(h.exportPDF))
+	mux.HandleFunc("POST /ota", h.audited(h.triggerOTA))
 
 	// Auth routes
-	mux.HandleFunc("POST /auth/login", h.handleLogin)
+	mux.HandleFunc("POST /auth/login", h.audited(h.handleLogin))
 	mux.HandleFunc("GET /auth/session", h.handleSession)
+	mux.HandleFunc("POST /scan", h.audited(h.handleScan))
 
 	// RMA routes
-	mux.HandleFunc("POST /rmas", h.createRMA)
-	mux.HandleFunc("GET /rmas", h.listRMAs)
-	mux.HandleFunc("GET /rmas/search", h.searchRMAs)
-	mux.HandleFunc("GET /rmas/{id}", h.getRMA)
-	mux.HandleFunc("POST /rmas/{id}/close", h.closeRMA)
+	mux.HandleFunc("POST /rmas", h.audited(h.createRMA))
+	mux.HandleFunc("GET /rmas", h.authenticated(h.listRMAs))
+	mux.HandleFunc("GET /rmas/search", h.authenticated(h.searchRMAs))
+	mux.HandleFunc("GET /rmas/{id}", h.authenticated(h.getRMA))
+	mux.HandleFunc("POST /rmas/{id}/close", h.audited(h.closeRMA))
 
 	// Station test control routes
-	mux.HandleFunc("POST /stations/{id}/test/start", h.startTest)
-	mux.HandleFunc("POST /stations/{id}/test/pause", h.pauseTest)
-	mux.HandleFunc("POST /stations/{id}/test/resume", h.resumeTest)
-	mux.HandleFunc("POST /stations/{id}/test/terminate", h.terminateTest)
-	mux.HandleFunc("POST /stations/{id}/test/abort", h.abortTest)
-	mux.HandleFunc("GET /stations/{id}/state", h.getStationState)
-	mux.HandleFunc("POST /stations/{id}/command", h.stationCommand)
+	mux.HandleFunc("POST /stations/{id}/test/start", h.audited(h.startTest))
+	mux.HandleFunc("POST /stations/{id}/test/pause", h.audited(h.pauseTest))
+	mux.HandleFunc("POST /stations/{id}/test/resume", h.audited(h.resumeTest))
+	mux.HandleFunc("POST /stations/{id}/test/terminate", h.audited(h.terminateTest))
+	mux.HandleFunc("POST /stations/{id}/test/abort", h.audited(h.abortTest))
+	mux.HandleFunc("GET /stations/{id}/state", h.authenticated(h.getStationState))
+	mux.HandleFunc("POST /stations/{id}/command", h.audited(h.stationCommand))
+	mux.HandleFunc("POST /stations/{id}/batch", h.audited(h.stationBatch))
 
 	// Continuous temperature log route
-	mux.HandleFunc("GET /stations/{id}/temperatures", h.getStationTemperatures)
-	mux.HandleFunc("GET /stations/{id}/regen-curve.csv", h.getStationRegenCurve)
+	mux.HandleFunc("GET /stations/{id}/temperatures", h.authenticated(h.getStationTemperatures))
+	mux.HandleFunc("GET /stations/{id}/regen-curve.csv", h.authenticated(h.getStationRegenCurve))
 
 	// Test run data routes
-	mux.HandleFunc("GET /test-runs/{id}/temperatures", h.getTemperatures)
-	mux.HandleFunc("GET /test-runs/{id}/events", h.getTestEvents)
+	mux.HandleFunc("GET /test-runs/{id}/temperatures", h.authenticated(h.getTemperatures))
+	mux.HandleFunc("GET /test-runs/{id}/events", h.authenticated(h.getTestEvents))
+	mux.HandleFunc("GET /test-runs/{id}/review", h.authenticated(h.getTestRunReview))
+	mux.HandleFunc("POST /test-runs/{id}/signatures", h.audited(h.signTestRun))
 
 	// Artifact routes
-	mux.HandleFunc("GET /rmas/{id}/artifact", h.getRMAArtifact)
-	mux.HandleFunc("GET /rmas/{id}/pdf", h.getRMAPDF)
-	mux.HandleFunc("GET /rmas/{rmaId}/runs/{runId}/csv", h.getRunCSV)
-
-	// Script listing
-	mux.HandleFunc("GET /scripts", h.listScripts)
+	mux.HandleFunc("GET /rmas/{id}/artifact", h.authenticated(h.getRMAArtifact))
+	mux.HandleFunc("GET /rmas/{id}/pdf", h.authenticated(h.getRMAPDF))
+	mux.HandleFunc("GET /rmas/{rmaId}/runs/{runId}/csv", h.authenticated(h.getRunCSV))
+
+	// Script listing and versioned script registry
+	mux.HandleFunc("GET /scripts", h.authenticated(h.listScripts))
+	mux.HandleFunc("POST /scripts", h.audited(h.uploadScript))
+	mux.HandleFunc("GET /scripts/versions", h.authenticated(h.listScriptVersions))
+	mux.HandleFunc("GET /scripts/{id}", h.authenticated(h.getScriptVersion))
+	mux.HandleFunc("POST /scripts/{id}/approve", h.audited(h.approveScriptVersion))
+
+	// Database backups
+	mux.HandleFunc("GET /admin/backups", h.listBackups)
+	mux.HandleFunc("POST /admin/backups", h.audited(h.createBackup))
+	mux.HandleFunc("GET /admin/backups/{name}", h.audited(h.downloadBackup))
+
+	// Employees and login audit
+	mux.HandleFunc("GET /admin/employees", h.listEmployees)
+	mux.HandleFunc("PUT /admin/employees/{id}", h.audited(h.putEmployee))
+	mux.HandleFunc("GET /admin/login-failures", h.listLoginFailures)
+
+	// Audit log of state-changing requests
+	mux.HandleFunc("GET /admin/audit", h.listAuditLog)
+	mux.HandleFunc("GET /admin/audit/export", h.exportAuditLog)
+	mux.HandleFunc("GET /admin/audit/verify", h.verifyAuditLog)
+
+	// API keys for machine clients
+	mux.HandleFunc("GET /admin/api-keys", h.listAPIKeys)
+	mux.HandleFunc("POST /admin/api-keys", h.audited(h.createAPIKey))
+	mux.HandleFunc("DELETE /admin/api-keys/{id}", h.audited(h.revokeAPIKey))
 }
 
 func (h *Handler) listDevices(w http.ResponseWriter, r *http.Request) {
@@ -167,10 +257,34 @@ func (h *Handler) sendCommand(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
 		return
 	}
+	if !authorize(h, w, r, commandRole(req.Command, req.Raw)) {
+		return
+	}
 
 	h.executeCommand(w, r, deviceID, req.Command, req.Parameters, req.TimeoutMs, req.Raw)
 }
 
+// commandRole is the role needed to send a device command. Operators may
+// only send queries, which read device state (see scheduler.IsQuery).
+// Commands that change it, and raw commands, which bypass the device
+// profile, are limited to engineers.
+func commandRole(command string, raw bool) auth.Role {
+	if raw || !scheduler.IsQuery(command) {
+		return auth.RoleEngineer
+	}
+	return auth.RoleOperator
+}
+
+// batchRole is the role needed to send every command in a batch.
+func batchRole(commands []batchCommandRequest) auth.Role {
+	for _, c := range commands {
+		if commandRole(c.Command, false) == auth.RoleEngineer {
+			return auth.RoleEngineer
+		}
+	}
+	return auth.RoleOperator
+}
+
 // executeCommand is the shared core for sending a device command and waiting for a response.
 func (h *Handler) executeCommand(w http.ResponseWriter, r *http.Request, deviceID, command string, parameters map[string]string, timeoutMs int, raw bool) {
 	if !h.redisAvailable() {
@@ -238,12 +352,110 @@ func (h *Handler) listStations(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) listTestRuns(w http.ResponseWriter, r *http.Request) {
-	runs, err := h.Store.QueryTestRuns()
+	page, since, ok := parseListPage(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	runs, next, err := h.Store.QueryTestRunsPage(store.TestRunFilter{
+		Page:       page,
+		Status:     params.Get("status"),
+		Station:    params.Get("station"),
+		Script:     params.Get("script"),
+		RMAID:      params.Get("rma"),
+		ReportType: params.Get("report_type"),
+		Since:      since,
+	})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to query test runs: %v", err)})
 		return
 	}
-	writeJSON(w, http.StatusOK, runs)
+	writeList(w, r, runs, next)
+}
+
+// searchResponse is the response for GET /search.
+type searchResponse struct {
+	Total  int                  `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+	Runs   []store.RunSearchHit `json:"runs"`
+	RMAs   []store.RMA          `json:"rmas"`
+}
+
+// search finds test runs by structured filters and free text (q), which
+// matches run scripts and summaries, test event text, and RMA fields and
+// notes. RMAs matching q are returned alongside the runs.
+func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := store.RunSearch{
+		Query:      params.Get("q"),
+		Status:     params.Get("status"),
+		Station:    params.Get("station"),
+		Script:     params.Get("script"),
+		ReportType: params.Get("report_type"),
+		EmployeeID: params.Get("employee"),
+		PumpSerial: params.Get("pump_serial"),
+		PumpModel:  params.Get("pump_model"),
+		RMAID:      params.Get("rma"),
+		Sort:       params.Get("sort"),
+		Limit:      store.DefaultSearchLimit,
+	}
+	if !store.ValidRunSort(q.Sort) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid sort"})
+		return
+	}
+	for name, dst := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		if v := params.Get(name); v != "" {
+			t, err := parseSearchTime(v)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name + ": use RFC 3339 or YYYY-MM-DD"})
+				return
+			}
+			*dst = &t
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+				return
+			}
+			*dst = n
+		}
+	}
+	if q.Limit == 0 {
+		q.Limit = store.DefaultSearchLimit
+	}
+	q.Limit = min(q.Limit, store.MaxSearchLimit)
+
+	runs, total, err := h.Store.SearchTestRuns(q)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "search failed"})
+		return
+	}
+	rmas := []store.RMA{}
+	if q.Query != "" && q.Offset == 0 {
+		rmas, err = h.Store.SearchRMAText(q.Query, store.DefaultSearchLimit)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "search failed"})
+			return
+		}
+	}
+	writeJSONETag(w, r, searchResponse{Total: total, Limit: q.Limit, Offset: q.Offset, Runs: runs, RMAs: rmas})
+}
+
+// parseSearchTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date
+// (midnight UTC).
+func parseSearchTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
 }
 
 func (h *Handler) getSystemStatus(w http.ResponseWriter, r *http.Request) {
@@ -259,9 +471,29 @@ func (h *Handler) getSystemStatus(w http.ResponseWriter, r *http.Request) {
 		rh := h.RedisHealth.GetStatus()
 		status.RedisHealth = &rh
 	}
+	if h.Retention != nil {
+		rs := h.Retention.Stats()
+		status.Retention = &rs
+	}
+	if h.TestMgr != nil {
+		status.Resources = h.TestMgr.ResourceStatus()
+	}
+	if h.Queues != nil {
+		status.CommandQueues = h.Queues.Status()
+	}
 	writeJSON(w, http.StatusOK, status)
 }
 
+// getPollerStats returns each station's poll state, interval, latency and
+// failure counts.
+func (h *Handler) getPollerStats(w http.ResponseWriter, r *http.Request) {
+	if h.Poller == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "station poller not available"})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Poller.Stats())
+}
+
 func (h *Handler) exportCSV(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	w.Header().Set("Content-Type", "text/csv")
@@ -299,6 +531,9 @@ func (h *Handler) getRunCSV(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) triggerOTA(w http.ResponseWriter, r *http.Request) {
+	if !authorize(h, w, r, auth.RoleEngineer) {
+		return
+	}
 	if !h.redisAvailable() {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "redis unavailable"})
 		return
@@ -408,13 +643,29 @@ func (h *Handler) createRMA(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) listRMAs(w http.ResponseWriter, r *http.Request) {
-	status := r.URL.Query().Get("status")
-	rmas, err := h.Store.ListRMAs(status)
+	page, since, ok := parseListPage(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	rmas, next, err := h.Store.ListRMAsPage(store.RMAFilter{
+		Page:       page,
+		Status:     params.Get("status"),
+		PumpSerial: params.Get("pump_serial"),
+		PumpModel:  params.Get("pump_model"),
+		Customer:   params.Get("customer"),
+		EmployeeID: params.Get("employee"),
+		Since:      since,
+	})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list RMAs"})
 		return
 	}
-	writeJSON(w, http.StatusOK, rmas)
+	writeList(w, r, rmas, next)
 }
 
 func (h *Handler) searchRMAs(w http.ResponseWriter, r *http.Request) {
@@ -429,7 +680,7 @@ func (h *Handler) searchRMAs(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "search failed"})
 		return
 	}
-	writeJSON(w, http.StatusOK, rmas)
+	writeJSONETag(w, r, rmas)
 }
 
 func (h *Handler) getRMA(w http.ResponseWriter, r *http.Request) {
@@ -444,12 +695,18 @@ func (h *Handler) getRMA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Include test run history
+	// Include test run history and each run's review state
 	runs, _ := h.Store.QueryTestRunsByRMA(id)
+	reviews, err := artifact.RMAReviewStatuses(h.Store, id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get run reviews"})
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"rma":  rma,
-		"runs": runs,
+		"rma":     rma,
+		"runs":    runs,
+		"reviews": reviews,
 	})
 }
 
@@ -477,6 +734,19 @@ func (h *Handler) closeRMA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Every run needs an approval signature on its current results
+	unapproved, err := h.unapprovedRuns(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to check run approvals"})
+		return
+	}
+	if len(unapproved) > 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error": fmt.Sprintf("%d test run(s) not approved: %s", len(unapproved), strings.Join(unapproved, ", ")),
+		})
+		return
+	}
+
 	if err := h.Store.CloseRMA(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to close RMA"})
 		return
@@ -517,9 +787,10 @@ func (h *Handler) closeRMA(w http.ResponseWriter, r *http.Request) {
 // ---------------------------------------------------------------------------
 
 type startTestRequest struct {
-	RMAID      string `json:"rma_id"`
-	ScriptPath string `json:"script_path"`
-	DeviceID   string `json:"device_id"`
+	RMAID           string `json:"rma_id"`
+	ScriptPath      string `json:"script_path"`
+	ScriptVersionID string `json:"script_version_id"`
+	DeviceID        string `json:"device_id"`
 }
 
 type terminateRequest struct {
@@ -545,8 +816,8 @@ func (h *Handler) startTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RMAID == "" || req.ScriptPath == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rma_id and script_path are required"})
+	if req.RMAID == "" || (req.ScriptPath == "" && req.ScriptVersionID == "") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "rma_id and script_version_id or script_path are required"})
 		return
 	}
 
@@ -562,7 +833,13 @@ func (h *Handler) startTest(w http.ResponseWriter, r *http.Request) {
 
 	testRunID := time.Now().Format("20060102-150405.000")
 
-	if err := h.TestMgr.StartTest(stationID, deviceID, req.ScriptPath, req.RMAID, testRunID, emp.ID); err != nil {
+	var err error
+	if req.ScriptVersionID != "" {
+		err = h.TestMgr.StartTestVersion(stationID, deviceID, req.ScriptVersionID, req.RMAID, testRunID, emp.ID)
+	} else {
+		err = h.TestMgr.StartTest(stationID, deviceID, req.ScriptPath, req.RMAID, testRunID, emp.ID)
+	}
+	if err != nil {
 		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
 		return
 	}
@@ -725,10 +1002,93 @@ func (h *Handler) stationCommand(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "device_id is required"})
 		return
 	}
+	if !authorize(h, w, r, commandRole(req.Command, req.Raw)) {
+		return
+	}
 
 	h.executeCommand(w, r, req.DeviceID, req.Command, req.Parameters, req.TimeoutMs, req.Raw)
 }
 
+// stationBatch sends several device commands to a station in one
+// device.command.batch_request and returns the batch response. The station
+// must have advertised protocol.FeatureBatchCommands in its service.hello.
+func (h *Handler) stationBatch(w http.ResponseWriter, r *http.Request) {
+	stationID := r.PathValue("id")
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if !authorize(h, w, r, batchRole(req.Commands)) {
+		return
+	}
+	if !h.redisAvailable() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "redis unavailable"})
+		return
+	}
+	if h.Registry.GetStationStatus(stationID) == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "station not found"})
+		return
+	}
+	if !h.Registry.Supports(stationID, protocol.FeatureBatchCommands) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "station does not support batch commands"})
+		return
+	}
+
+	// Items default to the single-command timeout; the batch defaults to
+	// running its commands back to back.
+	commands := make([]protocol.BatchCommand, len(req.Commands))
+	total := 0
+	for i, c := range req.Commands {
+		t := c.TimeoutMs
+		if t <= 0 {
+			t = 5000
+		}
+		total += t
+		commands[i] = protocol.BatchCommand{DeviceID: c.DeviceID, CommandName: c.Command, Parameters: c.Parameters, TimeoutMs: &t}
+	}
+	timeoutMs := req.TimeoutMs
+	if timeoutMs <= 0 {
+		timeoutMs = min(total, 600000)
+	}
+
+	msg, err := protocol.BuildBatchRequest(h.Source, commands, timeoutMs)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	waiterCh := h.Dispatcher.Register(msg.Envelope.CorrelationID)
+
+	if err := h.Sender.SendCommand(r.Context(), transport.CommandStream(stationID), msg); err != nil {
+		h.Dispatcher.Deregister(msg.Envelope.CorrelationID)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to send batch: %v", err)})
+		return
+	}
+
+	select {
+	case resp := <-waiterCh:
+		payload, err := protocol.ParseBatchResponse(resp)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to parse response: %v", err)})
+			return
+		}
+		writeJSON(w, http.StatusOK, payload)
+
+	case <-time.After(time.Duration(timeoutMs) * time.Millisecond):
+		h.Dispatcher.Deregister(msg.Envelope.CorrelationID)
+		writeJSON(w, http.StatusGatewayTimeout, map[string]string{
+			"error":          "batch timed out",
+			"correlation_id": msg.Envelope.CorrelationID,
+		})
+
+	case <-r.Context().Done():
+		h.Dispatcher.Deregister(msg.Envelope.CorrelationID)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "request cancelled"})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Test run data endpoints
 // ---------------------------------------------------------------------------
@@ -818,13 +1178,26 @@ func (h *Handler) getStationTemperatures(w http.ResponseWriter, r *http.Request)
 
 func (h *Handler) getTestEvents(w http.ResponseWriter, r *http.Request) {
 	testRunID := r.PathValue("id")
-
-	events, err := h.Store.QueryTestEvents(testRunID)
+	page, since, ok := parseListPage(w, r)
+	if !ok {
+		return
+	}
+	params := r.URL.Query()
+	events, next, err := h.Store.QueryTestEventsPage(testRunID, store.TestEventFilter{
+		Page:       page,
+		EventType:  params.Get("event_type"),
+		EmployeeID: params.Get("employee"),
+		Since:      since,
+	})
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query events"})
 		return
 	}
-	writeJSON(w, http.StatusOK, events)
+	writeList(w, r, events, next)
 }
 
 // ---------------------------------------------------------------------------
@@ -887,40 +1260,303 @@ func parseRunIDs(r *http.Request) []string {
 // Script listing
 // ---------------------------------------------------------------------------
 
+// scriptEntry is one runnable script in GET /scripts. Registry versions carry
+// a version_id; unversioned files from ScriptsDir carry a path and are only
+// listed when the test manager is not in production mode.
 type scriptEntry struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name          string     `json:"name"`
+	Path          string     `json:"path,omitempty"`
+	VersionID     string     `json:"version_id,omitempty"`
+	Version       int        `json:"version,omitempty"`
+	TestName      string     `json:"test_name,omitempty"`
+	ReportType    string     `json:"report_type,omitempty"`
+	ReportVersion string     `json:"report_version,omitempty"`
+	SHA256        string     `json:"sha256,omitempty"`
+	ApprovedBy    *string    `json:"approved_by,omitempty"`
+	ApprovedAt    *time.Time `json:"approved_at,omitempty"`
 }
 
 func (h *Handler) listScripts(w http.ResponseWriter, r *http.Request) {
-	if h.ScriptsDir == "" {
-		writeJSON(w, http.StatusOK, []scriptEntry{})
+	scripts := []scriptEntry{}
+
+	versions, err := h.Store.ListScriptVersions("", "approved")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list script versions"})
+		return
+	}
+	for _, v := range versions {
+		scripts = append(scripts, scriptEntry{
+			Name:          v.Name,
+			VersionID:     v.ID,
+			Version:       v.Version,
+			TestName:      v.TestName,
+			ReportType:    v.ReportType,
+			ReportVersion: v.ReportVersion,
+			SHA256:        v.SHA256,
+			ApprovedBy:    v.ApprovedBy,
+			ApprovedAt:    v.ApprovedAt,
+		})
+	}
+
+	if h.ScriptsDir == "" || (h.TestMgr != nil && h.TestMgr.RequireApprovedScripts()) {
+		writeJSON(w, http.StatusOK, scripts)
 		return
 	}
 
-	var scripts []scriptEntry
 	filepath.Walk(h.ScriptsDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() {
 			return nil
 		}
 		if strings.HasSuffix(info.Name(), ".art") {
 			rel, _ := filepath.Rel(h.ScriptsDir, path)
-			scripts = append(scripts, scriptEntry{
+			entry := scriptEntry{
 				Name: rel,
 				Path: path,
-			})
+			}
+			if content, err := os.ReadFile(path); err == nil {
+				if meta, err := testmanager.ParseScriptMeta(string(content)); err == nil {
+					entry.TestName = meta.TestName
+					entry.ReportType = meta.ReportType
+					entry.ReportVersion = meta.ReportVersion
+				}
+			}
+			scripts = append(scripts, entry)
 		}
 		return nil
 	})
 
-	if scripts == nil {
-		scripts = []scriptEntry{}
-	}
 	writeJSON(w, http.StatusOK, scripts)
 }
 
+// uploadScriptRequest is the JSON body for POST /scripts.
+type uploadScriptRequest struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// uploadScript stores a new pending version of a script in the registry.
+// The script must parse and declare REPORT_TYPE and REPORT_VERSION.
+func (h *Handler) uploadScript(w http.ResponseWriter, r *http.Request) {
+	emp, ok := requireRole(h, w, r, auth.RoleEngineer)
+	if !ok {
+		return
+	}
+
+	var req uploadScriptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.Name == "" || req.Content == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name and content are required"})
+		return
+	}
+
+	meta, err := testmanager.ParseScriptMeta(req.Content)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id := uuid.New().String()
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(req.Content)))
+	if _, err := h.Store.CreateScriptVersion(id, req.Name, req.Content, hash,
+		meta.TestName, meta.ReportType, meta.ReportVersion, emp.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to store script: %v", err)})
+		return
+	}
+
+	v, err := h.Store.GetScriptVersion(id)
+	if err != nil || v == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to retrieve stored script"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, v)
+}
+
+// listScriptVersions returns every registry version, approved or not.
+// Optional name and status query parameters filter the list.
+func (h *Handler) listScriptVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.Store.ListScriptVersions(r.URL.Query().Get("name"), r.URL.Query().Get("status"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list script versions"})
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h *Handler) getScriptVersion(w http.ResponseWriter, r *http.Request) {
+	v, err := h.Store.GetScriptVersion(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get script version"})
+		return
+	}
+	if v == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "script version not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (h *Handler) approveScriptVersion(w http.ResponseWriter, r *http.Request) {
+	emp, ok := requireRole(h, w, r, auth.RoleEngineer)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	v, err := h.Store.GetScriptVersion(id)
+	if err != nil || v == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "script version not found"})
+		return
+	}
+	if v.Status != "pending" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "script version is already " + v.Status})
+		return
+	}
+
+	if err := h.Store.ApproveScriptVersion(id, emp.ID); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+
+	v, _ = h.Store.GetScriptVersion(id)
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (h *Handler) listBackups(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	if h.Backups == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "backups not configured"})
+		return
+	}
+	backups, err := h.Backups.List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list backups"})
+		return
+	}
+	writeJSON(w, http.StatusOK, backups)
+}
+
+// createBackup takes a backup immediately, outside the regular schedule.
+func (h *Handler) createBackup(w http.ResponseWriter, r *http.Request) {
+	emp, ok := requireRole(h, w, r, auth.RoleAdmin)
+	if !ok {
+		return
+	}
+	if h.Backups == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "backups not configured"})
+		return
+	}
+	info, err := h.Backups.BackupNow()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("backup: %s requested by %s", info.Name, emp.ID)
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func (h *Handler) downloadBackup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireRole(h, w, r, auth.RoleAdmin); !ok {
+		return
+	}
+	if h.Backups == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "backups not configured"})
+		return
+	}
+	f, info, err := h.Backups.Open(r.PathValue("name"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "backup not found"})
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", info.Name))
+	http.ServeContent(w, r, info.Name, info.CreatedAt, f)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(v)
 }
+
+// maxListLimit caps the limit parameter of the list endpoints.
+const maxListLimit = 1000
+
+// parseListPage reads the paging parameters shared by the list endpoints:
+// limit (default unlimited), offset, cursor (X-Next-Cursor from the
+// previous page), and since (RFC 3339 or YYYY-MM-DD). It writes a 400 and
+// returns false if one is malformed.
+func parseListPage(w http.ResponseWriter, r *http.Request) (store.Page, *time.Time, bool) {
+	params := r.URL.Query()
+	page := store.Page{Cursor: params.Get("cursor")}
+	for name, dst := range map[string]*int{"limit": &page.Limit, "offset": &page.Offset} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+				return page, nil, false
+			}
+			*dst = n
+		}
+	}
+	page.Limit = min(page.Limit, maxListLimit)
+
+	var since *time.Time
+	if v := params.Get("since"); v != "" {
+		t, err := parseSearchTime(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since: use RFC 3339 or YYYY-MM-DD"})
+			return page, nil, false
+		}
+		since = &t
+	}
+	return page, since, true
+}
+
+// writeList writes one page of a list endpoint. When more rows follow,
+// the cursor for the next page is sent in the X-Next-Cursor header so the
+// body stays a plain JSON array.
+func writeList(w http.ResponseWriter, r *http.Request, v interface{}, next string) {
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	writeJSONETag(w, r, v)
+}
+
+// writeJSONETag writes v as a 200 response with an ETag of its content,
+// or a bodyless 304 if the request's If-None-Match already has it.
+func writeJSONETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode response"})
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison RFC 9110 requires for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
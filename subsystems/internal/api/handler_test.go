@@ -3,19 +3,32 @@ package api
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/holla2040/arturo/internal/artifact"
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/backup"
 	"github.com/holla2040/arturo/internal/estop"
+	"github.com/holla2040/arturo/internal/poller"
 	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/redishealth"
 	"github.com/holla2040/arturo/internal/registry"
+	"github.com/holla2040/arturo/internal/retention"
+	"github.com/holla2040/arturo/internal/scan"
+	"github.com/holla2040/arturo/internal/scheduler"
 	"github.com/holla2040/arturo/internal/store"
+	"github.com/holla2040/arturo/internal/testmanager"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 // mockRedisHealth implements RedisHealthChecker for tests.
@@ -34,6 +47,24 @@ func (m *mockRedisHealth) GetStatus() redishealth.Status {
 	}
 }
 
+// mockPoller implements PollerReporter for tests.
+type mockPoller struct {
+	stats []poller.StationStats
+}
+
+func (m *mockPoller) Stats() []poller.StationStats {
+	return m.stats
+}
+
+// mockRetention implements RetentionReporter for tests.
+type mockRetention struct {
+	stats retention.Stats
+}
+
+func (m *mockRetention) Stats() retention.Stats {
+	return m.stats
+}
+
 // mockSender implements CommandSender for tests.
 type mockSender struct {
 	mu       sync.Mutex
@@ -324,6 +355,109 @@ func TestGetSystemStatusWithEstop(t *testing.T) {
 	}
 }
 
+func TestGetSystemStatusResources(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.TestMgr = testmanager.NewWithFactory(context.Background(), h.Store, nil, nil)
+	h.TestMgr.SetResources([]testmanager.ResourceConfig{{Name: "rough_line", Capacity: 1}})
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/system/status")
+	if err != nil {
+		t.Fatalf("GET /system/status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status systemStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	if len(status.Resources) != 1 {
+		t.Fatalf("expected 1 resource, got %d", len(status.Resources))
+	}
+	if status.Resources[0].Name != "rough_line" || status.Resources[0].Capacity != 1 {
+		t.Errorf("unexpected resource: %+v", status.Resources[0])
+	}
+}
+
+func TestGetSystemStatusRetention(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Retention = &mockRetention{stats: retention.Stats{Runs: 3, RawPrunedTotal: 120, AggregatedTotal: 7}}
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/system/status")
+	if err != nil {
+		t.Fatalf("GET /system/status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status systemStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	if status.Retention == nil {
+		t.Fatal("expected retention stats")
+	}
+	if status.Retention.Runs != 3 || status.Retention.RawPrunedTotal != 120 || status.Retention.AggregatedTotal != 7 {
+		t.Errorf("unexpected retention stats: %+v", status.Retention)
+	}
+}
+
+func TestGetSystemStatusCommandQueues(t *testing.T) {
+	h, sender := newTestHandler(t)
+	queues := scheduler.New(sender, h.Dispatcher, 0)
+	h.Sender = queues
+	h.Queues = queues
+	msg, _ := protocol.BuildCommandRequest(h.Source, "PUMP-01", "get_telemetry", nil, 5000, false)
+	if err := h.Sender.SendCommand(context.Background(), transport.CommandStream("station-01"), msg); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/system/status")
+	if err != nil {
+		t.Fatalf("GET /system/status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status systemStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	if len(status.CommandQueues) != 1 {
+		t.Fatalf("expected 1 command queue, got %d", len(status.CommandQueues))
+	}
+	if q := status.CommandQueues[0]; q.Station != "station-01" || q.Sent != 1 || q.Queued != 0 {
+		t.Errorf("unexpected command queue: %+v", q)
+	}
+}
+
+func TestGetPollerStats(t *testing.T) {
+	h, _ := newTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/system/poller")
+	if err != nil {
+		t.Fatalf("GET /system/poller failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("without a poller: expected 503, got %d", resp.StatusCode)
+	}
+
+	h.Poller = &mockPoller{stats: []poller.StationStats{
+		{Station: "station-01", Active: true, State: poller.StateRegen, Interval: "2s", Polls: 40, Failures: 1, AvgLatency: "120ms"},
+	}}
+	resp, err = http.Get(srv.URL + "/system/poller")
+	if err != nil {
+		t.Fatalf("GET /system/poller failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var stats []poller.StationStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	if len(stats) != 1 || stats[0].Station != "station-01" || stats[0].Polls != 40 || stats[0].State != poller.StateRegen {
+		t.Errorf("unexpected poller stats: %+v", stats)
+	}
+}
+
 func TestSendCommandDeviceNotFound(t *testing.T) {
 	h, _ := newTestHandler(t)
 	srv := newTestServer(t, h)
@@ -514,6 +648,78 @@ func TestSendCommandDefaultTimeout(t *testing.T) {
 	}
 }
 
+func TestStationBatch(t *testing.T) {
+	h, sender := newTestHandler(t)
+	seedRegistry(h.Registry)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	// Echo each command name back as its response.
+	sender.sendFunc = func(ctx context.Context, stream string, msg *protocol.Message) error {
+		req, err := protocol.ParseBatchRequest(msg)
+		if err != nil {
+			return err
+		}
+		var out protocol.BatchResponsePayload
+		for _, c := range req.Commands {
+			resp := c.CommandName
+			out.Results = append(out.Results, protocol.CommandResponsePayload{DeviceID: c.DeviceID, CommandName: c.CommandName, Success: true, Response: &resp})
+		}
+		payloadBytes, _ := json.Marshal(out)
+		go h.Dispatcher.Dispatch(&protocol.Message{
+			Envelope: protocol.Envelope{CorrelationID: msg.Envelope.CorrelationID, Type: protocol.TypeDeviceCommandBatchResponse},
+			Payload:  payloadBytes,
+		})
+		return nil
+	}
+
+	post := func(station, body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/stations/"+station+"/batch", "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	body := `{"commands": [{"device_id": "fluke-8846a", "command": "measure_dc_voltage"}, {"device_id": "fluke-8846a", "command": "measure_resistance", "timeout_ms": 2000}]}`
+
+	if resp := post("station-99", body); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown station: expected 404, got %d", resp.StatusCode)
+	}
+	if resp := post("station-01", body); resp.StatusCode != http.StatusConflict {
+		t.Errorf("station without batch support: expected 409, got %d", resp.StatusCode)
+	}
+	if len(sender.sent) != 0 {
+		t.Fatalf("sent %d messages to stations that cannot take them", len(sender.sent))
+	}
+
+	h.Registry.UpdateFromHello("station-01", protocol.SchemaVersion, &protocol.HelloPayload{Features: []string{protocol.FeatureBatchCommands}})
+
+	if resp := post("station-01", `{"commands": []}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty batch: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp := post("station-01", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var result protocol.BatchResponsePayload
+	json.NewDecoder(resp.Body).Decode(&result)
+	if len(result.Results) != 2 || *result.Results[1].Response != "measure_resistance" {
+		t.Errorf("results = %+v", result.Results)
+	}
+
+	sent := sender.sent[len(sender.sent)-1]
+	if sent.Stream != "commands:station-01" {
+		t.Errorf("sent to %s, want commands:station-01", sent.Stream)
+	}
+	req, _ := protocol.ParseBatchRequest(sent.Msg)
+	if *req.TimeoutMs != 7000 {
+		t.Errorf("batch timeout = %d, want the 7000 ms sum of command timeouts", *req.TimeoutMs)
+	}
+}
+
 func TestContentTypeJSON(t *testing.T) {
 	h, _ := newTestHandler(t)
 	srv := newTestServer(t, h)
@@ -984,3 +1190,938 @@ func TestOTARedisUnavailable(t *testing.T) {
 		t.Fatalf("expected 503, got %d", resp.StatusCode)
 	}
 }
+
+// --- Script Registry Tests ---
+
+func postJSONAs(t *testing.T, url, employeeID string, body interface{}) *http.Response {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if employeeID != "" {
+		req.Header.Set("X-Employee-ID", employeeID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", url, err)
+	}
+	return resp
+}
+
+const testRegistryScript = `CONST REPORT_TYPE "regen"
+CONST REPORT_VERSION "2.1"
+
+TEST "Registry Test"
+    PASS "ok"
+ENDTEST`
+
+func TestUploadAndApproveScript(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := postJSONAs(t, srv.URL+"/scripts", "emp-1", uploadScriptRequest{Name: "regen.art", Content: testRegistryScript})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var v store.ScriptVersion
+	json.NewDecoder(resp.Body).Decode(&v)
+	if v.Version != 1 || v.Status != "pending" || v.ReportType != "regen" || v.ReportVersion != "2.1" {
+		t.Errorf("unexpected uploaded version: %+v", v)
+	}
+
+	// Pending versions are not listed as runnable
+	listResp, _ := http.Get(srv.URL + "/scripts")
+	var entries []scriptEntry
+	json.NewDecoder(listResp.Body).Decode(&entries)
+	listResp.Body.Close()
+	if len(entries) != 0 {
+		t.Fatalf("expected no approved scripts, got %d", len(entries))
+	}
+
+	approveResp := postJSONAs(t, srv.URL+"/scripts/"+v.ID+"/approve", "emp-1", nil)
+	approveResp.Body.Close()
+	if approveResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 on approve, got %d", approveResp.StatusCode)
+	}
+
+	again := postJSONAs(t, srv.URL+"/scripts/"+v.ID+"/approve", "emp-1", nil)
+	again.Body.Close()
+	if again.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 on second approve, got %d", again.StatusCode)
+	}
+
+	listResp, _ = http.Get(srv.URL + "/scripts")
+	json.NewDecoder(listResp.Body).Decode(&entries)
+	listResp.Body.Close()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 approved script, got %d", len(entries))
+	}
+	if entries[0].VersionID != v.ID || entries[0].ReportType != "regen" || entries[0].ReportVersion != "2.1" {
+		t.Errorf("unexpected script entry: %+v", entries[0])
+	}
+}
+
+func TestUploadScriptRejectsMissingReportMeta(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := postJSONAs(t, srv.URL+"/scripts", "emp-1", uploadScriptRequest{
+		Name:    "bad.art",
+		Content: "TEST \"no meta\"\n    PASS \"ok\"\nENDTEST",
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadScriptRequiresEmployee(t *testing.T) {
+	h, _ := newTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := postJSONAs(t, srv.URL+"/scripts", "", uploadScriptRequest{Name: "regen.art", Content: testRegistryScript})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", resp.StatusCode)
+	}
+}
+
+// --- Search Tests ---
+
+func TestSearch(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	h.Store.CreateRMA("rma-1", "RMA-001", "SN-AAA", "ACME Corp", "CT-8", "emp-1", "cryopump leak at flange")
+	h.Store.CreateTestRunWithRMA("run-1", "regen.art", "rma-1", "station-01", "sha", "", "regen", "1.0")
+	h.Store.FinishTestRun("run-1", "passed", "ok")
+	h.Store.CreateTestRunWithRMA("run-2", "cooldown.art", "rma-1", "station-02", "sha", "", "cooldown", "1.0")
+	h.Store.FinishTestRun("run-2", "failed", "too warm")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	get := func(query string) (int, searchResponse) {
+		resp, err := http.Get(srv.URL + "/search?" + query)
+		if err != nil {
+			t.Fatalf("GET /search failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body searchResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	code, body := get("q=flange&status=failed")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if body.Total != 1 || len(body.Runs) != 1 || body.Runs[0].ID != "run-2" || body.Runs[0].RMANumber != "RMA-001" {
+		t.Errorf("unexpected runs: %+v", body)
+	}
+	if len(body.RMAs) != 1 || body.RMAs[0].ID != "rma-1" {
+		t.Errorf("expected rma-1 in rmas, got %+v", body.RMAs)
+	}
+
+	code, body = get("station=station-01&from=2000-01-01&limit=1")
+	if code != http.StatusOK || body.Total != 1 || body.Limit != 1 || body.Runs[0].ID != "run-1" || len(body.RMAs) != 0 {
+		t.Errorf("unexpected filtered result: %d %+v", code, body)
+	}
+
+	for _, bad := range []string{"sort=password", "from=yesterday", "limit=-1"} {
+		if code, _ := get(bad); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, code)
+		}
+	}
+}
+
+// --- List Paging Tests ---
+
+func TestListRMAsPagingAndETag(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	for i, num := range []string{"RMA-003", "RMA-001", "RMA-002"} {
+		h.Store.CreateRMA(fmt.Sprintf("rma-%d", i), num, "SN-"+num, "ACME Corp", "CT-8", "emp-1", "")
+	}
+	h.Store.CloseRMA("rma-0")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	var numbers []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("paging did not terminate")
+		}
+		resp, err := http.Get(srv.URL + "/rmas?limit=2&cursor=" + cursor)
+		if err != nil {
+			t.Fatalf("GET /rmas failed: %v", err)
+		}
+		var rmas []store.RMA
+		json.NewDecoder(resp.Body).Decode(&rmas)
+		resp.Body.Close()
+		for _, r := range rmas {
+			numbers = append(numbers, r.RMANumber)
+		}
+		cursor = resp.Header.Get("X-Next-Cursor")
+		if cursor == "" {
+			break
+		}
+	}
+	if strings.Join(numbers, ",") != "RMA-001,RMA-002,RMA-003" {
+		t.Errorf("unexpected paged RMAs: %v", numbers)
+	}
+
+	resp, _ := http.Get(srv.URL + "/rmas?status=open")
+	var open []store.RMA
+	json.NewDecoder(resp.Body).Decode(&open)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if len(open) != 2 || etag == "" || resp.Header.Get("X-Next-Cursor") != "" {
+		t.Fatalf("expected 2 open RMAs with an ETag and no cursor, got %d %q", len(open), etag)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/rmas?status=open", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+		t.Errorf("expected empty 304, got %d %q", resp.StatusCode, body)
+	}
+
+	h.Store.CloseRMA("rma-1")
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("expected 200 with a new ETag after a change, got %d", resp.StatusCode)
+	}
+}
+
+func TestListTestRunsAndEventsFilters(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateTestRunWithRMA("run-1", "regen.art", "", "station-01", "sha", "", "regen", "1.0")
+	h.Store.CreateTestRunWithRMA("run-2", "cooldown.art", "", "station-02", "sha", "", "cooldown", "1.0")
+	h.Store.RecordTestEvent("run-1", "started", "emp-1", "")
+	h.Store.RecordTestEvent("run-1", "paused", "emp-2", "lunch")
+	h.Store.RecordTestEvent("run-1", "resumed", "emp-2", "")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp, _ := http.Get(srv.URL + "/test-runs?station=station-02&since=2000-01-01")
+	var runs []store.TestRun
+	json.NewDecoder(resp.Body).Decode(&runs)
+	resp.Body.Close()
+	if len(runs) != 1 || runs[0].ID != "run-2" {
+		t.Errorf("expected only run-2, got %+v", runs)
+	}
+
+	resp, _ = http.Get(srv.URL + "/test-runs/run-1/events?employee=emp-2&limit=1")
+	var events []store.TestEvent
+	json.NewDecoder(resp.Body).Decode(&events)
+	resp.Body.Close()
+	next := resp.Header.Get("X-Next-Cursor")
+	if len(events) != 1 || events[0].EventType != "paused" || next == "" {
+		t.Fatalf("expected first emp-2 event and a cursor, got %+v %q", events, next)
+	}
+	resp, _ = http.Get(srv.URL + "/test-runs/run-1/events?employee=emp-2&limit=1&cursor=" + next)
+	events = nil
+	json.NewDecoder(resp.Body).Decode(&events)
+	resp.Body.Close()
+	if len(events) != 1 || events[0].EventType != "resumed" || resp.Header.Get("X-Next-Cursor") != "" {
+		t.Errorf("expected last emp-2 event, got %+v", events)
+	}
+
+	for _, bad := range []string{"/test-runs?cursor=bogus", "/test-runs?limit=x", "/rmas?since=yesterday", "/test-runs/run-1/events?offset=-1"} {
+		resp, _ := http.Get(srv.URL + bad)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, resp.StatusCode)
+		}
+	}
+}
+
+// --- Backup Tests ---
+
+func getAs(t *testing.T, url, employeeID string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if employeeID != "" {
+		req.Header.Set("X-Employee-ID", employeeID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	return resp
+}
+
+func TestBackupEndpoints(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	mgr, err := backup.New(h.Store.(*store.SQLStore), backup.Config{Dir: t.TempDir(), Keep: 3})
+	if err != nil {
+		t.Fatalf("backup.New failed: %v", err)
+	}
+	h.Backups = mgr
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := postJSONAs(t, srv.URL+"/admin/backups", "emp-1", nil)
+	var created backup.Info
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Name == "" {
+		t.Fatalf("expected 201 with backup info, got %d %+v", resp.StatusCode, created)
+	}
+
+	resp = getAs(t, srv.URL+"/admin/backups", "emp-1")
+	var list []backup.Info
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].Name != created.Name {
+		t.Fatalf("expected [%s], got %+v", created.Name, list)
+	}
+
+	resp = getAs(t, srv.URL+"/admin/backups/"+created.Name, "emp-1")
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || int64(len(data)) != created.Size {
+		t.Fatalf("download: status %d, %d bytes, want %d", resp.StatusCode, len(data), created.Size)
+	}
+	if !strings.HasPrefix(string(data), "SQLite format 3") {
+		t.Error("expected a SQLite database file")
+	}
+
+	resp = getAs(t, srv.URL+"/admin/backups/arturo.db", "emp-1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for non-backup file, got %d", resp.StatusCode)
+	}
+
+	resp = getAs(t, srv.URL+"/admin/backups", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without employee, got %d", resp.StatusCode)
+	}
+}
+
+func TestBackupEndpointsNotConfigured(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Store.CreateEmployee("emp-1", "Test User")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := postJSONAs(t, srv.URL+"/admin/backups", "emp-1", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", resp.StatusCode)
+	}
+}
+
+// --- Auth Tests ---
+
+// newAuthTestHandler returns a handler with authentication enabled and one
+// employee per role, each with PIN "<role>-pin".
+func newAuthTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, _ := newTestHandler(t)
+	h.Auth = auth.NewSigner(bytes.Repeat([]byte("k"), 32), time.Hour)
+	for _, role := range []string{"operator", "engineer", "admin"} {
+		id := "emp-" + role
+		h.Store.CreateEmployee(id, role+" user")
+		h.Store.SetEmployeeRole(id, role)
+		hash, err := auth.HashCredential(role + "-pin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Store.SetEmployeeCredential(id, hash)
+	}
+	return h
+}
+
+// doWithToken sends a JSON request with a bearer token.
+func doWithToken(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, url, r)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	return resp
+}
+
+func loginAs(t *testing.T, srvURL, id, password string) string {
+	t.Helper()
+	resp := doWithToken(t, http.MethodPost, srvURL+"/auth/login", "", loginRequest{EmployeeID: id, Password: password})
+	defer resp.Body.Close()
+	var body loginResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Token == "" {
+		t.Fatalf("login as %s: status %d, %+v", id, resp.StatusCode, body)
+	}
+	return body.Token
+}
+
+func TestLoginAndSession(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	token := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	resp := doWithToken(t, http.MethodGet, srv.URL+"/auth/session", token, nil)
+	var emp store.Employee
+	json.NewDecoder(resp.Body).Decode(&emp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || emp.ID != "emp-operator" || emp.Role != "operator" {
+		t.Errorf("unexpected session: %d %+v", resp.StatusCode, emp)
+	}
+
+	// The X-Employee-ID header is no longer trusted.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/auth/session", nil)
+	req.Header.Set("X-Employee-ID", "emp-admin")
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for header-only identity, got %d", resp.StatusCode)
+	}
+
+	for _, bad := range []loginRequest{
+		{EmployeeID: "emp-operator", Password: "wrong-pin"},
+		{EmployeeID: "emp-nobody", Password: "operator-pin"},
+	} {
+		resp := doWithToken(t, http.MethodPost, srv.URL+"/auth/login", "", bad)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", bad.EmployeeID, resp.StatusCode)
+		}
+	}
+	failures, _ := h.Store.QueryLoginFailures(time.Now().Add(-time.Minute))
+	if len(failures) != 2 || failures[0].Reason != "unknown employee" || failures[1].Reason != "bad credential" {
+		t.Errorf("expected two audited failures, got %+v", failures)
+	}
+
+	adminToken := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+	for token, want := range map[string]int{token: http.StatusForbidden, adminToken: http.StatusOK} {
+		resp := doWithToken(t, http.MethodGet, srv.URL+"/admin/login-failures", token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET /admin/login-failures: expected %d, got %d", want, resp.StatusCode)
+		}
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	h := newAuthTestHandler(t)
+	seedRegistry(h.Registry)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	operator := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	engineer := loginAs(t, srv.URL, "emp-engineer", "engineer-pin")
+	ota := otaRequest{Station: "nonexistent-station", FirmwareURL: "http://fw/fw.bin", Version: "1.1.0", SHA256: "abc"}
+	raw := stationCommandRequest{DeviceID: "nonexistent-device", Command: "*IDN?", Raw: true}
+	regen := stationCommandRequest{DeviceID: "nonexistent-device", Command: "start_regen"}
+	query := stationCommandRequest{DeviceID: "nonexistent-device", Command: "pump_status"}
+	batch := batchRequest{Commands: []batchCommandRequest{{DeviceID: "PUMP-01", Command: "pump_status"}, {DeviceID: "PUMP-01", Command: "set_regen_param"}}}
+
+	cases := []struct {
+		name         string
+		method, path string
+		token        string
+		body         interface{}
+		want         int
+	}{
+		{"no token", http.MethodPost, "/rmas", "", map[string]string{}, http.StatusUnauthorized},
+		{"bad token", http.MethodPost, "/rmas", "forged.token", map[string]string{}, http.StatusUnauthorized},
+		{"operator rma", http.MethodPost, "/rmas", operator, map[string]string{}, http.StatusBadRequest},
+		{"operator ota", http.MethodPost, "/ota", operator, ota, http.StatusForbidden},
+		{"engineer ota", http.MethodPost, "/ota", engineer, ota, http.StatusNotFound},
+		{"operator raw", http.MethodPost, "/stations/station-01/command", operator, raw, http.StatusForbidden},
+		{"engineer raw", http.MethodPost, "/stations/station-01/command", engineer, raw, http.StatusNotFound},
+		{"operator named command", http.MethodPost, "/stations/station-01/command", operator, regen, http.StatusForbidden},
+		{"operator device command", http.MethodPost, "/devices/nonexistent-device/command", operator, commandRequest{Command: "start_regen"}, http.StatusForbidden},
+		{"operator batch command", http.MethodPost, "/stations/station-01/batch", operator, batch, http.StatusForbidden},
+		{"operator query", http.MethodPost, "/stations/station-01/command", operator, query, http.StatusNotFound},
+		{"engineer named command", http.MethodPost, "/stations/station-01/command", engineer, regen, http.StatusNotFound},
+		{"operator script", http.MethodPost, "/scripts", operator, map[string]string{}, http.StatusForbidden},
+		{"engineer backups", http.MethodGet, "/admin/backups", engineer, nil, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		resp := doWithToken(t, c.method, srv.URL+c.path, c.token, c.body)
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, resp.StatusCode)
+		}
+	}
+
+	// Role changes apply to existing sessions.
+	h.Store.SetEmployeeRole("emp-operator", "engineer")
+	resp := doWithToken(t, http.MethodPost, srv.URL+"/ota", operator, ota)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected promoted operator to reach OTA, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadRoutesRequireAuth(t *testing.T) {
+	h := newAuthTestHandler(t)
+	seedRegistry(h.Registry)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	operator := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	paths := []string{
+		"/devices", "/stations", "/stations/station-01/state", "/stations/station-01/temperatures",
+		"/test-runs", "/test-runs/run-1/events", "/search?q=x", "/reports/run-1/json",
+		"/rmas", "/rmas/search?q=x", "/rmas/rma-1", "/rmas/rma-1/pdf", "/scripts", "/scripts/1",
+	}
+	for _, path := range paths {
+		resp := doWithToken(t, http.MethodGet, srv.URL+path, "", nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %s without a token: expected 401, got %d", path, resp.StatusCode)
+		}
+		resp = doWithToken(t, http.MethodGet, srv.URL+path, operator, nil)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			t.Errorf("GET %s as operator: got %d", path, resp.StatusCode)
+		}
+	}
+
+	// Downloads opened in a browser tab pass the token in the query string.
+	resp := doWithToken(t, http.MethodGet, srv.URL+"/stations/station-01/regen-curve.csv?token="+url.QueryEscape(operator), "", nil)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		t.Error("expected query-string token to authenticate a download")
+	}
+
+	// System status stays open for monitoring.
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/system/status", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /system/status without a token: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminPutEmployee(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+	admin := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+
+	resp := doWithToken(t, http.MethodPut, srv.URL+"/admin/employees/emp-new", admin,
+		employeeRequest{Name: "New Hire", Role: "engineer", Password: "2468"})
+	var emp store.Employee
+	json.NewDecoder(resp.Body).Decode(&emp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || emp.Name != "New Hire" || emp.Role != "engineer" {
+		t.Fatalf("unexpected employee: %d %+v", resp.StatusCode, emp)
+	}
+	loginAs(t, srv.URL, "emp-new", "2468")
+
+	for _, bad := range []employeeRequest{{Role: "root"}, {Password: "12"}, {Role: "admin"}} {
+		path := "/admin/employees/emp-new"
+		if bad.Role == "admin" {
+			path = "/admin/employees/emp-missing" // new employee without a name
+		}
+		resp := doWithToken(t, http.MethodPut, srv.URL+path, admin, bad)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%+v: expected 400, got %d", bad, resp.StatusCode)
+		}
+	}
+}
+
+// --- Scan Tests ---
+
+func postScan(t *testing.T, srvURL, token, payload string) (int, scanResponse) {
+	t.Helper()
+	resp := doWithToken(t, http.MethodPost, srvURL+"/scan", token, scanRequest{Payload: payload})
+	defer resp.Body.Close()
+	var body scanResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestScanBadgeLogin(t *testing.T) {
+	h := newAuthTestHandler(t)
+	h.Scanner, _ = scan.NewParser(scan.DefaultFormats())
+	h.Store.SetEmployeeBadgeHash("emp-operator", auth.HashBadge("4821"))
+	h.Store.SetEmployeeBadgeHash("emp-admin", auth.HashBadge("A77X"))
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	code, body := postScan(t, srv.URL, "", "EMP:4821\r\n")
+	if code != http.StatusOK || body.Kind != scan.KindBadge || body.Employee == nil || body.Employee.ID != "emp-operator" || body.Token == "" {
+		t.Fatalf("unexpected badge login: %d %+v", code, body)
+	}
+	if body.Fields != nil {
+		t.Errorf("badge code must not be echoed, got %v", body.Fields)
+	}
+	resp := doWithToken(t, http.MethodGet, srv.URL+"/auth/session", body.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected badge token to authenticate, got %d", resp.StatusCode)
+	}
+
+	if code, _ := postScan(t, srv.URL, "", "EMP:9999"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for unknown badge, got %d", code)
+	}
+	failures, _ := h.Store.QueryLoginFailures(time.Now().Add(-time.Minute))
+	if len(failures) != 1 || failures[0].Reason != "unknown badge" {
+		t.Errorf("expected unknown badge to be audited, got %+v", failures)
+	}
+	if code, _ := postScan(t, srv.URL, "", "~~~"); code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for unrecognised barcode, got %d", code)
+	}
+
+	// Badge sessions are capped at operator, and codes match in any case.
+	code, body = postScan(t, srv.URL, "", "emp:a77x")
+	if code != http.StatusOK || body.Employee == nil || body.Employee.ID != "emp-admin" || body.Employee.Role != "operator" {
+		t.Fatalf("expected operator-capped admin badge login, got %d %+v", code, body)
+	}
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/employees", body.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected admin badge session to be refused admin routes, got %d", resp.StatusCode)
+	}
+}
+
+func TestScanBadgeThrottled(t *testing.T) {
+	h := newAuthTestHandler(t)
+	h.Scanner, _ = scan.NewParser(scan.DefaultFormats())
+	h.Store.SetEmployeeBadgeHash("emp-operator", auth.HashBadge("4821"))
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	for i := 0; i < badgeFailureLimit; i++ {
+		if code, _ := postScan(t, srv.URL, "", fmt.Sprintf("EMP:%04d", i)); code != http.StatusUnauthorized {
+			t.Fatalf("scan %d: expected 401, got %d", i, code)
+		}
+	}
+	if code, _ := postScan(t, srv.URL, "", "EMP:4821"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after %d unknown badges, got %d", badgeFailureLimit, code)
+	}
+}
+
+func TestScanRMAAndWorkOrder(t *testing.T) {
+	h := newAuthTestHandler(t)
+	h.Scanner, _ = scan.NewParser(scan.DefaultFormats())
+	h.Store.CreateRMA("rma-1", "RMA-2024-001", "SN-AAA", "ACME Corp", "CT-8", "emp-operator", "")
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	code, body := postScan(t, srv.URL, "", "RMA-2024-001")
+	if code != http.StatusOK || body.RMA == nil || body.RMA.ID != "rma-1" {
+		t.Errorf("expected rma-1, got %d %+v", code, body)
+	}
+	if code, _ := postScan(t, srv.URL, "", "RMA-2024-404"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown RMA, got %d", code)
+	}
+	code, body = postScan(t, srv.URL, "", "SN:SN-AAA")
+	if code != http.StatusOK || body.Kind != scan.KindPumpSerial || len(body.RMAs) != 1 {
+		t.Errorf("expected one RMA for serial, got %d %+v", code, body)
+	}
+
+	label := "WO|RMA-2024-002|SN-BBB|CT-10|Beta Inc"
+	if code, _ := postScan(t, srv.URL, "", label); code != http.StatusUnauthorized {
+		t.Errorf("expected creating from a work order to need a login, got %d", code)
+	}
+	token := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	code, body = postScan(t, srv.URL, token, label)
+	if code != http.StatusCreated || !body.Created || body.RMA == nil || body.RMA.PumpModel != "CT-10" || body.RMA.EmployeeID != "emp-operator" {
+		t.Fatalf("expected created RMA, got %d %+v", code, body)
+	}
+	code, body = postScan(t, srv.URL, "", label)
+	if code != http.StatusOK || body.Created || body.RMA == nil || body.RMA.RMANumber != "RMA-2024-002" {
+		t.Errorf("expected rescan to open the existing RMA, got %d %+v", code, body)
+	}
+}
+
+func TestAuditLogRedactsCredentials(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	admin := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+	resp := doWithToken(t, http.MethodPut, srv.URL+"/admin/employees/emp-new", admin, map[string]string{
+		"name": "New Hire", "Password": "hunter22", "badge": "B7731"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	entries, _, err := h.Store.QueryAuditLog(store.AuditFilter{Endpoint: "PUT /admin/employees/{id}"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one audit entry, got %+v %v", entries, err)
+	}
+	params := entries[0].Params
+	if strings.Contains(params, "hunter22") || strings.Contains(params, "B7731") || !strings.Contains(params, "New Hire") {
+		t.Errorf("credentials not redacted: %s", params)
+	}
+}
+
+func TestAuditLogMiddleware(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	resp := doWithToken(t, http.MethodPost, srv.URL+"/auth/login", "", loginRequest{EmployeeID: "emp-operator", Password: "wrong"})
+	resp.Body.Close()
+	operator := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	admin := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+	resp = doWithToken(t, http.MethodPost, srv.URL+"/rmas", operator, createRMARequest{
+		RMANumber: "RMA-A1", PumpSerialNumber: "SN-1", CustomerName: "ACME", PumpModel: "CT-8"})
+	resp.Body.Close()
+	resp = doWithToken(t, http.MethodPost, srv.URL+"/ota", operator, map[string]string{})
+	resp.Body.Close()
+
+	// Reads are not audited, and only admins may read the log.
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/audit", operator, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for operator, got %d", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/audit", admin, nil)
+	var entries []store.AuditEntry
+	json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 audit entries, got %d: %+v", len(entries), entries)
+	}
+	failed, rma, ota := entries[0], entries[3], entries[4]
+	if failed.Endpoint != "POST /auth/login" || failed.Status != http.StatusUnauthorized || failed.EmployeeID != "" ||
+		failed.Result != "invalid employee ID or password" {
+		t.Errorf("unexpected failed login entry %+v", failed)
+	}
+	if strings.Contains(failed.Params, "wrong") || !strings.Contains(failed.Params, `"password":"[redacted]"`) {
+		t.Errorf("password not redacted: %s", failed.Params)
+	}
+	if entries[1].EmployeeID != "emp-operator" || entries[2].EmployeeID != "emp-admin" {
+		t.Errorf("logins not attributed: %q, %q", entries[1].EmployeeID, entries[2].EmployeeID)
+	}
+	if rma.EmployeeID != "emp-operator" || rma.Status != http.StatusCreated || !strings.Contains(rma.Params, "RMA-A1") {
+		t.Errorf("unexpected RMA entry %+v", rma)
+	}
+	if ota.Endpoint != "POST /ota" || ota.Status != http.StatusForbidden {
+		t.Errorf("expected denied OTA to be audited, got %+v", ota)
+	}
+
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/audit?employee=emp-operator&endpoint="+url.QueryEscape("POST /rmas"), admin, nil)
+	json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if len(entries) != 1 || entries[0].ID != rma.ID {
+		t.Errorf("expected filtered RMA entry, got %+v", entries)
+	}
+
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/audit/verify", admin, nil)
+	var verify auditVerifyResponse
+	json.NewDecoder(resp.Body).Decode(&verify)
+	resp.Body.Close()
+	if !verify.OK || verify.Entries != 5 {
+		t.Errorf("expected intact chain of 5, got %+v", verify)
+	}
+
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/admin/audit/export", admin, nil)
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || len(records) != 6 || records[0][0] != "id" || records[5][11] != ota.Hash {
+		t.Errorf("unexpected CSV export (%v): %v", err, records)
+	}
+}
+
+func TestSignTestRunAndCloseRMA(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	h.Store.CreateRMA("rma-1", "RMA-S1", "SN-1", "ACME", "CT-8", "emp-operator", "")
+	h.Store.CreateTestRunWithRMA("run-1", "regen.art", "rma-1", "station-01", "sha", "", "regen", "1.0")
+	h.Store.RecordTestEvent("run-1", "started", "emp-operator", "")
+	h.Store.FinishTestRun("run-1", "passed", "ok")
+	h.Store.CreateTestRunWithRMA("run-2", "cooldown.art", "rma-1", "station-02", "sha", "", "cooldown", "1.0")
+	h.Store.RecordTestEvent("run-2", "started", "emp-engineer", "")
+	h.Store.FinishTestRun("run-2", "failed", "too warm")
+
+	operator := loginAs(t, srv.URL, "emp-operator", "operator-pin")
+	engineer := loginAs(t, srv.URL, "emp-engineer", "engineer-pin")
+	admin := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+
+	sign := func(token, runID string, req signRequest) int {
+		t.Helper()
+		resp := doWithToken(t, http.MethodPost, srv.URL+"/test-runs/"+runID+"/signatures", token, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	closeRMA := func() int {
+		t.Helper()
+		resp := doWithToken(t, http.MethodPost, srv.URL+"/rmas/rma-1/close", operator, nil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := closeRMA(); code != http.StatusConflict {
+		t.Fatalf("expected close of unapproved RMA to fail with 409, got %d", code)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		runID string
+		req   signRequest
+		want  int
+	}{
+		{"operator", operator, "run-1", signRequest{Meaning: "approved", Password: "operator-pin"}, http.StatusForbidden},
+		{"wrong pin", engineer, "run-1", signRequest{Meaning: "approved", Password: "nope"}, http.StatusForbidden},
+		{"bad meaning", engineer, "run-1", signRequest{Meaning: "ok", Password: "engineer-pin"}, http.StatusBadRequest},
+		{"reject without reason", engineer, "run-1", signRequest{Meaning: "rejected", Password: "engineer-pin"}, http.StatusBadRequest},
+		{"own run", engineer, "run-2", signRequest{Meaning: "approved", Password: "engineer-pin"}, http.StatusForbidden},
+		{"unknown run", engineer, "run-9", signRequest{Meaning: "approved", Password: "engineer-pin"}, http.StatusNotFound},
+		{"approve", engineer, "run-1", signRequest{Meaning: "approved", Password: "engineer-pin"}, http.StatusCreated},
+		{"reject", admin, "run-2", signRequest{Meaning: "rejected", Reason: "second stage too warm", Password: "admin-pin"}, http.StatusCreated},
+	}
+	for _, c := range cases {
+		if code := sign(c.token, c.runID, c.req); code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, code)
+		}
+	}
+
+	resp := doWithToken(t, http.MethodGet, srv.URL+"/rmas/rma-1", operator, nil)
+	var detail struct {
+		Reviews map[string]string `json:"reviews"`
+	}
+	json.NewDecoder(resp.Body).Decode(&detail)
+	resp.Body.Close()
+	if detail.Reviews["run-1"] != "approved" || detail.Reviews["run-2"] != "rejected" {
+		t.Errorf("unexpected reviews %v", detail.Reviews)
+	}
+
+	if code := closeRMA(); code != http.StatusConflict {
+		t.Fatalf("expected close with a rejected run to fail with 409, got %d", code)
+	}
+	if code := sign(admin, "run-2", signRequest{Meaning: "approved", Reason: "failure confirmed, pump scrapped", Password: "admin-pin"}); code != http.StatusCreated {
+		t.Fatalf("expected approval of run-2, got %d", code)
+	}
+
+	// A later review of an approved run does not withdraw the approval.
+	if code := sign(admin, "run-1", signRequest{Meaning: "reviewed", Password: "admin-pin"}); code != http.StatusCreated {
+		t.Fatalf("expected review of run-1, got %d", code)
+	}
+
+	resp = doWithToken(t, http.MethodGet, srv.URL+"/test-runs/run-2/review", operator, nil)
+	var review artifact.ArtifactReview
+	json.NewDecoder(resp.Body).Decode(&review)
+	resp.Body.Close()
+	if review.Status != "approved" || len(review.Signatures) != 2 || review.Signatures[1].ContentHash != review.ContentHash {
+		t.Errorf("unexpected review %+v", review)
+	}
+
+	if code := closeRMA(); code != http.StatusOK {
+		t.Errorf("expected close of approved RMA to succeed, got %d", code)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	h := newAuthTestHandler(t)
+	srv := newTestServer(t, h)
+	defer srv.Close()
+
+	admin := loginAs(t, srv.URL, "emp-admin", "admin-pin")
+	engineer := loginAs(t, srv.URL, "emp-engineer", "engineer-pin")
+
+	create := func(token string, req apiKeyRequest) (int, apiKeyResponse) {
+		t.Helper()
+		resp := doWithToken(t, http.MethodPost, srv.URL+"/admin/api-keys", token, req)
+		defer resp.Body.Close()
+		var body apiKeyResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	if code, _ := create(engineer, apiKeyRequest{Name: "mes", EmployeeID: "emp-engineer", Scopes: "read"}); code != http.StatusForbidden {
+		t.Errorf("engineer creating a key: expected 403, got %d", code)
+	}
+	if code, _ := create(admin, apiKeyRequest{Name: "mes", EmployeeID: "emp-engineer", Scopes: "everything"}); code != http.StatusBadRequest {
+		t.Errorf("unknown scope: expected 400, got %d", code)
+	}
+	if code, _ := create(admin, apiKeyRequest{Name: "mes", EmployeeID: "emp-nobody", Scopes: "read"}); code != http.StatusBadRequest {
+		t.Errorf("unknown employee: expected 400, got %d", code)
+	}
+	code, created := create(admin, apiKeyRequest{Name: "mes", EmployeeID: "emp-engineer", Scopes: "read,admin"})
+	if code != http.StatusCreated || !auth.IsAPIKey(created.Key) || created.APIKey == nil {
+		t.Fatalf("create key: status %d, %+v", code, created)
+	}
+	key := created.Key
+
+	status := func(method, path, token string, body interface{}) int {
+		t.Helper()
+		resp := doWithToken(t, method, srv.URL+path, token, body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"read scope", http.MethodGet, "/auth/session", key, http.StatusOK},
+		{"read scope data", http.MethodGet, "/rmas", key, http.StatusOK},
+		{"missing scope", http.MethodPost, "/rmas", key, http.StatusForbidden},
+		// The key's scopes include admin but it acts as an engineer.
+		{"role still applies", http.MethodGet, "/admin/audit", key, http.StatusForbidden},
+		{"signatures need a person", http.MethodPost, "/test-runs/run-1/signatures", key, http.StatusForbidden},
+		{"wrong secret", http.MethodGet, "/auth/session", key + "x", http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/auth/session", "ak_000000000000_secret", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		if code := status(c.method, c.path, c.token, nil); code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, code)
+		}
+	}
+
+	resp := doWithToken(t, http.MethodGet, srv.URL+"/admin/api-keys", admin, nil)
+	var keys []store.APIKey
+	json.NewDecoder(resp.Body).Decode(&keys)
+	resp.Body.Close()
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("expected one used key, got %+v", keys)
+	}
+
+	// WebSocket upgrades take the key from the query string.
+	for token, wantOK := range map[string]bool{key: true, "": false, "bogus": false} {
+		req := httptest.NewRequest(http.MethodGet, "/ws?token="+url.QueryEscape(token), nil)
+		req.Pattern = "GET /ws"
+		if err := h.AuthenticateWebSocket(req); (err == nil) != wantOK {
+			t.Errorf("AuthenticateWebSocket(%q) = %v, want ok=%v", token, err, wantOK)
+		}
+	}
+
+	if code := status(http.MethodDelete, "/admin/api-keys/"+created.APIKey.ID, admin, nil); code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", code)
+	}
+	if code := status(http.MethodGet, "/auth/session", key, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: expected 401, got %d", code)
+	}
+	if code := status(http.MethodDelete, "/admin/api-keys/nope", admin, nil); code != http.StatusNotFound {
+		t.Errorf("revoke unknown key: expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/scan"
+	"github.com/holla2040/arturo/internal/store"
+)
+
+// scanRequest is the JSON body for POST /scan.
+type scanRequest struct {
+	Payload string `json:"payload"`
+}
+
+// scanResponse is the response for POST /scan. Which of the optional
+// fields are set depends on Kind.
+type scanResponse struct {
+	scan.Result
+	Token     string          `json:"token,omitempty"`      // badge
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"` // badge
+	Employee  *store.Employee `json:"employee,omitempty"`   // badge
+	RMA       *store.RMA      `json:"rma,omitempty"`        // rma, work_order
+	RMAs      []store.RMA     `json:"rmas,omitempty"`       // pump_serial
+	Created   bool            `json:"created,omitempty"`    // work_order
+}
+
+// handleScan takes a raw barcode scanner payload and acts on what it is:
+// a badge logs the employee in (like POST /auth/login), an RMA number or
+// pump serial resolves to RMAs, and a work-order label opens its RMA,
+// creating it for the logged-in operator if it does not exist yet.
+func (h *Handler) handleScan(w http.ResponseWriter, r *http.Request) {
+	if h.Scanner == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "scan input not configured"})
+		return
+	}
+	var req scanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	res := scanResponse{Result: h.Scanner.Parse(req.Payload)}
+	switch res.Kind {
+	case scan.KindBadge:
+		h.scanBadge(w, r, res)
+	case scan.KindRMA:
+		rma, err := h.Store.GetRMAByNumber(res.Fields["rma"])
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get RMA"})
+			return
+		}
+		if rma == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "RMA " + res.Fields["rma"] + " not found"})
+			return
+		}
+		res.RMA = rma
+		writeJSON(w, http.StatusOK, res)
+	case scan.KindPumpSerial:
+		rmas, _, err := h.Store.ListRMAsPage(store.RMAFilter{PumpSerial: res.Fields["serial"]})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list RMAs"})
+			return
+		}
+		res.RMAs = rmas
+		writeJSON(w, http.StatusOK, res)
+	case scan.KindWorkOrder:
+		h.scanWorkOrder(w, r, res)
+	default:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": "unrecognised barcode"})
+	}
+}
+
+// Badge codes are short, so a client that scans too many unknown badges is
+// refused until its older failures age out of the window.
+const (
+	badgeFailureLimit  = 5
+	badgeFailureWindow = 5 * time.Minute
+	badgeFailureReason = "unknown badge"
+)
+
+// scanBadge logs in the employee holding a badge. A badge alone is
+// something you have, not something you know, so the session it issues is
+// capped at the operator role; engineers and admins log in with their PIN
+// or password for more.
+func (h *Handler) scanBadge(w http.ResponseWriter, r *http.Request, res scanResponse) {
+	addr := remoteHost(r)
+	failures, err := h.Store.CountLoginFailures(addr, badgeFailureReason, time.Now().Add(-badgeFailureWindow))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to check login failures"})
+		return
+	}
+	if failures >= badgeFailureLimit {
+		log.Printf("auth: badge scan from %s refused after %d unknown badges", addr, failures)
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many unknown badges; try again later"})
+		return
+	}
+
+	emp, err := h.Store.GetEmployeeByBadgeHash(auth.HashBadge(res.Fields["badge"]))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	if emp == nil {
+		log.Printf("auth: unknown badge scanned from %s", addr)
+		if err := h.Store.RecordLoginFailure("", addr, badgeFailureReason); err != nil {
+			log.Printf("auth: failed to record login failure: %v", err)
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unknown badge"})
+		return
+	}
+
+	res.Fields = nil // the badge code is a credential; don't echo it
+	setAuditEmployee(r, emp.ID)
+	if h.Auth != nil {
+		token, exp := h.Auth.IssueCapped(emp.ID, auth.RoleOperator)
+		res.Token, res.ExpiresAt = token, &exp
+		emp.Role = string(auth.Role(emp.Role).Cap(auth.RoleOperator))
+	}
+	res.Employee = emp
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *Handler) scanWorkOrder(w http.ResponseWriter, r *http.Request, res scanResponse) {
+	f := res.Fields
+	rma, err := h.Store.GetRMAByNumber(f["rma"])
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get RMA"})
+		return
+	}
+	if rma != nil {
+		res.RMA = rma
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	emp, ok := requireEmployee(h, w, r)
+	if !ok {
+		return
+	}
+	if f["customer"] == "" || f["model"] == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "work-order label has no customer or pump model; create the RMA by hand"})
+		return
+	}
+	id := uuid.New().String()
+	notes := "Created from work-order scan"
+	if err := h.Store.CreateRMA(id, f["rma"], f["serial"], f["customer"], f["model"], emp.ID, notes); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("failed to create RMA: %v", err)})
+		return
+	}
+	rma, err = h.Store.GetRMA(id)
+	if err != nil || rma == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to retrieve created RMA"})
+		return
+	}
+	res.RMA, res.Created = rma, true
+	writeJSON(w, http.StatusCreated, res)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/holla2040/arturo/internal/artifact"
+	"github.com/holla2040/arturo/internal/auth"
+	"github.com/holla2040/arturo/internal/store"
+)
+
+// signRequest is the JSON body for POST /test-runs/{id}/signatures. The
+// signer re-enters their PIN or password to sign.
+type signRequest struct {
+	Meaning  string `json:"meaning"`
+	Reason   string `json:"reason"`
+	Password string `json:"password"`
+}
+
+// signTestRun records an engineer's electronic signature on a finished
+// test run. The signature binds the signer, its meaning, the time, and a
+// hash of the run's results. The operator who ran the test cannot sign it.
+func (h *Handler) signTestRun(w http.ResponseWriter, r *http.Request) {
+	emp, ok := requireRole(h, w, r, auth.RoleEngineer)
+	if !ok {
+		return
+	}
+	// Signatures are quality records: the role applies even with
+	// authentication disabled.
+	if !auth.Role(emp.Role).Allows(auth.RoleEngineer) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "engineer role required"})
+		return
+	}
+
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if !store.ValidSignatureMeaning(req.Meaning) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "meaning must be reviewed, approved, or rejected"})
+		return
+	}
+	if req.Meaning == store.SignatureRejected && req.Reason == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a rejection needs a reason"})
+		return
+	}
+
+	hash, err := h.Store.GetEmployeeCredential(emp.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get employee"})
+		return
+	}
+	if !auth.CheckCredential(hash, req.Password) {
+		addr := remoteHost(r)
+		log.Printf("auth: failed signature credential for %q from %s", emp.ID, addr)
+		if err := h.Store.RecordLoginFailure(emp.ID, addr, "bad signature credential"); err != nil {
+			log.Printf("auth: failed to record login failure: %v", err)
+		}
+		// 403, not 401: the session itself is still valid.
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "incorrect PIN or password; signature not recorded"})
+		return
+	}
+
+	runID := r.PathValue("id")
+	run, err := h.Store.GetTestRun(runID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get test run"})
+		return
+	}
+	if run == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "test run not found"})
+		return
+	}
+	if run.Status == "running" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "test run has not finished"})
+		return
+	}
+
+	events, err := h.Store.QueryTestEvents(runID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to query test events"})
+		return
+	}
+	for _, e := range events {
+		if e.EventType == "started" && e.EmployeeID == emp.ID {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "a test run must be signed by someone other than its operator"})
+			return
+		}
+	}
+
+	review, err := artifact.RunReview(h.Store, runID)
+	if err != nil || review == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to hash test run"})
+		return
+	}
+	sig, err := h.Store.RecordRunSignature(runID, emp.ID, req.Meaning, req.Reason, review.ContentHash)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to record signature"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, sig)
+}
+
+// getTestRunReview returns a test run's review state and signatures.
+func (h *Handler) getTestRunReview(w http.ResponseWriter, r *http.Request) {
+	review, err := artifact.RunReview(h.Store, r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get review"})
+		return
+	}
+	if review == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "test run not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, review)
+}
+
+// unapprovedRuns returns the IDs of the RMA's test runs whose current
+// results are not approved.
+func (h *Handler) unapprovedRuns(rmaID string) ([]string, error) {
+	statuses, err := artifact.RMAReviewStatuses(h.Store, rmaID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id, status := range statuses {
+		if status != artifact.ReviewApproved {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
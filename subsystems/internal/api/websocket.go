@@ -25,6 +25,10 @@ type Hub struct {
 	registerCh   chan *Client
 	unregisterCh chan *Client
 	broadcastCh  chan []byte
+
+	// Authenticate checks a connection before it is upgraded. nil means
+	// connections are not authenticated.
+	Authenticate func(r *http.Request) error
 }
 
 // Client wraps a single WebSocket connection.
@@ -114,6 +118,13 @@ func (h *Hub) ClientCount() int {
 
 // HandleWebSocket is an HTTP handler that upgrades to WebSocket.
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.Authenticate != nil {
+		if err := h.Authenticate(r); err != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: true, // Allow all origins for LAN use
 	})
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -208,3 +209,34 @@ func TestBroadcastEventMarshal(t *testing.T) {
 		t.Errorf("expected active=true, got %v", p["active"])
 	}
 }
+
+func TestHubAuthenticate(t *testing.T) {
+	hub := NewHub()
+	hub.Authenticate = func(r *http.Request) error {
+		if r.URL.Query().Get("token") != "good" {
+			return errors.New("invalid session")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc(hub.HandleWebSocket))
+	defer srv.Close()
+	wsURL := "ws" + srv.URL[4:]
+
+	_, resp, err := websocket.Dial(ctx, wsURL+"?token=bad", nil)
+	if err == nil {
+		t.Fatal("expected dial with a bad token to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 before upgrade, got %v", resp)
+	}
+
+	conn, _, err := websocket.Dial(ctx, wsURL+"?token=good", nil)
+	if err != nil {
+		t.Fatalf("dial with a good token failed: %v", err)
+	}
+	conn.Close(websocket.StatusNormalClosure, "")
+}
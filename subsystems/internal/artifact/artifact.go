@@ -44,6 +44,7 @@ type ArtifactRun struct {
 	Events        []ArtifactEvent     `json:"events,omitempty"`
 	Temperatures  []ArtifactTemp      `json:"temperatures,omitempty"`
 	Measurements  []ArtifactMeasure   `json:"measurements,omitempty"`
+	Review        *ArtifactReview     `json:"review,omitempty"`
 }
 
 // ArtifactEvent is a test lifecycle event.
@@ -72,7 +73,7 @@ type ArtifactMeasure struct {
 }
 
 // Generate builds a TestArtifact from the store for the given RMA ID.
-func Generate(st *store.Store, rmaID string) (*TestArtifact, error) {
+func Generate(st store.Store, rmaID string) (*TestArtifact, error) {
 	rma, err := st.GetRMA(rmaID)
 	if err != nil {
 		return nil, err
@@ -99,74 +100,13 @@ func Generate(st *store.Store, rmaID string) (*TestArtifact, error) {
 
 	artifactRuns := make([]ArtifactRun, 0, len(runs))
 	for _, run := range runs {
-		ar := ArtifactRun{
-			RunID:      run.ID,
-			ScriptName: run.ScriptName,
-			StartedAt:  run.StartedAt,
-			FinishedAt: run.FinishedAt,
-			Status:     run.Status,
-			Summary:    run.Summary,
+		ar, err := buildRun(st, run)
+		if err != nil {
+			return nil, err
 		}
-		if run.ScriptSHA256 != nil {
-			ar.ScriptSHA256 = *run.ScriptSHA256
+		if err := addReview(st, &ar); err != nil {
+			return nil, err
 		}
-		if run.ReportType != nil {
-			ar.ReportType = *run.ReportType
-		}
-		if run.ReportVersion != nil {
-			ar.ReportVersion = *run.ReportVersion
-		}
-
-		// Events
-		events, err := st.QueryTestEvents(run.ID)
-		if err == nil {
-			for _, e := range events {
-				ar.Events = append(ar.Events, ArtifactEvent{
-					Type:       e.EventType,
-					EmployeeID: e.EmployeeID,
-					Reason:     e.Reason,
-					Timestamp:  e.Timestamp,
-				})
-			}
-		}
-
-		// Employee name from "started" event
-		for _, e := range ar.Events {
-			if e.Type == "started" && e.EmployeeID != "" {
-				if emp, err := st.GetEmployee(e.EmployeeID); err == nil && emp != nil {
-					ar.EmployeeName = emp.Name
-				}
-				break
-			}
-		}
-
-		// Temperatures
-		temps, err := st.QueryTemperatures(run.ID)
-		if err == nil {
-			for _, t := range temps {
-				ar.Temperatures = append(ar.Temperatures, ArtifactTemp{
-					Stage:        t.Stage,
-					TemperatureK: t.TemperatureK,
-					Timestamp:    t.Timestamp,
-				})
-			}
-		}
-
-		// Measurements
-		measurements, err := st.QueryMeasurements(run.ID)
-		if err == nil {
-			for _, m := range measurements {
-				ar.Measurements = append(ar.Measurements, ArtifactMeasure{
-					DeviceID:    m.DeviceID,
-					CommandName: m.CommandName,
-					Success:     m.Success,
-					Response:    m.Response,
-					DurationMs:  m.DurationMs,
-					Timestamp:   m.Timestamp,
-				})
-			}
-		}
-
 		artifactRuns = append(artifactRuns, ar)
 	}
 
@@ -186,10 +126,90 @@ func Generate(st *store.Store, rmaID string) (*TestArtifact, error) {
 	return artifact, nil
 }
 
+// buildRun collects a test run's report data.
+func buildRun(st store.Store, run store.TestRun) (ArtifactRun, error) {
+	ar := ArtifactRun{
+		RunID:      run.ID,
+		ScriptName: run.ScriptName,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Status:     run.Status,
+		Summary:    run.Summary,
+	}
+	if run.ScriptSHA256 != nil {
+		ar.ScriptSHA256 = *run.ScriptSHA256
+	}
+	if run.ReportType != nil {
+		ar.ReportType = *run.ReportType
+	}
+	if run.ReportVersion != nil {
+		ar.ReportVersion = *run.ReportVersion
+	}
+
+	// Events
+	events, err := st.QueryTestEvents(run.ID)
+	if err != nil {
+		return ar, err
+	}
+	for _, e := range events {
+		ar.Events = append(ar.Events, ArtifactEvent{
+			Type:       e.EventType,
+			EmployeeID: e.EmployeeID,
+			Reason:     e.Reason,
+			Timestamp:  e.Timestamp,
+		})
+	}
+
+	// Employee name from "started" event
+	for _, e := range ar.Events {
+		if e.Type == "started" && e.EmployeeID != "" {
+			emp, err := st.GetEmployee(e.EmployeeID)
+			if err != nil {
+				return ar, err
+			}
+			if emp != nil {
+				ar.EmployeeName = emp.Name
+			}
+			break
+		}
+	}
+
+	// Temperatures
+	temps, err := st.QueryTemperatures(run.ID)
+	if err != nil {
+		return ar, err
+	}
+	for _, t := range temps {
+		ar.Temperatures = append(ar.Temperatures, ArtifactTemp{
+			Stage:        t.Stage,
+			TemperatureK: t.TemperatureK,
+			Timestamp:    t.Timestamp,
+		})
+	}
+
+	// Measurements
+	measurements, err := st.QueryMeasurements(run.ID)
+	if err != nil {
+		return ar, err
+	}
+	for _, m := range measurements {
+		ar.Measurements = append(ar.Measurements, ArtifactMeasure{
+			DeviceID:    m.DeviceID,
+			CommandName: m.CommandName,
+			Success:     m.Success,
+			Response:    m.Response,
+			DurationMs:  m.DurationMs,
+			Timestamp:   m.Timestamp,
+		})
+	}
+
+	return ar, nil
+}
+
 // GenerateFiltered builds a TestArtifact and filters runs to only those in runIDs.
 // If runIDs is nil, all runs are included (no filter).
 // If runIDs is non-nil (even empty), only matching runs are included.
-func GenerateFiltered(st *store.Store, rmaID string, runIDs []string) (*TestArtifact, error) {
+func GenerateFiltered(st store.Store, rmaID string, runIDs []string) (*TestArtifact, error) {
 	artifact, err := Generate(st, rmaID)
 	if err != nil || artifact == nil || runIDs == nil {
 		return artifact, err
@@ -211,7 +231,7 @@ func GenerateFiltered(st *store.Store, rmaID string, runIDs []string) (*TestArti
 }
 
 // GenerateJSON writes the JSON artifact to the given writer.
-func GenerateJSON(w io.Writer, st *store.Store, rmaID string) error {
+func GenerateJSON(w io.Writer, st store.Store, rmaID string) error {
 	artifact, err := Generate(st, rmaID)
 	if err != nil {
 		return err
@@ -226,7 +246,7 @@ func GenerateJSON(w io.Writer, st *store.Store, rmaID string) error {
 }
 
 // GenerateFilteredJSON writes a JSON artifact containing only the specified runs.
-func GenerateFilteredJSON(w io.Writer, st *store.Store, rmaID string, runIDs []string) error {
+func GenerateFilteredJSON(w io.Writer, st store.Store, rmaID string, runIDs []string) error {
 	artifact, err := GenerateFiltered(st, rmaID, runIDs)
 	if err != nil {
 		return err
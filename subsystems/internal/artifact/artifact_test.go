@@ -3,6 +3,7 @@ package artifact
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -11,7 +12,7 @@ import (
 	"github.com/holla2040/arturo/internal/store"
 )
 
-func newTestStore(t *testing.T) *store.Store {
+func newTestStore(t *testing.T) store.Store {
 	t.Helper()
 	s, err := store.New(":memory:")
 	if err != nil {
@@ -21,7 +22,7 @@ func newTestStore(t *testing.T) *store.Store {
 	return s
 }
 
-func setupTestData(t *testing.T, st *store.Store) {
+func setupTestData(t *testing.T, st store.Store) {
 	t.Helper()
 
 	st.CreateEmployee("emp-1", "John Doe")
@@ -118,7 +119,7 @@ func TestGeneratePDF(t *testing.T) {
 	}
 }
 
-func setupRegenTestData(t *testing.T, st *store.Store) {
+func setupRegenTestData(t *testing.T, st store.Store) {
 	t.Helper()
 
 	st.CreateEmployee("emp-1", "John Doe")
@@ -198,3 +199,118 @@ func TestGenerateNotFound(t *testing.T) {
 		t.Error("expected nil artifact for nonexistent RMA")
 	}
 }
+
+func TestRunReview(t *testing.T) {
+	st := newTestStore(t)
+	setupTestData(t, st)
+	st.CreateEmployee("emp-2", "Eve Engineer")
+
+	review, err := RunReview(st, "run-1")
+	if err != nil || review == nil {
+		t.Fatalf("RunReview failed: %v", err)
+	}
+	if review.Status != ReviewPending || len(review.ContentHash) != 64 {
+		t.Errorf("expected pending review with a hash, got %+v", review)
+	}
+	if r, _ := RunReview(st, "missing"); r != nil {
+		t.Errorf("expected nil review for unknown run, got %+v", r)
+	}
+
+	st.RecordRunSignature("run-1", "emp-2", store.SignatureApproved, "", review.ContentHash)
+	artifact, err := Generate(st, "rma-1")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	got := artifact.Runs[0].Review
+	if got.Status != ReviewApproved || len(got.Signatures) != 1 || got.Signatures[0].EmployeeName != "Eve Engineer" {
+		t.Errorf("expected approved review, got %+v", got)
+	}
+	var buf bytes.Buffer
+	if err := GeneratePDF(&buf, st, "rma-1"); err != nil || buf.Len() == 0 {
+		t.Errorf("GeneratePDF with signatures failed: %v", err)
+	}
+
+	// A later "reviewed" signature does not downgrade the approval.
+	st.RecordRunSignature("run-1", "emp-1", store.SignatureReviewed, "", review.ContentHash)
+	if r, _ := RunReview(st, "run-1"); r.Status != ReviewApproved {
+		t.Errorf("expected approval to stand after a review, got %q", r.Status)
+	}
+
+	// Results recorded after the approval invalidate it.
+	st.RecordTemperature("run-1", "station-01", "PUMP-01", "first_stage", 90)
+	review, _ = RunReview(st, "run-1")
+	if review.Status != ReviewChanged {
+		t.Errorf("expected changed review after new data, got %q", review.Status)
+	}
+}
+
+func TestSignedStatus(t *testing.T) {
+	sig := func(meaning, hash string) store.RunSignature {
+		return store.RunSignature{Meaning: meaning, ContentHash: hash}
+	}
+	cases := []struct {
+		name string
+		sigs []store.RunSignature
+		want string
+	}{
+		{"unsigned", nil, ReviewPending},
+		{"reviewed", []store.RunSignature{sig("reviewed", "h1")}, ReviewReviewed},
+		{"approved then reviewed", []store.RunSignature{sig("approved", "h1"), sig("reviewed", "h1")}, ReviewApproved},
+		{"rejected then approved", []store.RunSignature{sig("rejected", "h1"), sig("approved", "h1")}, ReviewApproved},
+		{"approved then rejected", []store.RunSignature{sig("approved", "h1"), sig("rejected", "h1")}, ReviewRejected},
+		{"approved old content", []store.RunSignature{sig("approved", "h0")}, ReviewChanged},
+		{"reviewed after change", []store.RunSignature{sig("approved", "h0"), sig("reviewed", "h1")}, ReviewReviewed},
+	}
+	for _, c := range cases {
+		if got := signedStatus(c.sigs, "h1"); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRMAReviewStatuses(t *testing.T) {
+	st := newTestStore(t)
+	setupTestData(t, st)
+	st.CreateTestRunWithRMA("run-2", "cooldown.art", "rma-1", "station-02", "abc123def", "", "cooldown", "1.0")
+	st.FinishTestRun("run-2", "passed", "")
+
+	review, _ := RunReview(st, "run-1")
+	st.RecordRunSignature("run-1", "emp-1", store.SignatureApproved, "", review.ContentHash)
+
+	statuses, err := RMAReviewStatuses(st, "rma-1")
+	if err != nil {
+		t.Fatalf("RMAReviewStatuses failed: %v", err)
+	}
+	if len(statuses) != 2 || statuses["run-1"] != ReviewApproved || statuses["run-2"] != ReviewPending {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+
+	// Only signed runs have their results read.
+	if _, err := RMAReviewStatuses(failingTemps{st}, "rma-1"); err == nil {
+		t.Error("expected query error for the signed run")
+	}
+	st.RecordTemperature("run-1", "station-01", "PUMP-01", "first_stage", 90)
+	if statuses, _ := RMAReviewStatuses(st, "rma-1"); statuses["run-1"] != ReviewChanged {
+		t.Errorf("expected changed run-1, got %v", statuses)
+	}
+}
+
+// failingTemps is a store whose temperature query fails.
+type failingTemps struct{ store.Store }
+
+func (failingTemps) QueryTemperatures(string) ([]store.TemperatureSample, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestRunReviewQueryError(t *testing.T) {
+	st := newTestStore(t)
+	setupTestData(t, st)
+
+	// A failed query must not be reported as changed run content.
+	if review, err := RunReview(failingTemps{st}, "run-1"); err == nil {
+		t.Errorf("expected query error, got review %+v", review)
+	}
+	if _, err := Generate(failingTemps{st}, "rma-1"); err == nil {
+		t.Error("expected Generate to return the query error")
+	}
+}
@@ -15,7 +15,7 @@ import (
 // from the station poller's temperature_log and pump_status_log over the
 // run's [StartedAt, FinishedAt] window. Script events are NOT the data
 // source: telemetry is owned by the poller per ARCHITECTURE.md §2.8.
-func ExportRunCSV(w io.Writer, st *store.Store, rmaID, runID string) error {
+func ExportRunCSV(w io.Writer, st store.Store, rmaID, runID string) error {
 	rma, err := st.GetRMA(rmaID)
 	if err != nil {
 		return fmt.Errorf("get RMA: %w", err)
@@ -425,7 +425,7 @@ func init() {
 }
 
 // GenerateFilteredPDF creates a PDF report containing only the specified runs.
-func GenerateFilteredPDF(w io.Writer, st *store.Store, rmaID string, runIDs []string) error {
+func GenerateFilteredPDF(w io.Writer, st store.Store, rmaID string, runIDs []string) error {
 	artifact, err := GenerateFiltered(st, rmaID, runIDs)
 	if err != nil {
 		return fmt.Errorf("generate artifact: %w", err)
@@ -434,7 +434,7 @@ func GenerateFilteredPDF(w io.Writer, st *store.Store, rmaID string, runIDs []st
 }
 
 // GeneratePDF creates a customer-facing PDF report for the given RMA.
-func GeneratePDF(w io.Writer, st *store.Store, rmaID string) error {
+func GeneratePDF(w io.Writer, st store.Store, rmaID string) error {
 	artifact, err := Generate(st, rmaID)
 	if err != nil {
 		return fmt.Errorf("generate artifact: %w", err)
@@ -524,19 +524,21 @@ func renderPDF(w io.Writer, artifact *TestArtifact) error {
 		// Table header
 		pdf.SetFont("Arial", "B", 9)
 		pdf.SetFillColor(220, 220, 220)
-		pdf.CellFormat(45, 7, "Test", "1", 0, "L", true, 0, "")
-		pdf.CellFormat(40, 7, "Test ID", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(40, 7, "Test", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(35, 7, "Test ID", "1", 0, "L", true, 0, "")
 		pdf.CellFormat(30, 7, "Started", "1", 0, "L", true, 0, "")
 		pdf.CellFormat(20, 7, "Status", "1", 0, "C", true, 0, "")
+		pdf.CellFormat(20, 7, "Review", "1", 0, "C", true, 0, "")
 		pdf.CellFormat(0, 7, "Technician", "1", 1, "L", true, 0, "")
 
 		// Table rows
 		pdf.SetFont("Arial", "", 9)
 		for _, run := range artifact.Runs {
-			pdf.CellFormat(45, 7, truncate(run.ScriptName, 24), "1", 0, "L", false, 0, "")
-			pdf.CellFormat(40, 7, truncate(run.RunID, 22), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(40, 7, truncate(run.ScriptName, 22), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(35, 7, truncate(run.RunID, 19), "1", 0, "L", false, 0, "")
 			pdf.CellFormat(30, 7, run.StartedAt.In(denverTZ).Format("2006-01-02 15:04"), "1", 0, "L", false, 0, "")
 			pdf.CellFormat(20, 7, run.Status, "1", 0, "C", false, 0, "")
+			pdf.CellFormat(20, 7, reviewStatus(run), "1", 0, "C", false, 0, "")
 			pdf.CellFormat(0, 7, run.EmployeeName, "1", 1, "L", false, 0, "")
 		}
 	}
@@ -569,6 +571,7 @@ func renderPDF(w io.Writer, artifact *TestArtifact) error {
 			pdf.SetFont("Arial", "", 10)
 			pdf.CellFormat(0, 4.5, item.value, "", 1, "L", false, 0, "")
 		}
+		renderSignatures(pdf, run)
 
 		if run.ReportType == "regen" {
 			renderRegenPlotRotated(pdf, run, i)
@@ -642,6 +645,61 @@ func renderPDF(w io.Writer, artifact *TestArtifact) error {
 	return pdf.Output(w)
 }
 
+// reviewStatus returns the run's review state for display.
+func reviewStatus(run ArtifactRun) string {
+	if run.Review == nil {
+		return ReviewPending
+	}
+	return run.Review.Status
+}
+
+// renderSignatures writes the run's review state, content hash, and
+// electronic signatures.
+func renderSignatures(pdf *fpdf.Fpdf, run ArtifactRun) {
+	if run.Review == nil {
+		return
+	}
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(25, 4.5, "Review:", "", 0, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.CellFormat(0, 4.5, run.Review.Status, "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(25, 4.5, "SHA-256:", "", 0, "L", false, 0, "")
+	pdf.SetFont("Courier", "", 8)
+	pdf.CellFormat(0, 4.5, run.Review.ContentHash, "", 1, "L", false, 0, "")
+	if len(run.Review.Signatures) == 0 {
+		pdf.Ln(2)
+		return
+	}
+
+	pdf.Ln(2)
+	pdf.SetFont("Arial", "B", 8)
+	pdf.SetFillColor(220, 220, 220)
+	pdf.CellFormat(20, 6, "Meaning", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(45, 6, "Signed By", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(35, 6, "Time", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(25, 6, "Hash", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(0, 6, "Reason", "1", 1, "L", true, 0, "")
+
+	pdf.SetFont("Arial", "", 8)
+	for _, sig := range run.Review.Signatures {
+		signer := sig.EmployeeID
+		if sig.EmployeeName != "" {
+			signer = sig.EmployeeName + " (" + sig.EmployeeID + ")"
+		}
+		hash := sig.ContentHash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		pdf.CellFormat(20, 6, sig.Meaning, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(45, 6, truncate(signer, 28), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(35, 6, sig.Timestamp.In(denverTZ).Format("2006-01-02 15:04:05"), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(25, 6, hash, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, truncate(sig.Reason, 40), "1", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -20,7 +20,7 @@ import (
 // known reading for that column.
 func ExportStationRegenCurve(
 	w io.Writer,
-	st *store.Store,
+	st store.Store,
 	stationID string,
 	sess *testmanager.SessionInfo,
 	since, until time.Time,
@@ -0,0 +1,135 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/holla2040/arturo/internal/store"
+)
+
+// Review states of a test run, from the signatures on its current results
+// (see signedStatus).
+const (
+	ReviewPending  = "pending" // not signed yet
+	ReviewReviewed = store.SignatureReviewed
+	ReviewApproved = store.SignatureApproved
+	ReviewRejected = store.SignatureRejected
+	ReviewChanged  = "changed" // signed, but the results changed since
+)
+
+// ArtifactReview is the sign-off state of a test run.
+type ArtifactReview struct {
+	Status      string              `json:"status"`
+	ContentHash string              `json:"content_hash"`
+	Signatures  []ArtifactSignature `json:"signatures,omitempty"`
+}
+
+// ArtifactSignature is an electronic signature on a test run.
+type ArtifactSignature struct {
+	EmployeeID   string    `json:"employee_id"`
+	EmployeeName string    `json:"employee_name,omitempty"`
+	Meaning      string    `json:"meaning"`
+	Reason       string    `json:"reason,omitempty"`
+	ContentHash  string    `json:"content_hash"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// ContentHash returns the SHA-256 of the run's results: everything in the
+// report except the review itself and the technician's display name.
+func (ar ArtifactRun) ContentHash() string {
+	ar.EmployeeName = ""
+	ar.Review = nil
+	data, _ := json.Marshal(ar)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// addReview fills in the run's signatures and review state.
+func addReview(st store.Store, ar *ArtifactRun) error {
+	sigs, err := st.QueryRunSignatures(ar.RunID)
+	if err != nil {
+		return err
+	}
+	review := &ArtifactReview{Status: ReviewPending, ContentHash: ar.ContentHash()}
+	for _, sig := range sigs {
+		review.Signatures = append(review.Signatures, ArtifactSignature{
+			EmployeeID:   sig.EmployeeID,
+			EmployeeName: sig.EmployeeName,
+			Meaning:      sig.Meaning,
+			Reason:       sig.Reason,
+			ContentHash:  sig.ContentHash,
+			Timestamp:    sig.Timestamp,
+		})
+	}
+	review.Status = signedStatus(sigs, review.ContentHash)
+	ar.Review = review
+	return nil
+}
+
+// signedStatus returns a run's review state from its signatures, oldest
+// first, and the hash of its current results. Only signatures over the
+// current results count. A decision, approved or rejected, outranks
+// "reviewed" and the latest decision stands, so a later review does not
+// undo an approval.
+func signedStatus(sigs []store.RunSignature, contentHash string) string {
+	if len(sigs) == 0 {
+		return ReviewPending
+	}
+	status := ReviewChanged
+	for _, sig := range sigs {
+		if sig.ContentHash != contentHash {
+			continue
+		}
+		if sig.Meaning != store.SignatureReviewed || status == ReviewChanged {
+			status = sig.Meaning
+		}
+	}
+	return status
+}
+
+// RMAReviewStatuses returns the review state of each of an RMA's test runs,
+// by run ID. Unsigned runs are pending without their results being read;
+// only signed runs are hashed.
+func RMAReviewStatuses(st store.Store, rmaID string) (map[string]string, error) {
+	runs, err := st.QueryTestRunsByRMA(rmaID)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := st.QueryRMARunSignatures(rmaID)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string, len(runs))
+	for _, run := range runs {
+		runSigs := sigs[run.ID]
+		if len(runSigs) == 0 {
+			statuses[run.ID] = ReviewPending
+			continue
+		}
+		ar, err := buildRun(st, run)
+		if err != nil {
+			return nil, err
+		}
+		statuses[run.ID] = signedStatus(runSigs, ar.ContentHash())
+	}
+	return statuses, nil
+}
+
+// RunReview returns the review state of a test run, or nil if the run does
+// not exist.
+func RunReview(st store.Store, runID string) (*ArtifactReview, error) {
+	run, err := st.GetTestRun(runID)
+	if err != nil || run == nil {
+		return nil, err
+	}
+	ar, err := buildRun(st, *run)
+	if err != nil {
+		return nil, err
+	}
+	if err := addReview(st, &ar); err != nil {
+		return nil, err
+	}
+	return ar.Review, nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Scope limits what an API key may do. A key acts as the employee it was
+// issued for, so the employee's role applies as well.
+type Scope string
+
+const (
+	ScopeRead     Scope = "read"     // session and other authenticated reads, WebSocket events
+	ScopeRMAs     Scope = "rmas"     // create and close RMAs, scan input
+	ScopeTests    Scope = "tests"    // start, pause, resume, terminate, and abort tests
+	ScopeCommands Scope = "commands" // raw device and station commands, OTA
+	ScopeScripts  Scope = "scripts"  // upload and approve scripts
+	ScopeAdmin    Scope = "admin"    // employees, backups, and audit log
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{ScopeRead, ScopeRMAs, ScopeTests, ScopeCommands, ScopeScripts, ScopeAdmin}
+
+// ParseScopes validates a comma-separated list of scopes.
+func ParseScopes(list string) ([]Scope, error) {
+	var scopes []Scope
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !HasScope(Scopes, Scope(s)) {
+			return nil, fmt.Errorf("unknown scope %q (want read, rmas, tests, commands, scripts, or admin)", s)
+		}
+		if !HasScope(scopes, Scope(s)) {
+			scopes = append(scopes, Scope(s))
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether scopes contains s.
+func HasScope(scopes []Scope, s Scope) bool {
+	for _, have := range scopes {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyPrefix marks a bearer token as an API key rather than a session.
+const apiKeyPrefix = "ak_"
+
+// NewAPIKey generates an API key. The key is "ak_<id>_<secret>"; only the
+// ID and HashAPIKey of the secret are stored.
+func NewAPIKey() (id, secret, key string, err error) {
+	idBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", err
+	}
+	id = hex.EncodeToString(idBytes)
+	secret = base64.RawURLEncoding.EncodeToString(secretBytes)
+	return id, secret, apiKeyPrefix + id + "_" + secret, nil
+}
+
+// IsAPIKey reports whether a bearer token is an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// SplitAPIKey returns the ID and secret of an API key.
+func SplitAPIKey(key string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// HashAPIKey hashes an API key secret for storage. The secrets are random,
+// so a fast hash is enough.
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckAPIKey reports whether secret matches a hash from HashAPIKey.
+func CheckAPIKey(hash, secret string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(HashAPIKey(secret))) == 1
+}
@@ -0,0 +1,205 @@
+// Package auth hashes employee credentials, issues signed session tokens,
+// and defines the roles the API authorizes against.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role is an employee's permission level. Each role can do everything the
+// roles below it can.
+type Role string
+
+const (
+	RoleOperator Role = "operator" // run tests and manage RMAs
+	RoleEngineer Role = "engineer" // also raw commands, OTA, and scripts
+	RoleAdmin    Role = "admin"    // also employees, backups, and audit
+)
+
+var roleRank = map[Role]int{RoleOperator: 1, RoleEngineer: 2, RoleAdmin: 3}
+
+// ParseRole validates a role name.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q (want operator, engineer, or admin)", s)
+	}
+	return r, nil
+}
+
+// Allows reports whether r grants at least the permissions of min. Unknown
+// roles allow nothing.
+func (r Role) Allows(min Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[min]
+}
+
+// Cap returns r limited to max. An empty max is no limit.
+func (r Role) Cap(max Role) Role {
+	if max != "" && !max.Allows(r) {
+		return max
+	}
+	return r
+}
+
+// MinCredentialLength is the shortest accepted PIN or password.
+const MinCredentialLength = 4
+
+// HashCredential hashes a PIN or password for storage.
+func HashCredential(secret string) (string, error) {
+	if len(secret) < MinCredentialLength {
+		return "", fmt.Errorf("credential must be at least %d characters", MinCredentialLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// dummyHash is compared against when an employee has no credential, so a
+// failed login takes the same time whether or not the employee exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("arturo-dummy"), bcrypt.DefaultCost)
+
+// CheckCredential reports whether secret matches hash. An empty hash never
+// matches.
+func CheckCredential(hash, secret string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(secret))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
+
+// NormalizeBadge returns the canonical form of a badge code: scanners and
+// keyboards disagree on case, so codes compare case-insensitively.
+func NormalizeBadge(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// HashBadge hashes a badge code for storage and lookup. It must be
+// deterministic to be looked up, so unlike HashCredential it is not salted;
+// short codes are only as safe as the limits on badge logins (sessions
+// capped at RoleOperator, failed scans throttled).
+func HashBadge(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeBadge(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Token errors.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Claims are the contents of a session token.
+type Claims struct {
+	EmployeeID string `json:"sub"`
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+	// MaxRole, if set, caps the employee's role for this session.
+	MaxRole Role `json:"max_role,omitempty"`
+}
+
+// Signer issues and verifies HMAC-SHA256 signed session tokens. A token is
+// the base64url JSON claims and signature joined by a dot. Roles are not
+// carried in the token, only an optional cap; they are looked up on each
+// request so a role change applies at once.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner returns a Signer whose tokens are valid for ttl.
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, ttl: ttl, now: time.Now}
+}
+
+// TTL returns how long issued tokens are valid.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue returns a token for employeeID and its expiry.
+func (s *Signer) Issue(employeeID string) (string, time.Time) {
+	return s.IssueCapped(employeeID, "")
+}
+
+// IssueCapped returns a token for employeeID whose session holds at most
+// maxRole, and its expiry. An empty maxRole is no cap.
+func (s *Signer) IssueCapped(employeeID string, maxRole Role) (string, time.Time) {
+	now := s.now()
+	exp := now.Add(s.ttl)
+	payload, _ := json.Marshal(Claims{EmployeeID: employeeID, IssuedAt: now.Unix(), ExpiresAt: exp.Unix(), MaxRole: maxRole})
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + s.sign(body), exp
+}
+
+// Verify checks a token's signature and expiry and returns its claims.
+func (s *Signer) Verify(token string) (Claims, error) {
+	var c Claims
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(body))) {
+		return c, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return c, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &c); err != nil || c.EmployeeID == "" {
+		return c, ErrInvalidToken
+	}
+	if s.now().Unix() >= c.ExpiresAt {
+		return c, ErrExpiredToken
+	}
+	return c, nil
+}
+
+func (s *Signer) sign(body string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LoadOrCreateKey reads the token signing key at path, generating a random
+// 32-byte key there (mode 0600) if the file does not exist. Keeping the key
+// on disk lets sessions survive a controller restart.
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("%s: signing key must be at least 32 bytes", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return key, f.Close()
+}
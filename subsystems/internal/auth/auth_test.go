@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role, min Role
+		want      bool
+	}{
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleEngineer, false},
+		{RoleEngineer, RoleOperator, true},
+		{RoleEngineer, RoleAdmin, false},
+		{RoleAdmin, RoleEngineer, true},
+		{Role("root"), RoleOperator, false},
+		{Role(""), RoleOperator, false},
+	}
+	for _, c := range cases {
+		if got := c.role.Allows(c.min); got != c.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", c.role, c.min, got, c.want)
+		}
+	}
+	if _, err := ParseRole("superuser"); err == nil {
+		t.Error("expected error for unknown role")
+	}
+	if RoleAdmin.Cap(RoleOperator) != RoleOperator || RoleOperator.Cap(RoleEngineer) != RoleOperator || RoleAdmin.Cap("") != RoleAdmin {
+		t.Error("unexpected Cap result")
+	}
+}
+
+func TestHashBadge(t *testing.T) {
+	if HashBadge("a77") != HashBadge(" A77") {
+		t.Error("expected badge codes to hash case-insensitively")
+	}
+	if HashBadge("A77") == "A77" || HashBadge("A77") == HashBadge("A78") {
+		t.Error("unexpected badge hash")
+	}
+}
+
+func TestHashAndCheckCredential(t *testing.T) {
+	hash, err := HashCredential("4821")
+	if err != nil {
+		t.Fatalf("HashCredential failed: %v", err)
+	}
+	if hash == "4821" {
+		t.Fatal("credential stored in the clear")
+	}
+	if !CheckCredential(hash, "4821") {
+		t.Error("expected matching PIN to pass")
+	}
+	if CheckCredential(hash, "4822") || CheckCredential("", "4821") {
+		t.Error("expected wrong PIN and missing hash to fail")
+	}
+	if _, err := HashCredential("123"); err == nil {
+		t.Error("expected short credential to be rejected")
+	}
+}
+
+func TestSignerIssueAndVerify(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := NewSigner(bytes.Repeat([]byte("k"), 32), time.Hour)
+	s.now = func() time.Time { return now }
+
+	token, exp := s.Issue("emp-1")
+	if !exp.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected expiry %v", exp)
+	}
+	c, err := s.Verify(token)
+	if err != nil || c.EmployeeID != "emp-1" {
+		t.Fatalf("Verify failed: %+v %v", c, err)
+	}
+
+	other := NewSigner(bytes.Repeat([]byte("x"), 32), time.Hour)
+	if _, err := other.Verify(token); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another key, got %v", err)
+	}
+	if _, err := s.Verify(token[:len(token)-2] + "AA"); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for tampered signature, got %v", err)
+	}
+	if _, err := s.Verify("garbage"); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for garbage, got %v", err)
+	}
+
+	capped, _ := s.IssueCapped("emp-1", RoleOperator)
+	if c, err := s.Verify(capped); err != nil || c.MaxRole != RoleOperator {
+		t.Errorf("expected operator cap, got %+v %v", c, err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := s.Verify(token); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.key")
+	key, err := LoadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey failed: %v", err)
+	}
+	if len(key) != 32 {
+		t.Errorf("expected 32-byte key, got %d", len(key))
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+	again, err := LoadOrCreateKey(path)
+	if err != nil || !bytes.Equal(key, again) {
+		t.Errorf("expected the same key on reload, err %v", err)
+	}
+
+	short := filepath.Join(t.TempDir(), "short.key")
+	os.WriteFile(short, []byte("tiny"), 0o600)
+	if _, err := LoadOrCreateKey(short); err == nil {
+		t.Error("expected short key to be rejected")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	id, secret, key, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey failed: %v", err)
+	}
+	if !IsAPIKey(key) {
+		t.Errorf("%q not recognised as an API key", key)
+	}
+	gotID, gotSecret, ok := SplitAPIKey(key)
+	if !ok || gotID != id || gotSecret != secret {
+		t.Errorf("SplitAPIKey(%q) = %q, %q, %v", key, gotID, gotSecret, ok)
+	}
+	for _, bad := range []string{"", "ak_", "ak_abc", "ak__secret", "session.token"} {
+		if _, _, ok := SplitAPIKey(bad); ok {
+			t.Errorf("SplitAPIKey(%q) should fail", bad)
+		}
+	}
+
+	hash := HashAPIKey(secret)
+	if !CheckAPIKey(hash, secret) || CheckAPIKey(hash, secret+"x") || CheckAPIKey("", "") {
+		t.Error("CheckAPIKey gave the wrong answer")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" rmas, tests,rmas ")
+	if err != nil || len(scopes) != 2 || !HasScope(scopes, ScopeRMAs) || !HasScope(scopes, ScopeTests) || HasScope(scopes, ScopeAdmin) {
+		t.Errorf("ParseScopes = %v, %v", scopes, err)
+	}
+	for _, bad := range []string{"", " , ", "rmas,everything"} {
+		if _, err := ParseScopes(bad); err == nil {
+			t.Errorf("ParseScopes(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package backup takes periodic online copies of the controller database.
+// Each backup is written under a temporary name, integrity-checked, then
+// renamed into place, and the oldest backups beyond the configured count are
+// removed.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holla2040/arturo/internal/store"
+)
+
+const (
+	filePrefix = "arturo-"
+	fileSuffix = ".db"
+	timeLayout = "20060102T150405Z"
+)
+
+// Config configures where backups go and how many are kept.
+type Config struct {
+	Dir      string        // backup directory
+	Interval time.Duration // time between scheduled backups (0 = manual only)
+	Keep     int           // newest backups to keep (0 = keep all)
+}
+
+// DefaultConfig backs up daily to ./backups and keeps a week.
+func DefaultConfig() Config {
+	return Config{
+		Dir:      "backups",
+		Interval: 24 * time.Hour,
+		Keep:     7,
+	}
+}
+
+// Store is the subset of store.SQLStore the manager needs.
+type Store interface {
+	Backup(path string) error
+}
+
+// Info describes one backup file.
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manager creates, lists, and rotates backups.
+type Manager struct {
+	store Store
+	cfg   Config
+	mu    sync.Mutex // serializes backups and rotation
+}
+
+// New creates a backup manager and its directory.
+func New(st Store, cfg Config) (*Manager, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("backup directory not set")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	return &Manager{store: st, cfg: cfg}, nil
+}
+
+// Run takes scheduled backups until ctx is cancelled. The first backup is
+// due one interval after the newest existing backup, so restarting the
+// controller neither skips nor repeats a backup.
+func (m *Manager) Run(ctx context.Context) {
+	if m.cfg.Interval <= 0 {
+		return
+	}
+	for {
+		timer := time.NewTimer(m.nextDue(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		info, err := m.BackupNow()
+		if err != nil {
+			log.Printf("backup: %v", err)
+			// Retry after a short delay rather than waiting a full interval.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+			}
+			continue
+		}
+		log.Printf("backup: wrote %s (%d bytes)", info.Name, info.Size)
+	}
+}
+
+// nextDue returns how long to wait before the next scheduled backup.
+func (m *Manager) nextDue(now time.Time) time.Duration {
+	backups, err := m.List()
+	if err != nil || len(backups) == 0 {
+		return 0
+	}
+	wait := backups[0].CreatedAt.Add(m.cfg.Interval).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// BackupNow writes a new backup, verifies it, and rotates old ones.
+func (m *Manager) BackupNow() (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	name := filePrefix + now.Format(timeLayout) + fileSuffix
+	path := filepath.Join(m.cfg.Dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return Info{}, fmt.Errorf("backup %s already exists", name)
+	}
+
+	tmp := path + ".partial"
+	os.Remove(tmp)
+	if err := m.store.Backup(tmp); err != nil {
+		os.Remove(tmp)
+		return Info{}, err
+	}
+	if _, err := store.CheckIntegrity(tmp); err != nil {
+		os.Remove(tmp)
+		return Info{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return Info{}, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := m.rotate(); err != nil {
+		log.Printf("backup: rotate: %v", err)
+	}
+	return Info{Name: name, Size: fi.Size(), CreatedAt: now.Truncate(time.Second)}, nil
+}
+
+// List returns existing backups, newest first.
+func (m *Manager) List() ([]Info, error) {
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	backups := []Info{}
+	for _, e := range entries {
+		created, ok := parseName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Info{Name: e.Name(), Size: fi.Size(), CreatedAt: created})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// Open opens a backup by name for download. Names that are not backup files
+// in the backup directory are rejected.
+func (m *Manager) Open(name string) (*os.File, Info, error) {
+	created, ok := parseName(name)
+	if !ok || filepath.Base(name) != name {
+		return nil, Info{}, os.ErrNotExist
+	}
+	f, err := os.Open(filepath.Join(m.cfg.Dir, name))
+	if err != nil {
+		return nil, Info{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Info{}, err
+	}
+	return f, Info{Name: name, Size: fi.Size(), CreatedAt: created}, nil
+}
+
+// rotate removes the oldest backups beyond cfg.Keep. Caller holds m.mu.
+func (m *Manager) rotate() error {
+	if m.cfg.Keep <= 0 {
+		return nil
+	}
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(m.cfg.Keep, len(backups)):] {
+		if err := os.Remove(filepath.Join(m.cfg.Dir, b.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseName extracts the creation time from a backup file name.
+func parseName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix)
+	t, err := time.Parse(timeLayout, ts)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
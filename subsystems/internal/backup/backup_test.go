@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/holla2040/arturo/internal/store"
+)
+
+func newTestManager(t *testing.T, cfg Config) (*Manager, *store.SQLStore) {
+	t.Helper()
+	st, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("store.New failed: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	m, err := New(st, cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return m, st
+}
+
+// writeFakeBackup places a backup file with the given creation time.
+func writeFakeBackup(t *testing.T, dir string, created time.Time) string {
+	t.Helper()
+	name := filePrefix + created.UTC().Format(timeLayout) + fileSuffix
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestBackupNowWritesVerifiedCopy(t *testing.T) {
+	m, st := newTestManager(t, Config{})
+	st.CreateTestRun("run-1", "test.art")
+
+	info, err := m.BackupNow()
+	if err != nil {
+		t.Fatalf("BackupNow failed: %v", err)
+	}
+	if info.Size == 0 {
+		t.Error("expected non-empty backup")
+	}
+
+	path := filepath.Join(m.cfg.Dir, info.Name)
+	if _, err := store.CheckIntegrity(path); err != nil {
+		t.Fatalf("backup failed integrity check: %v", err)
+	}
+	restored, err := store.New(path)
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer restored.Close()
+	if run, _ := restored.GetTestRun("run-1"); run == nil {
+		t.Error("expected run-1 in backup")
+	}
+	if _, err := os.Stat(path + ".partial"); !os.IsNotExist(err) {
+		t.Error("expected temporary file to be removed")
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	m, _ := newTestManager(t, Config{Keep: 2})
+	now := time.Now()
+	oldest := writeFakeBackup(t, m.cfg.Dir, now.Add(-72*time.Hour))
+	older := writeFakeBackup(t, m.cfg.Dir, now.Add(-48*time.Hour))
+	newer := writeFakeBackup(t, m.cfg.Dir, now.Add(-24*time.Hour))
+	os.WriteFile(filepath.Join(m.cfg.Dir, "notes.txt"), []byte("x"), 0o644)
+
+	info, err := m.BackupNow()
+	if err != nil {
+		t.Fatalf("BackupNow failed: %v", err)
+	}
+
+	backups, err := m.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(backups) != 2 || backups[0].Name != info.Name || backups[1].Name != newer {
+		t.Fatalf("expected [%s %s], got %+v", info.Name, newer, backups)
+	}
+	for _, name := range []string{oldest, older} {
+		if _, err := os.Stat(filepath.Join(m.cfg.Dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be rotated out", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(m.cfg.Dir, "notes.txt")); err != nil {
+		t.Error("rotation must not touch unrelated files")
+	}
+}
+
+func TestOpenRejectsOtherFiles(t *testing.T) {
+	m, _ := newTestManager(t, Config{})
+	name := writeFakeBackup(t, m.cfg.Dir, time.Now())
+
+	f, info, err := m.Open(name)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "old" || info.Size != 3 {
+		t.Errorf("unexpected backup contents %q, info %+v", data, info)
+	}
+
+	for _, bad := range []string{"../arturo.db", "notes.txt", "arturo-latest.db", "../" + name} {
+		if _, _, err := m.Open(bad); !os.IsNotExist(err) {
+			t.Errorf("Open(%q): expected not-exist error, got %v", bad, err)
+		}
+	}
+}
+
+func TestNextDue(t *testing.T) {
+	m, _ := newTestManager(t, Config{Interval: 24 * time.Hour})
+	now := time.Now()
+	if d := m.nextDue(now); d != 0 {
+		t.Errorf("expected immediate backup with none on disk, got %s", d)
+	}
+
+	writeFakeBackup(t, m.cfg.Dir, now.Add(-6*time.Hour))
+	if d := m.nextDue(now); d < 17*time.Hour || d > 18*time.Hour {
+		t.Errorf("expected ~18h until next backup, got %s", d)
+	}
+
+	writeFakeBackup(t, m.cfg.Dir, now.Add(-48*time.Hour))
+	if d := m.nextDue(now); d < 17*time.Hour {
+		t.Errorf("newest backup should set the schedule, got %s", d)
+	}
+}
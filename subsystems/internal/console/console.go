@@ -1,5 +1,5 @@
 // Package console provides a web-based console for mock station control
-// and Redis traffic monitoring.
+// and message bus traffic monitoring.
 package console
 
 import (
@@ -15,7 +15,7 @@ import (
 	"github.com/holla2040/arturo/internal/api"
 	"github.com/holla2040/arturo/internal/mockpump"
 	"github.com/holla2040/arturo/internal/protocol"
-	"github.com/redis/go-redis/v9"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 //go:embed index.html
@@ -29,7 +29,7 @@ type StationInfo struct {
 	Online   *bool // shared pointer; toggled by console UI
 }
 
-// MonitorMessage is a parsed Redis message for the web UI.
+// MonitorMessage is a parsed bus message for the web UI.
 type MonitorMessage struct {
 	Timestamp string      `json:"timestamp"`
 	Direction string      `json:"direction"` // "→" outgoing, "←" incoming, "♥" heartbeat, "!" e-stop
@@ -50,8 +50,8 @@ type stationSnapshot struct {
 }
 
 // Handler builds the HTTP handler and returns a run function that starts
-// the Redis monitor goroutines. Call run in a goroutine.
-func Handler(stations []*StationInfo, rdb *redis.Client) (http.Handler, func(ctx context.Context)) {
+// the bus monitor goroutines. Call run in a goroutine.
+func Handler(stations []*StationInfo, bus transport.Transport) (http.Handler, func(ctx context.Context)) {
 	hub := api.NewHub()
 
 	mux := http.NewServeMux()
@@ -202,9 +202,9 @@ func Handler(stations []*StationInfo, rdb *redis.Client) (http.Handler, func(ctx
 
 	run := func(ctx context.Context) {
 		go hub.Run(ctx)
-		go watchCommands(ctx, rdb, hub)
-		go watchPubSub(ctx, rdb, hub)
-		go pollPresence(ctx, rdb, hub)
+		go watchCommands(ctx, bus, hub)
+		go watchPubSub(ctx, bus, hub)
+		go pollPresence(ctx, bus, hub)
 	}
 
 	return mux, run
@@ -215,47 +215,32 @@ func writeJSON(w http.ResponseWriter, v interface{}) {
 	json.NewEncoder(w).Encode(v)
 }
 
-// watchCommands subscribes to commands:* and responses:* via Pub/Sub.
-func watchCommands(ctx context.Context, rdb *redis.Client, hub *api.Hub) {
-	for {
-		if ctx.Err() != nil {
-			return
-		}
+// watchCommands follows every command and response stream.
+func watchCommands(ctx context.Context, bus transport.Streams, hub *api.Hub) {
+	for ctx.Err() == nil {
+		sub, err := bus.Watch(ctx)
+		if err != nil {
+			log.Printf("console: command/response watch: %v", err)
+		} else {
+			for m := range sub.Messages() {
+				var msg protocol.Message
+				if err := json.Unmarshal(m.Data, &msg); err != nil {
+					continue
+				}
 
-		sub := rdb.PSubscribe(ctx, "commands:*", "responses:*")
-		ch := sub.Channel()
-
-		func() {
-			defer sub.Close()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case redisMsg, ok := <-ch:
-					if !ok {
-						log.Println("console: command/response subscription closed, reconnecting...")
-						return
-					}
-
-					var msg protocol.Message
-					if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
-						continue
-					}
-
-					direction := "→"
-					category := "command"
-					if strings.HasPrefix(redisMsg.Channel, "responses:") {
-						direction = "←"
-						category = "response"
-					}
-
-					mm := buildMonitorMessage(&msg, redisMsg.Channel, direction, category)
-					broadcastMonitor(hub, mm)
+				direction := "→"
+				category := "command"
+				if strings.HasPrefix(m.Channel, "responses:") {
+					direction = "←"
+					category = "response"
 				}
+
+				mm := buildMonitorMessage(&msg, m.Channel, direction, category)
+				broadcastMonitor(hub, mm)
 			}
-		}()
+			sub.Close()
+		}
 
-		// Back off before retrying
 		select {
 		case <-ctx.Done():
 			return
@@ -264,52 +249,38 @@ func watchCommands(ctx context.Context, rdb *redis.Client, hub *api.Hub) {
 	}
 }
 
-// watchPubSub subscribes to events:* for heartbeats and e-stop.
-func watchPubSub(ctx context.Context, rdb *redis.Client, hub *api.Hub) {
-	sub := rdb.PSubscribe(ctx, "events:*")
-	defer sub.Close()
-
-	ch := sub.Channel()
-	for {
-		select {
-		case <-ctx.Done():
+// watchPubSub subscribes to events:* for heartbeats, hellos and e-stop.
+func watchPubSub(ctx context.Context, bus transport.PubSub, hub *api.Hub) {
+	transport.Listen(ctx, bus, func(m transport.Message) {
+		var msg protocol.Message
+		if err := json.Unmarshal(m.Data, &msg); err != nil {
 			return
-		case redisMsg, ok := <-ch:
-			if !ok {
-				return
-			}
-
-			var msg protocol.Message
-			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
-				continue
-			}
-
-			direction := "♥"
-			category := "heartbeat"
-			if msg.Envelope.Type == protocol.TypeSystemEmergencyStop {
-				direction = "!"
-				category = "estop"
-			}
+		}
 
-			mm := buildMonitorMessage(&msg, redisMsg.Channel, direction, category)
-			broadcastMonitor(hub, mm)
+		direction := "♥"
+		category := "heartbeat"
+		switch msg.Envelope.Type {
+		case protocol.TypeSystemEmergencyStop:
+			direction = "!"
+			category = "estop"
+		case protocol.TypeServiceHello:
+			direction = "☺"
+			category = "hello"
 		}
-	}
+
+		mm := buildMonitorMessage(&msg, m.Channel, direction, category)
+		broadcastMonitor(hub, mm)
+	}, transport.ChannelEvents)
 }
 
-// pollPresence scans device:*:alive keys periodically.
-func pollPresence(ctx context.Context, rdb *redis.Client, hub *api.Hub) {
+// pollPresence reports every station's presence marker periodically.
+func pollPresence(ctx context.Context, bus transport.Presence, hub *api.Hub) {
 	poll := func() {
-		iter := rdb.Scan(ctx, 0, "device:*:alive", 100).Iterator()
-		for iter.Next(ctx) {
-			key := iter.Val()
-			instance := extractInstance(key)
-
-			ttl, err := rdb.TTL(ctx, key).Result()
-			if err != nil {
-				continue
-			}
-
+		alive, err := bus.Alive(ctx)
+		if err != nil {
+			return
+		}
+		for instance, ttl := range alive {
 			state := "online"
 			if ttl.Seconds() < 5 {
 				state = "stale"
@@ -318,7 +289,7 @@ func pollPresence(ctx context.Context, rdb *redis.Client, hub *api.Hub) {
 			mm := &MonitorMessage{
 				Timestamp: time.Now().Format("15:04:05"),
 				Direction: "●",
-				Channel:   key,
+				Channel:   transport.PresenceKey(instance),
 				Instance:  instance,
 				Type:      "presence",
 				Category:  "presence",
@@ -361,11 +332,32 @@ func buildMonitorMessage(msg *protocol.Message, channel, direction, category str
 			}
 			summary = fmt.Sprintf("success=%t response=%q", resp.Success, val)
 		}
+	case protocol.TypeDeviceCommandBatchRequest:
+		req, err := protocol.ParseBatchRequest(msg)
+		if err == nil {
+			summary = fmt.Sprintf("batch cmds=%d", len(req.Commands))
+		}
+	case protocol.TypeDeviceCommandBatchResponse:
+		resp, err := protocol.ParseBatchResponse(msg)
+		if err == nil {
+			failed := 0
+			for _, r := range resp.Results {
+				if !r.Success {
+					failed++
+				}
+			}
+			summary = fmt.Sprintf("batch results=%d failed=%d", len(resp.Results), failed)
+		}
 	case protocol.TypeServiceHeartbeat:
 		hb, err := protocol.ParseHeartbeat(msg)
 		if err == nil {
 			summary = fmt.Sprintf("%s heap=%d rssi=%d", hb.Status, hb.FreeHeap, hb.WifiRSSI)
 		}
+	case protocol.TypeServiceHello:
+		h, err := protocol.ParseHello(msg)
+		if err == nil {
+			summary = fmt.Sprintf("%s features=%v request=%t", msg.Envelope.SchemaVersion, h.Features, h.Request)
+		}
 	case protocol.TypeSystemEmergencyStop:
 		es, err := protocol.ParseEmergencyStop(msg)
 		if err == nil {
@@ -399,15 +391,3 @@ func broadcastMonitor(hub *api.Hub, mm *MonitorMessage) {
 	}
 	hub.Broadcast(data)
 }
-
-// extractInstance pulls the station instance from a Redis key like device:{instance}:alive.
-func extractInstance(key string) string {
-	parts := strings.Split(key, ":")
-	if len(parts) >= 3 && parts[0] == "device" && parts[len(parts)-1] == "alive" {
-		return strings.Join(parts[1:len(parts)-1], ":")
-	}
-	if len(parts) >= 2 && (parts[0] == "commands" || parts[0] == "responses") {
-		return strings.Join(parts[1:], ":")
-	}
-	return key
-}
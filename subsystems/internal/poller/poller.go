@@ -4,13 +4,17 @@ package poller
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/holla2040/arturo/internal/api"
 	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/registry"
+	"github.com/holla2040/arturo/internal/scheduler"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 // Broadcaster sends events to connected clients (e.g., WebSocket).
@@ -24,58 +28,260 @@ type TempRecorder interface {
 	RecordPumpStatusLog(stationInstance, deviceID string, pumpOn, roughValveOpen, purgeValveOpen bool, regenStatus string) error
 }
 
-// StationPoller periodically queries all online stations for pump status and temperatures.
+// Sender sends a command to a station's command stream.
+type Sender interface {
+	SendCommand(ctx context.Context, stream string, msg *protocol.Message) error
+}
+
+// Intervals sets how often a station is polled, by the state its pumps
+// were last seen in.
+type Intervals struct {
+	Regen   time.Duration // a pump is regenerating
+	Running time.Duration // a pump is on
+	Idle    time.Duration // every pump is off
+	// MaxBackoff caps the interval, doubled on each consecutive failed
+	// poll, for a station that is not answering.
+	MaxBackoff time.Duration
+}
+
+// DefaultIntervals polls every 2s during regen, 5s while a pump runs and
+// 15s when idle, backing off to one poll a minute.
+func DefaultIntervals() Intervals {
+	return Intervals{
+		Regen:      2 * time.Second,
+		Running:    5 * time.Second,
+		Idle:       15 * time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// Station poll states reported in StationStats.
+const (
+	StateRegen   = "regen"
+	StateRunning = "running"
+	StateIdle    = "idle"
+)
+
+// StationStats are one station's poll metrics since the controller started.
+type StationStats struct {
+	Station             string     `json:"station"`
+	Active              bool       `json:"active"` // being polled now (station online)
+	State               string     `json:"state,omitempty"`
+	Interval            string     `json:"interval,omitempty"`
+	Polls               int64      `json:"polls"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastPoll            *time.Time `json:"last_poll,omitempty"`
+	LastLatency         string     `json:"last_latency,omitempty"`
+	AvgLatency          string     `json:"avg_latency,omitempty"`
+	MaxLatency          string     `json:"max_latency,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// stationPoll is the state of one station's polling goroutine.
+type stationPoll struct {
+	stats        StationStats
+	totalLatency time.Duration
+	maxLatency   time.Duration
+}
+
+// StationPoller polls each online station for pump telemetry in its own
+// goroutine, so a slow station delays nobody else, at an interval that
+// follows the pumps' state.
 type StationPoller struct {
-	source     protocol.Source
-	sender     api.CommandSender
-	dispatcher *api.ResponseDispatcher
-	registry   *registry.Registry
-	hub        Broadcaster
-	recorder   TempRecorder
-	interval   time.Duration
+	source       protocol.Source
+	sender       Sender
+	dispatcher   *transport.Dispatcher
+	registry     *registry.Registry
+	hub          Broadcaster
+	recorder     TempRecorder
+	intervals    Intervals
+	queryTimeout time.Duration
+	scanInterval time.Duration // how often newly online stations are picked up
+
+	mu       sync.Mutex
+	stations map[string]*stationPoll
 }
 
-// New creates a StationPoller with a 5-second interval.
-func New(source protocol.Source, sender api.CommandSender, dispatcher *api.ResponseDispatcher, reg *registry.Registry, hub Broadcaster, recorder TempRecorder) *StationPoller {
+// New creates a StationPoller with DefaultIntervals.
+func New(source protocol.Source, sender Sender, dispatcher *transport.Dispatcher, reg *registry.Registry, hub Broadcaster, recorder TempRecorder) *StationPoller {
 	return &StationPoller{
-		source:     source,
-		sender:     sender,
-		dispatcher: dispatcher,
-		registry:   reg,
-		hub:        hub,
-		recorder:   recorder,
-		interval:   5 * time.Second,
+		source:       source,
+		sender:       sender,
+		dispatcher:   dispatcher,
+		registry:     reg,
+		hub:          hub,
+		recorder:     recorder,
+		intervals:    DefaultIntervals(),
+		queryTimeout: 5 * time.Second,
+		scanInterval: time.Second,
+		stations:     make(map[string]*stationPoll),
 	}
 }
 
-// Run starts the polling loop. It blocks until ctx is cancelled.
+// SetIntervals replaces the poll intervals. Zero fields keep their
+// defaults. Call before Run.
+func (p *StationPoller) SetIntervals(iv Intervals) {
+	def := DefaultIntervals()
+	if iv.Regen <= 0 {
+		iv.Regen = def.Regen
+	}
+	if iv.Running <= 0 {
+		iv.Running = def.Running
+	}
+	if iv.Idle <= 0 {
+		iv.Idle = def.Idle
+	}
+	if iv.MaxBackoff <= 0 {
+		iv.MaxBackoff = def.MaxBackoff
+	}
+	p.intervals = iv
+}
+
+// Run starts a polling goroutine for every station that comes online and
+// blocks until ctx is cancelled and they have all stopped.
 func (p *StationPoller) Run(ctx context.Context) {
-	ticker := time.NewTicker(p.interval)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(p.scanInterval)
 	defer ticker.Stop()
 
 	for {
+		for _, station := range p.registry.ListStations() {
+			if station.Status == registry.StatusOnline && p.activate(station.Instance) {
+				wg.Add(1)
+				go func(instance string) {
+					defer wg.Done()
+					p.pollStation(ctx, instance)
+				}(station.Instance)
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			p.pollAll(ctx)
 		}
 	}
 }
 
-func (p *StationPoller) pollAll(ctx context.Context) {
-	stations := p.registry.ListStations()
-	for _, station := range stations {
-		if station.Status != registry.StatusOnline {
+// activate marks station as polled, reporting false if it already was.
+func (p *StationPoller) activate(instance string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp, ok := p.stations[instance]
+	if !ok {
+		sp = &stationPoll{stats: StationStats{Station: instance}}
+		p.stations[instance] = sp
+	}
+	if sp.stats.Active {
+		return false
+	}
+	sp.stats.Active = true
+	return true
+}
+
+// pollStation polls one station until it goes offline or ctx is cancelled.
+func (p *StationPoller) pollStation(ctx context.Context, instance string) {
+	defer func() {
+		p.mu.Lock()
+		p.stations[instance].stats.Active = false
+		p.mu.Unlock()
+	}()
+
+	for p.registry.GetStationStatus(instance) == registry.StatusOnline {
+		interval := p.pollOnce(ctx, instance)
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// pollOnce polls the station's pumps, records the outcome, and returns how
+// long to wait before the next poll.
+func (p *StationPoller) pollOnce(ctx context.Context, instance string) time.Duration {
+	start := time.Now()
+	state := StateIdle
+	var pollErr error
+	for _, deviceID := range p.registry.DevicesForStation(instance) {
+		if !isPumpDevice(deviceID) {
 			continue
 		}
-		for _, deviceID := range station.Devices {
-			if !isPumpDevice(deviceID) {
-				continue
-			}
-			p.pollDevice(ctx, station.Instance, deviceID)
+		snap, err := p.pollDevice(ctx, instance, deviceID)
+		switch {
+		case err != nil:
+			pollErr = fmt.Errorf("%s: %w", deviceID, err)
+		case snap.regenActive():
+			state = StateRegen
+		case snap.PumpOn && state == StateIdle:
+			state = StateRunning
 		}
 	}
+	latency := time.Since(start)
+	if ctx.Err() != nil {
+		return 0 // shutting down; not a station failure
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.stations[instance]
+	st := &sp.stats
+	st.Polls++
+	st.LastPoll = &start
+	st.LastLatency = latency.Round(time.Millisecond).String()
+	sp.totalLatency += latency
+	st.AvgLatency = (sp.totalLatency / time.Duration(st.Polls)).Round(time.Millisecond).String()
+	if latency > sp.maxLatency {
+		sp.maxLatency = latency
+		st.MaxLatency = latency.Round(time.Millisecond).String()
+	}
+	if pollErr != nil {
+		st.Failures++
+		st.ConsecutiveFailures++
+		st.LastError = pollErr.Error()
+	} else {
+		st.ConsecutiveFailures = 0
+		st.State = state
+	}
+
+	interval := backoff(p.baseInterval(st.State), st.ConsecutiveFailures, p.intervals.MaxBackoff)
+	st.Interval = interval.String()
+	return interval
+}
+
+// baseInterval returns the interval for a station in state; before its
+// first successful poll a station is polled as if running.
+func (p *StationPoller) baseInterval(state string) time.Duration {
+	switch state {
+	case StateRegen:
+		return p.intervals.Regen
+	case StateIdle:
+		return p.intervals.Idle
+	}
+	return p.intervals.Running
+}
+
+// backoff doubles interval for each consecutive failure, up to limit.
+func backoff(interval time.Duration, failures int, limit time.Duration) time.Duration {
+	for i := 0; i < failures && interval < limit; i++ {
+		interval = min(2*interval, limit)
+	}
+	return interval
+}
+
+// Stats returns every station's poll metrics, by station name.
+func (p *StationPoller) Stats() []StationStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]StationStats, 0, len(p.stations))
+	for _, sp := range p.stations {
+		out = append(out, sp.stats)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Station < out[j].Station })
+	return out
 }
 
 // telemetrySnapshot matches the JSON object returned by the firmware's
@@ -94,32 +300,36 @@ type telemetrySnapshot struct {
 	LastUpdateMs   uint32  `json:"last_update_ms"`
 }
 
-func (p *StationPoller) pollDevice(ctx context.Context, stationInstance, deviceID string) {
-	commandStream := "commands:" + stationInstance
+// regenActive reports whether the pump is regenerating: the regen state
+// character is not pump-off ('A'), regen-complete ('P'), or regen-aborted
+// ('V'). Matches the pre-telemetry derivation at the old poller call site.
+func (snap *telemetrySnapshot) regenActive() bool {
+	return snap.RegenChar != "" && snap.RegenChar != "A" &&
+		snap.RegenChar != "P" && snap.RegenChar != "V"
+}
+
+// pollDevice queries one pump's telemetry, broadcasts and records it, and
+// returns it.
+func (p *StationPoller) pollDevice(ctx context.Context, stationInstance, deviceID string) (*telemetrySnapshot, error) {
+	commandStream := transport.CommandStream(stationInstance)
 	now := time.Now().UTC().Format(time.RFC3339Nano)
 
 	// One cache-served round-trip replaces 8 individual CTI queries. The
 	// firmware serves this from the RAM snapshot its own poll task maintains.
 	// See docs/architecture/ARCHITECTURE.md §4.6.
-	raw := p.queryCommand(ctx, deviceID, "get_telemetry", commandStream)
-	if raw == nil {
-		log.Printf("poller: %s/%s get_telemetry returned nil (timeout or error response)",
-			stationInstance, deviceID)
-		return
+	raw, err := p.queryCommand(ctx, deviceID, "get_telemetry", commandStream)
+	if err != nil {
+		log.Printf("poller: %s/%s %v", stationInstance, deviceID, err)
+		return nil, err
 	}
 
 	var snap telemetrySnapshot
-	if err := json.Unmarshal([]byte(*raw), &snap); err != nil {
+	if err := json.Unmarshal([]byte(raw), &snap); err != nil {
 		log.Printf("poller: %s/%s telemetry parse error: %v (raw=%q)",
-			stationInstance, deviceID, err, *raw)
-		return
+			stationInstance, deviceID, err, raw)
+		return nil, fmt.Errorf("telemetry parse error: %w", err)
 	}
-
-	// regen is active whenever the regen state character is not pump-off ('A'),
-	// regen-complete ('P'), or regen-aborted ('V'). Matches the pre-telemetry
-	// derivation at the old poller call site.
-	regenActive := snap.RegenChar != "" && snap.RegenChar != "A" &&
-		snap.RegenChar != "P" && snap.RegenChar != "V"
+	regenActive := snap.regenActive()
 
 	// status_1_raw: single byte with the same bit pattern as Status1, to
 	// preserve WS event shape for any client that inspects it.
@@ -170,53 +380,51 @@ func (p *StationPoller) pollDevice(ctx context.Context, stationInstance, deviceI
 
 	log.Printf("poller: %s/%s S1=0x%02X J=%.1fK K=%.1fK regen=%s",
 		stationInstance, deviceID, snap.Status1, snap.Stage1TempK, snap.Stage2TempK, snap.RegenChar)
+	return &snap, nil
 }
 
-// queryCommand sends a single command and waits for the response.
-// Returns the response string on success, nil on failure.
-func (p *StationPoller) queryCommand(ctx context.Context, deviceID, command, stream string) *string {
-	msg, err := protocol.BuildCommandRequest(p.source, deviceID, command, nil, 5000, false)
+// queryCommand sends a single command in the telemetry lane and waits for
+// the response string.
+func (p *StationPoller) queryCommand(ctx context.Context, deviceID, command, stream string) (string, error) {
+	msg, err := protocol.BuildCommandRequest(p.source, deviceID, command, nil, int(p.queryTimeout/time.Millisecond), false)
 	if err != nil {
-		return nil
+		return "", err
 	}
 
 	waiterCh := p.dispatcher.Register(msg.Envelope.CorrelationID)
 
-	if err := p.sender.SendCommand(ctx, stream, msg); err != nil {
+	if err := p.sender.SendCommand(scheduler.WithLane(ctx, scheduler.LaneTelemetry), stream, msg); err != nil {
 		p.dispatcher.Deregister(msg.Envelope.CorrelationID)
-		return nil
+		return "", fmt.Errorf("%s: send: %w", command, err)
 	}
 
+	timer := time.NewTimer(p.queryTimeout)
+	defer timer.Stop()
 	select {
 	case resp := <-waiterCh:
 		payload, err := protocol.ParseCommandResponse(resp)
 		if err != nil {
-			log.Printf("poller: %s parse response error: %v", command, err)
-			return nil
+			return "", fmt.Errorf("%s: parse response: %w", command, err)
 		}
 		if !payload.Success {
 			if payload.Error != nil {
-				log.Printf("poller: %s returned error code=%q message=%q",
+				return "", fmt.Errorf("%s returned error code=%q message=%q",
 					command, payload.Error.Code, payload.Error.Message)
-			} else {
-				log.Printf("poller: %s returned success=false with no error object", command)
 			}
-			return nil
+			return "", fmt.Errorf("%s returned success=false with no error object", command)
 		}
 		if payload.Response == nil {
-			log.Printf("poller: %s returned success with nil response field", command)
-			return nil
+			return "", fmt.Errorf("%s returned success with nil response field", command)
 		}
-		return payload.Response
+		return *payload.Response, nil
 
-	case <-time.After(5 * time.Second):
+	case <-timer.C:
 		p.dispatcher.Deregister(msg.Envelope.CorrelationID)
-		log.Printf("poller: %s timed out after 5s", command)
-		return nil
+		return "", fmt.Errorf("%s timed out after %s", command, p.queryTimeout)
 
 	case <-ctx.Done():
 		p.dispatcher.Deregister(msg.Envelope.CorrelationID)
-		return nil
+		return "", ctx.Err()
 	}
 }
 
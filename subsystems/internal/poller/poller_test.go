@@ -0,0 +1,145 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/registry"
+	"github.com/holla2040/arturo/internal/transport"
+)
+
+type nopHub struct{}
+
+func (nopHub) BroadcastEvent(string, interface{}) {}
+
+// stationSim answers get_telemetry for the stations in regenChar and
+// ignores the rest.
+type stationSim struct {
+	d         *transport.Dispatcher
+	mu        sync.Mutex
+	regenChar map[string]string
+	delay     time.Duration
+}
+
+func (s *stationSim) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	s.mu.Lock()
+	char, ok := s.regenChar[transport.InstanceFromName(stream)]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	go func() {
+		time.Sleep(s.delay)
+		snap, _ := json.Marshal(telemetrySnapshot{PumpOn: true, RegenChar: char, Stage2TempK: 15})
+		resp := string(snap)
+		payload, _ := json.Marshal(protocol.CommandResponsePayload{DeviceID: "PUMP-01", CommandName: "get_telemetry", Success: true, Response: &resp})
+		s.d.Dispatch(&protocol.Message{
+			Envelope: protocol.Envelope{CorrelationID: msg.Envelope.CorrelationID, Type: protocol.TypeDeviceCommandResponse},
+			Payload:  payload,
+		})
+	}()
+	return nil
+}
+
+func stats(p *StationPoller, station string) StationStats {
+	for _, st := range p.Stats() {
+		if st.Station == station {
+			return st
+		}
+	}
+	return StationStats{}
+}
+
+func TestPollStationsIndependently(t *testing.T) {
+	reg := registry.New()
+	for _, inst := range []string{"station-01", "station-02", "station-03"} {
+		reg.UpdateFromHeartbeat(inst, &protocol.HeartbeatPayload{Status: "running", Devices: []string{"PUMP-01"}})
+	}
+	d := transport.NewDispatcher()
+	sim := &stationSim{d: d, delay: 5 * time.Millisecond, regenChar: map[string]string{
+		"station-01": "B", // regenerating
+		"station-03": "A", // pump on, no regen
+		// station-02 never answers
+	}}
+
+	p := New(protocol.Source{Service: "arturo_controller", Instance: "ctrl-01", Version: "1.0.0"}, sim, d, reg, nopHub{}, nil)
+	p.SetIntervals(Intervals{Regen: 10 * time.Millisecond, Running: 40 * time.Millisecond, Idle: time.Second, MaxBackoff: 200 * time.Millisecond})
+	p.queryTimeout = 50 * time.Millisecond
+	p.scanInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+
+	fast := stats(p, "station-01")
+	if fast.State != StateRegen || fast.Interval != "10ms" {
+		t.Errorf("station-01: state %q interval %s, want regen at 10ms", fast.State, fast.Interval)
+	}
+	if fast.Polls < 10 || fast.Failures != 0 {
+		t.Errorf("station-01: %d polls, %d failures; a silent station should not slow it down", fast.Polls, fast.Failures)
+	}
+	if fast.LastPoll == nil || fast.LastPoll.IsZero() {
+		t.Error("station-01: no last poll time")
+	}
+	if b, _ := json.Marshal(StationStats{Station: "station-09"}); strings.Contains(string(b), "last_poll") {
+		t.Errorf("unpolled station reports a last poll: %s", b)
+	}
+
+	running := stats(p, "station-03")
+	if running.State != StateRunning || running.Interval != "40ms" {
+		t.Errorf("station-03: state %q interval %s, want running at 40ms", running.State, running.Interval)
+	}
+	if running.Polls >= fast.Polls {
+		t.Errorf("station-03 polled %d times, station-01 %d; regen should poll faster", running.Polls, fast.Polls)
+	}
+
+	silent := stats(p, "station-02")
+	if silent.Failures == 0 || silent.Failures != silent.Polls || silent.ConsecutiveFailures != int(silent.Failures) {
+		t.Errorf("station-02: %+v, want every poll failed", silent)
+	}
+	if silent.LastError == "" {
+		t.Error("station-02: no last error")
+	}
+	// Doubling from 40ms: 80ms, 160ms, then capped at 200ms.
+	if silent.Polls > 4 {
+		t.Errorf("station-02 polled %d times, want backoff", silent.Polls)
+	}
+	if silent.Active || fast.Active {
+		t.Error("pollers still active after Run returned")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		0: 5 * time.Second,
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		5: 30 * time.Second,
+	} {
+		if got := backoff(5*time.Second, failures, 30*time.Second); got != want {
+			t.Errorf("%d failures: %s, want %s", failures, got, want)
+		}
+	}
+	if got := backoff(time.Minute, 2, 30*time.Second); got != time.Minute {
+		t.Errorf("an interval above the limit became %s", got)
+	}
+}
+
+func TestPollStationWithoutPumps(t *testing.T) {
+	reg := registry.New()
+	reg.UpdateFromHeartbeat("station-01", &protocol.HeartbeatPayload{Devices: []string{"DMM-01"}})
+	p := New(protocol.Source{}, nil, transport.NewDispatcher(), reg, nopHub{}, nil)
+	p.activate("station-01")
+
+	if got := p.pollOnce(context.Background(), "station-01"); got != DefaultIntervals().Idle {
+		t.Errorf("interval = %s, want the idle default", got)
+	}
+	if st := stats(p, "station-01"); st.Polls != 1 || st.State != StateIdle {
+		t.Errorf("stats = %+v", st)
+	}
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// FeatureBatchCommands is advertised in service.hello by stations that
+// execute device.command.batch_request. Other stations get the same
+// commands as individual device.command.request messages.
+const FeatureBatchCommands = "batch_commands"
+
+// MaxBatchCommands is the most commands one batch request may carry.
+const MaxBatchCommands = 16
+
+// BatchCommand is one command in a device.command.batch_request: a
+// device.command.request payload without raw passthrough.
+type BatchCommand struct {
+	DeviceID    string            `json:"device_id"`
+	CommandName string            `json:"command_name"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	TimeoutMs   *int              `json:"timeout_ms,omitempty"`
+}
+
+// BatchRequestPayload contains fields from the device.command.batch_request payload.
+type BatchRequestPayload struct {
+	Commands  []BatchCommand `json:"commands"`
+	TimeoutMs *int           `json:"timeout_ms,omitempty"`
+}
+
+// BatchResponsePayload contains fields from the device.command.batch_response
+// payload. Results[i] answers the request's Commands[i].
+type BatchResponsePayload struct {
+	Results    []CommandResponsePayload `json:"results"`
+	DurationMs *int                     `json:"duration_ms,omitempty"`
+}
+
+// BuildBatchRequest creates a device.command.batch_request message ready to
+// send to a station. It generates a correlation_id and sets reply_to to
+// "responses:{source.Instance}". timeoutMs is how long the sender will wait
+// for the whole batch; stations drop the batch once it has passed.
+func BuildBatchRequest(source Source, commands []BatchCommand, timeoutMs int) (*Message, error) {
+	payload := BatchRequestPayload{Commands: commands, TimeoutMs: &timeoutMs}
+	if err := ValidateBatchRequest(&payload); err != nil {
+		return nil, err
+	}
+
+	msg, err := NewMessage(source, TypeDeviceCommandBatchRequest, payload)
+	if err != nil {
+		return nil, fmt.Errorf("build batch request: %w", err)
+	}
+	msg.Envelope.CorrelationID = uuid.New().String()
+	msg.Envelope.ReplyTo = "responses:" + source.Instance
+	return msg, nil
+}
+
+// ParseBatchRequest extracts a BatchRequestPayload from a Message.
+func ParseBatchRequest(msg *Message) (*BatchRequestPayload, error) {
+	var p BatchRequestPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		return nil, fmt.Errorf("parse batch request payload: %w", err)
+	}
+	return &p, nil
+}
+
+// ParseBatchResponse extracts a BatchResponsePayload from a Message.
+func ParseBatchResponse(msg *Message) (*BatchResponsePayload, error) {
+	var p BatchResponsePayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		return nil, fmt.Errorf("parse batch response payload: %w", err)
+	}
+	return &p, nil
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBuildBatchRequest(t *testing.T) {
+	timeout := 2000
+	cmds := []BatchCommand{
+		{DeviceID: "PUMP-01", CommandName: "get_regen_status"},
+		{DeviceID: "PUMP-01", CommandName: "get_temp_1st_stage", TimeoutMs: &timeout},
+	}
+	msg, err := BuildBatchRequest(testSource(), cmds, 7000)
+	if err != nil {
+		t.Fatalf("BuildBatchRequest: %v", err)
+	}
+
+	if msg.Envelope.Type != TypeDeviceCommandBatchRequest {
+		t.Errorf("type = %q", msg.Envelope.Type)
+	}
+	if msg.Envelope.ReplyTo != "responses:ctrl-01" {
+		t.Errorf("reply_to = %q", msg.Envelope.ReplyTo)
+	}
+	if err := Validate(msg); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	data, _ := json.Marshal(msg)
+	if err := ValidateSchema(data); err != nil {
+		t.Errorf("ValidateSchema: %v", err)
+	}
+
+	p, err := ParseBatchRequest(msg)
+	if err != nil {
+		t.Fatalf("ParseBatchRequest: %v", err)
+	}
+	if len(p.Commands) != 2 || p.Commands[1].CommandName != "get_temp_1st_stage" || *p.Commands[1].TimeoutMs != 2000 {
+		t.Errorf("commands = %+v", p.Commands)
+	}
+	if p.TimeoutMs == nil || *p.TimeoutMs != 7000 {
+		t.Errorf("timeout_ms = %v, want 7000", p.TimeoutMs)
+	}
+}
+
+func TestValidateBatchRequest(t *testing.T) {
+	tooMany := make([]BatchCommand, MaxBatchCommands+1)
+	for i := range tooMany {
+		tooMany[i] = BatchCommand{DeviceID: "PUMP-01", CommandName: "get_status_1"}
+	}
+	short, long := 50, 700000
+
+	tests := []struct {
+		name    string
+		payload BatchRequestPayload
+		want    string
+	}{
+		{"empty", BatchRequestPayload{}, "commands"},
+		{"too_many", BatchRequestPayload{Commands: tooMany}, "commands"},
+		{"bad_device", BatchRequestPayload{Commands: []BatchCommand{{DeviceID: "pump 1", CommandName: "x"}}}, "commands[0].device_id"},
+		{"no_command", BatchRequestPayload{Commands: []BatchCommand{{DeviceID: "PUMP-01"}}}, "commands[0].command_name"},
+		{"item_timeout", BatchRequestPayload{Commands: []BatchCommand{{DeviceID: "PUMP-01", CommandName: "x", TimeoutMs: &short}}}, "commands[0].timeout_ms"},
+		{"batch_timeout", BatchRequestPayload{Commands: []BatchCommand{{DeviceID: "PUMP-01", CommandName: "x"}}, TimeoutMs: &long}, "timeout_ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBatchRequest(&tt.payload)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateBatchRequest = %v, want error about %s", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := BuildBatchRequest(testSource(), nil, 5000); err == nil {
+		t.Error("BuildBatchRequest accepted an empty batch")
+	}
+}
+
+func TestBatchResponseSchema(t *testing.T) {
+	resp, dur := "A", 12
+	msg, err := NewMessage(testSource(), TypeDeviceCommandBatchResponse, BatchResponsePayload{
+		Results: []CommandResponsePayload{
+			{DeviceID: "PUMP-01", CommandName: "get_regen_status", Success: true, Response: &resp, DurationMs: &dur},
+			{DeviceID: "PUMP-01", CommandName: "get_temp_1st_stage", Success: false,
+				Error: &Error{Code: ErrCodeDeviceTimeout, Message: "no answer"}},
+		},
+		DurationMs: &dur,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Envelope.CorrelationID = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	data, _ := json.Marshal(msg)
+	if err := ValidateSchema(data); err != nil {
+		t.Errorf("ValidateSchema: %v", err)
+	}
+
+	// A failed result without an error object does not conform.
+	msg.Payload = json.RawMessage(`{"results":[{"device_id":"PUMP-01","command_name":"x","success":false,"response":null}]}`)
+	data, _ = json.Marshal(msg)
+	if err := ValidateSchema(data); err == nil || !strings.Contains(err.Error(), "/payload/results/0") {
+		t.Errorf("ValidateSchema = %v, want a violation at /payload/results/0", err)
+	}
+}
@@ -0,0 +1,326 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Conformance tests keep the Go types in step with the JSON schemas under
+// schemas/: every message type has a schema, payload structs carry exactly
+// the schema's properties, enums match the Go constants, and every example
+// in every v1.x tree parses, validates and decodes without unknown fields.
+
+// payloadStructs maps each message type to the struct its payload decodes into.
+var payloadStructs = map[string]reflect.Type{
+	TypeDeviceCommandRequest:  reflect.TypeOf(CommandRequestPayload{}),
+	TypeDeviceCommandResponse: reflect.TypeOf(CommandResponsePayload{}),
+	TypeServiceHeartbeat:      reflect.TypeOf(HeartbeatPayload{}),
+	TypeServiceHello:          reflect.TypeOf(HelloPayload{}),
+	TypeSystemEmergencyStop:   reflect.TypeOf(EmergencyStopPayload{}),
+	TypeSystemOTARequest:      reflect.TypeOf(OTARequestPayload{}),
+	TypeTestStateUpdate:       reflect.TypeOf(TestStateUpdatePayload{}),
+	TypeTestControlRequest:    reflect.TypeOf(TestControlRequestPayload{}),
+	TypeTestControlResponse:   reflect.TypeOf(TestControlResponsePayload{}),
+
+	TypeDeviceCommandBatchRequest:  reflect.TypeOf(BatchRequestPayload{}),
+	TypeDeviceCommandBatchResponse: reflect.TypeOf(BatchResponsePayload{}),
+}
+
+// payloadItemStructs maps array payload properties to their element structs.
+var payloadItemStructs = map[string]map[string]reflect.Type{
+	TypeDeviceCommandBatchRequest:  {"commands": reflect.TypeOf(BatchCommand{})},
+	TypeDeviceCommandBatchResponse: {"results": reflect.TypeOf(CommandResponsePayload{})},
+}
+
+// schemaNode is the subset of JSON Schema the conformance tests inspect.
+type schemaNode struct {
+	Required   []string               `json:"required"`
+	Properties map[string]*schemaNode `json:"properties"`
+	Enum       []string               `json:"enum"`
+	Const      string                 `json:"const"`
+	Items      *schemaNode            `json:"items"`
+}
+
+// schemaDirName returns the schemas/ directory and file stem for a message
+// type, e.g. "system.emergency_stop" -> "system-emergency-stop".
+func schemaDirName(msgType string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(msgType)
+}
+
+func loadSchema(t *testing.T, path string) *schemaNode {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	var s schemaNode
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("parse schema %s: %v", path, err)
+	}
+	return &s
+}
+
+// property walks nested properties by name, failing the test if any is missing.
+func (s *schemaNode) property(t *testing.T, names ...string) *schemaNode {
+	t.Helper()
+	node := s
+	for _, name := range names {
+		next := node.Properties[name]
+		if next == nil {
+			t.Fatalf("schema has no property %q", strings.Join(names, "."))
+		}
+		node = next
+	}
+	return node
+}
+
+// jsonFields returns the JSON field names of a struct type and whether each
+// is tagged omitempty.
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := make(map[string]bool, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = strings.Contains(opts, "omitempty")
+	}
+	return fields
+}
+
+// checkFieldsMatch reports schema properties without a struct field, struct
+// fields without a schema property, and required properties tagged omitempty.
+func checkFieldsMatch(t *testing.T, what string, node *schemaNode, typ reflect.Type) {
+	t.Helper()
+	fields := jsonFields(typ)
+	for name := range node.Properties {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s: schema property %q has no field in %s", what, name, typ.Name())
+		}
+	}
+	for name := range fields {
+		if _, ok := node.Properties[name]; !ok {
+			t.Errorf("%s: %s field %q is not in the schema", what, typ.Name(), name)
+		}
+	}
+	for _, name := range node.Required {
+		if fields[name] {
+			t.Errorf("%s: required property %q is tagged omitempty in %s", what, name, typ.Name())
+		}
+	}
+}
+
+func sortedCopy(s []string) []string {
+	c := slices.Clone(s)
+	sort.Strings(c)
+	return c
+}
+
+func TestSchemaFilesCoverMessageTypes(t *testing.T) {
+	base := schemasDir()
+
+	for _, msgType := range ValidMessageTypes {
+		t.Run(msgType, func(t *testing.T) {
+			if _, ok := payloadStructs[msgType]; !ok {
+				t.Errorf("no payload struct registered for %q", msgType)
+			}
+			s := loadSchema(t, filepath.Join(base, schemaDirName(msgType)+".schema.json"))
+			if got := s.property(t, "envelope", "type").Const; got != msgType {
+				t.Errorf("envelope.type const = %q, want %q", got, msgType)
+			}
+		})
+	}
+
+	files, err := filepath.Glob(filepath.Join(base, "*.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := map[string]bool{"envelope": true, "error": true}
+	for _, msgType := range ValidMessageTypes {
+		known[schemaDirName(msgType)] = true
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".schema.json")
+		if !known[name] {
+			t.Errorf("%s has no matching message type in ValidMessageTypes", filepath.Base(f))
+		}
+	}
+}
+
+func TestEnvelopeSchemaMatchesGo(t *testing.T) {
+	s := loadSchema(t, filepath.Join(schemasDir(), "envelope.schema.json"))
+
+	got := sortedCopy(s.property(t, "envelope", "type").Enum)
+	want := sortedCopy(ValidMessageTypes)
+	if !slices.Equal(got, want) {
+		t.Errorf("envelope type enum = %v, ValidMessageTypes = %v", got, want)
+	}
+
+	checkFieldsMatch(t, "envelope", s.property(t, "envelope"), reflect.TypeOf(Envelope{}))
+	checkFieldsMatch(t, "envelope.source", s.property(t, "envelope", "source"), reflect.TypeOf(Source{}))
+}
+
+func TestPayloadSchemasMatchStructs(t *testing.T) {
+	base := schemasDir()
+
+	for msgType, typ := range payloadStructs {
+		t.Run(msgType, func(t *testing.T) {
+			s := loadSchema(t, filepath.Join(base, schemaDirName(msgType)+".schema.json"))
+			payload := s.property(t, "payload")
+			checkFieldsMatch(t, "payload", payload, typ)
+			if errNode := payload.Properties["error"]; errNode != nil {
+				checkFieldsMatch(t, "payload.error", errNode, reflect.TypeOf(Error{}))
+			}
+			for name, itemTyp := range payloadItemStructs[msgType] {
+				items := s.property(t, "payload", name).Items
+				if items == nil {
+					t.Fatalf("payload.%s has no items schema", name)
+				}
+				checkFieldsMatch(t, "payload."+name+"[]", items, itemTyp)
+				if errNode := items.Properties["error"]; errNode != nil {
+					checkFieldsMatch(t, "payload."+name+"[].error", errNode, reflect.TypeOf(Error{}))
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaEnumsMatchConstants(t *testing.T) {
+	base := schemasDir()
+	errorCodes := []string{
+		ErrCodeDeviceTimeout, ErrCodeDeviceNotFound, ErrCodeDeviceNotConnected, ErrCodeDeviceError,
+		ErrCodeCommandFailed, ErrCodeValidationFailed, ErrCodeInvalidParameter, ErrCodeInternal,
+	}
+
+	tests := []struct {
+		name  string
+		file  string
+		path  []string
+		wants []string
+	}{
+		{"test_states", "test-state-update.schema.json", []string{"payload", "state"}, TestStates},
+		{"test_control_actions", "test-control-request.schema.json", []string{"payload", "action"}, TestControlActions},
+		{"error_codes", "error.schema.json", []string{"code"}, errorCodes},
+		{"command_response_error_codes", "device-command-response.schema.json", []string{"payload", "error", "code"}, errorCodes},
+		{"test_control_response_error_codes", "test-control-response.schema.json", []string{"payload", "error", "code"}, errorCodes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := loadSchema(t, filepath.Join(base, tt.file))
+			got := sortedCopy(s.property(t, tt.path...).Enum)
+			if !slices.Equal(got, sortedCopy(tt.wants)) {
+				t.Errorf("%s enum = %v, want %v", strings.Join(tt.path, "."), got, tt.wants)
+			}
+		})
+	}
+}
+
+// validatePayload runs the payload checks that exist for a message type.
+func validatePayload(msg *Message) error {
+	switch msg.Envelope.Type {
+	case TypeTestStateUpdate:
+		p, err := ParseTestStateUpdate(msg)
+		if err != nil {
+			return err
+		}
+		return ValidateTestStateUpdate(p)
+	case TypeTestControlRequest:
+		p, err := ParseTestControlRequest(msg)
+		if err != nil {
+			return err
+		}
+		return ValidateTestControlRequest(p)
+	case TypeDeviceCommandBatchRequest:
+		p, err := ParseBatchRequest(msg)
+		if err != nil {
+			return err
+		}
+		return ValidateBatchRequest(p)
+	}
+	return nil
+}
+
+func TestExamplesConform(t *testing.T) {
+	versionDirs, err := filepath.Glob(schemasVersionDir("v1.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versionDirs) == 0 {
+		t.Fatal("no v1.x schema directories found")
+	}
+
+	for _, versionDir := range versionDirs {
+		examples, err := filepath.Glob(filepath.Join(versionDir, "*", "examples", "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range examples {
+			rel, _ := filepath.Rel(filepath.Dir(versionDir), path)
+			t.Run(filepath.ToSlash(rel), func(t *testing.T) {
+				dirName := filepath.Base(filepath.Dir(filepath.Dir(path)))
+				schemaPath := filepath.Join(versionDir, dirName+".schema.json")
+				if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
+					// v1.0.0 documented test.state.update without a schema file.
+					t.Skipf("no %s in %s", filepath.Base(schemaPath), filepath.Base(versionDir))
+				}
+				s := loadSchema(t, schemaPath)
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("read example: %v", err)
+				}
+
+				msg, err := Parse(data)
+				if err != nil {
+					t.Fatalf("Parse() error: %v", err)
+				}
+				if want := s.property(t, "envelope", "type").Const; msg.Envelope.Type != want {
+					t.Errorf("type = %q, want %q", msg.Envelope.Type, want)
+				}
+				if err := Validate(msg); err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				if err := validatePayload(msg); err != nil {
+					t.Errorf("payload validation error: %v", err)
+				}
+
+				// Unknown envelope or source fields.
+				dec := json.NewDecoder(bytes.NewReader(data))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(new(Message)); err != nil {
+					t.Errorf("strict decode of envelope: %v", err)
+				}
+
+				// Unknown payload fields.
+				typ, ok := payloadStructs[msg.Envelope.Type]
+				if !ok {
+					t.Fatalf("no payload struct registered for %q", msg.Envelope.Type)
+				}
+				dec = json.NewDecoder(bytes.NewReader(msg.Payload))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(reflect.New(typ).Interface()); err != nil {
+					t.Errorf("strict decode of payload: %v", err)
+				}
+
+				// Required payload fields.
+				var payload map[string]json.RawMessage
+				if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+					t.Fatalf("payload is not an object: %v", err)
+				}
+				for _, name := range s.property(t, "payload").Required {
+					if _, ok := payload[name]; !ok {
+						t.Errorf("payload is missing required field %q", name)
+					}
+				}
+			})
+		}
+	}
+}
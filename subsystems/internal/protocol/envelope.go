@@ -15,11 +15,21 @@ const (
 	TypeServiceHeartbeat      = "service.heartbeat"
 	TypeSystemEmergencyStop   = "system.emergency_stop"
 	TypeSystemOTARequest      = "system.ota.request"
+	TypeServiceHello          = "service.hello"
 
-	// TypeTestStateUpdate is an operational message type used by the test manager
-	// to notify stations about test state changes (display updates, control lockout).
-	// Not part of the 5 formal schema-validated types.
-	TypeTestStateUpdate = "test.state.update"
+	// TypeDeviceCommandBatchRequest carries several device commands in one
+	// round trip, answered by one TypeDeviceCommandBatchResponse. Only
+	// stations advertising FeatureBatchCommands receive batches.
+	TypeDeviceCommandBatchRequest  = "device.command.batch_request"
+	TypeDeviceCommandBatchResponse = "device.command.batch_response"
+
+	// TypeTestStateUpdate notifies a station about test state changes
+	// (display updates, control lockout). TypeTestControlRequest carries a
+	// station UI's pause/continue/terminate/abort button press to the
+	// controller, which answers with TypeTestControlResponse.
+	TypeTestStateUpdate     = "test.state.update"
+	TypeTestControlRequest  = "test.control.request"
+	TypeTestControlResponse = "test.control.response"
 )
 
 // ValidMessageTypes lists all valid message types.
@@ -29,10 +39,17 @@ var ValidMessageTypes = []string{
 	TypeServiceHeartbeat,
 	TypeSystemEmergencyStop,
 	TypeSystemOTARequest,
+	TypeServiceHello,
+	TypeTestStateUpdate,
+	TypeTestControlRequest,
+	TypeTestControlResponse,
+	TypeDeviceCommandBatchRequest,
+	TypeDeviceCommandBatchResponse,
 }
 
-// SchemaVersion is the current protocol version.
-const SchemaVersion = "v1.0.0"
+// SchemaVersion is the current protocol version. Peers accept any version
+// with the same major version; see CheckSchemaVersion.
+const SchemaVersion = "v1.1.0"
 
 // Message is the top-level protocol message containing an envelope and payload.
 type Message struct {
@@ -49,6 +66,8 @@ type Envelope struct {
 	Type          string `json:"type"`
 	CorrelationID string `json:"correlation_id,omitempty"`
 	ReplyTo       string `json:"reply_to,omitempty"`
+	// Signature is the optional HMAC-SHA256 of the message; see Sign.
+	Signature string `json:"signature,omitempty"`
 }
 
 // Source identifies who sent a message.
@@ -58,6 +77,18 @@ type Source struct {
 	Version  string `json:"version"`
 }
 
+// Error codes from the shared error schema.
+const (
+	ErrCodeDeviceTimeout      = "E_DEVICE_TIMEOUT"
+	ErrCodeDeviceNotFound     = "E_DEVICE_NOT_FOUND"
+	ErrCodeDeviceNotConnected = "E_DEVICE_NOT_CONNECTED"
+	ErrCodeDeviceError        = "E_DEVICE_ERROR"
+	ErrCodeCommandFailed      = "E_COMMAND_FAILED"
+	ErrCodeValidationFailed   = "E_VALIDATION_FAILED"
+	ErrCodeInvalidParameter   = "E_INVALID_PARAMETER"
+	ErrCodeInternal           = "E_INTERNAL"
+)
+
 // Error is a standard error object used in response payloads.
 type Error struct {
 	Code    string                 `json:"code"`
@@ -84,6 +115,17 @@ type HeartbeatPayload struct {
 	TimeSynced        *bool    `json:"time_synced,omitempty"`
 }
 
+// HelloPayload contains fields from the service.hello payload: what the
+// sender can handle, exchanged when a station connects. The sender's
+// protocol version is its envelope schema_version.
+type HelloPayload struct {
+	MessageTypes    []string `json:"message_types"`
+	Features        []string `json:"features"`
+	FirmwareVersion string   `json:"firmware_version,omitempty"`
+	// Request asks the receiver to answer with its own service.hello.
+	Request bool `json:"request,omitempty"`
+}
+
 // CommandRequestPayload contains fields from the device.command.request payload.
 type CommandRequestPayload struct {
 	DeviceID    string            `json:"device_id"`
@@ -206,6 +248,15 @@ func ParseOTARequest(msg *Message) (*OTARequestPayload, error) {
 	return &p, nil
 }
 
+// ParseHello extracts a HelloPayload from a Message.
+func ParseHello(msg *Message) (*HelloPayload, error) {
+	var p HelloPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		return nil, fmt.Errorf("parse hello payload: %w", err)
+	}
+	return &p, nil
+}
+
 // ParseTestStateUpdate extracts a TestStateUpdatePayload from a Message.
 func ParseTestStateUpdate(msg *Message) (*TestStateUpdatePayload, error) {
 	var p TestStateUpdatePayload
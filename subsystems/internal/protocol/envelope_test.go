@@ -104,10 +104,15 @@ func TestNewMessageRoundTrip(t *testing.T) {
 	}
 }
 
-// schemasDir returns the path to the schemas directory.
+// schemasDir returns the path to the schemas directory for SchemaVersion.
 func schemasDir() string {
+	return schemasVersionDir(SchemaVersion)
+}
+
+// schemasVersionDir returns the path to the schemas directory for version.
+func schemasVersionDir(version string) string {
 	_, filename, _, _ := runtime.Caller(0)
-	return filepath.Join(filepath.Dir(filename), "..", "..", "..", "schemas", "v1.0.0")
+	return filepath.Join(filepath.Dir(filename), "..", "..", "..", "schemas", version)
 }
 
 func TestParseExampleFiles(t *testing.T) {
@@ -121,8 +126,14 @@ func TestParseExampleFiles(t *testing.T) {
 		{"command_request_relay", "device-command-request/examples/set_relay.json", TypeDeviceCommandRequest},
 		{"command_response_success", "device-command-response/examples/success.json", TypeDeviceCommandResponse},
 		{"command_response_error", "device-command-response/examples/error_timeout.json", TypeDeviceCommandResponse},
+		{"batch_request_telemetry", "device-command-batch-request/examples/telemetry_queries.json", TypeDeviceCommandBatchRequest},
+		{"batch_response_partial", "device-command-batch-response/examples/partial_failure.json", TypeDeviceCommandBatchResponse},
 		{"emergency_stop_button", "system-emergency-stop/examples/button_press.json", TypeSystemEmergencyStop},
 		{"ota_request_standard", "system-ota-request/examples/standard_update.json", TypeSystemOTARequest},
+		{"hello_station_connect", "service-hello/examples/station_connect.json", TypeServiceHello},
+		{"test_state_running", "test-state-update/examples/test_running.json", TypeTestStateUpdate},
+		{"test_control_pause", "test-control-request/examples/pause.json", TypeTestControlRequest},
+		{"test_control_response_error", "test-control-response/examples/no_active_test.json", TypeTestControlResponse},
 	}
 
 	base := schemasDir()
@@ -148,6 +159,36 @@ func TestParseExampleFiles(t *testing.T) {
 	}
 }
 
+func TestOlderMinorExamplesValidate(t *testing.T) {
+	base := schemasVersionDir("v1.0.0")
+	paths := []string{
+		"service-heartbeat/examples/healthy.json",
+		"device-command-request/examples/measure_voltage.json",
+		"device-command-response/examples/success.json",
+		"system-emergency-stop/examples/button_press.json",
+		"system-ota-request/examples/standard_update.json",
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(base, path))
+			if err != nil {
+				t.Fatalf("read example file: %v", err)
+			}
+			msg, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if msg.Envelope.SchemaVersion != "v1.0.0" {
+				t.Fatalf("SchemaVersion = %q, want v1.0.0", msg.Envelope.SchemaVersion)
+			}
+			if err := Validate(msg); err != nil {
+				t.Errorf("Validate() error: %v", err)
+			}
+		})
+	}
+}
+
 func TestParseInvalidJSON(t *testing.T) {
 	tests := []struct {
 		name string
@@ -309,4 +350,27 @@ func TestTypedPayloadParsers(t *testing.T) {
 			t.Errorf("SHA256 = %q, want expected hash", p.SHA256)
 		}
 	})
+	t.Run("hello", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join(base, "service-hello/examples/station_connect.json"))
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		msg, err := Parse(data)
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		p, err := ParseHello(msg)
+		if err != nil {
+			t.Fatalf("ParseHello: %v", err)
+		}
+		if !p.Request {
+			t.Error("Request should be true")
+		}
+		if len(p.MessageTypes) != 6 {
+			t.Errorf("MessageTypes = %v, want 6 entries", p.MessageTypes)
+		}
+		if len(p.Features) != 4 || p.Features[0] != FeatureRawCommands {
+			t.Errorf("Features = %v, want 4 entries starting with %q", p.Features, FeatureRawCommands)
+		}
+	})
 }
@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Command features a station can advertise in service.hello. A station that
+// never says hello (protocol v1.0) is assumed to support none of them.
+const (
+	FeatureRawCommands   = "raw_commands"   // device.command.request "raw" passthrough
+	FeatureCommandDedup  = "command_dedup"  // redelivered commands skipped by correlation_id
+	FeatureCommandExpiry = "command_expiry" // commands past timeout_ms dropped unexecuted
+	FeatureOTA           = "ota"            // system.ota.request
+)
+
+// BuildHello creates a service.hello message advertising messageTypes and
+// features. Set request to ask the receiver to answer with its own hello.
+func BuildHello(source Source, messageTypes, features []string, firmwareVersion string, request bool) (*Message, error) {
+	env := NewEnvelope(source, TypeServiceHello)
+
+	payload := HelloPayload{
+		MessageTypes:    messageTypes,
+		Features:        features,
+		FirmwareVersion: firmwareVersion,
+		Request:         request,
+	}
+	if payload.MessageTypes == nil {
+		payload.MessageTypes = []string{}
+	}
+	if payload.Features == nil {
+		payload.Features = []string{}
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal hello payload: %w", err)
+	}
+
+	return &Message{
+		Envelope: env,
+		Payload:  json.RawMessage(payloadBytes),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildHello(t *testing.T) {
+	src := Source{Service: "controller", Instance: "ctrl-01", Version: "1.0.0"}
+	msg, err := BuildHello(src, []string{TypeDeviceCommandRequest, TypeServiceHello}, []string{FeatureCommandDedup}, "1.0.0", true)
+	if err != nil {
+		t.Fatalf("BuildHello: %v", err)
+	}
+	if msg.Envelope.Type != TypeServiceHello {
+		t.Errorf("Type = %q, want %q", msg.Envelope.Type, TypeServiceHello)
+	}
+	if msg.Envelope.CorrelationID != "" || msg.Envelope.ReplyTo != "" {
+		t.Error("hello should not carry correlation_id or reply_to")
+	}
+	if err := Validate(msg); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p, err := ParseHello(parsed)
+	if err != nil {
+		t.Fatalf("ParseHello: %v", err)
+	}
+	if len(p.MessageTypes) != 2 || p.MessageTypes[1] != TypeServiceHello {
+		t.Errorf("MessageTypes = %v", p.MessageTypes)
+	}
+	if len(p.Features) != 1 || p.Features[0] != FeatureCommandDedup {
+		t.Errorf("Features = %v", p.Features)
+	}
+	if p.FirmwareVersion != "1.0.0" {
+		t.Errorf("FirmwareVersion = %q, want 1.0.0", p.FirmwareVersion)
+	}
+	if !p.Request {
+		t.Error("Request should be true")
+	}
+}
+
+func TestBuildHelloNilSlices(t *testing.T) {
+	src := Source{Service: "controller", Instance: "ctrl-01", Version: "1.0.0"}
+	msg, err := BuildHello(src, nil, nil, "", false)
+	if err != nil {
+		t.Fatalf("BuildHello: %v", err)
+	}
+	// message_types and features are required, so they must encode as [].
+	want := `{"message_types":[],"features":[]}`
+	if string(msg.Payload) != want {
+		t.Errorf("Payload = %s, want %s", msg.Payload, want)
+	}
+}
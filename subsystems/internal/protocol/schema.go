@@ -0,0 +1,235 @@
+package protocol
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// schemaFS holds a copy of every schemas/<version>/*.schema.json file.
+// Refresh it with "make sync-schemas" after editing the schemas;
+// TestEmbeddedSchemasMatchSource fails while the copy is stale.
+//
+//go:embed schemas
+var schemaFS embed.FS
+
+// SchemaError reports a message that does not conform to its JSON schema.
+type SchemaError struct {
+	Version string   // schema tree the message was checked against, e.g. "v1.1.0"
+	Schema  string   // schema file, e.g. "service-heartbeat.schema.json"
+	Causes  []string // one line per violation, e.g. "/payload/status: value must be one of ..."
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s/%s: %s", e.Version, e.Schema, strings.Join(e.Causes, "; "))
+}
+
+// schemaTree is the compiled schemas of one protocol version.
+type schemaTree struct {
+	version  Version
+	name     string
+	envelope *jsonschema.Schema
+	types    map[string]typeSchema // by message type
+}
+
+// typeSchema is a compiled message type schema and the file it came from.
+type typeSchema struct {
+	file   string
+	schema *jsonschema.Schema
+}
+
+var (
+	schemaTreesOnce sync.Once
+	schemaTrees     []*schemaTree // oldest first
+	schemaTreesErr  error
+)
+
+func loadSchemaTrees() ([]*schemaTree, error) {
+	schemaTreesOnce.Do(func() {
+		schemaTrees, schemaTreesErr = compileSchemaTrees(schemaFS)
+	})
+	return schemaTrees, schemaTreesErr
+}
+
+func compileSchemaTrees(fsys fs.FS) ([]*schemaTree, error) {
+	dirs, err := fs.ReadDir(fsys, "schemas")
+	if err != nil {
+		return nil, err
+	}
+
+	var trees []*schemaTree
+	for _, dir := range dirs {
+		v, err := ParseVersion(dir.Name())
+		if err != nil || !dir.IsDir() {
+			continue
+		}
+		tree, err := compileSchemaTree(fsys, dir.Name(), v)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].version.Less(trees[j].version) })
+	return trees, nil
+}
+
+func compileSchemaTree(fsys fs.FS, name string, v Version) (*schemaTree, error) {
+	files, err := fs.Glob(fsys, path.Join("schemas", name, "*.schema.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft7)
+	msgTypes := make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		if err := c.AddResource(schemaURL(f), doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		msgTypes[f] = envelopeTypeConst(doc)
+	}
+
+	tree := &schemaTree{version: v, name: name, types: make(map[string]typeSchema)}
+	for _, f := range files {
+		sch, err := c.Compile(schemaURL(f))
+		if err != nil {
+			return nil, fmt.Errorf("compile %s: %w", f, err)
+		}
+		switch base := path.Base(f); base {
+		case "envelope.schema.json":
+			tree.envelope = sch
+		case "error.schema.json":
+			// Shared definition; embedded in each response schema.
+		default:
+			tree.types[msgTypes[f]] = typeSchema{file: base, schema: sch}
+		}
+	}
+	if tree.envelope == nil {
+		return nil, fmt.Errorf("schemas/%s: no envelope.schema.json", name)
+	}
+	return tree, nil
+}
+
+func schemaURL(file string) string {
+	return "embed:///" + file
+}
+
+// envelopeTypeConst returns the message type a schema describes, its
+// envelope.type const, or "" for the shared envelope and error schemas.
+func envelopeTypeConst(doc any) string {
+	cur := doc
+	for _, key := range []string{"properties", "envelope", "properties", "type", "const"} {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return ""
+		}
+		cur = m[key]
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+// treeFor picks the schema tree to check a message of schema_version v
+// against: the newest tree not newer than v with the same major version.
+// A message newer than every tree is checked against the newest one.
+func treeFor(trees []*schemaTree, v Version) *schemaTree {
+	var pick *schemaTree
+	for _, t := range trees {
+		if t.version.Major != v.Major {
+			continue
+		}
+		if pick == nil || !v.Less(t.version) {
+			pick = t
+		}
+	}
+	return pick
+}
+
+// ValidateSchema checks a raw JSON message against the JSON schemas in
+// schemas/: the shared envelope schema and the schema for its type, from
+// the schema tree matching its schema_version. It is stricter than
+// Validate, which only checks envelope rules: unknown fields, missing
+// payload fields and out-of-range values are all reported. Violations are
+// returned as a *SchemaError.
+func ValidateSchema(data []byte) error {
+	trees, err := loadSchemaTrees()
+	if err != nil {
+		return fmt.Errorf("load schemas: %w", err)
+	}
+
+	msg, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if err := CheckSchemaVersion(msg.Envelope.SchemaVersion); err != nil {
+		return fmt.Errorf("invalid schema_version: %w", err)
+	}
+	v, _ := ParseVersion(msg.Envelope.SchemaVersion)
+	tree := treeFor(trees, v)
+	if tree == nil {
+		return fmt.Errorf("no schemas for %s", msg.Envelope.SchemaVersion)
+	}
+
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("parse message: %w", err)
+	}
+
+	if err := checkSchema(tree, "envelope.schema.json", tree.envelope, inst); err != nil {
+		return err
+	}
+	// Types documented without a schema file (test.state.update in
+	// v1.0.0) are only checked against the envelope schema.
+	if ts, ok := tree.types[msg.Envelope.Type]; ok {
+		if err := checkSchema(tree, ts.file, ts.schema, inst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSchema(tree *schemaTree, file string, sch *jsonschema.Schema, inst any) error {
+	err := sch.Validate(inst)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("%s/%s: %w", tree.name, file, err)
+	}
+	return &SchemaError{Version: tree.name, Schema: file, Causes: schemaCauses(ve)}
+}
+
+// schemaCauses flattens a validation error into one line per violation.
+func schemaCauses(ve *jsonschema.ValidationError) []string {
+	var causes []string
+	for _, unit := range ve.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		loc := unit.InstanceLocation
+		if loc == "" {
+			loc = "/"
+		}
+		causes = append(causes, loc+": "+unit.Error.String())
+	}
+	if len(causes) == 0 {
+		causes = append(causes, ve.Error())
+	}
+	return causes
+}
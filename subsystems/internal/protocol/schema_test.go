@@ -0,0 +1,214 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedSchemasMatchSource(t *testing.T) {
+	source, err := filepath.Glob(filepath.Join(schemasVersionDir("v*"), "*.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(source) == 0 {
+		t.Fatal("no schema files found under schemas/")
+	}
+
+	want := make(map[string]bool)
+	for _, path := range source {
+		name := filepath.ToSlash(filepath.Join("schemas", filepath.Base(filepath.Dir(path)), filepath.Base(path)))
+		want[name] = true
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		embedded, err := fs.ReadFile(schemaFS, name)
+		if err != nil {
+			t.Errorf("%s is not embedded; run \"make sync-schemas\"", name)
+			continue
+		}
+		if !bytes.Equal(src, embedded) {
+			t.Errorf("embedded %s differs from the source; run \"make sync-schemas\"", name)
+		}
+	}
+
+	embedded, err := fs.Glob(schemaFS, "schemas/*/*.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range embedded {
+		if !want[name] {
+			t.Errorf("embedded %s has no source file; run \"make sync-schemas\"", name)
+		}
+	}
+}
+
+func TestValidateSchemaExamples(t *testing.T) {
+	examples, err := filepath.Glob(filepath.Join(schemasVersionDir("v*"), "*", "examples", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range examples {
+		rel, _ := filepath.Rel(schemasVersionDir(""), path)
+		t.Run(filepath.ToSlash(rel), func(t *testing.T) {
+			versionDir := filepath.Dir(filepath.Dir(filepath.Dir(path)))
+			if _, err := os.Stat(filepath.Join(versionDir, filepath.Base(filepath.Dir(filepath.Dir(path)))+".schema.json")); os.IsNotExist(err) {
+				t.Skip("no schema file for this type in this version")
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateSchema(data); err != nil {
+				t.Errorf("ValidateSchema: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaBuiltMessages(t *testing.T) {
+	src := testSource()
+	hello, _ := BuildHello(src, ValidMessageTypes, []string{FeatureCommandDedup}, "1.0.0", true)
+	state, _ := BuildTestStateUpdate(src, TestStateRunning, "run-1", "cooldown", 5)
+	control, _ := BuildTestControlResponse(src, "station-01", TestActionPause,
+		&Error{Code: ErrCodeCommandFailed, Message: "cannot pause: session is paused"})
+	heartbeat, _ := NewMessage(src, TypeServiceHeartbeat, HeartbeatPayload{
+		Status: "running", Devices: []string{}, FirmwareVersion: "1.0.0",
+	})
+
+	for name, msg := range map[string]*Message{
+		"hello":                 hello,
+		"test_state_update":     state,
+		"test_control_response": control,
+		"heartbeat":             heartbeat,
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateSchema(data); err != nil {
+				t.Errorf("ValidateSchema: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaViolations(t *testing.T) {
+	envelope := `"envelope":{"id":"2f6a8c14-9b3d-4e7a-8c51-0d2e3f4a5b61","timestamp":1771336860,` +
+		`"source":{"service":"dmm_station","instance":"dmm-station-01","version":"1.1.0"},` +
+		`"schema_version":"v1.1.0","type":"%s"%s}`
+
+	tests := []struct {
+		name      string
+		msgType   string
+		extraEnv  string
+		payload   string
+		wantFile  string
+		wantCause string
+	}{
+		{
+			name:      "unknown_envelope_field",
+			msgType:   TypeTestControlRequest,
+			extraEnv:  `,"trace":"x"`,
+			payload:   `{"station_instance":"dmm-station-01","action":"pause"}`,
+			wantFile:  "envelope.schema.json",
+			wantCause: "/envelope:",
+		},
+		{
+			name:      "unknown_payload_field",
+			msgType:   TypeTestControlRequest,
+			payload:   `{"station_instance":"dmm-station-01","action":"pause","reason":"lunch"}`,
+			wantFile:  "test-control-request.schema.json",
+			wantCause: "/payload:",
+		},
+		{
+			name:      "bad_enum",
+			msgType:   TypeTestControlRequest,
+			payload:   `{"station_instance":"dmm-station-01","action":"stop"}`,
+			wantFile:  "test-control-request.schema.json",
+			wantCause: "/payload/action:",
+		},
+		{
+			name:      "missing_required",
+			msgType:   TypeServiceHeartbeat,
+			payload:   `{"status":"running","uptime_seconds":1,"devices":[],"free_heap":1000,"firmware_version":"1.0.0"}`,
+			wantFile:  "service-heartbeat.schema.json",
+			wantCause: "wifi_rssi",
+		},
+		{
+			name:      "failure_without_error",
+			msgType:   TypeTestControlResponse,
+			payload:   `{"station_instance":"dmm-station-01","action":"pause","success":false}`,
+			wantFile:  "test-control-response.schema.json",
+			wantCause: "error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte("{" + fmt.Sprintf(envelope, tt.msgType, tt.extraEnv) + `,"payload":` + tt.payload + "}")
+			err := ValidateSchema(data)
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("ValidateSchema = %v, want *SchemaError", err)
+			}
+			if se.Version != SchemaVersion || se.Schema != tt.wantFile {
+				t.Errorf("schema = %s/%s, want %s/%s", se.Version, se.Schema, SchemaVersion, tt.wantFile)
+			}
+			if !strings.Contains(se.Error(), tt.wantCause) {
+				t.Errorf("error %q does not mention %q", se.Error(), tt.wantCause)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaRejectsOtherMajor(t *testing.T) {
+	msg, _ := BuildTestControlRequest(testSource(), "ctrl-01", TestActionPause)
+	msg.Envelope.SchemaVersion = "v2.0.0"
+	data, _ := json.Marshal(msg)
+	err := ValidateSchema(data)
+	if err == nil {
+		t.Fatal("expected error for v2.0.0")
+	}
+	var se *SchemaError
+	if errors.As(err, &se) {
+		t.Errorf("got *SchemaError %v, want a version error", err)
+	}
+}
+
+func TestSchemaTreeFor(t *testing.T) {
+	trees, err := loadSchemaTrees()
+	if err != nil {
+		t.Fatalf("loadSchemaTrees: %v", err)
+	}
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.0.0", "v1.0.0"},
+		{"v1.0.7", "v1.0.0"},
+		{"v1.1.0", "v1.1.0"},
+		{"v1.9.0", SchemaVersion}, // newer than any tree: checked against the newest
+	}
+	for _, tt := range tests {
+		v, _ := ParseVersion(tt.version)
+		tree := treeFor(trees, v)
+		if tree == nil || tree.name != tt.want {
+			t.Errorf("treeFor(%s) = %v, want %s", tt.version, tree, tt.want)
+		}
+	}
+	if tree := treeFor(trees, Version{Major: 2}); tree != nil {
+		t.Errorf("treeFor(v2.0.0) = %s, want nil", tree.name)
+	}
+}
@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	stationKey = []byte("0123456789abcdef0123456789abcdef")
+	otherKey   = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func signedCommand(t *testing.T) *Message {
+	t.Helper()
+	msg, err := BuildCommandRequest(testSource(), "PUMP-01", "pump_status", nil, 5000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(msg, stationKey); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestSignAndVerify(t *testing.T) {
+	msg := signedCommand(t)
+	if len(msg.Envelope.Signature) != 64 {
+		t.Fatalf("signature = %q", msg.Envelope.Signature)
+	}
+	if err := Validate(msg); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	data, _ := json.Marshal(msg)
+	if err := ValidateSchema(data); err != nil {
+		t.Errorf("ValidateSchema: %v", err)
+	}
+
+	// The signature survives the wire, including payload reformatting.
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.Payload = json.RawMessage(`{ "device_id": "PUMP-01", "command_name": "pump_status", "timeout_ms": 5000 }`)
+	if err := VerifySignature(parsed, otherKey, stationKey); err != nil {
+		t.Errorf("VerifySignature: %v", err)
+	}
+
+	tampered := *parsed
+	tampered.Payload = json.RawMessage(`{"device_id":"PUMP-01","command_name":"start_regen","timeout_ms":5000}`)
+	if err := VerifySignature(&tampered, stationKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered payload: err = %v, want ErrBadSignature", err)
+	}
+	tampered = *parsed
+	tampered.Envelope.ReplyTo = "responses:evil"
+	if err := VerifySignature(&tampered, stationKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered envelope: err = %v, want ErrBadSignature", err)
+	}
+	if err := VerifySignature(parsed, otherKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("wrong key: err = %v, want ErrBadSignature", err)
+	}
+
+	parsed.Envelope.Signature = ""
+	if err := VerifySignature(parsed, stationKey); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned: err = %v, want ErrUnsigned", err)
+	}
+
+	parsed.Envelope.Signature = "NOT-HEX"
+	if err := Validate(parsed); err == nil {
+		t.Error("Validate accepted a malformed signature")
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	keys := func(station string) [][]byte {
+		if station == "station-01" {
+			return [][]byte{otherKey, stationKey}
+		}
+		return nil
+	}
+	now := time.Now()
+	v := NewVerifier(keys, false, 0)
+	v.now = func() time.Time { return now }
+
+	msg := signedCommand(t)
+	msg.Envelope.Timestamp = now.Unix()
+	Sign(msg, stationKey)
+
+	if err := v.Verify(msg, "station-01"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := v.Verify(msg, "station-01"); !errors.Is(err, ErrReplay) {
+		t.Errorf("second delivery: err = %v, want ErrReplay", err)
+	}
+
+	unsigned, _ := BuildCommandRequest(testSource(), "PUMP-01", "pump_status", nil, 5000, false)
+	if err := v.Verify(unsigned, "station-01"); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned for keyed station: err = %v, want ErrUnsigned", err)
+	}
+	if err := v.Verify(unsigned, "station-02"); err != nil {
+		t.Errorf("unsigned for station without keys: %v", err)
+	}
+	if err := NewVerifier(keys, true, 0).Verify(unsigned, "station-02"); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned with signatures required: err = %v, want ErrUnsigned", err)
+	}
+
+	old := signedCommand(t)
+	old.Envelope.Timestamp = now.Add(-2 * DefaultReplayWindow).Unix()
+	Sign(old, stationKey)
+	if err := v.Verify(old, "station-01"); !errors.Is(err, ErrReplay) {
+		t.Errorf("stale timestamp: err = %v, want ErrReplay", err)
+	}
+
+	// Remembered IDs are forgotten once their timestamp leaves the window.
+	now = now.Add(3 * DefaultReplayWindow)
+	fresh := signedCommand(t)
+	fresh.Envelope.Timestamp = now.Unix()
+	Sign(fresh, stationKey)
+	if err := v.Verify(fresh, "station-01"); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, ok := v.seen[msg.Envelope.ID]; ok || len(v.seen) != 1 {
+		t.Errorf("cache holds %d IDs, want only the fresh one", len(v.seen))
+	}
+}
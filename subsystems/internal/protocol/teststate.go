@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Test states carried by test.state.update.
+const (
+	TestStateRunning   = "running"
+	TestStatePaused    = "paused"
+	TestStateCompleted = "completed"
+	TestStateAborted   = "aborted"
+)
+
+// TestStates lists every valid test.state.update state.
+var TestStates = []string{TestStateRunning, TestStatePaused, TestStateCompleted, TestStateAborted}
+
+// Actions a station UI can request with test.control.request.
+const (
+	TestActionPause     = "pause"
+	TestActionContinue  = "continue"
+	TestActionTerminate = "terminate"
+	TestActionAbort     = "abort"
+)
+
+// TestControlActions lists every valid test.control.request action.
+var TestControlActions = []string{TestActionPause, TestActionContinue, TestActionTerminate, TestActionAbort}
+
+// TestControlRequestPayload contains fields from the test.control.request payload.
+type TestControlRequestPayload struct {
+	StationInstance string `json:"station_instance"`
+	Action          string `json:"action"`
+}
+
+// TestControlResponsePayload contains fields from the test.control.response
+// payload, the controller's answer to a test.control.request.
+type TestControlResponsePayload struct {
+	StationInstance string `json:"station_instance"`
+	Action          string `json:"action"`
+	Success         bool   `json:"success"`
+	Error           *Error `json:"error,omitempty"`
+}
+
+// BuildTestStateUpdate creates a test.state.update message for a station's
+// command stream.
+func BuildTestStateUpdate(source Source, state, testID, testName string, elapsedSeconds uint32) (*Message, error) {
+	payload := TestStateUpdatePayload{
+		State:          state,
+		TestID:         testID,
+		TestName:       testName,
+		ElapsedSeconds: elapsedSeconds,
+	}
+	if err := ValidateTestStateUpdate(&payload); err != nil {
+		return nil, err
+	}
+	return NewMessage(source, TypeTestStateUpdate, payload)
+}
+
+// BuildTestControlRequest creates a test.control.request message asking the
+// controller to apply action to the test on stationInstance.
+func BuildTestControlRequest(source Source, stationInstance, action string) (*Message, error) {
+	payload := TestControlRequestPayload{
+		StationInstance: stationInstance,
+		Action:          action,
+	}
+	if err := ValidateTestControlRequest(&payload); err != nil {
+		return nil, err
+	}
+	return NewMessage(source, TypeTestControlRequest, payload)
+}
+
+// BuildTestControlResponse creates a test.control.response message. A nil
+// respErr reports success.
+func BuildTestControlResponse(source Source, stationInstance, action string, respErr *Error) (*Message, error) {
+	payload := TestControlResponsePayload{
+		StationInstance: stationInstance,
+		Action:          action,
+		Success:         respErr == nil,
+		Error:           respErr,
+	}
+	return NewMessage(source, TypeTestControlResponse, payload)
+}
+
+// ParseTestControlRequest extracts a TestControlRequestPayload from a Message.
+func ParseTestControlRequest(msg *Message) (*TestControlRequestPayload, error) {
+	var p TestControlRequestPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		return nil, fmt.Errorf("parse test control request payload: %w", err)
+	}
+	return &p, nil
+}
+
+// ParseTestControlResponse extracts a TestControlResponsePayload from a Message.
+func ParseTestControlResponse(msg *Message) (*TestControlResponsePayload, error) {
+	var p TestControlResponsePayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		return nil, fmt.Errorf("parse test control response payload: %w", err)
+	}
+	return &p, nil
+}
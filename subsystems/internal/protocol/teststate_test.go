@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildTestStateUpdate(t *testing.T) {
+	msg, err := BuildTestStateUpdate(testSource(), TestStatePaused, "run-42", "cooldown", 90)
+	if err != nil {
+		t.Fatalf("BuildTestStateUpdate: %v", err)
+	}
+	if msg.Envelope.Type != TypeTestStateUpdate {
+		t.Errorf("Type = %q, want %q", msg.Envelope.Type, TypeTestStateUpdate)
+	}
+	if err := Validate(msg); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	p, err := ParseTestStateUpdate(msg)
+	if err != nil {
+		t.Fatalf("ParseTestStateUpdate: %v", err)
+	}
+	want := TestStateUpdatePayload{State: TestStatePaused, TestID: "run-42", TestName: "cooldown", ElapsedSeconds: 90}
+	if *p != want {
+		t.Errorf("payload = %+v, want %+v", *p, want)
+	}
+}
+
+func TestBuildTestStateUpdateRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  string
+		testID string
+	}{
+		{"unknown_state", "stopped", "run-42"},
+		{"empty_state", "", "run-42"},
+		{"empty_test_id", TestStateRunning, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildTestStateUpdate(testSource(), tt.state, tt.testID, "cooldown", 0); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTestControlRequestRoundTrip(t *testing.T) {
+	src := Source{Service: "dmm_station", Instance: "dmm-station-01", Version: "1.1.0"}
+	msg, err := BuildTestControlRequest(src, "dmm-station-01", TestActionTerminate)
+	if err != nil {
+		t.Fatalf("BuildTestControlRequest: %v", err)
+	}
+	if err := Validate(msg); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if parsed.Envelope.Type != TypeTestControlRequest {
+		t.Errorf("Type = %q, want %q", parsed.Envelope.Type, TypeTestControlRequest)
+	}
+	p, err := ParseTestControlRequest(parsed)
+	if err != nil {
+		t.Fatalf("ParseTestControlRequest: %v", err)
+	}
+	if p.StationInstance != "dmm-station-01" || p.Action != TestActionTerminate {
+		t.Errorf("payload = %+v", *p)
+	}
+}
+
+func TestBuildTestControlRequestRejectsInvalid(t *testing.T) {
+	src := Source{Service: "dmm_station", Instance: "dmm-station-01", Version: "1.1.0"}
+	tests := []struct {
+		name     string
+		instance string
+		action   string
+	}{
+		{"unknown_action", "dmm-station-01", "stop"},
+		{"empty_action", "dmm-station-01", ""},
+		{"empty_instance", "", TestActionPause},
+		{"bad_instance", "DMM Station", TestActionPause},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildTestControlRequest(src, tt.instance, tt.action); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestBuildTestControlResponse(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		msg, err := BuildTestControlResponse(testSource(), "dmm-station-01", TestActionPause, nil)
+		if err != nil {
+			t.Fatalf("BuildTestControlResponse: %v", err)
+		}
+		if err := Validate(msg); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+		// error is omitted on success.
+		want := `{"station_instance":"dmm-station-01","action":"pause","success":true}`
+		if string(msg.Payload) != want {
+			t.Errorf("Payload = %s, want %s", msg.Payload, want)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		respErr := &Error{Code: ErrCodeCommandFailed, Message: "no active test on station dmm-station-01"}
+		msg, err := BuildTestControlResponse(testSource(), "dmm-station-01", TestActionContinue, respErr)
+		if err != nil {
+			t.Fatalf("BuildTestControlResponse: %v", err)
+		}
+		p, err := ParseTestControlResponse(msg)
+		if err != nil {
+			t.Fatalf("ParseTestControlResponse: %v", err)
+		}
+		if p.Success {
+			t.Error("Success should be false")
+		}
+		if p.Error == nil || p.Error.Code != ErrCodeCommandFailed {
+			t.Errorf("Error = %+v, want code %s", p.Error, ErrCodeCommandFailed)
+		}
+	})
+}
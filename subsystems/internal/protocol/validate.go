@@ -3,6 +3,7 @@ package protocol
 import (
 	"fmt"
 	"regexp"
+	"slices"
 )
 
 // Compiled regex patterns matching the JSON schema definitions.
@@ -12,6 +13,8 @@ var (
 	instancePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
 	versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
 	replyToPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_:/-]*$`)
+	deviceIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+	signaturePattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
 )
 
 // validTypes is a set for fast type lookup.
@@ -27,11 +30,15 @@ var validTypes = func() map[string]bool {
 var requestTypes = map[string]bool{
 	TypeDeviceCommandRequest: true,
 	TypeSystemOTARequest:     true,
+
+	TypeDeviceCommandBatchRequest: true,
 }
 
 // responseTypes require correlation_id.
 var responseTypes = map[string]bool{
 	TypeDeviceCommandResponse: true,
+
+	TypeDeviceCommandBatchResponse: true,
 }
 
 // Validate checks a Message against protocol rules.
@@ -53,9 +60,9 @@ func Validate(msg *Message) error {
 		return err
 	}
 
-	// Validate schema_version.
-	if env.SchemaVersion != SchemaVersion {
-		return fmt.Errorf("invalid schema_version: must be %q, got %q", SchemaVersion, env.SchemaVersion)
+	// Validate schema_version: same major version as this build.
+	if err := CheckSchemaVersion(env.SchemaVersion); err != nil {
+		return fmt.Errorf("invalid schema_version: %w", err)
 	}
 
 	// Validate type.
@@ -77,6 +84,14 @@ func Validate(msg *Message) error {
 		}
 	}
 
+	// Validate signature format if present. Whether it matches is checked
+	// by a Verifier, which holds the keys.
+	if env.Signature != "" {
+		if !signaturePattern.MatchString(env.Signature) {
+			return fmt.Errorf("invalid signature: must be 64 lowercase hex characters, got %q", env.Signature)
+		}
+	}
+
 	// Request types require correlation_id and reply_to.
 	if requestTypes[env.Type] {
 		if env.CorrelationID == "" {
@@ -97,6 +112,53 @@ func Validate(msg *Message) error {
 	return nil
 }
 
+// ValidateTestStateUpdate checks a test.state.update payload against its
+// schema.
+func ValidateTestStateUpdate(p *TestStateUpdatePayload) error {
+	if !slices.Contains(TestStates, p.State) {
+		return fmt.Errorf("invalid state: must be one of %v, got %q", TestStates, p.State)
+	}
+	if p.TestID == "" {
+		return fmt.Errorf("missing test_id")
+	}
+	return nil
+}
+
+// ValidateTestControlRequest checks a test.control.request payload against
+// its schema.
+func ValidateTestControlRequest(p *TestControlRequestPayload) error {
+	if p.StationInstance == "" || len(p.StationInstance) > 64 || !instancePattern.MatchString(p.StationInstance) {
+		return fmt.Errorf("invalid station_instance: must match pattern %q (1-64 chars), got %q", instancePattern.String(), p.StationInstance)
+	}
+	if !slices.Contains(TestControlActions, p.Action) {
+		return fmt.Errorf("invalid action: must be one of %v, got %q", TestControlActions, p.Action)
+	}
+	return nil
+}
+
+// ValidateBatchRequest checks a device.command.batch_request payload against
+// its schema.
+func ValidateBatchRequest(p *BatchRequestPayload) error {
+	if len(p.Commands) == 0 || len(p.Commands) > MaxBatchCommands {
+		return fmt.Errorf("invalid commands: must have 1-%d entries, got %d", MaxBatchCommands, len(p.Commands))
+	}
+	for i, c := range p.Commands {
+		if c.DeviceID == "" || len(c.DeviceID) > 64 || !deviceIDPattern.MatchString(c.DeviceID) {
+			return fmt.Errorf("invalid commands[%d].device_id: must match pattern %q (1-64 chars), got %q", i, deviceIDPattern.String(), c.DeviceID)
+		}
+		if c.CommandName == "" || len(c.CommandName) > 256 {
+			return fmt.Errorf("invalid commands[%d].command_name: must be 1-256 chars, got %d", i, len(c.CommandName))
+		}
+		if c.TimeoutMs != nil && (*c.TimeoutMs < 100 || *c.TimeoutMs > 300000) {
+			return fmt.Errorf("invalid commands[%d].timeout_ms: must be 100-300000, got %d", i, *c.TimeoutMs)
+		}
+	}
+	if p.TimeoutMs != nil && (*p.TimeoutMs < 100 || *p.TimeoutMs > 600000) {
+		return fmt.Errorf("invalid timeout_ms: must be 100-600000, got %d", *p.TimeoutMs)
+	}
+	return nil
+}
+
 func validateSource(src Source) error {
 	if src.Service == "" || len(src.Service) > 64 || !servicePattern.MatchString(src.Service) {
 		return fmt.Errorf("invalid source.service: must match pattern %q (1-64 chars), got %q", servicePattern.String(), src.Service)
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed protocol version such as v1.1.0.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses a "vMAJOR.MINOR.PATCH" schema_version.
+func ParseVersion(s string) (Version, error) {
+	rest, ok := strings.CutPrefix(s, "v")
+	if !ok {
+		return Version{}, fmt.Errorf("version %q: missing leading \"v\"", s)
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("version %q: want vMAJOR.MINOR.PATCH", s)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p == "" || (len(p) > 1 && p[0] == '0') {
+			return Version{}, fmt.Errorf("version %q: want vMAJOR.MINOR.PATCH", s)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an older version than o.
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// CurrentVersion is SchemaVersion, parsed.
+var CurrentVersion = func() Version {
+	v, err := ParseVersion(SchemaVersion)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}()
+
+// CheckSchemaVersion reports whether a message's schema_version can be
+// handled by this build. Minor and patch versions only add optional fields
+// and message types, so any version with the same major version is
+// accepted, older or newer; a different major version is rejected.
+func CheckSchemaVersion(s string) error {
+	v, err := ParseVersion(s)
+	if err != nil {
+		return err
+	}
+	if v.Major != CurrentVersion.Major {
+		return fmt.Errorf("incompatible schema_version %s: this build speaks %s (major version %d)", s, SchemaVersion, CurrentVersion.Major)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Version
+	}{
+		{"v1.0.0", Version{1, 0, 0}},
+		{"v1.1.0", Version{1, 1, 0}},
+		{"v2.10.3", Version{2, 10, 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("String() = %q, want %q", got.String(), tt.in)
+		}
+	}
+
+	for _, bad := range []string{"", "1.1.0", "v1.1", "v1.1.0.0", "v1.x.0", "v01.1.0", "v1.-1.0", "v1..0"} {
+		if _, err := ParseVersion(bad); err == nil {
+			t.Errorf("ParseVersion(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	v100 := Version{1, 0, 0}
+	v110 := Version{1, 1, 0}
+	v111 := Version{1, 1, 1}
+	v200 := Version{2, 0, 0}
+
+	if !v100.Less(v110) || !v110.Less(v111) || !v111.Less(v200) {
+		t.Error("expected v1.0.0 < v1.1.0 < v1.1.1 < v2.0.0")
+	}
+	if v110.Less(v100) || v110.Less(v110) {
+		t.Error("Less should be false for older or equal versions")
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	for _, ok := range []string{SchemaVersion, "v1.0.0", "v1.5.2"} {
+		if err := CheckSchemaVersion(ok); err != nil {
+			t.Errorf("CheckSchemaVersion(%q) error: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"v2.0.0", "v0.9.0", "1.1.0", ""} {
+		if err := CheckSchemaVersion(bad); err == nil {
+			t.Errorf("CheckSchemaVersion(%q) expected error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package redisacl generates the Redis ACL file that gives the controller,
+// the monitor tool, and each station its own Redis user. Passwords are
+// stored as SHA-256 hashes, so the file can be kept with the deployment
+// without exposing station credentials.
+package redisacl
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Well-known users.
+const (
+	ControllerUser = "controller"
+	MonitorUser    = "monitor"
+	DefaultUser    = "default"
+)
+
+// stationCommands are the commands station firmware and the console's mock
+// stations use.
+const stationCommands = "+xreadgroup +xack +xadd +xgroup|create +publish +subscribe +set +get +del +expire " +
+	"+ping +auth +hello +select +info +client|setinfo"
+
+// ControllerRules are the controller's permissions: every Arturo key and
+// channel, without server administration.
+func ControllerRules() string {
+	return "~commands:* ~responses:* ~device:*:alive ~dedup:* ~events:* &events:* +@all -@admin"
+}
+
+// MonitorRules are the monitor tool's permissions: read-only access to
+// every Arturo key and channel.
+func MonitorRules() string {
+	return "~commands:* ~responses:* ~device:*:alive ~events:* &events:* " +
+		"+subscribe +psubscribe +xread +xrange +xrevrange +xlen +xinfo +xpending +get +keys +scan +ttl +exists +ping +auth +hello +select +info"
+}
+
+// StationRules are a station's permissions. It may only read its own
+// command stream and keep its own presence and dedup keys. Responses go to
+// the reply_to stream of whoever sent the command, which is
+// controllerInstance's response stream.
+func StationRules(instance, controllerInstance string) string {
+	return fmt.Sprintf("~commands:%[1]s ~responses:%[2]s ~device:%[1]s:alive ~dedup:%[1]s:* "+
+		"&events:heartbeat &events:hello &events:emergency_stop &events:test.control %[3]s",
+		instance, controllerInstance, stationCommands)
+}
+
+// IsStationUser reports whether an existing user looks like a station: its
+// rules grant its own command stream (or, in older files, channel).
+func IsStationUser(u *User) bool {
+	for _, r := range strings.Fields(u.Rules) {
+		if r == "&commands:"+u.Name || r == "~commands:"+u.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// User is one "user" line of an ACL file.
+type User struct {
+	Name string
+	On   bool
+	// Passwords holds the SHA-256 hex of each password the user may
+	// authenticate with, oldest first. Several are accepted while a
+	// rotation is rolled out.
+	Passwords []string
+	// Rules holds the key, channel, and command rules.
+	Rules string
+}
+
+// SetPassword adds a password. Older passwords stay valid until Retire.
+func (u *User) SetPassword(password string) {
+	u.Passwords = append(u.Passwords, HashPassword(password))
+}
+
+// Retire drops every password but the newest, ending a rotation.
+func (u *User) Retire() {
+	if len(u.Passwords) > 1 {
+		u.Passwords = u.Passwords[len(u.Passwords)-1:]
+	}
+}
+
+// Line returns the user's ACL file line.
+func (u *User) Line() string {
+	parts := []string{"user", u.Name}
+	if u.On {
+		parts = append(parts, "on")
+	} else {
+		parts = append(parts, "off")
+	}
+	for _, h := range u.Passwords {
+		parts = append(parts, "#"+h)
+	}
+	if u.Rules != "" {
+		parts = append(parts, u.Rules)
+	}
+	return strings.Join(parts, " ")
+}
+
+// File is an ACL file: its users in order.
+type File struct {
+	Users []*User
+}
+
+// User returns the named user, or nil.
+func (f *File) User(name string) *User {
+	for _, u := range f.Users {
+		if u.Name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+// Ensure returns the named user, appending it with no passwords if needed.
+func (f *File) Ensure(name string) *User {
+	if u := f.User(name); u != nil {
+		return u
+	}
+	u := &User{Name: name}
+	f.Users = append(f.Users, u)
+	return u
+}
+
+// Remove deletes the named user, reporting whether it existed.
+func (f *File) Remove(name string) bool {
+	for i, u := range f.Users {
+		if u.Name == name {
+			f.Users = append(f.Users[:i], f.Users[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads an ACL file. Plain-text passwords (">secret") are converted
+// to hashes; comments and blank lines are dropped.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected \"user <name> ...\"", n)
+		}
+		u := &User{Name: fields[1]}
+		var rules []string
+		for _, tok := range fields[2:] {
+			switch {
+			case tok == "on":
+				u.On = true
+			case tok == "off":
+				u.On = false
+			case strings.HasPrefix(tok, ">"):
+				u.Passwords = append(u.Passwords, HashPassword(tok[1:]))
+			case strings.HasPrefix(tok, "#"):
+				u.Passwords = append(u.Passwords, strings.ToLower(tok[1:]))
+			default:
+				rules = append(rules, tok)
+			}
+		}
+		u.Rules = strings.Join(rules, " ")
+		if f.User(u.Name) != nil {
+			return nil, fmt.Errorf("line %d: duplicate user %q", n, u.Name)
+		}
+		f.Users = append(f.Users, u)
+	}
+	return f, sc.Err()
+}
+
+// Load reads the ACL file at path. A missing file is an empty one.
+func Load(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// WriteTo writes the file with a header comment.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString("# Arturo Redis ACL, generated by \"controller acl\"; edit with that command.\n")
+	b.WriteString("# Load with: redis-server --aclfile <this file>, or ACL LOAD once aclfile is set.\n\n")
+	for _, u := range f.Users {
+		b.WriteString(u.Line())
+		b.WriteByte('\n')
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Save writes the file to path, readable only by its owner, replacing it
+// atomically.
+func (f *File) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".redis-acl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// NewPassword returns a random password. It avoids characters that need
+// quoting in .env files and build flags.
+func NewPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashPassword returns the SHA-256 hex Redis stores for a password.
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadPasswordFile reads a password from the first line of path.
+func ReadPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password, _, _ := strings.Cut(string(data), "\n")
+	password = strings.TrimSpace(password)
+	if password == "" {
+		return "", fmt.Errorf("%s: empty password", path)
+	}
+	return password, nil
+}
+
+// Plan is a change to an ACL file. Rotate and Retire name users, or "all".
+type Plan struct {
+	// ControllerInstance is the controller's protocol instance; stations
+	// reply on its responses channel.
+	ControllerInstance string
+	// Stations are added to the station users already in the file.
+	Stations []string
+	Remove   []string
+	// Rotate gives users a new password while keeping their old ones, so
+	// stations keep connecting until they are reconfigured.
+	Rotate []string
+	// Retire drops all but the newest password, ending a rotation.
+	Retire []string
+}
+
+// Apply updates the controller, monitor, and station users to the current
+// rules, creating any that are missing, and disables the default user.
+// Users without a password and rotated users get a new one; the new
+// plain-text passwords are returned by user name.
+func (f *File) Apply(p Plan) (map[string]string, error) {
+	for _, name := range p.Stations {
+		if name == "" || strings.ContainsAny(name, " \t*?[]&~#>") {
+			return nil, fmt.Errorf("invalid station name %q", name)
+		}
+		if name == ControllerUser || name == MonitorUser || name == DefaultUser {
+			return nil, fmt.Errorf("station name %q is reserved", name)
+		}
+	}
+	for _, name := range p.Remove {
+		if !f.Remove(name) {
+			return nil, fmt.Errorf("no user %q to remove", name)
+		}
+	}
+
+	managed := []*User{f.Ensure(ControllerUser), f.Ensure(MonitorUser)}
+	managed[0].Rules = ControllerRules()
+	managed[1].Rules = MonitorRules()
+	for _, name := range p.Stations {
+		f.Ensure(name).Rules = "~commands:" + name
+	}
+	for _, u := range f.Users {
+		if IsStationUser(u) {
+			u.Rules = StationRules(u.Name, p.ControllerInstance)
+			managed = append(managed, u)
+		}
+	}
+	// The default user goes last, after the users it locks out.
+	f.Remove(DefaultUser)
+	f.Users = append(f.Users, &User{Name: DefaultUser})
+
+	if err := f.checkNames(p.Rotate); err != nil {
+		return nil, fmt.Errorf("rotate: %w", err)
+	}
+	if err := f.checkNames(p.Retire); err != nil {
+		return nil, fmt.Errorf("retire: %w", err)
+	}
+	created := map[string]string{}
+	for _, u := range managed {
+		u.On = true
+		if len(u.Passwords) == 0 || listed(p.Rotate, u.Name) {
+			password, err := NewPassword()
+			if err != nil {
+				return nil, err
+			}
+			u.SetPassword(password)
+			created[u.Name] = password
+		}
+	}
+	for _, u := range f.Users {
+		if listed(p.Retire, u.Name) {
+			u.Retire()
+		}
+	}
+	return created, nil
+}
+
+func (f *File) checkNames(names []string) error {
+	for _, name := range names {
+		if name != "all" && f.User(name) == nil {
+			return fmt.Errorf("no user %q", name)
+		}
+	}
+	return nil
+}
+
+func listed(names []string, name string) bool {
+	for _, n := range names {
+		if n == name || n == "all" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package redisacl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const legacyACL = `# hand-written file
+user controller on >controller-change-me ~commands:* +@all
+user dmm-station-01 on >dmm01-change-me ~commands:dmm-station-01 ~responses:* +publish
+user backup-tool on #` + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" + ` ~* +bgsave
+user default off
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(legacyACL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Users) != 4 {
+		t.Fatalf("expected 4 users, got %d", len(f.Users))
+	}
+	ctrl := f.User("controller")
+	if !ctrl.On || len(ctrl.Passwords) != 1 || ctrl.Passwords[0] != HashPassword("controller-change-me") {
+		t.Errorf("unexpected controller %+v", ctrl)
+	}
+	if ctrl.Rules != "~commands:* +@all" {
+		t.Errorf("unexpected rules %q", ctrl.Rules)
+	}
+	if !IsStationUser(f.User("dmm-station-01")) || IsStationUser(f.User("backup-tool")) {
+		t.Error("station detection wrong")
+	}
+	if strings.Contains(ctrl.Line(), "change-me") {
+		t.Error("plain-text password written back")
+	}
+
+	if _, err := Parse(strings.NewReader("user a on\nuser a off\n")); err == nil {
+		t.Error("expected duplicate user error")
+	}
+	if _, err := Parse(strings.NewReader("requirepass x\n")); err == nil {
+		t.Error("expected error for non-user line")
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, _ := Parse(strings.NewReader(legacyACL))
+	created, err := f.Apply(Plan{ControllerInstance: "ctrl-01", Stations: []string{"station-01", "station-02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Existing users keep their passwords; new ones get one each.
+	if _, ok := created["controller"]; ok {
+		t.Error("controller password changed without rotation")
+	}
+	for _, name := range []string{"monitor", "station-01", "station-02"} {
+		if created[name] == "" {
+			t.Errorf("%s: no password created", name)
+		}
+	}
+	st := f.User("station-01")
+	if !st.On || st.Passwords[0] != HashPassword(created["station-01"]) {
+		t.Errorf("unexpected station user %+v", st)
+	}
+	for _, want := range []string{"~commands:station-01", "~device:station-01:alive", "~responses:ctrl-01", "+xreadgroup", "&events:heartbeat", "&events:hello"} {
+		if !strings.Contains(st.Rules, want) {
+			t.Errorf("station rules %q missing %s", st.Rules, want)
+		}
+	}
+	if strings.Contains(strings.ReplaceAll(st.Rules, "~dedup:station-01:*", ""), "*") {
+		t.Errorf("station rules should not use wildcards: %q", st.Rules)
+	}
+	// The old station is upgraded to the new rules; other users are left alone.
+	if !strings.Contains(f.User("dmm-station-01").Rules, "~dedup:dmm-station-01:*") {
+		t.Errorf("legacy station not upgraded: %q", f.User("dmm-station-01").Rules)
+	}
+	if f.User("backup-tool").Rules != "~* +bgsave" {
+		t.Error("unmanaged user changed")
+	}
+	if def := f.User("default"); def.On || len(def.Passwords) != 0 {
+		t.Errorf("default user should be off: %+v", def)
+	}
+
+	// Rotation keeps the old password until it is retired.
+	old := st.Passwords[0]
+	created, err = f.Apply(Plan{ControllerInstance: "ctrl-01", Rotate: []string{"station-01"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || len(st.Passwords) != 2 || st.Passwords[0] != old {
+		t.Fatalf("rotation: created %v, passwords %v", created, st.Passwords)
+	}
+	if _, err := f.Apply(Plan{ControllerInstance: "ctrl-01", Retire: []string{"all"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Passwords) != 1 || st.Passwords[0] != HashPassword(created["station-01"]) {
+		t.Errorf("retire kept %v", st.Passwords)
+	}
+
+	if _, err := f.Apply(Plan{Remove: []string{"dmm-station-01"}}); err != nil || f.User("dmm-station-01") != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+	for _, p := range []Plan{
+		{Rotate: []string{"nobody"}},
+		{Remove: []string{"nobody"}},
+		{Stations: []string{"controller"}},
+		{Stations: []string{"bad*name"}},
+	} {
+		if _, err := f.Apply(p); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis-acl.conf")
+	f, err := Load(path)
+	if err != nil || len(f.Users) != 0 {
+		t.Fatalf("missing file: %v, %+v", err, f)
+	}
+	if _, err := f.Apply(Plan{ControllerInstance: "ctrl-01", Stations: []string{"station-01"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600, got %v", info.Mode().Perm())
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Users) != len(f.Users) {
+		t.Fatalf("expected %d users, got %d", len(f.Users), len(loaded.Users))
+	}
+	for i, u := range f.Users {
+		if got := loaded.Users[i].Line(); got != u.Line() {
+			t.Errorf("round trip:\n got %s\nwant %s", got, u.Line())
+		}
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pw")
+	os.WriteFile(path, []byte("s3cret\n"), 0o600)
+	if pw, err := ReadPasswordFile(path); err != nil || pw != "s3cret" {
+		t.Errorf("ReadPasswordFile = %q, %v", pw, err)
+	}
+	os.WriteFile(path, []byte("\n"), 0o600)
+	if _, err := ReadPasswordFile(path); err == nil {
+		t.Error("expected error for empty password")
+	}
+}
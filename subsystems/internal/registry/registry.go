@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"slices"
 	"sync"
 	"time"
 
@@ -18,6 +19,9 @@ const (
 const (
 	StaleThreshold   = 5 * time.Second
 	OfflineThreshold = 10 * time.Second
+	// HelloRetryInterval is how often the controller asks a station it has
+	// no service.hello from to introduce itself.
+	HelloRetryInterval = time.Minute
 	// SessionTerminateAfter is the grace period a station may stay offline
 	// before its active test session is force-terminated. Set well above
 	// the executor's QUERY/SEND retry deadline (240s) so a transient
@@ -46,6 +50,16 @@ type StationEntry struct {
 	WifiRSSI        int
 	FirmwareVersion string
 	UptimeSeconds   int64
+
+	// ProtocolVersion is the schema_version of the station's latest
+	// heartbeat or hello. MessageTypes and Features come from its
+	// service.hello and stay empty for stations that never sent one (v1.0).
+	ProtocolVersion string   `json:"ProtocolVersion,omitempty"`
+	MessageTypes    []string `json:"MessageTypes,omitempty"`
+	Features        []string `json:"Features,omitempty"`
+
+	helloAt          time.Time // when the last hello arrived
+	helloRequestedAt time.Time // when we last asked for one
 }
 
 // Registry holds the in-memory map of stations and devices.
@@ -118,6 +132,75 @@ func (r *Registry) UpdateFromHeartbeat(instance string, payload *protocol.Heartb
 	}
 }
 
+// SetProtocolVersion records the schema_version seen in a message from a
+// known station.
+func (r *Registry) SetProtocolVersion(instance, schemaVersion string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if station, ok := r.stations[instance]; ok {
+		station.ProtocolVersion = schemaVersion
+	}
+}
+
+// UpdateFromHello records a station's protocol version and capabilities.
+// A hello from an unknown station registers it as online; its devices
+// arrive with the first heartbeat.
+func (r *Registry) UpdateFromHello(instance, schemaVersion string, payload *protocol.HelloPayload) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	station, exists := r.stations[instance]
+	if !exists {
+		station = &StationEntry{Instance: instance, LastHeartbeat: now, Status: StatusOnline}
+		r.stations[instance] = station
+	}
+	station.ProtocolVersion = schemaVersion
+	station.MessageTypes = payload.MessageTypes
+	station.Features = payload.Features
+	if payload.FirmwareVersion != "" {
+		station.FirmwareVersion = payload.FirmwareVersion
+	}
+	station.helloAt = now
+}
+
+// ShouldRequestHello reports whether the controller should ask a station
+// for its service.hello: the station is known, speaks v1.1 or later (older
+// firmware doesn't understand the request) and hasn't sent one, and it was
+// not asked within HelloRetryInterval. A true result counts as asking.
+func (r *Registry) ShouldRequestHello(instance string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	station, ok := r.stations[instance]
+	if !ok || !station.helloAt.IsZero() {
+		return false
+	}
+	v, err := protocol.ParseVersion(station.ProtocolVersion)
+	if err != nil || v.Less(protocol.Version{Major: 1, Minor: 1}) {
+		return false
+	}
+	if now.Sub(station.helloRequestedAt) < HelloRetryInterval {
+		return false
+	}
+	station.helloRequestedAt = now
+	return true
+}
+
+// Supports reports whether a station advertised feature in its hello.
+func (r *Registry) Supports(instance, feature string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	station, ok := r.stations[instance]
+	if !ok {
+		return false
+	}
+	return slices.Contains(station.Features, feature)
+}
+
 // LookupDevice returns a copy of the device entry, or nil if not found.
 func (r *Registry) LookupDevice(deviceID string) *DeviceEntry {
 	r.mu.RLock()
@@ -429,3 +429,90 @@ func TestHealthCheckRestoredAfterNewHeartbeat(t *testing.T) {
 		t.Errorf("expected device online after new heartbeat, got %s", d.Status)
 	}
 }
+
+func TestUpdateFromHelloRecordsCapabilities(t *testing.T) {
+	r := New()
+	r.UpdateFromHeartbeat("station-1", makePayload([]string{"dmm-1"}))
+	r.UpdateFromHello("station-1", "v1.1.0", &protocol.HelloPayload{
+		MessageTypes:    []string{protocol.TypeDeviceCommandRequest, protocol.TypeServiceHello},
+		Features:        []string{protocol.FeatureCommandDedup},
+		FirmwareVersion: "1.1.0",
+	})
+
+	s := r.ListStations()[0]
+	if s.ProtocolVersion != "v1.1.0" {
+		t.Errorf("ProtocolVersion = %q, want v1.1.0", s.ProtocolVersion)
+	}
+	if len(s.MessageTypes) != 2 {
+		t.Errorf("MessageTypes = %v, want 2 entries", s.MessageTypes)
+	}
+	if s.FirmwareVersion != "1.1.0" {
+		t.Errorf("FirmwareVersion = %q, want 1.1.0", s.FirmwareVersion)
+	}
+	if len(s.Devices) != 1 {
+		t.Errorf("Devices = %v, hello should not touch the device list", s.Devices)
+	}
+	if !r.Supports("station-1", protocol.FeatureCommandDedup) {
+		t.Error("Supports(command_dedup) = false, want true")
+	}
+	if r.Supports("station-1", protocol.FeatureOTA) {
+		t.Error("Supports(ota) = true, want false")
+	}
+	if r.Supports("station-2", protocol.FeatureCommandDedup) {
+		t.Error("Supports on unknown station = true, want false")
+	}
+}
+
+func TestUpdateFromHelloRegistersUnknownStation(t *testing.T) {
+	r := New()
+	r.UpdateFromHello("station-1", "v1.1.0", &protocol.HelloPayload{})
+
+	if got := r.GetStationStatus("station-1"); got != StatusOnline {
+		t.Errorf("status = %q, want %q", got, StatusOnline)
+	}
+}
+
+func TestSetProtocolVersion(t *testing.T) {
+	r := New()
+	r.SetProtocolVersion("station-1", "v1.0.0") // unknown: ignored
+	if got := r.ListStations(); len(got) != 0 {
+		t.Fatalf("expected 0 stations, got %d", len(got))
+	}
+
+	r.UpdateFromHeartbeat("station-1", makePayload(nil))
+	r.SetProtocolVersion("station-1", "v1.0.0")
+	if got := r.ListStations()[0].ProtocolVersion; got != "v1.0.0" {
+		t.Errorf("ProtocolVersion = %q, want v1.0.0", got)
+	}
+}
+
+func TestShouldRequestHello(t *testing.T) {
+	r := New()
+	now := time.Now()
+
+	if r.ShouldRequestHello("station-1", now) {
+		t.Error("unknown station: want false")
+	}
+
+	r.UpdateFromHeartbeat("station-1", makePayload(nil))
+	r.SetProtocolVersion("station-1", "v1.0.0")
+	if r.ShouldRequestHello("station-1", now) {
+		t.Error("v1.0.0 station: want false, it can't answer")
+	}
+
+	r.SetProtocolVersion("station-1", "v1.1.0")
+	if !r.ShouldRequestHello("station-1", now) {
+		t.Error("v1.1.0 station without hello: want true")
+	}
+	if r.ShouldRequestHello("station-1", now.Add(HelloRetryInterval/2)) {
+		t.Error("asked again within HelloRetryInterval: want false")
+	}
+	if !r.ShouldRequestHello("station-1", now.Add(HelloRetryInterval)) {
+		t.Error("asked again after HelloRetryInterval: want true")
+	}
+
+	r.UpdateFromHello("station-1", "v1.1.0", &protocol.HelloPayload{})
+	if r.ShouldRequestHello("station-1", now.Add(10*HelloRetryInterval)) {
+		t.Error("station already said hello: want false")
+	}
+}
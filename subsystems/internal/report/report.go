@@ -36,7 +36,7 @@ type MeasurementJSON struct {
 
 // ExportCSV writes measurement data as CSV to w.
 // Headers: device_id,command_name,success,response,duration_ms,timestamp
-func ExportCSV(w io.Writer, s *store.Store, testRunID string) error {
+func ExportCSV(w io.Writer, s store.Store, testRunID string) error {
 	measurements, err := s.QueryMeasurements(testRunID)
 	if err != nil {
 		return err
@@ -66,7 +66,7 @@ func ExportCSV(w io.Writer, s *store.Store, testRunID string) error {
 }
 
 // ExportJSON writes measurement data as a JSON array to w.
-func ExportJSON(w io.Writer, s *store.Store, testRunID string) error {
+func ExportJSON(w io.Writer, s store.Store, testRunID string) error {
 	measurements, err := s.QueryMeasurements(testRunID)
 	if err != nil {
 		return err
@@ -94,7 +94,7 @@ func ExportJSON(w io.Writer, s *store.Store, testRunID string) error {
 }
 
 // ExportPDF writes a formatted PDF test report to w.
-func ExportPDF(w io.Writer, s *store.Store, testRunID string) error {
+func ExportPDF(w io.Writer, s store.Store, testRunID string) error {
 	run, err := s.GetTestRun(testRunID)
 	if err != nil {
 		return fmt.Errorf("failed to get test run: %w", err)
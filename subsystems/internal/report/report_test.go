@@ -43,7 +43,7 @@ func extractPDFText(data []byte) []byte {
 }
 
 // seedFinishedTestData creates a test run and marks it finished with measurements.
-func seedFinishedTestData(t *testing.T, s *store.Store) {
+func seedFinishedTestData(t *testing.T, s store.Store) {
 	t.Helper()
 	seedTestData(t, s)
 	if err := s.FinishTestRun("run-1", "passed", "All tests passed"); err != nil {
@@ -51,7 +51,7 @@ func seedFinishedTestData(t *testing.T, s *store.Store) {
 	}
 }
 
-func newTestStore(t *testing.T) *store.Store {
+func newTestStore(t *testing.T) store.Store {
 	t.Helper()
 	s, err := store.New(":memory:")
 	if err != nil {
@@ -61,7 +61,7 @@ func newTestStore(t *testing.T) *store.Store {
 	return s
 }
 
-func seedTestData(t *testing.T, s *store.Store) {
+func seedTestData(t *testing.T, s store.Store) {
 	t.Helper()
 	if err := s.CreateTestRun("run-1", "test.art"); err != nil {
 		t.Fatalf("failed to create test run: %v", err)
@@ -0,0 +1,179 @@
+// Package retention downsamples and prunes the continuous telemetry logs
+// written by the station poller. Raw temperature_log and pump_status_log
+// rows are rolled up into 1-minute aggregates, then deleted once they age
+// past the raw window unless they overlap a test run, which are kept
+// forever as test evidence. Aggregates are deleted once they age past their
+// own, longer window.
+package retention
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Policy configures how long telemetry is kept.
+type Policy struct {
+	Raw       time.Duration // raw rows outside test runs
+	Aggregate time.Duration // 1-minute aggregates
+	Interval  time.Duration // how often the job runs
+}
+
+// DefaultPolicy keeps raw rows for 30 days and aggregates for a year,
+// running hourly.
+func DefaultPolicy() Policy {
+	return Policy{
+		Raw:       30 * 24 * time.Hour,
+		Aggregate: 365 * 24 * time.Hour,
+		Interval:  time.Hour,
+	}
+}
+
+// Store is the subset of store.Store the job needs.
+type Store interface {
+	AggregateTemperatureLog(before time.Time) (int64, error)
+	AggregatePumpStatusLog(before time.Time) (int64, error)
+	PruneTemperatureLogOutsideTests(before time.Time) (int64, error)
+	PrunePumpStatusLogOutsideTests(before time.Time) (int64, error)
+	PruneTelemetryAggregates(before time.Time) (int64, error)
+}
+
+// Result is the outcome of one retention pass.
+type Result struct {
+	Aggregated       int64 // 1-minute buckets written
+	RawPruned        int64 // raw log rows deleted
+	AggregatesPruned int64 // expired buckets deleted
+}
+
+// Stats are cumulative metrics since the job started.
+type Stats struct {
+	RawRetention          string     `json:"raw_retention"`
+	AggregateRetention    string     `json:"aggregate_retention"`
+	Runs                  int        `json:"runs"`
+	LastRun               *time.Time `json:"last_run,omitempty"`
+	LastDuration          string     `json:"last_duration,omitempty"`
+	LastError             string     `json:"last_error,omitempty"`
+	AggregatedTotal       int64      `json:"aggregated_total"`
+	RawPrunedTotal        int64      `json:"raw_pruned_total"`
+	AggregatesPrunedTotal int64      `json:"aggregates_pruned_total"`
+}
+
+// Job runs the retention policy against a store.
+type Job struct {
+	store  Store
+	policy Policy
+
+	mu    sync.RWMutex
+	stats Stats
+}
+
+// New creates a retention job. Zero fields in policy take their defaults.
+func New(st Store, policy Policy) *Job {
+	def := DefaultPolicy()
+	if policy.Raw <= 0 {
+		policy.Raw = def.Raw
+	}
+	if policy.Aggregate <= 0 {
+		policy.Aggregate = def.Aggregate
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = def.Interval
+	}
+	return &Job{
+		store:  st,
+		policy: policy,
+		stats: Stats{
+			RawRetention:       policy.Raw.String(),
+			AggregateRetention: policy.Aggregate.String(),
+		},
+	}
+}
+
+// Run executes a pass immediately and then every policy.Interval until ctx
+// is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	j.runLogged(time.Now())
+
+	ticker := time.NewTicker(j.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			j.runLogged(now)
+		}
+	}
+}
+
+func (j *Job) runLogged(now time.Time) {
+	res, err := j.RunOnce(now)
+	if err != nil {
+		log.Printf("retention: %v", err)
+		return
+	}
+	if res.Aggregated > 0 || res.RawPruned > 0 || res.AggregatesPruned > 0 {
+		log.Printf("retention: aggregated %d buckets, pruned %d raw rows and %d aggregates",
+			res.Aggregated, res.RawPruned, res.AggregatesPruned)
+	}
+}
+
+// RunOnce performs one retention pass as of now. Raw rows are aggregated
+// before they are pruned so no minute is lost.
+func (j *Job) RunOnce(now time.Time) (Result, error) {
+	start := time.Now()
+	res, err := j.pass(now)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.Runs++
+	j.stats.LastRun = &now
+	j.stats.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	j.stats.LastError = ""
+	if err != nil {
+		j.stats.LastError = err.Error()
+	}
+	j.stats.AggregatedTotal += res.Aggregated
+	j.stats.RawPrunedTotal += res.RawPruned
+	j.stats.AggregatesPrunedTotal += res.AggregatesPruned
+	return res, err
+}
+
+func (j *Job) pass(now time.Time) (Result, error) {
+	var res Result
+	rawCutoff := now.Add(-j.policy.Raw)
+
+	for _, aggregate := range []func(time.Time) (int64, error){
+		j.store.AggregateTemperatureLog,
+		j.store.AggregatePumpStatusLog,
+	} {
+		n, err := aggregate(rawCutoff)
+		res.Aggregated += n
+		if err != nil {
+			return res, err
+		}
+	}
+
+	for _, prune := range []func(time.Time) (int64, error){
+		j.store.PruneTemperatureLogOutsideTests,
+		j.store.PrunePumpStatusLogOutsideTests,
+	} {
+		n, err := prune(rawCutoff)
+		res.RawPruned += n
+		if err != nil {
+			return res, err
+		}
+	}
+
+	n, err := j.store.PruneTelemetryAggregates(now.Add(-j.policy.Aggregate))
+	res.AggregatesPruned = n
+	return res, err
+}
+
+// Stats returns a snapshot of the job's cumulative metrics.
+func (j *Job) Stats() Stats {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.stats
+}
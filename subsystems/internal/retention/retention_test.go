@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/holla2040/arturo/internal/store"
+)
+
+func TestRunOnceAggregatesThenPrunes(t *testing.T) {
+	st, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("store.New failed: %v", err)
+	}
+	defer st.Close()
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-40 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+	for _, ts := range []time.Time{old, old.Add(10 * time.Second), recent} {
+		st.DB().Exec(
+			`INSERT INTO temperature_log (station_instance, device_id, stage, temperature_k, timestamp) VALUES ('station-01', 'PUMP-01', 'first_stage', 70, ?)`,
+			ts.Format(time.RFC3339Nano),
+		)
+	}
+	// An aggregate from two years ago is past the aggregate window.
+	st.DB().Exec(
+		`INSERT INTO temperature_log_1m (station_instance, device_id, stage, bucket, min_k, max_k, avg_k, samples) VALUES ('station-01', 'PUMP-01', 'first_stage', ?, 1, 1, 1, 1)`,
+		now.Add(-2*365*24*time.Hour).Truncate(time.Minute).Format(time.RFC3339),
+	)
+
+	job := New(st, DefaultPolicy())
+	res, err := job.RunOnce(now)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if res.Aggregated != 1 || res.RawPruned != 2 || res.AggregatesPruned != 1 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	entries, _ := st.QueryTemperatureLog("station-01", old.Add(-time.Minute))
+	if len(entries) != 1 {
+		t.Errorf("expected only the recent raw row kept, got %d", len(entries))
+	}
+	aggs, _ := st.QueryTemperatureAggregates("station-01", old.Add(-time.Hour), now)
+	if len(aggs) != 1 || aggs[0].Samples != 2 {
+		t.Errorf("expected one 2-sample bucket, got %+v", aggs)
+	}
+
+	stats := job.Stats()
+	if stats.Runs != 1 || stats.AggregatedTotal != 1 || stats.RawPrunedTotal != 2 || stats.AggregatesPrunedTotal != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.LastRun == nil || !stats.LastRun.Equal(now) {
+		t.Errorf("unexpected last run %v", stats.LastRun)
+	}
+	if stats.RawRetention != "720h0m0s" {
+		t.Errorf("unexpected raw retention %q", stats.RawRetention)
+	}
+}
+
+type failingStore struct{ store.Store }
+
+func (failingStore) AggregateTemperatureLog(time.Time) (int64, error) {
+	return 0, errors.New("disk I/O error")
+}
+
+func TestRunOnceRecordsError(t *testing.T) {
+	job := New(failingStore{}, Policy{})
+	if _, err := job.RunOnce(time.Now()); err == nil {
+		t.Fatal("expected error")
+	}
+	stats := job.Stats()
+	if stats.Runs != 1 || stats.LastError != "disk I/O error" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
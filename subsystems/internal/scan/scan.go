@@ -0,0 +1,142 @@
+// Package scan recognises barcode scanner payloads: employee badges, RMA
+// numbers, pump serials, and work-order labels.
+package scan
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is what a scanned barcode identifies.
+type Kind string
+
+const (
+	KindBadge      Kind = "badge"       // group "badge": the employee's badge code
+	KindRMA        Kind = "rma"         // group "rma": an RMA number
+	KindPumpSerial Kind = "pump_serial" // group "serial": a pump serial number
+	KindWorkOrder  Kind = "work_order"  // groups "rma", "serial", and optional "model", "customer"
+	KindUnknown    Kind = "unknown"
+)
+
+// requiredGroups lists the named capture groups each kind's pattern must have.
+var requiredGroups = map[Kind][]string{
+	KindBadge:      {"badge"},
+	KindRMA:        {"rma"},
+	KindPumpSerial: {"serial"},
+	KindWorkOrder:  {"rma", "serial"},
+}
+
+// Format is one recognised barcode layout. Pattern is a Go regular
+// expression matched against the whole normalized payload; its named
+// groups carry the fields.
+type Format struct {
+	Kind    Kind   `yaml:"kind"`
+	Pattern string `yaml:"pattern"`
+}
+
+// DefaultFormats recognises badges printed as "EMP:<code>", work-order
+// labels "WO|<rma>|<serial>|<model>|<customer>", RMA numbers starting with
+// "RMA", and anything else that looks like a serial number.
+func DefaultFormats() []Format {
+	return []Format{
+		{Kind: KindBadge, Pattern: `(?i)^EMP[:-](?P<badge>[A-Z0-9-]+)$`},
+		{Kind: KindWorkOrder, Pattern: `^WO\|(?P<rma>[^|]+)\|(?P<serial>[^|]+)\|(?P<model>[^|]*)\|(?P<customer>[^|]*)$`},
+		{Kind: KindRMA, Pattern: `(?i)^(?P<rma>RMA-?[0-9][0-9-]*)$`},
+		{Kind: KindPumpSerial, Pattern: `(?i)^(?:SN[:-])?(?P<serial>[A-Z0-9][A-Z0-9-]{3,})$`},
+	}
+}
+
+// LoadFormats reads a YAML list of formats, tried in order:
+//
+//   - kind: badge
+//     pattern: '^B(?P<badge>\d{6})$'
+func LoadFormats(path string) ([]Format, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scan formats %s: %w", path, err)
+	}
+	var formats []Format
+	if err := yaml.Unmarshal(data, &formats); err != nil {
+		return nil, fmt.Errorf("parsing scan formats %s: %w", path, err)
+	}
+	return formats, nil
+}
+
+type compiledFormat struct {
+	kind Kind
+	re   *regexp.Regexp
+}
+
+// Parser matches payloads against an ordered list of formats.
+type Parser struct {
+	formats []compiledFormat
+}
+
+// NewParser compiles formats, checking each has the groups its kind needs.
+func NewParser(formats []Format) (*Parser, error) {
+	p := &Parser{}
+	for i, f := range formats {
+		groups, ok := requiredGroups[f.Kind]
+		if !ok {
+			return nil, fmt.Errorf("format %d: unknown kind %q", i+1, f.Kind)
+		}
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("format %d (%s): %w", i+1, f.Kind, err)
+		}
+		for _, g := range groups {
+			if re.SubexpIndex(g) < 0 {
+				return nil, fmt.Errorf("format %d (%s): pattern needs a (?P<%s>...) group", i+1, f.Kind, g)
+			}
+		}
+		p.formats = append(p.formats, compiledFormat{kind: f.Kind, re: re})
+	}
+	return p, nil
+}
+
+// Result is a recognised payload.
+type Result struct {
+	Kind   Kind              `json:"kind"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Parse returns the first format matching payload, or KindUnknown.
+func (p *Parser) Parse(payload string) Result {
+	payload = Normalize(payload)
+	for _, f := range p.formats {
+		m := f.re.FindStringSubmatch(payload)
+		if m == nil {
+			continue
+		}
+		fields := make(map[string]string)
+		for i, name := range f.re.SubexpNames() {
+			if name != "" {
+				fields[name] = strings.TrimSpace(m[i])
+			}
+		}
+		return Result{Kind: f.kind, Fields: fields}
+	}
+	return Result{Kind: KindUnknown}
+}
+
+// aimPrefix is the symbology identifier some scanners send first, e.g.
+// "]C1" for GS1-128.
+var aimPrefix = regexp.MustCompile(`^\][A-Za-z][0-9A-Za-z]`)
+
+// Normalize strips what keyboard-wedge scanners add around the data:
+// surrounding whitespace, CR/LF suffixes, an AIM symbology identifier,
+// and other control characters.
+func Normalize(payload string) string {
+	payload = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, payload)
+	payload = strings.TrimSpace(payload)
+	return aimPrefix.ReplaceAllString(payload, "")
+}
@@ -0,0 +1,71 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDefaultFormats(t *testing.T) {
+	p, err := NewParser(DefaultFormats())
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	cases := []struct {
+		payload string
+		want    Result
+	}{
+		{"EMP:4821\r\n", Result{Kind: KindBadge, Fields: map[string]string{"badge": "4821"}}},
+		{"]C1emp-A77", Result{Kind: KindBadge, Fields: map[string]string{"badge": "A77"}}},
+		{"RMA-2024-001", Result{Kind: KindRMA, Fields: map[string]string{"rma": "RMA-2024-001"}}},
+		{"SN:CT8-12345", Result{Kind: KindPumpSerial, Fields: map[string]string{"serial": "CT8-12345"}}},
+		{"WO|RMA-2024-009|SN-777|CT-8|ACME Corp", Result{Kind: KindWorkOrder, Fields: map[string]string{
+			"rma": "RMA-2024-009", "serial": "SN-777", "model": "CT-8", "customer": "ACME Corp"}}},
+		{"hello world", Result{Kind: KindUnknown}},
+		{"\x1d\x1d", Result{Kind: KindUnknown}},
+	}
+	for _, c := range cases {
+		if got := p.Parse(c.payload); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.payload, got, c.want)
+		}
+	}
+}
+
+func TestNewParserValidates(t *testing.T) {
+	bad := [][]Format{
+		{{Kind: "ticket", Pattern: `^(?P<x>.*)$`}},
+		{{Kind: KindBadge, Pattern: `^(`}},
+		{{Kind: KindWorkOrder, Pattern: `^(?P<rma>.*)$`}},
+	}
+	for _, formats := range bad {
+		if _, err := NewParser(formats); err == nil {
+			t.Errorf("expected error for %+v", formats)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.yaml")
+	os.WriteFile(path, []byte(`
+- kind: badge
+  pattern: '^B(?P<badge>\d{6})$'
+- kind: rma
+  pattern: '^(?P<rma>R\d+)$'
+`), 0o644)
+
+	formats, err := LoadFormats(path)
+	if err != nil {
+		t.Fatalf("LoadFormats failed: %v", err)
+	}
+	p, err := NewParser(formats)
+	if err != nil {
+		t.Fatalf("NewParser failed: %v", err)
+	}
+	if r := p.Parse("B123456"); r.Kind != KindBadge || r.Fields["badge"] != "123456" {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r := p.Parse("EMP:4821"); r.Kind != KindUnknown {
+		t.Errorf("defaults should not apply with a formats file, got %+v", r)
+	}
+}
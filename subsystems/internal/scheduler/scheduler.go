@@ -0,0 +1,396 @@
+// Package scheduler queues the device commands the controller sends each
+// station, so operator commands, script commands and poller telemetry share
+// a station's slow instrument link (a 2400-baud CTI pump) fairly. Each
+// station gets a queue with three priority lanes, drained no faster than a
+// configured rate, and a query identical to one already queued or awaiting
+// its response is answered with that response instead of being sent again.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/transport"
+)
+
+// Lane is a command priority. Lower lanes are sent first.
+type Lane int
+
+const (
+	// LaneSafety carries e-stop and safe-state commands. They go ahead of
+	// everything queued and are never held back by the rate.
+	LaneSafety Lane = iota
+	// LaneCommand carries script and operator commands. It is the default.
+	LaneCommand
+	// LaneTelemetry carries background polling.
+	LaneTelemetry
+
+	numLanes
+)
+
+func (l Lane) String() string {
+	switch l {
+	case LaneSafety:
+		return "safety"
+	case LaneCommand:
+		return "command"
+	case LaneTelemetry:
+		return "telemetry"
+	}
+	return "unknown"
+}
+
+type laneKey struct{}
+
+// WithLane returns a context whose commands are queued in lane.
+func WithLane(ctx context.Context, lane Lane) context.Context {
+	return context.WithValue(ctx, laneKey{}, lane)
+}
+
+// LaneOf returns the lane set on ctx by WithLane, or LaneCommand.
+func LaneOf(ctx context.Context) Lane {
+	if lane, ok := ctx.Value(laneKey{}).(Lane); ok && lane >= 0 && lane < numLanes {
+		return lane
+	}
+	return LaneCommand
+}
+
+// Sender sends a message to a command stream, normally a transport.Sender.
+type Sender interface {
+	SendCommand(ctx context.Context, stream string, msg *protocol.Message) error
+}
+
+// Follower lets a waiter for one response receive another's, normally a
+// transport.Dispatcher. See transport.Dispatcher.Follow and Awaited.
+type Follower interface {
+	Follow(correlationID, leader string) bool
+	Awaited(correlationID string) bool
+}
+
+// IsQuery reports whether a command only reads device state, by the
+// profile naming convention (get_*, *_status). Only queries are coalesced.
+func IsQuery(command string) bool {
+	return strings.HasPrefix(command, "get_") || strings.HasSuffix(command, "_status")
+}
+
+// QueueStatus describes one station's queue.
+type QueueStatus struct {
+	Station   string `json:"station"`
+	Queued    int    `json:"queued"`
+	Safety    int    `json:"safety"`
+	Command   int    `json:"command"`
+	Telemetry int    `json:"telemetry"`
+	Sent      int64  `json:"sent"`
+	Coalesced int64  `json:"coalesced"`
+	// MaxWait is the longest any command sent so far spent queued.
+	MaxWait string `json:"max_wait"`
+}
+
+// Scheduler implements the controller's command sender with a queue per
+// station. It is safe for concurrent use.
+type Scheduler struct {
+	send     Sender
+	follower Follower      // nil disables coalescing
+	interval time.Duration // minimum time per command; 0 = unlimited
+
+	mu       sync.Mutex
+	stations map[string]*station
+}
+
+// New creates a Scheduler sending through send at most rate commands per
+// second to each station; 0 means no limit. follower, if not nil, is the
+// dispatcher response waiters register with, used to coalesce queries.
+func New(send Sender, follower Follower, rate float64) *Scheduler {
+	s := &Scheduler{send: send, follower: follower, stations: make(map[string]*station)}
+	if rate > 0 {
+		s.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return s
+}
+
+// request is a message waiting in a station's queue.
+type request struct {
+	ctx    context.Context
+	stream string
+	msg    *protocol.Message
+	lane   Lane
+	cost   int // commands the message carries
+	key    string
+	queued time.Time
+	done   chan struct{} // closed once sent, or once dropped unsent
+	err    error         // the send result, set before done is closed
+
+	// Guarded by station.mu.
+	waiting   bool // still in a lane
+	followers int  // requests coalesced into this one
+}
+
+type station struct {
+	mu       sync.Mutex
+	lanes    [numLanes][]*request
+	running  bool // a drain goroutine is active
+	wake     chan struct{}
+	next     time.Time           // earliest time the next non-safety command may go
+	inflight map[string]*request // query key -> latest request sent or queued
+	sent     int64
+	merged   int64
+	maxWait  time.Duration
+}
+
+func (s *Scheduler) station(name string) *station {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.stations[name]
+	if !ok {
+		st = &station{wake: make(chan struct{}, 1), inflight: make(map[string]*request)}
+		s.stations[name] = st
+	}
+	return st
+}
+
+// SendCommand queues msg for stream's station in ctx's lane (see WithLane)
+// and returns once it has been sent. A query coalesced into an identical one
+// returns that one's send result, at once if it was already sent. Messages
+// other than device commands, and commands while the rate is unlimited, are
+// sent straight away; queries are still coalesced.
+func (s *Scheduler) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	cost := commandCount(msg)
+	if cost == 0 {
+		return s.send.SendCommand(ctx, stream, msg)
+	}
+	st := s.station(transport.InstanceFromName(stream))
+	r := &request{
+		ctx:    ctx,
+		stream: stream,
+		msg:    msg,
+		lane:   LaneOf(ctx),
+		cost:   cost,
+		key:    queryKey(stream, msg),
+		queued: time.Now(),
+		done:   make(chan struct{}),
+	}
+
+	st.mu.Lock()
+	if leader := s.coalesce(st, r); leader != nil {
+		st.merged++
+		st.mu.Unlock()
+		select {
+		case <-leader.done:
+			return leader.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if r.key != "" && s.follower != nil {
+		st.inflight[r.key] = r
+	}
+	if s.interval == 0 {
+		st.sent++
+		st.mu.Unlock()
+		err := s.send.SendCommand(ctx, stream, msg)
+		st.mu.Lock()
+		st.finish(r, err)
+		st.mu.Unlock()
+		return err
+	}
+	r.waiting = true
+	st.lanes[r.lane] = append(st.lanes[r.lane], r)
+	if !st.running {
+		st.running = true
+		go s.drain(st)
+	} else {
+		select {
+		case st.wake <- struct{}{}:
+		default:
+		}
+	}
+	st.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		// A request others are coalesced into is still sent for them.
+		if r.waiting && r.followers == 0 {
+			st.lanes[r.lane] = without(st.lanes[r.lane], r)
+			r.waiting = false
+			st.finish(r, ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+// coalesce makes r follow an identical query already queued or awaiting
+// its response, returning the request it follows, or nil if there is none.
+// A queued leader is moved up to r's lane if that is more urgent. Queries
+// whose responses are no longer awaited are forgotten first. Caller holds
+// st.mu.
+func (s *Scheduler) coalesce(st *station, r *request) *request {
+	if s.follower == nil || r.key == "" {
+		return nil
+	}
+	s.prune(st)
+	leader, ok := st.inflight[r.key]
+	if !ok || !s.follower.Follow(r.msg.Envelope.CorrelationID, leader.msg.Envelope.CorrelationID) {
+		return nil
+	}
+	leader.followers++
+	if leader.waiting && r.lane < leader.lane {
+		st.lanes[leader.lane] = without(st.lanes[leader.lane], leader)
+		leader.lane = r.lane
+		st.lanes[leader.lane] = append(st.lanes[leader.lane], leader)
+	}
+	return leader
+}
+
+// prune forgets sent queries that nobody awaits a response to any more.
+// Caller holds st.mu.
+func (s *Scheduler) prune(st *station) {
+	for key, r := range st.inflight {
+		if !r.waiting && !s.follower.Awaited(r.msg.Envelope.CorrelationID) {
+			delete(st.inflight, key)
+		}
+	}
+}
+
+// drain sends st's queued requests in lane order, pacing all but safety
+// commands by the scheduler's interval, and exits once the queue is empty.
+func (s *Scheduler) drain(st *station) {
+	for {
+		st.mu.Lock()
+		r := st.head()
+		if r == nil {
+			st.running = false
+			st.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		if wait := st.next.Sub(now); wait > 0 && r.lane != LaneSafety {
+			st.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-st.wake: // something more urgent may have arrived
+				timer.Stop()
+			}
+			continue
+		}
+		st.lanes[r.lane] = st.lanes[r.lane][1:]
+		r.waiting = false
+		if st.next.Before(now) {
+			st.next = now
+		}
+		st.next = st.next.Add(time.Duration(r.cost) * s.interval)
+		st.sent++
+		if wait := now.Sub(r.queued); wait > st.maxWait {
+			st.maxWait = wait
+		}
+		ctx := r.ctx
+		if r.followers > 0 {
+			ctx = context.WithoutCancel(ctx)
+		}
+		st.mu.Unlock()
+
+		err := s.send.SendCommand(ctx, r.stream, r.msg)
+		st.mu.Lock()
+		st.finish(r, err)
+		st.mu.Unlock()
+	}
+}
+
+// head returns the first request in the most urgent non-empty lane.
+// Caller holds st.mu.
+func (st *station) head() *request {
+	for _, lane := range st.lanes {
+		if len(lane) > 0 {
+			return lane[0]
+		}
+	}
+	return nil
+}
+
+// finish records r's send result and releases everyone waiting for it. A
+// request that was not sent is no longer coalesced into. Caller holds
+// st.mu.
+func (st *station) finish(r *request, err error) {
+	r.err = err
+	if err != nil && st.inflight[r.key] == r {
+		delete(st.inflight, r.key)
+	}
+	close(r.done)
+}
+
+// Status returns every station's queue, by station name.
+func (s *Scheduler) Status() []QueueStatus {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.stations))
+	for name := range s.stations {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	out := make([]QueueStatus, 0, len(names))
+	for _, name := range names {
+		st := s.station(name)
+		st.mu.Lock()
+		qs := QueueStatus{
+			Station:   name,
+			Safety:    len(st.lanes[LaneSafety]),
+			Command:   len(st.lanes[LaneCommand]),
+			Telemetry: len(st.lanes[LaneTelemetry]),
+			Sent:      st.sent,
+			Coalesced: st.merged,
+			MaxWait:   st.maxWait.Round(time.Millisecond).String(),
+		}
+		st.mu.Unlock()
+		qs.Queued = qs.Safety + qs.Command + qs.Telemetry
+		out = append(out, qs)
+	}
+	return out
+}
+
+// commandCount returns how many device commands msg asks a station to run,
+// or 0 if it is not a command request.
+func commandCount(msg *protocol.Message) int {
+	switch msg.Envelope.Type {
+	case protocol.TypeDeviceCommandRequest:
+		return 1
+	case protocol.TypeDeviceCommandBatchRequest:
+		if p, err := protocol.ParseBatchRequest(msg); err == nil && len(p.Commands) > 0 {
+			return len(p.Commands)
+		}
+		return 1
+	}
+	return 0
+}
+
+// queryKey identifies a query by station, device, command and parameters,
+// or returns "" if msg cannot be coalesced.
+func queryKey(stream string, msg *protocol.Message) string {
+	if msg.Envelope.Type != protocol.TypeDeviceCommandRequest {
+		return ""
+	}
+	p, err := protocol.ParseCommandRequest(msg)
+	if err != nil || p.Raw || !IsQuery(p.CommandName) {
+		return ""
+	}
+	params, _ := json.Marshal(p.Parameters) // map keys are sorted
+	return stream + "\n" + p.DeviceID + "\n" + p.CommandName + "\n" + string(params)
+}
+
+func without(rs []*request, r *request) []*request {
+	for i, q := range rs {
+		if q == r {
+			return append(rs[:i:i], rs[i+1:]...)
+		}
+	}
+	return rs
+}
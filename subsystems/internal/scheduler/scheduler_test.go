@@ -0,0 +1,338 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/transport"
+)
+
+var testSource = protocol.Source{Service: "arturo_controller", Instance: "ctrl-01", Version: "1.0.0"}
+
+// recordingSender records the commands it sends, in order.
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (r *recordingSender) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	name := msg.Envelope.Type
+	if p, err := protocol.ParseCommandRequest(msg); err == nil && p.CommandName != "" {
+		name = p.CommandName
+	}
+	r.mu.Lock()
+	r.sent = append(r.sent, name)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingSender) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.sent...)
+}
+
+func command(t *testing.T, name string) *protocol.Message {
+	t.Helper()
+	msg, err := protocol.BuildCommandRequest(testSource, "PUMP-01", name, nil, 5000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func queued(s *Scheduler) int {
+	n := 0
+	for _, qs := range s.Status() {
+		n += qs.Queued
+	}
+	return n
+}
+
+func TestLanes(t *testing.T) {
+	rec := &recordingSender{}
+	s := New(rec, nil, 5) // one command per 200ms
+	stream := transport.CommandStream("station-01")
+	ctx := context.Background()
+
+	send := func(lane Lane, name string, wg *sync.WaitGroup) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.SendCommand(WithLane(ctx, lane), stream, command(t, name)); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	send(LaneTelemetry, "get_telemetry", &wg)
+	waitFor(t, "first send", func() bool { return len(rec.names()) == 1 })
+	send(LaneTelemetry, "get_pump_failure", &wg)
+	waitFor(t, "telemetry queued", func() bool { return queued(s) == 1 })
+	send(LaneCommand, "start_regen", &wg)
+	waitFor(t, "command queued", func() bool { return queued(s) == 2 })
+
+	// Safety commands skip the queue and the rate.
+	start := time.Now()
+	if err := s.SendCommand(WithLane(ctx, LaneSafety), stream, command(t, "close_rough_valve")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("safety command waited %s", d)
+	}
+	wg.Wait()
+
+	want := []string{"get_telemetry", "close_rough_valve", "start_regen", "get_pump_failure"}
+	got := rec.names()
+	if len(got) != len(want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sent %v, want %v", got, want)
+		}
+	}
+	if d := time.Since(start); d < 350*time.Millisecond {
+		t.Errorf("three paced commands took %s, want at least 400ms after the first", d)
+	}
+
+	st := s.Status()
+	if len(st) != 1 || st[0].Station != "station-01" || st[0].Sent != 4 || st[0].Queued != 0 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	rec := &recordingSender{}
+	d := transport.NewDispatcher()
+	s := New(rec, d, 0)
+	stream := transport.CommandStream("station-01")
+	ctx := context.Background()
+
+	first := command(t, "get_telemetry")
+	firstCh := d.Register(first.Envelope.CorrelationID)
+	second := command(t, "get_telemetry")
+	secondCh := d.Register(second.Envelope.CorrelationID)
+	for _, msg := range []*protocol.Message{first, second} {
+		if err := s.SendCommand(ctx, stream, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rec.names(); len(got) != 1 {
+		t.Fatalf("sent %v, want one get_telemetry", got)
+	}
+
+	resp := &protocol.Message{Envelope: protocol.Envelope{CorrelationID: first.Envelope.CorrelationID}}
+	d.Dispatch(resp)
+	<-firstCh
+	if got := <-secondCh; got.Envelope.CorrelationID != second.Envelope.CorrelationID {
+		t.Errorf("coalesced waiter got correlation ID %q", got.Envelope.CorrelationID)
+	}
+
+	// Answered queries and commands that change state are sent again.
+	third := command(t, "get_telemetry")
+	d.Register(third.Envelope.CorrelationID)
+	s.SendCommand(ctx, stream, third)
+	for i := 0; i < 2; i++ {
+		msg := command(t, "start_regen")
+		d.Register(msg.Envelope.CorrelationID)
+		s.SendCommand(ctx, stream, msg)
+	}
+	if got := rec.names(); len(got) != 4 {
+		t.Errorf("sent %v, want get_telemetry, get_telemetry, start_regen, start_regen", got)
+	}
+	if st := s.Status(); st[0].Coalesced != 1 {
+		t.Errorf("coalesced = %d, want 1", st[0].Coalesced)
+	}
+}
+
+func TestCoalescePromotesLeader(t *testing.T) {
+	rec := &recordingSender{}
+	d := transport.NewDispatcher()
+	s := New(rec, d, 5)
+	stream := transport.CommandStream("station-01")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		s.SendCommand(WithLane(ctx, LaneTelemetry), stream, command(t, "get_regen_step"))
+	}()
+	waitFor(t, "first send", func() bool { return len(rec.names()) == 1 })
+	poll := command(t, "get_telemetry")
+	d.Register(poll.Envelope.CorrelationID)
+	go func() {
+		defer wg.Done()
+		s.SendCommand(WithLane(ctx, LaneTelemetry), stream, poll)
+	}()
+	go func() {
+		defer wg.Done()
+		s.SendCommand(ctx, stream, command(t, "start_regen"))
+	}()
+	waitFor(t, "queued", func() bool { return queued(s) == 2 })
+
+	// A script asking for the same telemetry joins the queued poll, which
+	// moves up to the command lane behind start_regen, and returns once the
+	// poll is sent.
+	script := command(t, "get_telemetry")
+	d.Register(script.Envelope.CorrelationID)
+	scriptDone := make(chan error, 1)
+	go func() { scriptDone <- s.SendCommand(ctx, stream, script) }()
+	waitFor(t, "coalesced", func() bool { return s.Status()[0].Coalesced == 1 })
+	if st := s.Status(); st[0].Command != 2 || st[0].Telemetry != 0 {
+		t.Errorf("status = %+v, want the poll moved to the command lane", st[0])
+	}
+	if err := <-scriptDone; err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.names(); len(got) != 3 {
+		t.Errorf("script returned after %v, want the poll sent", got)
+	}
+	wg.Wait()
+	want := []string{"get_regen_step", "start_regen", "get_telemetry"}
+	if got := rec.names(); len(got) != 3 || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+// failingSender fails every send after a delay.
+type failingSender struct{ delay time.Duration }
+
+func (f failingSender) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	time.Sleep(f.delay)
+	return errors.New("bus down")
+}
+
+func TestCoalesceLeaderFails(t *testing.T) {
+	d := transport.NewDispatcher()
+	s := New(failingSender{delay: 50 * time.Millisecond}, d, 0)
+	stream := transport.CommandStream("station-01")
+	ctx := context.Background()
+
+	leader := command(t, "get_telemetry")
+	d.Register(leader.Envelope.CorrelationID)
+	leaderErr := make(chan error, 1)
+	go func() { leaderErr <- s.SendCommand(ctx, stream, leader) }()
+	waitFor(t, "leader in flight", func() bool {
+		st := s.Status()
+		return len(st) == 1 && st[0].Sent == 1
+	})
+
+	// A follower gets the leader's error instead of waiting for a
+	// response that will never come.
+	follower := command(t, "get_telemetry")
+	d.Register(follower.Envelope.CorrelationID)
+	if err := s.SendCommand(ctx, stream, follower); err == nil || err.Error() != "bus down" {
+		t.Errorf("follower err = %v, want the leader's send error", err)
+	}
+	if err := <-leaderErr; err == nil {
+		t.Error("expected the leader's send to fail")
+	}
+
+	// The failed query is forgotten, so the next one is sent again.
+	retry := command(t, "get_telemetry")
+	d.Register(retry.Envelope.CorrelationID)
+	s.SendCommand(ctx, stream, retry)
+	if st := s.Status()[0]; st.Sent != 2 || st.Coalesced != 1 {
+		t.Errorf("status = %+v, want the retry sent", st)
+	}
+}
+
+func TestCoalesceForgetsAnswered(t *testing.T) {
+	rec := &recordingSender{}
+	d := transport.NewDispatcher()
+	s := New(rec, d, 0)
+	stream := transport.CommandStream("station-01")
+
+	for _, name := range []string{"get_telemetry", "pump_status"} {
+		msg := command(t, name)
+		d.Register(msg.Envelope.CorrelationID)
+		s.SendCommand(context.Background(), stream, msg)
+		d.Dispatch(&protocol.Message{Envelope: protocol.Envelope{CorrelationID: msg.Envelope.CorrelationID}})
+	}
+	last := command(t, "get_telemetry")
+	s.SendCommand(context.Background(), stream, last)
+
+	st := s.station("station-01")
+	st.mu.Lock()
+	n := len(st.inflight)
+	st.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d queries in flight, want only the last one", n)
+	}
+	if got := rec.names(); len(got) != 3 {
+		t.Errorf("sent %v, want the answered query sent again", got)
+	}
+}
+
+func TestCancelQueued(t *testing.T) {
+	rec := &recordingSender{}
+	s := New(rec, nil, 5)
+	stream := transport.CommandStream("station-01")
+
+	s.SendCommand(context.Background(), stream, command(t, "get_telemetry"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.SendCommand(ctx, stream, command(t, "pump_status")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := queued(s); n != 0 {
+		t.Errorf("%d still queued", n)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if got := rec.names(); len(got) != 1 {
+		t.Errorf("sent %v, want the cancelled command dropped", got)
+	}
+}
+
+func TestNonCommandsBypass(t *testing.T) {
+	rec := &recordingSender{}
+	s := New(rec, nil, 1)
+	stream := transport.CommandStream("station-01")
+	s.SendCommand(context.Background(), stream, command(t, "get_telemetry"))
+
+	hello, err := protocol.BuildHello(testSource, protocol.ValidMessageTypes, nil, "1.0.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := s.SendCommand(context.Background(), stream, hello); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("hello waited %s behind the rate", d)
+	}
+	if len(s.Status()) != 1 || s.Status()[0].Sent != 1 {
+		t.Errorf("status = %+v, want only the command counted", s.Status())
+	}
+}
+
+func TestIsQuery(t *testing.T) {
+	for cmd, want := range map[string]bool{
+		"get_telemetry": true,
+		"pump_status":   true,
+		"start_regen":   false,
+		"set_pfr_on":    false,
+	} {
+		if got := IsQuery(cmd); got != want {
+			t.Errorf("IsQuery(%q) = %v, want %v", cmd, got, want)
+		}
+	}
+}
@@ -248,6 +248,18 @@ type ParallelStmt struct {
 func (n *ParallelStmt) Pos() token.Position { return n.Position }
 func (n *ParallelStmt) stmtNode()           {}
 
+// BatchStmt represents BATCH [TIMEOUT expr] ... ENDBATCH. The body holds
+// only QUERY statements, which are sent to the device in one round trip
+// when the station supports it.
+type BatchStmt struct {
+	Timeout  Expression // may be nil
+	Queries  []*QueryStmt
+	Position token.Position
+}
+
+func (n *BatchStmt) Pos() token.Position { return n.Position }
+func (n *BatchStmt) stmtNode()           {}
+
 // ---------------------------------------------------------------------------
 // Device communication
 // ---------------------------------------------------------------------------
@@ -424,6 +436,25 @@ type DelayStmt struct {
 func (n *DelayStmt) Pos() token.Position { return n.Position }
 func (n *DelayStmt) stmtNode()           {}
 
+// AcquireStmt represents ACQUIRE resource [TIMEOUT ms].
+type AcquireStmt struct {
+	Resource Expression
+	Timeout  Expression // nil = wait until acquired or the test is stopped
+	Position token.Position
+}
+
+func (n *AcquireStmt) Pos() token.Position { return n.Position }
+func (n *AcquireStmt) stmtNode()           {}
+
+// ReleaseStmt represents RELEASE resource.
+type ReleaseStmt struct {
+	Resource Expression
+	Position token.Position
+}
+
+func (n *ReleaseStmt) Pos() token.Position { return n.Position }
+func (n *ReleaseStmt) stmtNode()           {}
+
 // ReserveStmt represents RESERVE name size.
 type ReserveStmt struct {
 	Name     string
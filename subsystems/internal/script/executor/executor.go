@@ -31,6 +31,10 @@ var ErrContinue = errors.New("continue")
 // ErrTestTerminated signals that PASS, FAIL, or SKIP was called inside a test.
 var ErrTestTerminated = errors.New("test terminated")
 
+// ErrBatchUnsupported is returned by BatchRouter.SendBatch when the station
+// cannot take batches. The executor then sends the commands one at a time.
+var ErrBatchUnsupported = errors.New("station does not support batch commands")
+
 // ReturnValue wraps a return value for function returns.
 type ReturnValue struct {
 	Value interface{}
@@ -72,6 +76,29 @@ type DeviceRouter interface {
 	SendCommand(ctx context.Context, deviceID, command string, params map[string]string, timeoutMs int) (*CommandResult, error)
 }
 
+// BatchCommand is one device command sent as part of a batch.
+type BatchCommand struct {
+	DeviceID  string
+	Command   string
+	Params    map[string]string
+	TimeoutMs int // per-command device timeout; 0 = router default
+}
+
+// BatchResult is the outcome of one command in a batch: its result, or the
+// error the device reported for it.
+type BatchResult struct {
+	Result *CommandResult
+	Err    error
+}
+
+// BatchRouter is a DeviceRouter that can send several commands in one round
+// trip. Results are returned in command order. timeoutMs bounds the whole
+// round trip; 0 lets the router derive it from the command timeouts.
+type BatchRouter interface {
+	DeviceRouter
+	SendBatch(ctx context.Context, cmds []BatchCommand, timeoutMs int) ([]BatchResult, error)
+}
+
 // ResultCollector records test results during execution.
 type ResultCollector interface {
 	RecordTestStart(name string)
@@ -91,6 +118,15 @@ type EventEmitter interface {
 	EmitEvent(eventType, detail string)
 }
 
+// ResourceLocker grants named shared resources (a roughing pump or purge-gas
+// line shared between stations) to the running script.
+type ResourceLocker interface {
+	// Acquire blocks until the resource is granted, ctx is done, or timeout
+	// elapses. A zero timeout waits until granted or ctx is done.
+	Acquire(ctx context.Context, resource string, timeout time.Duration) error
+	Release(resource string) error
+}
+
 // ---------------------------------------------------------------------------
 // Options
 // ---------------------------------------------------------------------------
@@ -118,6 +154,11 @@ func WithEmitter(em EventEmitter) Option {
 	return func(e *Executor) { e.emitter = em }
 }
 
+// WithLocker sets the ResourceLocker used by ACQUIRE and RELEASE.
+func WithLocker(l ResourceLocker) Option {
+	return func(e *Executor) { e.locker = l }
+}
+
 // WithDeviceID sets the default device ID used by SEND and QUERY statements.
 // Scripts are station-scoped and do not name devices, so the executor needs
 // the device ID supplied at runtime.
@@ -136,6 +177,7 @@ type Executor struct {
 	router       DeviceRouter
 	collector    ResultCollector
 	emitter      EventEmitter
+	locker       ResourceLocker
 	logger       io.Writer
 	deviceID     string // default device ID for SEND/QUERY (station-scoped scripts)
 	functions    map[string]*ast.FunctionDef
@@ -218,6 +260,8 @@ func (e *Executor) execStatement(stmt ast.Statement) error {
 		return e.execTryStmt(s)
 	case *ast.ParallelStmt:
 		return e.execParallelStmt(s)
+	case *ast.BatchStmt:
+		return e.execBatchStmt(s)
 	case *ast.ConnectStmt:
 		return e.execConnectStmt(s)
 	case *ast.DisconnectStmt:
@@ -250,6 +294,10 @@ func (e *Executor) execStatement(stmt ast.Statement) error {
 		return e.execLogStmt(s)
 	case *ast.DelayStmt:
 		return e.execDelayStmt(s)
+	case *ast.AcquireStmt:
+		return e.execAcquireStmt(s)
+	case *ast.ReleaseStmt:
+		return e.execReleaseStmt(s)
 	case *ast.LibraryDef:
 		// Execute library body statements in the current scope.
 		for _, bs := range s.Body {
@@ -659,9 +707,29 @@ func (e *Executor) execSendStmt(s *ast.SendStmt) error {
 }
 
 func (e *Executor) execQueryStmt(s *ast.QueryStmt) error {
+	cmdStr, timeoutMs, err := e.evalQuery(s)
+	if err != nil {
+		return err
+	}
+
+	if e.router == nil {
+		fmt.Fprintf(e.logger, "QUERY %s -> %s (no router)\n", cmdStr, s.ResultVar)
+		return e.env.Set(s.ResultVar, "")
+	}
+
+	result, routeErr := e.sendWithRetry(cmdStr, nil, timeoutMs)
+	if routeErr != nil {
+		return fmt.Errorf("QUERY %s: %w", cmdStr, routeErr)
+	}
+
+	return e.finishQuery(s, cmdStr, result)
+}
+
+// evalQuery evaluates a QUERY's command and TIMEOUT expressions.
+func (e *Executor) evalQuery(s *ast.QueryStmt) (string, int, error) {
 	cmdVal, err := e.evalExpression(s.Command)
 	if err != nil {
-		return fmt.Errorf("QUERY: %w", err)
+		return "", 0, fmt.Errorf("QUERY: %w", err)
 	}
 	cmdStr := variable.ToString(cmdVal)
 
@@ -669,30 +737,102 @@ func (e *Executor) execQueryStmt(s *ast.QueryStmt) error {
 	if s.Timeout != nil {
 		tVal, tErr := e.evalExpression(s.Timeout)
 		if tErr != nil {
-			return fmt.Errorf("QUERY TIMEOUT: %w", tErr)
+			return "", 0, fmt.Errorf("QUERY TIMEOUT: %w", tErr)
 		}
 		t, convErr := variable.ToInt(tVal)
 		if convErr != nil {
-			return fmt.Errorf("QUERY TIMEOUT: %w", convErr)
+			return "", 0, fmt.Errorf("QUERY TIMEOUT: %w", convErr)
 		}
 		timeoutMs = int(t)
 	}
+	return cmdStr, timeoutMs, nil
+}
 
-	if e.router == nil {
-		fmt.Fprintf(e.logger, "QUERY %s -> %s (no router)\n", cmdStr, s.ResultVar)
-		return e.env.Set(s.ResultVar, "")
+// finishQuery records a QUERY's command and stores its response.
+func (e *Executor) finishQuery(s *ast.QueryStmt, cmdStr string, result *CommandResult) error {
+	if e.collector != nil && e.currentTest != "" {
+		e.collector.RecordCommand(e.currentTest, e.deviceID, cmdStr, result.Success, result.Response, result.DurationMs)
 	}
+	return e.env.Set(s.ResultVar, result.Response)
+}
 
-	result, routeErr := e.sendWithRetry(cmdStr, nil, timeoutMs)
-	if routeErr != nil {
-		return fmt.Errorf("QUERY %s: %w", cmdStr, routeErr)
+// execBatchStmt runs a BATCH block's queries in one round trip when the
+// router and station support batches, and one at a time otherwise. All
+// commands are evaluated before anything is sent. A query that failed
+// inside the batch is retried on its own with QUERY's usual retry loop, so
+// a BATCH behaves like the same QUERYs written out, only faster.
+func (e *Executor) execBatchStmt(s *ast.BatchStmt) error {
+	cmds := make([]BatchCommand, len(s.Queries))
+	for i, q := range s.Queries {
+		cmdStr, timeoutMs, err := e.evalQuery(q)
+		if err != nil {
+			return err
+		}
+		cmds[i] = BatchCommand{DeviceID: e.deviceID, Command: cmdStr, TimeoutMs: timeoutMs}
 	}
 
-	if e.collector != nil && e.currentTest != "" {
-		e.collector.RecordCommand(e.currentTest, e.deviceID, cmdStr, result.Success, result.Response, result.DurationMs)
+	batchTimeoutMs := 0
+	if s.Timeout != nil {
+		tVal, err := e.evalExpression(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("BATCH TIMEOUT: %w", err)
+		}
+		t, err := variable.ToInt(tVal)
+		if err != nil {
+			return fmt.Errorf("BATCH TIMEOUT: %w", err)
+		}
+		batchTimeoutMs = int(t)
 	}
 
-	return e.env.Set(s.ResultVar, result.Response)
+	if e.router == nil {
+		for i, q := range s.Queries {
+			fmt.Fprintf(e.logger, "QUERY %s -> %s (no router)\n", cmds[i].Command, q.ResultVar)
+			if err := e.env.Set(q.ResultVar, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results := e.sendBatch(cmds, batchTimeoutMs)
+	for i, q := range s.Queries {
+		var result *CommandResult
+		if results != nil && results[i].Err == nil {
+			result = results[i].Result
+		} else {
+			var err error
+			result, err = e.sendWithRetry(cmds[i].Command, nil, cmds[i].TimeoutMs)
+			if err != nil {
+				return fmt.Errorf("QUERY %s: %w", cmds[i].Command, err)
+			}
+		}
+		if err := e.finishQuery(q, cmds[i].Command, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBatch sends cmds in one round trip. It returns nil, so the caller
+// sends each command on its own, when the router or station cannot take
+// batches or the batch as a whole failed.
+func (e *Executor) sendBatch(cmds []BatchCommand, timeoutMs int) []BatchResult {
+	br, ok := e.router.(BatchRouter)
+	if !ok {
+		return nil
+	}
+	results, err := br.SendBatch(e.ctx, cmds, timeoutMs)
+	if err != nil {
+		if !errors.Is(err, ErrBatchUnsupported) && e.ctx.Err() == nil {
+			e.emit("log", fmt.Sprintf("[WARN] BATCH of %d queries failed: %v; sending them one at a time", len(cmds), err))
+		}
+		return nil
+	}
+	if len(results) != len(cmds) {
+		e.emit("log", fmt.Sprintf("[WARN] BATCH returned %d results for %d queries; sending them one at a time", len(results), len(cmds)))
+		return nil
+	}
+	return results
 }
 
 func (e *Executor) execRelayStmt(s *ast.RelayStmt) error {
@@ -1031,6 +1171,59 @@ func (e *Executor) execDelayStmt(s *ast.DelayStmt) error {
 	}
 }
 
+func (e *Executor) execAcquireStmt(s *ast.AcquireStmt) error {
+	resVal, err := e.evalExpression(s.Resource)
+	if err != nil {
+		return fmt.Errorf("ACQUIRE: %w", err)
+	}
+	resource := variable.ToString(resVal)
+
+	var timeout time.Duration
+	if s.Timeout != nil {
+		tVal, tErr := e.evalExpression(s.Timeout)
+		if tErr != nil {
+			return fmt.Errorf("ACQUIRE TIMEOUT: %w", tErr)
+		}
+		ms, convErr := variable.ToInt(tVal)
+		if convErr != nil {
+			return fmt.Errorf("ACQUIRE TIMEOUT: %w", convErr)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	if e.locker == nil {
+		fmt.Fprintf(e.logger, "ACQUIRE %s (no locker)\n", resource)
+		return nil
+	}
+
+	start := time.Now()
+	if err := e.locker.Acquire(e.ctx, resource, timeout); err != nil {
+		return fmt.Errorf("ACQUIRE %s: %w", resource, err)
+	}
+	if waited := time.Since(start); waited >= time.Second {
+		e.emit("log", fmt.Sprintf("[INFO] acquired %s after waiting %s", resource, waited.Round(time.Second)))
+	}
+	return nil
+}
+
+func (e *Executor) execReleaseStmt(s *ast.ReleaseStmt) error {
+	resVal, err := e.evalExpression(s.Resource)
+	if err != nil {
+		return fmt.Errorf("RELEASE: %w", err)
+	}
+	resource := variable.ToString(resVal)
+
+	if e.locker == nil {
+		fmt.Fprintf(e.logger, "RELEASE %s (no locker)\n", resource)
+		return nil
+	}
+
+	if err := e.locker.Release(resource); err != nil {
+		return fmt.Errorf("RELEASE %s: %w", resource, err)
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // Block execution helper
 // ---------------------------------------------------------------------------
@@ -833,6 +833,170 @@ DISCONNECT dmm`
 	})
 }
 
+// mockBatchRouter is a mockRouter that also takes batches. Commands named
+// in failInBatch fail inside the batch; batchErr fails the whole batch.
+type mockBatchRouter struct {
+	mockRouter
+	batches      [][]BatchCommand
+	batchTimeout int
+	failInBatch  string
+	batchErr     error
+}
+
+func (m *mockBatchRouter) SendBatch(_ context.Context, cmds []BatchCommand, timeoutMs int) ([]BatchResult, error) {
+	m.batches = append(m.batches, cmds)
+	m.batchTimeout = timeoutMs
+	if m.batchErr != nil {
+		return nil, m.batchErr
+	}
+	results := make([]BatchResult, len(cmds))
+	for i, c := range cmds {
+		if c.Command == m.failInBatch {
+			results[i].Err = errors.New("device error E_DEVICE_TIMEOUT: no answer")
+			continue
+		}
+		results[i].Result = &CommandResult{Success: true, Response: "batch:" + c.Command, DurationMs: 2}
+	}
+	return results, nil
+}
+
+func TestBatchQueries(t *testing.T) {
+	src := `BATCH TIMEOUT 4000
+    QUERY "get_temp_1st_stage" t1
+    QUERY "get_temp_2nd_stage" t2 TIMEOUT 1500
+ENDBATCH`
+
+	t.Run("one round trip", func(t *testing.T) {
+		router := &mockBatchRouter{}
+		exec, err := parseAndExec(t, src, WithRouter(router))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(router.batches) != 1 || len(router.commands) != 0 {
+			t.Fatalf("batches = %d, single commands = %d", len(router.batches), len(router.commands))
+		}
+		if router.batchTimeout != 4000 || router.batches[0][1].TimeoutMs != 1500 {
+			t.Errorf("batch timeout = %d, item timeout = %d", router.batchTimeout, router.batches[0][1].TimeoutMs)
+		}
+		if v, _ := exec.Env().Get("t2"); v != "batch:get_temp_2nd_stage" {
+			t.Errorf("t2 = %v", v)
+		}
+	})
+
+	t.Run("failed item sent alone", func(t *testing.T) {
+		router := &mockBatchRouter{failInBatch: "get_temp_1st_stage"}
+		exec, err := parseAndExec(t, src, WithRouter(router))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(router.commands) != 1 || router.commands[0].command != "get_temp_1st_stage" {
+			t.Fatalf("single commands = %+v", router.commands)
+		}
+		if v, _ := exec.Env().Get("t1"); v != "OK" {
+			t.Errorf("t1 = %v, want the single-command response", v)
+		}
+	})
+
+	t.Run("unsupported falls back quietly", func(t *testing.T) {
+		router := &mockBatchRouter{batchErr: ErrBatchUnsupported}
+		em := &capturingEmitter{}
+		_, err := parseAndExec(t, src, WithRouter(router), WithEmitter(em))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(router.commands) != 2 {
+			t.Fatalf("single commands = %d, want 2", len(router.commands))
+		}
+		if logs := em.logs(); len(logs) != 0 {
+			t.Errorf("unexpected logs: %v", logs)
+		}
+	})
+
+	t.Run("plain router runs queries singly", func(t *testing.T) {
+		router := &mockRouter{}
+		_, err := parseAndExec(t, src, WithRouter(router))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(router.commands) != 2 || router.commands[1].timeoutMs != 1500 {
+			t.Fatalf("commands = %+v", router.commands)
+		}
+	})
+
+	t.Run("commands recorded in order", func(t *testing.T) {
+		router := &mockBatchRouter{}
+		coll := &mockCollector{}
+		_, err := parseAndExec(t, `TEST "batch"
+`+src+`
+ENDTEST`, WithRouter(router), WithCollector(coll))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(coll.commands) != 2 || coll.commands[0].command != "get_temp_1st_stage" {
+			t.Fatalf("recorded = %+v", coll.commands)
+		}
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Shared resources
+// ---------------------------------------------------------------------------
+
+type mockLocker struct {
+	calls      []string
+	timeouts   []time.Duration
+	acquireErr error
+}
+
+func (m *mockLocker) Acquire(_ context.Context, resource string, timeout time.Duration) error {
+	m.calls = append(m.calls, "acquire "+resource)
+	m.timeouts = append(m.timeouts, timeout)
+	return m.acquireErr
+}
+
+func (m *mockLocker) Release(resource string) error {
+	m.calls = append(m.calls, "release "+resource)
+	return nil
+}
+
+func TestResourceLocks(t *testing.T) {
+	t.Run("ACQUIRE and RELEASE route to locker", func(t *testing.T) {
+		locker := &mockLocker{}
+		src := `ACQUIRE "rough_line" TIMEOUT 2000
+RELEASE "rough_line"`
+		_, err := parseAndExec(t, src, WithLocker(locker))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"acquire rough_line", "release rough_line"}
+		if strings.Join(locker.calls, ",") != strings.Join(want, ",") {
+			t.Fatalf("calls = %v, want %v", locker.calls, want)
+		}
+		if locker.timeouts[0] != 2*time.Second {
+			t.Fatalf("timeout = %s, want 2s", locker.timeouts[0])
+		}
+	})
+
+	t.Run("ACQUIRE error propagates", func(t *testing.T) {
+		locker := &mockLocker{acquireErr: errors.New("timed out")}
+		_, err := parseAndExec(t, `ACQUIRE "rough_line" TIMEOUT 10`, WithLocker(locker))
+		if err == nil || !strings.Contains(err.Error(), "ACQUIRE rough_line: timed out") {
+			t.Fatalf("expected ACQUIRE timeout error, got %v", err)
+		}
+	})
+
+	t.Run("no locker is logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := parseAndExec(t, `ACQUIRE "rough_line"`, WithLogger(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "ACQUIRE rough_line (no locker)") {
+			t.Fatalf("expected no-locker log, got: %s", buf.String())
+		}
+	})
+}
+
 // ---------------------------------------------------------------------------
 // QUERY / SEND retry behavior
 // ---------------------------------------------------------------------------
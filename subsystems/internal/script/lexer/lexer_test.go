@@ -144,6 +144,8 @@ func TestAllKeywords(t *testing.T) {
 		{"PARALLEL", token.TOKEN_PARALLEL},
 		{"ENDPARALLEL", token.TOKEN_ENDPARALLEL},
 		{"TIMEOUT", token.TOKEN_TIMEOUT},
+		{"BATCH", token.TOKEN_BATCH},
+		{"ENDBATCH", token.TOKEN_ENDBATCH},
 		{"CONNECT", token.TOKEN_CONNECT},
 		{"DISCONNECT", token.TOKEN_DISCONNECT},
 		{"TCP", token.TOKEN_TCP},
@@ -165,6 +167,8 @@ func TestAllKeywords(t *testing.T) {
 		{"ASSERT", token.TOKEN_ASSERT},
 		{"LOG", token.TOKEN_LOG},
 		{"DELAY", token.TOKEN_DELAY},
+		{"ACQUIRE", token.TOKEN_ACQUIRE},
+		{"RELEASE", token.TOKEN_RELEASE},
 		{"RESERVE", token.TOKEN_RESERVE},
 		{"ON", token.TOKEN_ON},
 		{"OFF", token.TOKEN_OFF},
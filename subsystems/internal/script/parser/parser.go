@@ -174,13 +174,14 @@ func isStatementStart(tt token.TokenType) bool {
 		token.TOKEN_DELETE, token.TOKEN_APPEND, token.TOKEN_EXTEND,
 		token.TOKEN_IF, token.TOKEN_LOOP, token.TOKEN_WHILE, token.TOKEN_FOREACH,
 		token.TOKEN_BREAK, token.TOKEN_CONTINUE,
-		token.TOKEN_TRY, token.TOKEN_PARALLEL,
+		token.TOKEN_TRY, token.TOKEN_PARALLEL, token.TOKEN_BATCH,
 		token.TOKEN_CONNECT, token.TOKEN_DISCONNECT,
 		token.TOKEN_SEND, token.TOKEN_QUERY, token.TOKEN_RELAY,
 		token.TOKEN_FUNCTION, token.TOKEN_CALL, token.TOKEN_RETURN,
 		token.TOKEN_IMPORT, token.TOKEN_LIBRARY,
 		token.TOKEN_PASS, token.TOKEN_FAIL, token.TOKEN_SKIP,
 		token.TOKEN_ASSERT, token.TOKEN_LOG, token.TOKEN_DELAY,
+		token.TOKEN_ACQUIRE, token.TOKEN_RELEASE,
 		token.TOKEN_RESERVE,
 		token.TOKEN_TEST, token.TOKEN_SUITE:
 		return true
@@ -197,7 +198,7 @@ func isBlockEnd(tt token.TokenType) bool {
 		token.TOKEN_ENDIF, token.TOKEN_ELSEIF, token.TOKEN_ELSE,
 		token.TOKEN_ENDLOOP, token.TOKEN_ENDWHILE, token.TOKEN_ENDFOREACH,
 		token.TOKEN_ENDTRY, token.TOKEN_CATCH, token.TOKEN_FINALLY,
-		token.TOKEN_ENDPARALLEL,
+		token.TOKEN_ENDPARALLEL, token.TOKEN_ENDBATCH,
 		token.TOKEN_ENDFUNCTION,
 		token.TOKEN_ENDLIBRARY,
 		token.TOKEN_EOF:
@@ -277,6 +278,8 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseTryStmt()
 	case token.TOKEN_PARALLEL:
 		return p.parseParallelStmt()
+	case token.TOKEN_BATCH:
+		return p.parseBatchStmt()
 	case token.TOKEN_CONNECT:
 		return p.parseConnectStmt()
 	case token.TOKEN_DISCONNECT:
@@ -309,6 +312,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLogStmt()
 	case token.TOKEN_DELAY:
 		return p.parseDelayStmt()
+	case token.TOKEN_ACQUIRE:
+		return p.parseAcquireStmt()
+	case token.TOKEN_RELEASE:
+		return p.parseReleaseStmt()
 	case token.TOKEN_RESERVE:
 		return p.parseReserveStmt()
 	case token.TOKEN_TEST:
@@ -594,6 +601,35 @@ func (p *Parser) parseParallelStmt() *ast.ParallelStmt {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Batch
+// ---------------------------------------------------------------------------
+
+func (p *Parser) parseBatchStmt() *ast.BatchStmt {
+	tok := p.advance() // consume BATCH
+
+	node := &ast.BatchStmt{Position: tok.Pos}
+	if p.peekType() == token.TOKEN_TIMEOUT {
+		p.advance() // consume TIMEOUT
+		node.Timeout = p.parseExpression()
+	}
+
+	for _, stmt := range p.parseBlock(token.TOKEN_ENDBATCH) {
+		q, ok := stmt.(*ast.QueryStmt)
+		if !ok {
+			p.addError(stmt.Pos(), "only QUERY statements are allowed in BATCH")
+			continue
+		}
+		node.Queries = append(node.Queries, q)
+	}
+	p.expect(token.TOKEN_ENDBATCH)
+	if len(node.Queries) == 0 {
+		p.addError(tok.Pos, "BATCH must contain at least one QUERY")
+	}
+
+	return node
+}
+
 // ---------------------------------------------------------------------------
 // Device communication
 // ---------------------------------------------------------------------------
@@ -900,6 +936,28 @@ func (p *Parser) parseDelayStmt() *ast.DelayStmt {
 	return &ast.DelayStmt{Duration: dur, Position: tok.Pos}
 }
 
+func (p *Parser) parseAcquireStmt() *ast.AcquireStmt {
+	tok := p.advance() // consume ACQUIRE
+	node := &ast.AcquireStmt{
+		Resource: p.parseExpression(),
+		Position: tok.Pos,
+	}
+
+	// Optional TIMEOUT
+	if p.peekType() == token.TOKEN_TIMEOUT {
+		p.advance() // consume TIMEOUT
+		node.Timeout = p.parseExpression()
+	}
+
+	return node
+}
+
+func (p *Parser) parseReleaseStmt() *ast.ReleaseStmt {
+	tok := p.advance() // consume RELEASE
+	res := p.parseExpression()
+	return &ast.ReleaseStmt{Resource: res, Position: tok.Pos}
+}
+
 func (p *Parser) parseReserveStmt() *ast.ReserveStmt {
 	tok := p.advance() // consume RESERVE
 	nameTok := p.expect(token.TOKEN_IDENT)
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/holla2040/arturo/internal/script/ast"
@@ -777,6 +778,41 @@ func TestDelayStatement(t *testing.T) {
 	}
 }
 
+func TestAcquireStatement(t *testing.T) {
+	prog := parseSource(t, `ACQUIRE "rough_line" TIMEOUT 600000
+RELEASE "rough_line"`)
+	requireStmtCount(t, prog, 2)
+	acq, ok := prog.Statements[0].(*ast.AcquireStmt)
+	if !ok {
+		t.Fatalf("expected *ast.AcquireStmt, got %T", prog.Statements[0])
+	}
+	if res := acq.Resource.(*ast.StringLit); res.Value != "rough_line" {
+		t.Errorf("resource: got %q, want %q", res.Value, "rough_line")
+	}
+	if num := acq.Timeout.(*ast.NumberLit); num.Value != "600000" {
+		t.Errorf("timeout: got %q, want %q", num.Value, "600000")
+	}
+	rel, ok := prog.Statements[1].(*ast.ReleaseStmt)
+	if !ok {
+		t.Fatalf("expected *ast.ReleaseStmt, got %T", prog.Statements[1])
+	}
+	if res := rel.Resource.(*ast.StringLit); res.Value != "rough_line" {
+		t.Errorf("resource: got %q, want %q", res.Value, "rough_line")
+	}
+}
+
+func TestAcquireWithoutTimeout(t *testing.T) {
+	prog := parseSource(t, `ACQUIRE "purge_gas"`)
+	requireStmtCount(t, prog, 1)
+	acq, ok := prog.Statements[0].(*ast.AcquireStmt)
+	if !ok {
+		t.Fatalf("expected *ast.AcquireStmt, got %T", prog.Statements[0])
+	}
+	if acq.Timeout != nil {
+		t.Errorf("timeout should be nil")
+	}
+}
+
 func TestParallelBlock(t *testing.T) {
 	src := `PARALLEL
     SEND "reset"
@@ -796,6 +832,45 @@ ENDPARALLEL`
 	}
 }
 
+func TestBatchBlock(t *testing.T) {
+	src := `BATCH TIMEOUT 8000
+    QUERY "get_temp_1st_stage" t1
+    QUERY "get_temp_2nd_stage" t2 TIMEOUT 2000
+ENDBATCH`
+	prog := parseSource(t, src)
+	requireStmtCount(t, prog, 1)
+	s, ok := prog.Statements[0].(*ast.BatchStmt)
+	if !ok {
+		t.Fatalf("expected *ast.BatchStmt, got %T", prog.Statements[0])
+	}
+	if s.Timeout == nil || s.Timeout.(*ast.NumberLit).Value != "8000" {
+		t.Errorf("timeout: got %v, want 8000", s.Timeout)
+	}
+	if len(s.Queries) != 2 {
+		t.Fatalf("queries: got %d, want 2", len(s.Queries))
+	}
+	if s.Queries[1].ResultVar != "t2" || s.Queries[1].Timeout == nil {
+		t.Errorf("second query: %+v", s.Queries[1])
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"non_query", "BATCH\n    SEND \"reset\"\nENDBATCH", "only QUERY statements are allowed in BATCH"},
+		{"empty", "BATCH\nENDBATCH", "BATCH must contain at least one QUERY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := parseSourceWithErrors(t, tt.src)
+			if len(errs) == 0 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Errorf("errors = %v, want %q", errs, tt.want)
+			}
+		})
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	src := "SET arr [1, 2, 3]"
 	prog := parseSource(t, src)
@@ -35,6 +35,32 @@ type ModbusConfig struct {
 	Coils        map[string]int `yaml:"coils,omitempty" json:"coils,omitempty"`
 }
 
+// SafeStateConfig lists profile commands the controller sends to put a device
+// into a safe state when a test is paused, terminated or aborted (e.g. closing
+// the rough valve mid-regen). Each list is sent in order.
+type SafeStateConfig struct {
+	Pause     []string `yaml:"pause,omitempty" json:"pause,omitempty"`
+	Terminate []string `yaml:"terminate,omitempty" json:"terminate,omitempty"`
+	Abort     []string `yaml:"abort,omitempty" json:"abort,omitempty"`
+}
+
+// Commands returns the safe-state commands for the given action ("pause",
+// "terminate" or "abort"). A nil config has no commands.
+func (c *SafeStateConfig) Commands(action string) []string {
+	if c == nil {
+		return nil
+	}
+	switch action {
+	case "pause":
+		return c.Pause
+	case "terminate":
+		return c.Terminate
+	case "abort":
+		return c.Abort
+	}
+	return nil
+}
+
 // DeviceProfile represents a single device's configuration loaded from YAML.
 type DeviceProfile struct {
 	Manufacturer string            `yaml:"manufacturer" json:"manufacturer"`
@@ -45,6 +71,7 @@ type DeviceProfile struct {
 	Modbus       *ModbusConfig     `yaml:"modbus,omitempty" json:"modbus,omitempty"`
 	Commands     map[string]string `yaml:"commands" json:"commands"`
 	Responses    map[string]string `yaml:"responses,omitempty" json:"responses,omitempty"`
+	SafeState    *SafeStateConfig  `yaml:"safe_state,omitempty" json:"safe_state,omitempty"`
 
 	// DeviceID is derived from the filename (extension stripped), not from YAML.
 	DeviceID string `yaml:"-" json:"device_id"`
@@ -84,6 +111,15 @@ func LoadProfile(path string) (*DeviceProfile, error) {
 	base := filepath.Base(path)
 	p.DeviceID = strings.TrimSuffix(base, filepath.Ext(base))
 
+	// Safe-state commands must name commands defined by this profile.
+	for _, action := range []string{"pause", "terminate", "abort"} {
+		for _, cmd := range p.SafeState.Commands(action) {
+			if _, ok := p.Commands[cmd]; !ok {
+				return nil, fmt.Errorf("profile %s: safe_state %s command %q not defined in commands", path, action, cmd)
+			}
+		}
+	}
+
 	return &p, nil
 }
 
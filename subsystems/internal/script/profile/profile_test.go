@@ -566,6 +566,77 @@ func TestLoadActualProfile_Fluke(t *testing.T) {
 	}
 }
 
+func TestLoadProfile_SafeState(t *testing.T) {
+	dir := t.TempDir()
+	path := writeYAML(t, dir, "pump.yaml", `
+manufacturer: "CTI"
+model: "On-Board Cryopump"
+type: "cryopump"
+protocol: "cti"
+packetizer:
+  type: "cti"
+commands:
+  close_rough_valve: "$P{addr}D0{checksum}"
+  close_purge_valve: "$P{addr}E0{checksum}"
+safe_state:
+  pause: [close_rough_valve]
+  terminate: [close_rough_valve, close_purge_valve]
+`)
+
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+	if got := p.SafeState.Commands("pause"); len(got) != 1 || got[0] != "close_rough_valve" {
+		t.Errorf("SafeState pause = %v, want [close_rough_valve]", got)
+	}
+	if got := p.SafeState.Commands("terminate"); len(got) != 2 {
+		t.Errorf("SafeState terminate = %v, want 2 commands", got)
+	}
+	if got := p.SafeState.Commands("abort"); got != nil {
+		t.Errorf("SafeState abort = %v, want nil", got)
+	}
+
+	var none *SafeStateConfig
+	if got := none.Commands("pause"); got != nil {
+		t.Errorf("nil SafeState pause = %v, want nil", got)
+	}
+}
+
+func TestLoadProfile_SafeStateUnknownCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := writeYAML(t, dir, "pump.yaml", `
+manufacturer: "CTI"
+model: "On-Board Cryopump"
+type: "cryopump"
+protocol: "cti"
+commands:
+  close_rough_valve: "$P{addr}D0{checksum}"
+safe_state:
+  abort: [close_gate_valve]
+`)
+
+	if _, err := LoadProfile(path); err == nil {
+		t.Error("expected error for safe_state command not defined in commands")
+	}
+}
+
+func TestLoadActualProfile_CTISafeState(t *testing.T) {
+	dir := repoProfilesDir(t)
+	path := filepath.Join(dir, "pumps", "cti_onboard.yaml")
+
+	p, err := LoadProfile(path)
+	if err != nil {
+		t.Fatalf("LoadProfile() error: %v", err)
+	}
+	if p.SafeState == nil {
+		t.Fatal("expected safe_state in CTI profile")
+	}
+	if got := p.SafeState.Commands("pause"); len(got) == 0 || got[0] != "close_rough_valve" {
+		t.Errorf("SafeState pause = %v, want close_rough_valve first", got)
+	}
+}
+
 func TestBuildIntrospection(t *testing.T) {
 	profiles := []*DeviceProfile{
 		{
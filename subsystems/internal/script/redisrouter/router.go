@@ -1,32 +1,78 @@
 // Package redisrouter implements executor.DeviceRouter by sending protocol
-// messages through Redis Pub/Sub. It publishes command requests to the station's
-// command channel and subscribes to its own response channel for the correlated response.
+// messages over the bus (Redis Streams, or MQTT; see package transport). It
+// appends command requests to the station's command stream and waits for the
+// correlated response from a Dispatcher fed by the process's single response
+// stream listener (transport.ListenResponses), so routers for any number of
+// sessions share one reader.
 package redisrouter
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/script/executor"
-	"github.com/redis/go-redis/v9"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
-// RedisRouter sends device commands over Redis Pub/Sub and waits for responses.
+// Sender appends a command request to a station's command stream.
+// api.CommandSender and *transport.Sender satisfy it.
+type Sender interface {
+	SendCommand(ctx context.Context, stream string, msg *protocol.Message) error
+}
+
+// Dispatcher hands out a channel that receives the response with a given
+// correlation ID. *transport.Dispatcher (api.ResponseDispatcher) satisfies it.
+type Dispatcher interface {
+	Register(correlationID string) chan *protocol.Message
+	Deregister(correlationID string)
+}
+
+// Metrics counts the commands a router has sent.
+type Metrics struct {
+	InFlight int64 `json:"in_flight"` // sent, response not yet received
+	Sent     int64 `json:"sent"`
+	TimedOut int64 `json:"timed_out"`
+}
+
+// RedisRouter sends device commands over Redis Streams and waits for responses.
 type RedisRouter struct {
-	rdb     *redis.Client
-	source  protocol.Source
-	station string // station instance id, e.g. "station-01"
+	sender     Sender
+	dispatcher Dispatcher
+	source     protocol.Source
+	station    string // station instance id, e.g. "station-01"
+	supports   func(feature string) bool
+
+	inFlight atomic.Int64
+	sent     atomic.Int64
+	timedOut atomic.Int64
 }
 
 // New creates a RedisRouter.
-//   - rdb: connected go-redis client
-//   - source: protocol Source for this engine instance
-//   - station: station instance id (used to address command channel)
-func New(rdb *redis.Client, source protocol.Source, station string) *RedisRouter {
-	return &RedisRouter{rdb: rdb, source: source, station: station}
+//   - sender: appends requests to the station's command stream
+//   - dispatcher: delivers responses read from source's response stream
+//   - source: protocol Source for this engine instance (its reply_to stream)
+//   - station: station instance id (used to address command stream)
+func New(sender Sender, dispatcher Dispatcher, source protocol.Source, station string) *RedisRouter {
+	return &RedisRouter{sender: sender, dispatcher: dispatcher, source: source, station: station}
+}
+
+// SetFeatureCheck sets the function SendBatch uses to ask whether the
+// station advertised a service.hello feature (registry.Supports bound to
+// the station). Without one, SendBatch reports executor.ErrBatchUnsupported.
+func (r *RedisRouter) SetFeatureCheck(supports func(feature string) bool) {
+	r.supports = supports
+}
+
+// Metrics returns the router's command counters.
+func (r *RedisRouter) Metrics() Metrics {
+	return Metrics{
+		InFlight: r.inFlight.Load(),
+		Sent:     r.sent.Load(),
+		TimedOut: r.timedOut.Load(),
+	}
 }
 
 // SendCommand implements executor.DeviceRouter.
@@ -41,94 +87,150 @@ func (r *RedisRouter) SendCommand(ctx context.Context, deviceID, command string,
 	if err != nil {
 		return nil, fmt.Errorf("build command request: %w", err)
 	}
-	correlationID := msg.Envelope.CorrelationID
 
-	// 2. Marshal to JSON.
-	data, err := json.Marshal(msg)
+	// 2. Send and wait for the correlated response.
+	respMsg, err := r.roundTrip(ctx, msg, timeoutMs)
 	if err != nil {
-		return nil, fmt.Errorf("marshal message: %w", err)
+		return nil, err
 	}
 
-	// 3. Subscribe to response channel BEFORE publishing command.
-	responseChannel := "responses:" + r.source.Instance
-	sub := r.rdb.Subscribe(ctx, responseChannel)
-	defer sub.Close()
+	// 3. Parse command response payload.
+	payload, payloadErr := protocol.ParseCommandResponse(respMsg)
+	if payloadErr != nil {
+		return nil, fmt.Errorf("parse response payload: %w", payloadErr)
+	}
+	return commandResult(payload)
+}
 
-	ch := sub.Channel()
+// SendBatch implements executor.BatchRouter. Commands are sent as
+// device.command.batch_request messages of at most protocol.MaxBatchCommands
+// each; a longer list takes several round trips. timeoutMs bounds each
+// round trip and defaults to the sum of its commands' timeouts. A failed
+// command is reported in its BatchResult; an error return means no results
+// are usable.
+func (r *RedisRouter) SendBatch(ctx context.Context, cmds []executor.BatchCommand, timeoutMs int) ([]executor.BatchResult, error) {
+	if r.supports == nil || !r.supports(protocol.FeatureBatchCommands) {
+		return nil, executor.ErrBatchUnsupported
+	}
 
-	// 4. Publish to the station's command channel.
-	channelKey := "commands:" + r.station
-	if err := r.rdb.Publish(ctx, channelKey, string(data)).Err(); err != nil {
-		return nil, fmt.Errorf("PUBLISH %s: %w", channelKey, err)
+	results := make([]executor.BatchResult, 0, len(cmds))
+	for start := 0; start < len(cmds); start += protocol.MaxBatchCommands {
+		end := min(start+protocol.MaxBatchCommands, len(cmds))
+		chunk, err := r.sendBatchChunk(ctx, cmds[start:end], timeoutMs)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, chunk...)
 	}
+	return results, nil
+}
 
-	// 5. Read response from subscription with timeout.
-	deadline := time.Duration(timeoutMs) * time.Millisecond
-	timer := time.NewTimer(deadline)
-	defer timer.Stop()
+func (r *RedisRouter) sendBatchChunk(ctx context.Context, cmds []executor.BatchCommand, timeoutMs int) ([]executor.BatchResult, error) {
+	items := make([]protocol.BatchCommand, len(cmds))
+	total := 0
+	for i, c := range cmds {
+		t := c.TimeoutMs
+		if t <= 0 {
+			t = 5000
+		}
+		total += t
+		items[i] = protocol.BatchCommand{DeviceID: c.DeviceID, CommandName: c.Command, Parameters: c.Params, TimeoutMs: &t}
+	}
+	if timeoutMs <= 0 {
+		timeoutMs = min(total, 600000)
+	}
 
-	for {
-		select {
-		case subMsg, ok := <-ch:
-			if !ok {
-				return nil, fmt.Errorf("subscription channel closed")
-			}
+	msg, err := protocol.BuildBatchRequest(r.source, items, timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("build batch request: %w", err)
+	}
+	respMsg, err := r.roundTrip(ctx, msg, timeoutMs)
+	if err != nil {
+		return nil, err
+	}
+	if respMsg.Envelope.Type != protocol.TypeDeviceCommandBatchResponse {
+		return nil, fmt.Errorf("unexpected %s in reply to batch request", respMsg.Envelope.Type)
+	}
+	payload, err := protocol.ParseBatchResponse(respMsg)
+	if err != nil {
+		return nil, fmt.Errorf("parse batch response payload: %w", err)
+	}
+	if len(payload.Results) != len(cmds) {
+		return nil, fmt.Errorf("batch response has %d results for %d commands", len(payload.Results), len(cmds))
+	}
 
-			respMsg, parseErr := protocol.Parse([]byte(subMsg.Payload))
-			if parseErr != nil {
-				continue
-			}
+	results := make([]executor.BatchResult, len(cmds))
+	for i := range payload.Results {
+		results[i].Result, results[i].Err = commandResult(&payload.Results[i])
+	}
+	return results, nil
+}
 
-			// Match by correlation_id.
-			if respMsg.Envelope.CorrelationID != correlationID {
-				continue
-			}
+// roundTrip sends msg to the station's command stream and waits up to
+// timeoutMs for the response carrying its correlation ID.
+func (r *RedisRouter) roundTrip(ctx context.Context, msg *protocol.Message, timeoutMs int) (*protocol.Message, error) {
+	// Register for the response before sending so a fast reply can't
+	// arrive unclaimed, then append to the station's command stream.
+	correlationID := msg.Envelope.CorrelationID
+	ch := r.dispatcher.Register(correlationID)
+	r.inFlight.Add(1)
+	defer r.inFlight.Add(-1)
 
-			// 6. Parse command response payload.
-			payload, payloadErr := protocol.ParseCommandResponse(respMsg)
-			if payloadErr != nil {
-				return nil, fmt.Errorf("parse response payload: %w", payloadErr)
-			}
+	if err := r.sender.SendCommand(ctx, transport.CommandStream(r.station), msg); err != nil {
+		r.dispatcher.Deregister(correlationID)
+		return nil, fmt.Errorf("send command: %w", err)
+	}
+	r.sent.Add(1)
 
-			// Device-reported failure (success=false) is surfaced as an error
-			// so callers see a meaningful message instead of an empty Response
-			// string. Transient failures (e.g. pump_cache_stale) trigger the
-			// executor's QUERY/SEND retry loop; persistent ones fail the test
-			// with the device's error code/message.
-			if !payload.Success {
-				code := "unknown"
-				msg := "device returned unsuccessful response"
-				if payload.Error != nil {
-					if payload.Error.Code != "" {
-						code = payload.Error.Code
-					}
-					if payload.Error.Message != "" {
-						msg = payload.Error.Message
-					}
-				}
-				return nil, fmt.Errorf("device error %s: %s", code, msg)
-			}
+	timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case respMsg := <-ch:
+		return respMsg, nil
+	case <-timer.C:
+		r.dispatcher.Deregister(correlationID)
+		r.timedOut.Add(1)
+		return nil, fmt.Errorf("timeout waiting for response on %s (correlation_id=%s)", msg.Envelope.ReplyTo, correlationID)
+	case <-ctx.Done():
+		r.dispatcher.Deregister(correlationID)
+		return nil, ctx.Err()
+	}
+}
 
-			resp := ""
-			if payload.Response != nil {
-				resp = *payload.Response
+// commandResult converts a command response payload into a CommandResult.
+func commandResult(payload *protocol.CommandResponsePayload) (*executor.CommandResult, error) {
+	// Device-reported failure (success=false) is surfaced as an error
+	// so callers see a meaningful message instead of an empty Response
+	// string. Transient failures (e.g. pump_cache_stale) trigger the
+	// executor's QUERY/SEND retry loop; persistent ones fail the test
+	// with the device's error code/message.
+	if !payload.Success {
+		code := "unknown"
+		msg := "device returned unsuccessful response"
+		if payload.Error != nil {
+			if payload.Error.Code != "" {
+				code = payload.Error.Code
 			}
-			dur := 0
-			if payload.DurationMs != nil {
-				dur = *payload.DurationMs
+			if payload.Error.Message != "" {
+				msg = payload.Error.Message
 			}
-
-			return &executor.CommandResult{
-				Success:    payload.Success,
-				Response:   resp,
-				DurationMs: dur,
-			}, nil
-
-		case <-timer.C:
-			return nil, fmt.Errorf("timeout waiting for response on %s (correlation_id=%s)", responseChannel, correlationID)
-
-		case <-ctx.Done():
-			return nil, ctx.Err()
 		}
+		return nil, fmt.Errorf("device error %s: %s", code, msg)
+	}
+
+	resp := ""
+	if payload.Response != nil {
+		resp = *payload.Response
+	}
+	dur := 0
+	if payload.DurationMs != nil {
+		dur = *payload.DurationMs
 	}
+
+	return &executor.CommandResult{
+		Success:    payload.Success,
+		Response:   resp,
+		DurationMs: dur,
+	}, nil
 }
@@ -0,0 +1,172 @@
+package redisrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/script/executor"
+	"github.com/holla2040/arturo/internal/transport"
+)
+
+// fakeStation answers every command through the dispatcher, the way the
+// response stream listener would, unless silent is set.
+type fakeStation struct {
+	dispatcher *transport.Dispatcher
+	payload    string
+	silent     bool
+	streams    []string
+}
+
+func (f *fakeStation) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	f.streams = append(f.streams, stream)
+	if f.silent {
+		return nil
+	}
+	resp := &protocol.Message{
+		Envelope: protocol.Envelope{
+			Type:          "device.command.response",
+			CorrelationID: msg.Envelope.CorrelationID,
+		},
+		Payload: json.RawMessage(f.payload),
+	}
+	go f.dispatcher.Dispatch(resp)
+	return nil
+}
+
+var source = protocol.Source{Service: "test", Instance: "test-01", Version: "1.0.0"}
+
+func TestSendCommand(t *testing.T) {
+	d := transport.NewDispatcher()
+	station := &fakeStation{dispatcher: d, payload: `{"success":true,"response":"1","duration_ms":12}`}
+	r := New(station, d, source, "station-01")
+
+	res, err := r.SendCommand(context.Background(), "pump-01", "pump_status", nil, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Response != "1" || res.DurationMs != 12 {
+		t.Errorf("result = %+v", res)
+	}
+	if len(station.streams) != 1 || station.streams[0] != "commands:station-01" {
+		t.Errorf("sent to %v", station.streams)
+	}
+	if m := r.Metrics(); m.Sent != 1 || m.InFlight != 0 || m.TimedOut != 0 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if n := d.PendingCount(); n != 0 {
+		t.Errorf("%d waiters left registered", n)
+	}
+}
+
+func TestSendCommandDeviceError(t *testing.T) {
+	d := transport.NewDispatcher()
+	station := &fakeStation{dispatcher: d, payload: `{"success":false,"error":{"code":"pump_cache_stale","message":"stale"}}`}
+	r := New(station, d, source, "station-01")
+
+	_, err := r.SendCommand(context.Background(), "pump-01", "pump_status", nil, 1000)
+	if err == nil || !strings.Contains(err.Error(), "pump_cache_stale") {
+		t.Fatalf("err = %v, want device error", err)
+	}
+}
+
+func TestSendCommandTimeout(t *testing.T) {
+	d := transport.NewDispatcher()
+	r := New(&fakeStation{dispatcher: d, silent: true}, d, source, "station-01")
+
+	_, err := r.SendCommand(context.Background(), "pump-01", "pump_status", nil, 20)
+	if err == nil || !strings.Contains(err.Error(), "timeout waiting for response on responses:test-01") {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if m := r.Metrics(); m.Sent != 1 || m.InFlight != 0 || m.TimedOut != 1 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if n := d.PendingCount(); n != 0 {
+		t.Errorf("%d waiters left registered", n)
+	}
+}
+
+// batchStation answers batch requests item by item: commands named "fail"
+// report a device error, everything else echoes its command name.
+type batchStation struct {
+	dispatcher *transport.Dispatcher
+	sizes      []int
+}
+
+func (b *batchStation) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	req, err := protocol.ParseBatchRequest(msg)
+	if err != nil {
+		return err
+	}
+	b.sizes = append(b.sizes, len(req.Commands))
+	var out protocol.BatchResponsePayload
+	for _, c := range req.Commands {
+		r := protocol.CommandResponsePayload{DeviceID: c.DeviceID, CommandName: c.CommandName, Success: c.CommandName != "fail"}
+		if r.Success {
+			resp := c.CommandName
+			r.Response = &resp
+		} else {
+			r.Error = &protocol.Error{Code: protocol.ErrCodeDeviceError, Message: "bad"}
+		}
+		out.Results = append(out.Results, r)
+	}
+	data, _ := json.Marshal(out)
+	go b.dispatcher.Dispatch(&protocol.Message{
+		Envelope: protocol.Envelope{Type: protocol.TypeDeviceCommandBatchResponse, CorrelationID: msg.Envelope.CorrelationID},
+		Payload:  data,
+	})
+	return nil
+}
+
+func TestSendBatch(t *testing.T) {
+	d := transport.NewDispatcher()
+	station := &batchStation{dispatcher: d}
+	r := New(station, d, source, "station-01")
+
+	cmds := make([]executor.BatchCommand, protocol.MaxBatchCommands+2)
+	for i := range cmds {
+		cmds[i] = executor.BatchCommand{DeviceID: "pump-01", Command: fmt.Sprintf("get_%d", i)}
+	}
+	cmds[3].Command = "fail"
+
+	if _, err := r.SendBatch(context.Background(), cmds, 0); !errors.Is(err, executor.ErrBatchUnsupported) {
+		t.Fatalf("err = %v, want ErrBatchUnsupported without the feature", err)
+	}
+
+	r.SetFeatureCheck(func(f string) bool { return f == protocol.FeatureBatchCommands })
+	results, err := r.SendBatch(context.Background(), cmds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(station.sizes) != 2 || station.sizes[0] != protocol.MaxBatchCommands || station.sizes[1] != 2 {
+		t.Errorf("batch sizes = %v", station.sizes)
+	}
+	if len(results) != len(cmds) {
+		t.Fatalf("%d results for %d commands", len(results), len(cmds))
+	}
+	if results[0].Err != nil || results[0].Result.Response != "get_0" || results[17].Result.Response != "get_17" {
+		t.Errorf("results = %+v ... %+v", results[0], results[17])
+	}
+	if results[3].Err == nil || !strings.Contains(results[3].Err.Error(), "device error E_DEVICE_ERROR") {
+		t.Errorf("results[3].Err = %v, want device error", results[3].Err)
+	}
+	if m := r.Metrics(); m.Sent != 2 || m.InFlight != 0 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestSendBatchWrongReply(t *testing.T) {
+	d := transport.NewDispatcher()
+	station := &fakeStation{dispatcher: d, payload: `{"success":true,"response":"1"}`}
+	r := New(station, d, source, "station-01")
+	r.SetFeatureCheck(func(string) bool { return true })
+
+	_, err := r.SendBatch(context.Background(), []executor.BatchCommand{{DeviceID: "pump-01", Command: "pump_status"}}, 1000)
+	if err == nil || !strings.Contains(err.Error(), "unexpected device.command.response") {
+		t.Fatalf("err = %v, want unexpected reply type", err)
+	}
+}
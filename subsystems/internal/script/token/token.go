@@ -69,6 +69,10 @@ const (
 	TOKEN_ENDPARALLEL
 	TOKEN_TIMEOUT
 
+	// Batched queries
+	TOKEN_BATCH
+	TOKEN_ENDBATCH
+
 	// Device communication
 	TOKEN_CONNECT
 	TOKEN_DISCONNECT
@@ -100,6 +104,10 @@ const (
 	TOKEN_LOG
 	TOKEN_DELAY
 
+	// Shared resources
+	TOKEN_ACQUIRE
+	TOKEN_RELEASE
+
 	// Misc keywords
 	TOKEN_RESERVE
 	TOKEN_ON
@@ -195,6 +203,8 @@ var keywords = map[string]TokenType{
 	"PARALLEL":     TOKEN_PARALLEL,
 	"ENDPARALLEL":  TOKEN_ENDPARALLEL,
 	"TIMEOUT":      TOKEN_TIMEOUT,
+	"BATCH":        TOKEN_BATCH,
+	"ENDBATCH":     TOKEN_ENDBATCH,
 	"CONNECT":      TOKEN_CONNECT,
 	"DISCONNECT":   TOKEN_DISCONNECT,
 	"TCP":          TOKEN_TCP,
@@ -216,6 +226,8 @@ var keywords = map[string]TokenType{
 	"ASSERT":       TOKEN_ASSERT,
 	"LOG":          TOKEN_LOG,
 	"DELAY":        TOKEN_DELAY,
+	"ACQUIRE":      TOKEN_ACQUIRE,
+	"RELEASE":      TOKEN_RELEASE,
 	"RESERVE":      TOKEN_RESERVE,
 	"ON":           TOKEN_ON,
 	"OFF":          TOKEN_OFF,
@@ -289,6 +301,9 @@ var tokenNames = map[TokenType]string{
 	TOKEN_ENDPARALLEL: "ENDPARALLEL",
 	TOKEN_TIMEOUT:     "TIMEOUT",
 
+	TOKEN_BATCH:    "BATCH",
+	TOKEN_ENDBATCH: "ENDBATCH",
+
 	TOKEN_CONNECT:    "CONNECT",
 	TOKEN_DISCONNECT: "DISCONNECT",
 	TOKEN_TCP:        "TCP",
@@ -315,6 +330,9 @@ var tokenNames = map[TokenType]string{
 	TOKEN_LOG:    "LOG",
 	TOKEN_DELAY:  "DELAY",
 
+	TOKEN_ACQUIRE: "ACQUIRE",
+	TOKEN_RELEASE: "RELEASE",
+
 	TOKEN_RESERVE: "RESERVE",
 	TOKEN_ON:      "ON",
 	TOKEN_OFF:     "OFF",
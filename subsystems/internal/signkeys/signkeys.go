@@ -0,0 +1,243 @@
+// Package signkeys manages the file of per-station envelope signing keys
+// (see protocol.Sign). The controller and the Go processes running keyed
+// stations, such as console mock stations, load the same file; station
+// firmware does not sign. Unlike Redis ACL passwords the keys are stored as is, since HMAC
+// needs the secret itself, so the file must be kept private.
+package signkeys
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeySize is the length of a generated key in bytes.
+const KeySize = 32
+
+// Station is one station's keys, oldest first. Messages are signed with the
+// newest; all are accepted while a rotation is rolled out.
+type Station struct {
+	Name string
+	Keys [][]byte
+}
+
+// Line returns the station's key file line.
+func (s *Station) Line() string {
+	parts := []string{"station", s.Name}
+	for _, k := range s.Keys {
+		parts = append(parts, hex.EncodeToString(k))
+	}
+	return strings.Join(parts, " ")
+}
+
+// File is a signing key file: its stations in order. Lookup and Current
+// may be called concurrently as long as the file is not being changed.
+type File struct {
+	Stations []*Station
+}
+
+// Station returns the named station, or nil.
+func (f *File) Station(name string) *Station {
+	for _, s := range f.Stations {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Lookup returns the keys station may sign with, oldest first, or nil. Its
+// signature matches protocol.NewVerifier's keys argument.
+func (f *File) Lookup(station string) [][]byte {
+	if s := f.Station(station); s != nil {
+		return s.Keys
+	}
+	return nil
+}
+
+// Current returns the key messages to or from station are signed with, or
+// nil if it has none.
+func (f *File) Current(station string) []byte {
+	keys := f.Lookup(station)
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[len(keys)-1]
+}
+
+// Parse reads a key file. Comments and blank lines are dropped.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "station" || len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected \"station <name> <key> ...\"", n)
+		}
+		s := &Station{Name: fields[1]}
+		for _, tok := range fields[2:] {
+			key, err := hex.DecodeString(tok)
+			if err != nil || len(key) < 16 {
+				return nil, fmt.Errorf("line %d: key must be at least 16 bytes of hex", n)
+			}
+			s.Keys = append(s.Keys, key)
+		}
+		if f.Station(s.Name) != nil {
+			return nil, fmt.Errorf("line %d: duplicate station %q", n, s.Name)
+		}
+		f.Stations = append(f.Stations, s)
+	}
+	return f, sc.Err()
+}
+
+// Load reads the key file at path. A missing file is an empty one.
+func Load(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// WriteTo writes the file with a header comment.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString("# Arturo envelope signing keys, generated by \"controller keys\"; edit with that command.\n")
+	b.WriteString("# Secret: keep this file readable by the controller only.\n\n")
+	for _, s := range f.Stations {
+		b.WriteString(s.Line())
+		b.WriteByte('\n')
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Save writes the file to path, readable only by its owner, replacing it
+// atomically.
+func (f *File) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".signing-keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// NewKey returns a random key of KeySize bytes.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Plan is a change to a key file. Rotate and Retire name stations, or "all".
+type Plan struct {
+	// Stations are added with a new key unless already present.
+	Stations []string
+	Remove   []string
+	// Rotate gives stations a new key while keeping their old ones, so
+	// their messages verify until they are reconfigured.
+	Rotate []string
+	// Retire drops all but the newest key, ending a rotation.
+	Retire []string
+}
+
+// Apply makes the changes in p. New keys are returned by station name.
+func (f *File) Apply(p Plan) (map[string][]byte, error) {
+	for _, name := range p.Stations {
+		if name == "" || strings.ContainsAny(name, " \t#") {
+			return nil, fmt.Errorf("invalid station name %q", name)
+		}
+	}
+	for _, name := range p.Remove {
+		if !f.remove(name) {
+			return nil, fmt.Errorf("no station %q to remove", name)
+		}
+	}
+	for _, name := range p.Stations {
+		if f.Station(name) == nil {
+			f.Stations = append(f.Stations, &Station{Name: name})
+		}
+	}
+	if err := f.checkNames(p.Rotate); err != nil {
+		return nil, fmt.Errorf("rotate: %w", err)
+	}
+	if err := f.checkNames(p.Retire); err != nil {
+		return nil, fmt.Errorf("retire: %w", err)
+	}
+
+	created := map[string][]byte{}
+	for _, s := range f.Stations {
+		if len(s.Keys) == 0 || listed(p.Rotate, s.Name) {
+			key, err := NewKey()
+			if err != nil {
+				return nil, err
+			}
+			s.Keys = append(s.Keys, key)
+			created[s.Name] = key
+		}
+		if listed(p.Retire, s.Name) && len(s.Keys) > 1 {
+			s.Keys = s.Keys[len(s.Keys)-1:]
+		}
+	}
+	return created, nil
+}
+
+func (f *File) remove(name string) bool {
+	for i, s := range f.Stations {
+		if s.Name == name {
+			f.Stations = append(f.Stations[:i], f.Stations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *File) checkNames(names []string) error {
+	for _, name := range names {
+		if name != "all" && f.Station(name) == nil {
+			return fmt.Errorf("no station %q", name)
+		}
+	}
+	return nil
+}
+
+func listed(names []string, name string) bool {
+	for _, n := range names {
+		if n == name || n == "all" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package signkeys
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const keyFile = `# hand-written file
+station station-01 00112233445566778899aabbccddeeff 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+station station-02 ffeeddccbbaa99887766554433221100
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Stations) != 2 {
+		t.Fatalf("expected 2 stations, got %d", len(f.Stations))
+	}
+	if keys := f.Lookup("station-01"); len(keys) != 2 || len(keys[1]) != 32 {
+		t.Errorf("station-01 keys = %x", keys)
+	}
+	if cur := f.Current("station-01"); cur[0] != 0x01 {
+		t.Errorf("current key = %x, want the newest", cur)
+	}
+	if f.Lookup("station-09") != nil || f.Current("station-09") != nil {
+		t.Error("keys for an unknown station")
+	}
+
+	for _, bad := range []string{
+		"station a 00112233445566778899aabbccddeeff\nstation a 00112233445566778899aabbccddeeff\n",
+		"station a\n",
+		"station a 0011\n",
+		"station a not-hex-not-hex-not-hex-not-hex\n",
+		"key a 00112233445566778899aabbccddeeff\n",
+	} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, _ := Parse(strings.NewReader(keyFile))
+	created, err := f.Apply(Plan{Stations: []string{"station-02", "station-03"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || len(created["station-03"]) != KeySize {
+		t.Errorf("created = %x, want a key for station-03 only", created)
+	}
+
+	old := f.Current("station-02")
+	created, err = f.Apply(Plan{Rotate: []string{"station-02"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Station("station-02")
+	if len(s.Keys) != 2 || !bytes.Equal(s.Keys[0], old) || !bytes.Equal(s.Keys[1], created["station-02"]) {
+		t.Errorf("rotation: keys = %x", s.Keys)
+	}
+
+	if _, err := f.Apply(Plan{Retire: []string{"all"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Keys) != 1 || !bytes.Equal(s.Keys[0], created["station-02"]) {
+		t.Errorf("retire kept %x", s.Keys)
+	}
+
+	if _, err := f.Apply(Plan{Remove: []string{"station-01"}}); err != nil || f.Station("station-01") != nil {
+		t.Errorf("remove: err = %v", err)
+	}
+	if _, err := f.Apply(Plan{Rotate: []string{"station-09"}}); err == nil {
+		t.Error("rotated an unknown station")
+	}
+	if _, err := f.Apply(Plan{Stations: []string{"bad name"}}); err == nil {
+		t.Error("accepted a station name with a space")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing-keys.conf")
+	f, err := Load(path)
+	if err != nil || len(f.Stations) != 0 {
+		t.Fatalf("missing file: %v, %d stations", err, len(f.Stations))
+	}
+	created, err := f.Apply(Plan{Stations: []string{"station-01"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	again, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Current("station-01"), created["station-01"]) {
+		t.Error("key not preserved")
+	}
+}
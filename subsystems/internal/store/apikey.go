@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKey is a credential for a machine client. It acts as EmployeeID,
+// limited to Scopes.
+type APIKey struct {
+	ID         string
+	Name       string
+	EmployeeID string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// CreateAPIKey stores a new API key. secretHash is the hash of the key's
+// secret; the secret itself is never stored.
+func (s *SQLStore) CreateAPIKey(id, name, employeeID string, scopes []string, secretHash string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO api_keys (id, name, employee_id, scopes, secret_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, name, employeeID, strings.Join(scopes, ","), secretHash, time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	return err
+}
+
+// GetAPIKey returns an API key, or nil if it does not exist.
+func (s *SQLStore) GetAPIKey(id string) (*APIKey, error) {
+	rows, err := s.db.Query(
+		`SELECT id, name, employee_id, scopes, created_at, last_used_at, revoked_at FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scanAPIKeys(rows)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+// GetAPIKeySecretHash returns the stored secret hash of an API key, or ""
+// if it does not exist.
+func (s *SQLStore) GetAPIKeySecretHash(id string) (string, error) {
+	var hash string
+	err := s.db.QueryRow(`SELECT secret_hash FROM api_keys WHERE id = ?`, id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// ListAPIKeys returns all API keys, including revoked ones, oldest first.
+func (s *SQLStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(
+		`SELECT id, name, employee_id, scopes, created_at, last_used_at, revoked_at FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+// TouchAPIKey records that an API key was just used.
+func (s *SQLStore) TouchAPIKey(id string) error {
+	_, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, time.Now().UTC().Format(time.RFC3339Nano), id)
+	return err
+}
+
+// RevokeAPIKey disables an API key. Revoking a revoked key is a no-op.
+func (s *SQLStore) RevokeAPIKey(id string) error {
+	res, err := s.db.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339Nano), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("API key %q not found", id)
+	}
+	return nil
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]APIKey, error) {
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var scopes, createdAt string
+		var lastUsedAt, revokedAt sql.NullString
+		if err := rows.Scan(&k.ID, &k.Name, &k.EmployeeID, &scopes, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		t, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		k.CreatedAt = t
+		for _, col := range []struct {
+			v   sql.NullString
+			dst **time.Time
+		}{{lastUsedAt, &k.LastUsedAt}, {revokedAt, &k.RevokedAt}} {
+			if !col.v.Valid {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, col.v.String)
+			if err != nil {
+				return nil, err
+			}
+			*col.dst = &t
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditEntry is one row of the append-only audit log: who called which API
+// endpoint, with what parameters, and how it turned out.
+type AuditEntry struct {
+	ID         int64
+	Timestamp  time.Time
+	EmployeeID string // empty when the caller was not identified
+	RemoteAddr string
+	Method     string
+	Endpoint   string // route pattern, e.g. "POST /rmas/{id}/close"
+	Path       string
+	Params     string // JSON object of query and body parameters
+	Status     int    // HTTP status code
+	Result     string // error message of a failed request
+	PrevHash   string // Hash of the previous entry; empty for the first
+	Hash       string
+}
+
+// AuditFilter selects audit entries for QueryAuditLog, oldest first.
+// Zero-valued fields are not filtered on.
+type AuditFilter struct {
+	Page
+	EmployeeID string
+	Endpoint   string
+	Since      *time.Time // at or after
+	Until      *time.Time // before
+}
+
+// AuditChainError reports the first audit entry whose hash does not match
+// its contents or its predecessor.
+type AuditChainError struct {
+	ID     int64
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit log entry %d: %s", e.ID, e.Reason)
+}
+
+// computeHash returns the hash of e's contents chained to e.PrevHash.
+func (e *AuditEntry) computeHash() string {
+	data, _ := json.Marshal([]string{
+		e.PrevHash,
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.EmployeeID,
+		e.RemoteAddr,
+		e.Method,
+		e.Endpoint,
+		e.Path,
+		e.Params,
+		strconv.Itoa(e.Status),
+		e.Result,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAudit adds e to the end of the audit log, filling in its ID,
+// Timestamp (if zero), PrevHash, and Hash.
+func (s *SQLStore) AppendAudit(e *AuditEntry) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	e.Timestamp = e.Timestamp.UTC()
+	if e.Params == "" {
+		e.Params = "{}"
+	}
+
+	// Appends are serialised so each sees its predecessor's hash.
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.db.dialect == dialectPostgres {
+		// Other controllers sharing the database must wait too.
+		if _, err := tx.Exec(`LOCK TABLE audit_log IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRow(`SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&e.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	e.Hash = e.computeHash()
+
+	err = tx.QueryRow(
+		`INSERT INTO audit_log (timestamp, employee_id, remote_addr, method, endpoint, path, params, status, result, prev_hash, hash)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		e.Timestamp.Format(time.RFC3339Nano), e.EmployeeID, e.RemoteAddr, e.Method, e.Endpoint, e.Path,
+		e.Params, e.Status, e.Result, e.PrevHash, e.Hash,
+	).Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryAuditLog returns audit entries matching f and the cursor for the
+// next page, which is empty on the last page.
+func (s *SQLStore) QueryAuditLog(f AuditFilter) ([]AuditEntry, string, error) {
+	var w whereClause
+	if f.Cursor != "" {
+		key, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		id, err := strconv.ParseInt(key[0], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		w.add("id > ?", id)
+	}
+	w.addIf(f.EmployeeID, "employee_id = ?")
+	w.addIf(f.Endpoint, "endpoint = ?")
+	if f.Since != nil {
+		w.add("timestamp >= ?", f.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if f.Until != nil {
+		w.add("timestamp < ?", f.Until.UTC().Format(time.RFC3339Nano))
+	}
+
+	query, args := f.Page.apply(
+		`SELECT id, timestamp, employee_id, remote_addr, method, endpoint, path, params, status, result, prev_hash, hash
+		 FROM audit_log`+w.String()+` ORDER BY id ASC`, w.args)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	entries, more := trimPage(f.Page, entries)
+	if !more {
+		return entries, "", nil
+	}
+	return entries, encodeCursor(strconv.FormatInt(entries[len(entries)-1].ID, 10)), nil
+}
+
+// VerifyAuditLog walks the whole audit log checking each entry's hash and
+// its link to the previous entry. It returns the number of entries checked
+// and an *AuditChainError at the first break.
+func (s *SQLStore) VerifyAuditLog() (int, error) {
+	rows, err := s.db.Query(
+		`SELECT id, timestamp, employee_id, remote_addr, method, endpoint, path, params, status, result, prev_hash, hash
+		 FROM audit_log ORDER BY id ASC`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	prev := ""
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return n, err
+		}
+		if e.PrevHash != prev {
+			return n, &AuditChainError{ID: e.ID, Reason: "previous hash does not match; an entry was removed or reordered"}
+		}
+		if e.computeHash() != e.Hash {
+			return n, &AuditChainError{ID: e.ID, Reason: "hash does not match contents; the entry was modified"}
+		}
+		prev = e.Hash
+		n++
+	}
+	return n, rows.Err()
+}
+
+func scanAuditEntry(rows *sql.Rows) (AuditEntry, error) {
+	var e AuditEntry
+	var timestamp string
+	if err := rows.Scan(&e.ID, &timestamp, &e.EmployeeID, &e.RemoteAddr, &e.Method, &e.Endpoint, &e.Path,
+		&e.Params, &e.Status, &e.Result, &e.PrevHash, &e.Hash); err != nil {
+		return e, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return e, err
+	}
+	e.Timestamp = t
+	return e, nil
+}
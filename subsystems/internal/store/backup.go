@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Backup writes a consistent copy of the database to path while it stays
+// open for writes. It uses SQLite's VACUUM INTO, so the copy is also
+// compacted. path must not already exist. PostgreSQL deployments should use
+// pg_dump instead.
+func (s *SQLStore) Backup(path string) error {
+	if s.db.dialect != dialectSQLite {
+		return fmt.Errorf("online backup is not supported for %s; use pg_dump", s.db.dialect)
+	}
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("backup to %s: %w", path, err)
+	}
+	return nil
+}
+
+// CheckIntegrity opens the SQLite database at path read-only, runs
+// PRAGMA integrity_check, and confirms its schema is one this build can
+// migrate. It returns the database's schema version.
+func CheckIntegrity(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	s, err := Open("file:" + path + "?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	rows, err := s.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: integrity check: %w", path, err)
+	}
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: integrity check: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return 0, fmt.Errorf("%s: integrity check failed: %s", path, strings.Join(problems, "; "))
+	}
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("%s: not an arturo database (no test_runs table)", path)
+	}
+	if version > LatestSchemaVersion() {
+		return 0, fmt.Errorf("%s: schema version %d is newer than this build (%d)", path, version, LatestSchemaVersion())
+	}
+	return version, nil
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dialect selects the SQL flavour of the connected database. Queries in this
+// package are written for SQLite with ? placeholders; the postgres dialect
+// rewrites them on the way out.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+func (d dialect) String() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// dialectForDSN picks the driver for a DSN. postgres:// and postgresql://
+// URLs select PostgreSQL; anything else is treated as a SQLite path.
+func dialectForDSN(dsn string) dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return dialectPostgres
+	}
+	return dialectSQLite
+}
+
+var (
+	autoincrementRE = regexp.MustCompile(`INTEGER PRIMARY KEY AUTOINCREMENT`)
+	realRE          = regexp.MustCompile(`\bREAL\b`)
+	textRE          = regexp.MustCompile(`\bTEXT\b`)
+)
+
+// ddl translates SQLite schema DDL for the dialect. Text columns use the C
+// collation on PostgreSQL so RFC 3339 timestamps and names sort bytewise, as
+// they do in SQLite.
+func (d dialect) ddl(stmt string) string {
+	if d != dialectPostgres {
+		return stmt
+	}
+	stmt = autoincrementRE.ReplaceAllString(stmt, "BIGSERIAL PRIMARY KEY")
+	stmt = realRE.ReplaceAllString(stmt, "DOUBLE PRECISION")
+	return textRE.ReplaceAllString(stmt, `TEXT COLLATE "C"`)
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL. Question
+// marks inside quoted literals or identifiers are left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// sqlDB wraps *sql.DB so store queries are rebound for the dialect.
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *sqlDB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlTx wraps *sql.Tx so statements are rebound for the dialect.
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *sqlTx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+// tableExists reports whether a table exists in the current schema.
+func (db *sqlDB) tableExists(name string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if db.dialect == dialectPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables
+		         WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var n int
+	if err := db.QueryRow(query, name).Scan(&n); err != nil {
+		return false, fmt.Errorf("check table %s: %w", name, err)
+	}
+	return n > 0, nil
+}
+
+// tableColumns returns the column names of a table in the current schema.
+func (db *sqlDB) tableColumns(table string) (map[string]bool, error) {
+	if db.dialect == dialectPostgres {
+		return db.postgresColumns(table)
+	}
+
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+func (db *sqlDB) postgresColumns(table string) (map[string]bool, error) {
+	rows, err := db.Query(
+		`SELECT column_name FROM information_schema.columns
+		 WHERE table_schema = current_schema() AND table_name = ?`,
+		table,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
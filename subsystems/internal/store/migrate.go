@@ -0,0 +1,750 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration is one versioned schema change. Up moves the schema from
+// Version-1 to Version; Down reverses it. PostgresUp and PostgresDown, when
+// set, replace Up and Down on PostgreSQL for changes that use SQLite-only
+// features.
+type Migration struct {
+	Version      int
+	Name         string
+	Up           string
+	Down         string
+	PostgresUp   string
+	PostgresDown string
+}
+
+// sql returns the statements to run for direction on dialect d.
+func (m Migration) sql(d dialect, direction string) string {
+	if d == dialectPostgres && m.PostgresUp != "" {
+		if direction == "up" {
+			return m.PostgresUp
+		}
+		return m.PostgresDown
+	}
+	if direction == "up" {
+		return m.Up
+	}
+	return m.Down
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time // nil for unapplied or adopted pre-migration databases
+}
+
+// MigrationStep is one migration to run in a given direction.
+type MigrationStep struct {
+	Version   int
+	Name      string
+	Direction string // "up", "down"
+	SQL       string
+}
+
+// migrations is the ordered schema history. Never edit an entry that has
+// shipped; append a new one instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		// IF NOT EXISTS so databases created before schema_migrations existed
+		// can be adopted by re-running this step.
+		Up: `
+CREATE TABLE IF NOT EXISTS test_runs (
+    id TEXT PRIMARY KEY,
+    script_name TEXT NOT NULL,
+    started_at TEXT NOT NULL,
+    finished_at TEXT,
+    status TEXT NOT NULL,
+    summary TEXT DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS measurements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
+    device_id TEXT NOT NULL,
+    command_name TEXT NOT NULL,
+    success INTEGER NOT NULL,
+    response TEXT DEFAULT '',
+    duration_ms INTEGER DEFAULT 0,
+    timestamp TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS device_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT NOT NULL,
+    station_instance TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    details TEXT DEFAULT '',
+    timestamp TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS employees (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS rmas (
+    id TEXT PRIMARY KEY,
+    rma_number TEXT NOT NULL UNIQUE,
+    pump_serial_number TEXT NOT NULL,
+    customer_name TEXT NOT NULL,
+    pump_model TEXT NOT NULL,
+    employee_id TEXT NOT NULL REFERENCES employees(id),
+    status TEXT NOT NULL DEFAULT 'open',
+    created_at TEXT NOT NULL,
+    closed_at TEXT,
+    notes TEXT DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS station_states (
+    station_instance TEXT PRIMARY KEY,
+    state TEXT NOT NULL DEFAULT 'offline',
+    current_test_run_id TEXT,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS temperature_samples (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
+    station_instance TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    temperature_k REAL NOT NULL,
+    timestamp TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS test_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
+    event_type TEXT NOT NULL,
+    employee_id TEXT DEFAULT '',
+    reason TEXT DEFAULT '',
+    timestamp TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS temperature_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    station_instance TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    temperature_k REAL NOT NULL,
+    timestamp TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS pump_status_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    station_instance TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    pump_on INTEGER NOT NULL,
+    rough_valve_open INTEGER NOT NULL,
+    purge_valve_open INTEGER NOT NULL,
+    regen_status TEXT NOT NULL,
+    timestamp TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_temperature_samples_run ON temperature_samples(test_run_id);
+CREATE INDEX IF NOT EXISTS idx_temperature_samples_run_ts ON temperature_samples(test_run_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_test_events_run ON test_events(test_run_id);
+CREATE INDEX IF NOT EXISTS idx_temperature_log_station_ts ON temperature_log(station_instance, timestamp);
+CREATE INDEX IF NOT EXISTS idx_pump_status_log_station_ts ON pump_status_log(station_instance, timestamp);`,
+		Down: `
+DROP TABLE pump_status_log;
+DROP TABLE temperature_log;
+DROP TABLE test_events;
+DROP TABLE temperature_samples;
+DROP TABLE station_states;
+DROP TABLE rmas;
+DROP TABLE employees;
+DROP TABLE device_history;
+DROP TABLE measurements;
+DROP TABLE test_runs;`,
+	},
+	{
+		Version: 2,
+		Name:    "test_runs_rma_station",
+		Up: `
+ALTER TABLE test_runs ADD COLUMN rma_id TEXT;
+ALTER TABLE test_runs ADD COLUMN station_instance TEXT;`,
+		Down: `
+ALTER TABLE test_runs DROP COLUMN station_instance;
+ALTER TABLE test_runs DROP COLUMN rma_id;`,
+	},
+	{
+		Version: 3,
+		Name:    "test_runs_script_provenance",
+		Up: `
+ALTER TABLE test_runs ADD COLUMN script_sha256 TEXT;
+ALTER TABLE test_runs ADD COLUMN script_content TEXT;
+ALTER TABLE test_runs ADD COLUMN report_type TEXT;
+ALTER TABLE test_runs ADD COLUMN report_version TEXT;`,
+		Down: `
+ALTER TABLE test_runs DROP COLUMN report_version;
+ALTER TABLE test_runs DROP COLUMN report_type;
+ALTER TABLE test_runs DROP COLUMN script_content;
+ALTER TABLE test_runs DROP COLUMN script_sha256;`,
+	},
+	{
+		Version: 4,
+		Name:    "script_registry",
+		Up: `
+CREATE TABLE script_versions (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    test_name TEXT DEFAULT '',
+    report_type TEXT NOT NULL,
+    report_version TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    uploaded_by TEXT NOT NULL REFERENCES employees(id),
+    uploaded_at TEXT NOT NULL,
+    approved_by TEXT,
+    approved_at TEXT,
+    UNIQUE(name, version)
+);
+
+ALTER TABLE test_runs ADD COLUMN script_version_id TEXT;`,
+		Down: `
+ALTER TABLE test_runs DROP COLUMN script_version_id;
+DROP TABLE script_versions;`,
+	},
+	{
+		Version: 5,
+		Name:    "telemetry_aggregates",
+		Up: `
+CREATE TABLE temperature_log_1m (
+    station_instance TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    bucket TEXT NOT NULL,
+    min_k REAL NOT NULL,
+    max_k REAL NOT NULL,
+    avg_k REAL NOT NULL,
+    samples INTEGER NOT NULL,
+    PRIMARY KEY (station_instance, device_id, stage, bucket)
+);
+
+CREATE TABLE pump_status_log_1m (
+    station_instance TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    bucket TEXT NOT NULL,
+    samples INTEGER NOT NULL,
+    pump_on_samples INTEGER NOT NULL,
+    rough_valve_open_samples INTEGER NOT NULL,
+    purge_valve_open_samples INTEGER NOT NULL,
+    last_regen_status TEXT NOT NULL,
+    PRIMARY KEY (station_instance, device_id, bucket)
+);`,
+		Down: `
+DROP TABLE pump_status_log_1m;
+DROP TABLE temperature_log_1m;`,
+	},
+	{
+		Version: 6,
+		Name:    "search_index",
+		// External-content FTS5 tables mirror the searchable text columns and
+		// are kept current by triggers. PostgreSQL has no FTS5; search falls
+		// back to case-insensitive matching there.
+		Up: `
+CREATE INDEX idx_test_runs_started_at ON test_runs(started_at);
+CREATE INDEX idx_test_runs_station ON test_runs(station_instance);
+CREATE INDEX idx_test_runs_rma ON test_runs(rma_id);
+
+CREATE VIRTUAL TABLE test_runs_fts USING fts5(
+    script_name, summary,
+    content='test_runs', content_rowid='rowid'
+);
+CREATE TRIGGER test_runs_fts_ai AFTER INSERT ON test_runs BEGIN
+    INSERT INTO test_runs_fts(rowid, script_name, summary) VALUES (new.rowid, new.script_name, new.summary);
+END;
+CREATE TRIGGER test_runs_fts_ad AFTER DELETE ON test_runs BEGIN
+    INSERT INTO test_runs_fts(test_runs_fts, rowid, script_name, summary) VALUES ('delete', old.rowid, old.script_name, old.summary);
+END;
+CREATE TRIGGER test_runs_fts_au AFTER UPDATE OF script_name, summary ON test_runs BEGIN
+    INSERT INTO test_runs_fts(test_runs_fts, rowid, script_name, summary) VALUES ('delete', old.rowid, old.script_name, old.summary);
+    INSERT INTO test_runs_fts(rowid, script_name, summary) VALUES (new.rowid, new.script_name, new.summary);
+END;
+INSERT INTO test_runs_fts(test_runs_fts) VALUES ('rebuild');
+
+CREATE VIRTUAL TABLE test_events_fts USING fts5(
+    event_type, reason,
+    content='test_events', content_rowid='id'
+);
+CREATE TRIGGER test_events_fts_ai AFTER INSERT ON test_events BEGIN
+    INSERT INTO test_events_fts(rowid, event_type, reason) VALUES (new.id, new.event_type, new.reason);
+END;
+CREATE TRIGGER test_events_fts_ad AFTER DELETE ON test_events BEGIN
+    INSERT INTO test_events_fts(test_events_fts, rowid, event_type, reason) VALUES ('delete', old.id, old.event_type, old.reason);
+END;
+CREATE TRIGGER test_events_fts_au AFTER UPDATE OF event_type, reason ON test_events BEGIN
+    INSERT INTO test_events_fts(test_events_fts, rowid, event_type, reason) VALUES ('delete', old.id, old.event_type, old.reason);
+    INSERT INTO test_events_fts(rowid, event_type, reason) VALUES (new.id, new.event_type, new.reason);
+END;
+INSERT INTO test_events_fts(test_events_fts) VALUES ('rebuild');
+
+CREATE VIRTUAL TABLE rmas_fts USING fts5(
+    rma_number, pump_serial_number, customer_name, pump_model, notes,
+    content='rmas', content_rowid='rowid'
+);
+CREATE TRIGGER rmas_fts_ai AFTER INSERT ON rmas BEGIN
+    INSERT INTO rmas_fts(rowid, rma_number, pump_serial_number, customer_name, pump_model, notes)
+    VALUES (new.rowid, new.rma_number, new.pump_serial_number, new.customer_name, new.pump_model, new.notes);
+END;
+CREATE TRIGGER rmas_fts_ad AFTER DELETE ON rmas BEGIN
+    INSERT INTO rmas_fts(rmas_fts, rowid, rma_number, pump_serial_number, customer_name, pump_model, notes)
+    VALUES ('delete', old.rowid, old.rma_number, old.pump_serial_number, old.customer_name, old.pump_model, old.notes);
+END;
+CREATE TRIGGER rmas_fts_au AFTER UPDATE ON rmas BEGIN
+    INSERT INTO rmas_fts(rmas_fts, rowid, rma_number, pump_serial_number, customer_name, pump_model, notes)
+    VALUES ('delete', old.rowid, old.rma_number, old.pump_serial_number, old.customer_name, old.pump_model, old.notes);
+    INSERT INTO rmas_fts(rowid, rma_number, pump_serial_number, customer_name, pump_model, notes)
+    VALUES (new.rowid, new.rma_number, new.pump_serial_number, new.customer_name, new.pump_model, new.notes);
+END;
+INSERT INTO rmas_fts(rmas_fts) VALUES ('rebuild');`,
+		Down: `
+DROP TRIGGER rmas_fts_au;
+DROP TRIGGER rmas_fts_ad;
+DROP TRIGGER rmas_fts_ai;
+DROP TRIGGER test_events_fts_au;
+DROP TRIGGER test_events_fts_ad;
+DROP TRIGGER test_events_fts_ai;
+DROP TRIGGER test_runs_fts_au;
+DROP TRIGGER test_runs_fts_ad;
+DROP TRIGGER test_runs_fts_ai;
+DROP TABLE rmas_fts;
+DROP TABLE test_events_fts;
+DROP TABLE test_runs_fts;
+DROP INDEX idx_test_runs_rma;
+DROP INDEX idx_test_runs_station;
+DROP INDEX idx_test_runs_started_at;`,
+		PostgresUp: `
+CREATE INDEX idx_test_runs_started_at ON test_runs(started_at);
+CREATE INDEX idx_test_runs_station ON test_runs(station_instance);
+CREATE INDEX idx_test_runs_rma ON test_runs(rma_id);`,
+		PostgresDown: `
+DROP INDEX idx_test_runs_rma;
+DROP INDEX idx_test_runs_station;
+DROP INDEX idx_test_runs_started_at;`,
+	},
+	{
+		Version: 7,
+		Name:    "employee_credentials",
+		// credential_hash is NULL until a PIN or password is set; such
+		// employees cannot log in.
+		Up: `
+ALTER TABLE employees ADD COLUMN role TEXT NOT NULL DEFAULT 'operator';
+ALTER TABLE employees ADD COLUMN credential_hash TEXT;
+
+CREATE TABLE login_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    employee_id TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    timestamp TEXT NOT NULL
+);
+CREATE INDEX idx_login_failures_timestamp ON login_failures(timestamp);`,
+		Down: `
+DROP TABLE login_failures;
+ALTER TABLE employees DROP COLUMN credential_hash;
+ALTER TABLE employees DROP COLUMN role;`,
+	},
+	{
+		Version: 8,
+		Name:    "employee_badges",
+		// Badge codes are credentials, so only a hash is kept (see
+		// auth.HashBadge).
+		Up: `
+ALTER TABLE employees ADD COLUMN badge_hash TEXT;
+CREATE UNIQUE INDEX idx_employees_badge_hash ON employees(badge_hash);`,
+		Down: `
+DROP INDEX idx_employees_badge_hash;
+ALTER TABLE employees DROP COLUMN badge_hash;`,
+	},
+	{
+		Version: 9,
+		Name:    "audit_log",
+		// Each row's hash covers the previous row's, so edits or deletions
+		// break the chain; the triggers refuse them outright.
+		Up: `
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp TEXT NOT NULL,
+    employee_id TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    method TEXT NOT NULL,
+    endpoint TEXT NOT NULL,
+    path TEXT NOT NULL,
+    params TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    result TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+CREATE INDEX idx_audit_log_timestamp ON audit_log(timestamp);
+CREATE INDEX idx_audit_log_employee ON audit_log(employee_id);
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;`,
+		Down: `
+DROP TABLE audit_log;`,
+		PostgresUp: `
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp TEXT NOT NULL,
+    employee_id TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    method TEXT NOT NULL,
+    endpoint TEXT NOT NULL,
+    path TEXT NOT NULL,
+    params TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    result TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
+CREATE INDEX idx_audit_log_timestamp ON audit_log(timestamp);
+CREATE INDEX idx_audit_log_employee ON audit_log(employee_id);
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_log_no_change BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();`,
+		PostgresDown: `
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();`,
+	},
+	{
+		Version: 10,
+		Name:    "run_signatures",
+		// content_hash is the hash of the run's report data at signing, so
+		// a signature cannot be carried over to changed results.
+		Up: `
+CREATE TABLE run_signatures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
+    employee_id TEXT NOT NULL REFERENCES employees(id),
+    meaning TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    timestamp TEXT NOT NULL
+);
+CREATE INDEX idx_run_signatures_run ON run_signatures(test_run_id);`,
+		Down: `
+DROP TABLE run_signatures;`,
+	},
+	{
+		Version: 11,
+		Name:    "api_keys",
+		// Only a hash of each key's secret is stored; scopes is a
+		// comma-separated list.
+		Up: `
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    employee_id TEXT NOT NULL REFERENCES employees(id),
+    scopes TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    last_used_at TEXT,
+    revoked_at TEXT
+);`,
+		Down: `
+DROP TABLE api_keys;`,
+	},
+	{
+		Version: 12,
+		Name:    "telemetry_rollups",
+		// Raw telemetry before aggregated_before has been rolled up into the
+		// source table's 1-minute aggregates. Retention selects raw rows by
+		// timestamp across all stations.
+		Up: `
+CREATE TABLE telemetry_rollups (
+    source TEXT PRIMARY KEY,
+    aggregated_before TEXT NOT NULL
+);
+CREATE INDEX idx_temperature_log_timestamp ON temperature_log(timestamp);
+CREATE INDEX idx_pump_status_log_timestamp ON pump_status_log(timestamp);`,
+		Down: `
+DROP INDEX idx_pump_status_log_timestamp;
+DROP INDEX idx_temperature_log_timestamp;
+DROP TABLE telemetry_rollups;`,
+	},
+}
+
+// Migrations returns the ordered schema history.
+func Migrations() []Migration {
+	out := make([]Migration, len(migrations))
+	copy(out, migrations)
+	return out
+}
+
+// LatestSchemaVersion is the schema version this build expects.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Open connects to the database named by dsn without migrating it. A
+// postgres:// or postgresql:// URL selects PostgreSQL; anything else is a
+// SQLite file path (or ":memory:"). Use New for normal operation; Open is for
+// tooling such as `controller migrate`.
+func Open(dsn string) (*SQLStore, error) {
+	d := dialectForDSN(dsn)
+	driver := "sqlite"
+	if d == dialectPostgres {
+		driver = "pgx"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if d == dialectSQLite {
+		// SQLite requires single-connection mode for :memory: databases
+		// (each pool connection gets its own in-memory DB otherwise).
+		// For file-based DBs this also avoids "database is locked" errors.
+		db.SetMaxOpenConns(1)
+	} else if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	return &SQLStore{db: &sqlDB{DB: db, dialect: d}}, nil
+}
+
+// SchemaVersion returns the current schema version of the database. Databases created
+// before schema_migrations existed are inspected to infer their version.
+func (s *SQLStore) SchemaVersion() (int, error) {
+	tracked, err := s.db.tableExists("schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if !tracked {
+		return s.detectLegacyVersion()
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// SchemaStatus lists every known migration and whether it is applied.
+func (s *SQLStore) SchemaStatus() ([]MigrationStatus, error) {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	tracked, err := s.db.tableExists("schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if tracked {
+		rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+		if err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var at string
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, err
+			}
+			if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
+				appliedAt[version] = t
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationStatus{Version: m.Version, Name: m.Name, Applied: m.Version <= current}
+		if t, ok := appliedAt[m.Version]; ok {
+			st.AppliedAt = &t
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// PlanMigration returns the steps MigrateTo would run to reach target,
+// without changing the database. Step SQL is translated for the database's
+// dialect.
+func (s *SQLStore) PlanMigration(target int) ([]MigrationStep, error) {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := planSteps(current, target, s.db.dialect)
+	for i := range steps {
+		steps[i].SQL = s.db.dialect.ddl(steps[i].SQL)
+	}
+	return steps, err
+}
+
+// MigrateTo moves the database to the target schema version, applying up or down
+// migrations in order. Each step runs in its own transaction. It returns
+// the steps that were applied.
+func (s *SQLStore) MigrateTo(target int) ([]MigrationStep, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := planSteps(current, target, s.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	for i, step := range steps {
+		if err := s.applyStep(step); err != nil {
+			return steps[:i], err
+		}
+	}
+	return steps, nil
+}
+
+func planSteps(current, target int, d dialect) ([]MigrationStep, error) {
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than this build (%d)", current, latest)
+	}
+	if target < 0 || target > latest {
+		return nil, fmt.Errorf("target schema version %d out of range 0-%d", target, latest)
+	}
+
+	var steps []MigrationStep
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= target {
+			steps = append(steps, MigrationStep{Version: m.Version, Name: m.Name, Direction: "up", SQL: m.sql(d, "up")})
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= current && m.Version > target {
+			steps = append(steps, MigrationStep{Version: m.Version, Name: m.Name, Direction: "down", SQL: m.sql(d, "down")})
+		}
+	}
+	return steps, nil
+}
+
+func (s *SQLStore) applyStep(step MigrationStep) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(s.db.dialect.ddl(step.SQL)); err != nil {
+		return fmt.Errorf("migration %d %s %s: %w", step.Version, step.Name, step.Direction, err)
+	}
+	if step.Direction == "up" {
+		_, err = tx.Exec(
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			step.Version, step.Name, time.Now().UTC().Format(time.RFC3339Nano),
+		)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, step.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("record migration %d: %w", step.Version, err)
+	}
+	return tx.Commit()
+}
+
+// ensureMigrationsTable creates schema_migrations. A database created before
+// migrations were tracked is adopted: its version is inferred, migration 1
+// is re-run to create any tables it predates, and the inferred versions are
+// recorded without an applied_at time of their own.
+func (s *SQLStore) ensureMigrationsTable() error {
+	tracked, err := s.db.tableExists("schema_migrations")
+	if err != nil || tracked {
+		return err
+	}
+	legacy, err := s.detectLegacyVersion()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+CREATE TABLE schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TEXT NOT NULL
+)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	if legacy > 0 {
+		if _, err := tx.Exec(s.db.dialect.ddl(migrations[0].Up)); err != nil {
+			return fmt.Errorf("adopt legacy schema: %w", err)
+		}
+	}
+	for _, m := range migrations {
+		if m.Version > legacy {
+			break
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, "",
+		); err != nil {
+			return fmt.Errorf("record adopted migration %d: %w", m.Version, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// detectLegacyVersion infers the schema version of a database that predates
+// schema_migrations from the columns and tables the old ad-hoc migration
+// code would have added.
+func (s *SQLStore) detectLegacyVersion() (int, error) {
+	hasRuns, err := s.db.tableExists("test_runs")
+	if err != nil || !hasRuns {
+		return 0, err
+	}
+	cols, err := s.db.tableColumns("test_runs")
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	if cols["rma_id"] && cols["station_instance"] {
+		version = 2
+	}
+	if version == 2 && cols["script_sha256"] && cols["report_version"] {
+		version = 3
+	}
+	if version == 3 && cols["script_version_id"] {
+		if ok, err := s.db.tableExists("script_versions"); err != nil {
+			return 0, err
+		} else if ok {
+			version = 4
+		}
+	}
+	return version, nil
+}
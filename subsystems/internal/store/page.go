@@ -0,0 +1,319 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a page cursor was not produced by the
+// same list query.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects one page of a list query. Cursor continues after the last
+// row of the page it was returned with; Offset skips further rows after
+// that. A zero Limit returns every remaining row.
+type Page struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// TestRunFilter selects test runs for QueryTestRunsPage, newest first.
+// Zero-valued fields are not filtered on.
+type TestRunFilter struct {
+	Page
+	Status     string
+	Station    string
+	Script     string
+	RMAID      string
+	ReportType string
+	Since      *time.Time // started at or after
+}
+
+// RMAFilter selects RMAs for ListRMAsPage, by RMA number.
+type RMAFilter struct {
+	Page
+	Status     string
+	PumpSerial string
+	PumpModel  string
+	Customer   string
+	EmployeeID string
+	Since      *time.Time // created at or after
+}
+
+// TestEventFilter selects a test run's events for QueryTestEventsPage,
+// oldest first.
+type TestEventFilter struct {
+	Page
+	EventType  string
+	EmployeeID string
+	Since      *time.Time // at or after
+}
+
+// QueryTestRunsPage returns test runs matching f and the cursor for the
+// next page, which is empty on the last page.
+func (s *SQLStore) QueryTestRunsPage(f TestRunFilter) ([]TestRun, string, error) {
+	var w whereClause
+	if f.Cursor != "" {
+		key, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		w.add("(started_at < ? OR (started_at = ? AND id < ?))", key[0], key[0], key[1])
+	}
+	w.addIf(f.Status, "status = ?")
+	w.addIf(f.Station, "station_instance = ?")
+	w.addIf(f.Script, "script_name = ?")
+	w.addIf(f.RMAID, "rma_id = ?")
+	w.addIf(f.ReportType, "report_type = ?")
+	if f.Since != nil {
+		w.add("started_at >= ?", f.Since.UTC().Format(time.RFC3339Nano))
+	}
+
+	query, args := f.Page.apply(
+		`SELECT id, script_name, started_at, finished_at, status, summary,
+		        rma_id, station_instance, script_sha256, script_content,
+		        report_type, report_version, script_version_id
+		 FROM test_runs`+w.String()+` ORDER BY started_at DESC, id DESC`, w.args)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	runs := []TestRun{}
+	for rows.Next() {
+		var r TestRun
+		var startedAt string
+		var finishedAt, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion, scriptVersionID sql.NullString
+		if err := rows.Scan(&r.ID, &r.ScriptName, &startedAt, &finishedAt, &r.Status, &r.Summary,
+			&rmaID, &stationInstance, &scriptSHA256, &scriptContent,
+			&reportType, &reportVersion, &scriptVersionID); err != nil {
+			return nil, "", err
+		}
+		r.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt)
+		if err != nil {
+			return nil, "", err
+		}
+		if finishedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, finishedAt.String)
+			if err != nil {
+				return nil, "", err
+			}
+			r.FinishedAt = &t
+		}
+		r.RMAID = nullStringPtr(rmaID)
+		r.StationInstance = nullStringPtr(stationInstance)
+		r.ScriptSHA256 = nullStringPtr(scriptSHA256)
+		r.ScriptContent = nullStringPtr(scriptContent)
+		r.ReportType = nullStringPtr(reportType)
+		r.ReportVersion = nullStringPtr(reportVersion)
+		r.ScriptVersionID = nullStringPtr(scriptVersionID)
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	runs, more := trimPage(f.Page, runs)
+	if !more {
+		return runs, "", nil
+	}
+	last := runs[len(runs)-1]
+	return runs, encodeCursor(last.StartedAt.UTC().Format(time.RFC3339Nano), last.ID), nil
+}
+
+// ListRMAsPage returns RMAs matching f and the cursor for the next page,
+// which is empty on the last page.
+func (s *SQLStore) ListRMAsPage(f RMAFilter) ([]RMA, string, error) {
+	var w whereClause
+	if f.Cursor != "" {
+		key, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		w.add("rma_number > ?", key[0])
+	}
+	w.addIf(f.Status, "status = ?")
+	w.addIf(f.PumpSerial, "pump_serial_number = ?")
+	w.addIf(f.PumpModel, "pump_model = ?")
+	w.addIf(f.Customer, "customer_name = ?")
+	w.addIf(f.EmployeeID, "employee_id = ?")
+	if f.Since != nil {
+		w.add("created_at >= ?", f.Since.UTC().Format(time.RFC3339Nano))
+	}
+
+	query, args := f.Page.apply(
+		`SELECT id, rma_number, pump_serial_number, customer_name, pump_model, employee_id, status, created_at, closed_at, notes
+		 FROM rmas`+w.String()+` ORDER BY rma_number ASC`, w.args)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	rmas := []RMA{}
+	for rows.Next() {
+		var r RMA
+		var createdAt string
+		var closedAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.RMANumber, &r.PumpSerialNumber, &r.CustomerName, &r.PumpModel,
+			&r.EmployeeID, &r.Status, &createdAt, &closedAt, &r.Notes); err != nil {
+			return nil, "", err
+		}
+		r.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, "", err
+		}
+		if closedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, closedAt.String)
+			if err != nil {
+				return nil, "", err
+			}
+			r.ClosedAt = &t
+		}
+		rmas = append(rmas, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	rmas, more := trimPage(f.Page, rmas)
+	if !more {
+		return rmas, "", nil
+	}
+	return rmas, encodeCursor(rmas[len(rmas)-1].RMANumber), nil
+}
+
+// QueryTestEventsPage returns a test run's events matching f and the cursor
+// for the next page, which is empty on the last page.
+func (s *SQLStore) QueryTestEventsPage(testRunID string, f TestEventFilter) ([]TestEvent, string, error) {
+	var w whereClause
+	w.add("test_run_id = ?", testRunID)
+	if f.Cursor != "" {
+		key, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		id, err := strconv.ParseInt(key[1], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		w.add("(timestamp > ? OR (timestamp = ? AND id > ?))", key[0], key[0], id)
+	}
+	w.addIf(f.EventType, "event_type = ?")
+	w.addIf(f.EmployeeID, "employee_id = ?")
+	if f.Since != nil {
+		w.add("timestamp >= ?", f.Since.UTC().Format(time.RFC3339Nano))
+	}
+
+	query, args := f.Page.apply(
+		`SELECT id, test_run_id, event_type, employee_id, reason, timestamp
+		 FROM test_events`+w.String()+` ORDER BY timestamp ASC, id ASC`, w.args)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	events := []TestEvent{}
+	for rows.Next() {
+		var te TestEvent
+		var timestamp string
+		if err := rows.Scan(&te.ID, &te.TestRunID, &te.EventType, &te.EmployeeID, &te.Reason, &timestamp); err != nil {
+			return nil, "", err
+		}
+		te.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, te)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	events, more := trimPage(f.Page, events)
+	if !more {
+		return events, "", nil
+	}
+	last := events[len(events)-1]
+	return events, encodeCursor(last.Timestamp.UTC().Format(time.RFC3339Nano), strconv.FormatInt(last.ID, 10)), nil
+}
+
+// whereClause accumulates AND-ed conditions and their arguments.
+type whereClause struct {
+	conds []string
+	args  []any
+}
+
+func (w *whereClause) add(cond string, args ...any) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// addIf adds cond with val as its argument when val is not empty.
+func (w *whereClause) addIf(val, cond string) {
+	if val != "" {
+		w.add(cond, val)
+	}
+}
+
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// apply appends LIMIT and OFFSET to query. One row past the limit is
+// fetched so trimPage can tell whether another page follows.
+func (p Page) apply(query string, args []any) (string, []any) {
+	offset := max(p.Offset, 0)
+	switch {
+	case p.Limit > 0:
+		return query + " LIMIT ? OFFSET ?", append(args, p.Limit+1, offset)
+	case offset > 0:
+		// Both dialects need a LIMIT before OFFSET.
+		return query + " LIMIT ? OFFSET ?", append(args, int64(math.MaxInt64), offset)
+	}
+	return query, args
+}
+
+// trimPage drops the extra row fetched by Page.apply and reports whether
+// it was there.
+func trimPage[T any](p Page, rows []T) ([]T, bool) {
+	if p.Limit <= 0 || len(rows) <= p.Limit {
+		return rows, false
+	}
+	return rows[:p.Limit], true
+}
+
+// encodeCursor packs the sort key of a page's last row into an opaque
+// cursor.
+func encodeCursor(key ...string) string {
+	data, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor unpacks a cursor from encodeCursor. Every store cursor has
+// one or two key parts; the result always has two.
+func decodeCursor(cursor string) ([2]string, error) {
+	var key [2]string
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return key, ErrInvalidCursor
+	}
+	var parts []string
+	if err := json.Unmarshal(data, &parts); err != nil || len(parts) == 0 || len(parts) > 2 {
+		return key, ErrInvalidCursor
+	}
+	copy(key[:], parts)
+	return key, nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunSearch selects test runs for SearchTestRuns. Zero-valued fields are
+// not filtered on.
+type RunSearch struct {
+	Query      string     // full text over script/summary, event text, and RMA fields and notes
+	Status     string     // "running", "passed", ...
+	From       *time.Time // started at or after
+	To         *time.Time // started before
+	Station    string
+	Script     string
+	ReportType string
+	EmployeeID string // employee who started the run
+	PumpSerial string
+	PumpModel  string
+	RMAID      string
+	Sort       string // a key of runSortColumns, "-" prefix for descending; default "-started_at"
+	Limit      int    // default 50, max 500
+	Offset     int
+}
+
+// RunSearchHit is a test run with the RMA and operator details the history
+// view shows alongside it. ScriptContent is not loaded.
+type RunSearchHit struct {
+	TestRun
+	RMANumber        string
+	PumpSerialNumber string
+	PumpModel        string
+	CustomerName     string
+	EmployeeID       string
+}
+
+// Page sizes for SearchTestRuns and SearchRMAText.
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// runSortColumns maps the sort keys accepted by SearchTestRuns to columns.
+var runSortColumns = map[string]string{
+	"started_at":  "tr.started_at",
+	"finished_at": "tr.finished_at",
+	"status":      "tr.status",
+	"station":     "tr.station_instance",
+	"script":      "tr.script_name",
+	"rma":         "r.rma_number",
+}
+
+// ValidRunSort reports whether sort is accepted by SearchTestRuns.
+func ValidRunSort(sort string) bool {
+	_, ok := runSortColumns[strings.TrimPrefix(sort, "-")]
+	return sort == "" || ok
+}
+
+// SearchTestRuns returns one page of test runs matching q, and the total
+// number of matches.
+func (s *SQLStore) SearchTestRuns(q RunSearch) ([]RunSearchHit, int, error) {
+	var where []string
+	var args []any
+	add := func(cond string, vals ...any) {
+		where = append(where, cond)
+		args = append(args, vals...)
+	}
+
+	if strings.TrimSpace(q.Query) != "" {
+		cond, vals := s.runTextMatch(q.Query)
+		add(cond, vals...)
+	}
+	if q.Status != "" {
+		add("tr.status = ?", q.Status)
+	}
+	if q.From != nil {
+		add("tr.started_at >= ?", q.From.UTC().Format(time.RFC3339Nano))
+	}
+	if q.To != nil {
+		add("tr.started_at < ?", q.To.UTC().Format(time.RFC3339Nano))
+	}
+	if q.Station != "" {
+		add("tr.station_instance = ?", q.Station)
+	}
+	if q.Script != "" {
+		add("tr.script_name = ?", q.Script)
+	}
+	if q.ReportType != "" {
+		add("tr.report_type = ?", q.ReportType)
+	}
+	if q.EmployeeID != "" {
+		add(`EXISTS (SELECT 1 FROM test_events e
+		             WHERE e.test_run_id = tr.id AND e.event_type = 'started' AND e.employee_id = ?)`, q.EmployeeID)
+	}
+	if q.PumpSerial != "" {
+		add("r.pump_serial_number = ?", q.PumpSerial)
+	}
+	if q.PumpModel != "" {
+		add("r.pump_model = ?", q.PumpModel)
+	}
+	if q.RMAID != "" {
+		add("tr.rma_id = ?", q.RMAID)
+	}
+
+	from := ` FROM test_runs tr LEFT JOIN rmas r ON r.id = tr.rma_id`
+	if len(where) > 0 {
+		from += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sortKey, dir := strings.TrimPrefix(q.Sort, "-"), "ASC"
+	if q.Sort == "" {
+		sortKey, dir = "started_at", "DESC"
+	} else if strings.HasPrefix(q.Sort, "-") {
+		dir = "DESC"
+	}
+	col, ok := runSortColumns[sortKey]
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid sort %q", q.Sort)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+	offset := max(q.Offset, 0)
+
+	rows, err := s.db.Query(
+		`SELECT tr.id, tr.script_name, tr.started_at, tr.finished_at, tr.status, tr.summary,
+		        tr.rma_id, tr.station_instance, tr.script_sha256,
+		        tr.report_type, tr.report_version, tr.script_version_id,
+		        COALESCE(r.rma_number, ''), COALESCE(r.pump_serial_number, ''),
+		        COALESCE(r.pump_model, ''), COALESCE(r.customer_name, ''),
+		        COALESCE((SELECT e.employee_id FROM test_events e
+		                  WHERE e.test_run_id = tr.id AND e.event_type = 'started'
+		                  ORDER BY e.id LIMIT 1), '')`+
+			from+
+			fmt.Sprintf(` ORDER BY %s %s, tr.id %s LIMIT ? OFFSET ?`, col, dir, dir),
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []RunSearchHit{}
+	for rows.Next() {
+		var h RunSearchHit
+		var startedAt string
+		var finishedAt, rmaID, stationInstance, scriptSHA256, reportType, reportVersion, scriptVersionID sql.NullString
+		if err := rows.Scan(&h.ID, &h.ScriptName, &startedAt, &finishedAt, &h.Status, &h.Summary,
+			&rmaID, &stationInstance, &scriptSHA256,
+			&reportType, &reportVersion, &scriptVersionID,
+			&h.RMANumber, &h.PumpSerialNumber, &h.PumpModel, &h.CustomerName, &h.EmployeeID); err != nil {
+			return nil, 0, err
+		}
+		h.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		if finishedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, finishedAt.String)
+			if err != nil {
+				return nil, 0, err
+			}
+			h.FinishedAt = &t
+		}
+		h.RMAID = nullStringPtr(rmaID)
+		h.StationInstance = nullStringPtr(stationInstance)
+		h.ScriptSHA256 = nullStringPtr(scriptSHA256)
+		h.ReportType = nullStringPtr(reportType)
+		h.ReportVersion = nullStringPtr(reportVersion)
+		h.ScriptVersionID = nullStringPtr(scriptVersionID)
+		hits = append(hits, h)
+	}
+	return hits, total, rows.Err()
+}
+
+// SearchRMAText returns RMAs whose number, pump serial, customer, model, or
+// notes match query, newest first.
+func (s *SQLStore) SearchRMAText(query string, limit int) ([]RMA, error) {
+	if strings.TrimSpace(query) == "" {
+		return []RMA{}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	var cond string
+	var args []any
+	if s.db.dialect == dialectPostgres {
+		like := likePattern(query)
+		cond = `LOWER(rma_number) LIKE ? ESCAPE '\' OR LOWER(pump_serial_number) LIKE ? ESCAPE '\'
+		        OR LOWER(customer_name) LIKE ? ESCAPE '\' OR LOWER(pump_model) LIKE ? ESCAPE '\'
+		        OR LOWER(notes) LIKE ? ESCAPE '\'`
+		args = []any{like, like, like, like, like}
+	} else {
+		cond = `rowid IN (SELECT rowid FROM rmas_fts WHERE rmas_fts MATCH ?)`
+		args = []any{ftsQuery(query)}
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, rma_number, pump_serial_number, customer_name, pump_model, employee_id, status, created_at, closed_at, notes
+		 FROM rmas WHERE `+cond+`
+		 ORDER BY created_at DESC LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rmas := []RMA{}
+	for rows.Next() {
+		var r RMA
+		var createdAt string
+		var closedAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.RMANumber, &r.PumpSerialNumber, &r.CustomerName, &r.PumpModel,
+			&r.EmployeeID, &r.Status, &createdAt, &closedAt, &r.Notes); err != nil {
+			return nil, err
+		}
+		r.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if closedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, closedAt.String)
+			if err != nil {
+				return nil, err
+			}
+			r.ClosedAt = &t
+		}
+		rmas = append(rmas, r)
+	}
+	return rmas, rows.Err()
+}
+
+// runTextMatch builds the full-text condition for SearchTestRuns: the run's
+// script name or summary, any of its events, or its RMA.
+func (s *SQLStore) runTextMatch(query string) (string, []any) {
+	if s.db.dialect == dialectPostgres {
+		like := likePattern(query)
+		return `(LOWER(tr.script_name) LIKE ? ESCAPE '\' OR LOWER(tr.summary) LIKE ? ESCAPE '\'
+		         OR EXISTS (SELECT 1 FROM test_events e WHERE e.test_run_id = tr.id AND LOWER(e.reason) LIKE ? ESCAPE '\')
+		         OR LOWER(r.rma_number) LIKE ? ESCAPE '\' OR LOWER(r.pump_serial_number) LIKE ? ESCAPE '\'
+		         OR LOWER(r.customer_name) LIKE ? ESCAPE '\' OR LOWER(r.notes) LIKE ? ESCAPE '\')`,
+			[]any{like, like, like, like, like, like, like}
+	}
+	match := ftsQuery(query)
+	return `(tr.rowid IN (SELECT rowid FROM test_runs_fts WHERE test_runs_fts MATCH ?)
+	         OR tr.id IN (SELECT e.test_run_id FROM test_events e
+	                      JOIN test_events_fts f ON f.rowid = e.id WHERE test_events_fts MATCH ?)
+	         OR r.rowid IN (SELECT rowid FROM rmas_fts WHERE rmas_fts MATCH ?))`,
+		[]any{match, match, match}
+}
+
+// ftsQuery turns free text into an FTS5 query: every word must appear, as a
+// prefix. Words are quoted so punctuation in serials and RMA numbers is not
+// read as FTS5 syntax.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// likePattern turns free text into a case-insensitive LIKE pattern matching
+// it anywhere, for use with ESCAPE '\'. The LIKE wildcards % and _, and the
+// escape character itself, match only themselves.
+func likePattern(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(text))
+	return "%" + escaped + "%"
+}
+
+func nullStringPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Signature meanings. A reviewer records "reviewed" after checking a run;
+// "approved" or "rejected" is the decision on its results.
+const (
+	SignatureReviewed = "reviewed"
+	SignatureApproved = "approved"
+	SignatureRejected = "rejected"
+)
+
+// ValidSignatureMeaning reports whether meaning is one of the signature
+// meanings.
+func ValidSignatureMeaning(meaning string) bool {
+	switch meaning {
+	case SignatureReviewed, SignatureApproved, SignatureRejected:
+		return true
+	}
+	return false
+}
+
+// RunSignature is an electronic signature on a test run's results.
+type RunSignature struct {
+	ID           int64
+	TestRunID    string
+	EmployeeID   string
+	EmployeeName string
+	Meaning      string
+	Reason       string
+	ContentHash  string // hash of the run's report data when it was signed
+	Timestamp    time.Time
+}
+
+// RecordRunSignature stores a signature on a test run and returns it.
+func (s *SQLStore) RecordRunSignature(testRunID, employeeID, meaning, reason, contentHash string) (*RunSignature, error) {
+	sig := &RunSignature{
+		TestRunID:   testRunID,
+		EmployeeID:  employeeID,
+		Meaning:     meaning,
+		Reason:      reason,
+		ContentHash: contentHash,
+		Timestamp:   time.Now().UTC(),
+	}
+	err := s.db.QueryRow(
+		`INSERT INTO run_signatures (test_run_id, employee_id, meaning, reason, content_hash, timestamp)
+		 VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		testRunID, employeeID, meaning, reason, contentHash, sig.Timestamp.Format(time.RFC3339Nano),
+	).Scan(&sig.ID)
+	if err != nil {
+		return nil, err
+	}
+	if emp, err := s.GetEmployee(employeeID); err == nil && emp != nil {
+		sig.EmployeeName = emp.Name
+	}
+	return sig, nil
+}
+
+// runSignatureColumns selects a RunSignature from run_signatures rs.
+const runSignatureColumns = `rs.id, rs.test_run_id, rs.employee_id, COALESCE(e.name, ''), rs.meaning, rs.reason, rs.content_hash, rs.timestamp
+		 FROM run_signatures rs LEFT JOIN employees e ON e.id = rs.employee_id`
+
+// QueryRunSignatures returns a test run's signatures, oldest first.
+func (s *SQLStore) QueryRunSignatures(testRunID string) ([]RunSignature, error) {
+	rows, err := s.db.Query(
+		`SELECT `+runSignatureColumns+`
+		 WHERE rs.test_run_id = ? ORDER BY rs.id ASC`,
+		testRunID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanRunSignatures(rows)
+}
+
+// QueryRMARunSignatures returns the signatures on every test run of an RMA,
+// oldest first, keyed by test run ID. Runs without signatures are absent.
+func (s *SQLStore) QueryRMARunSignatures(rmaID string) (map[string][]RunSignature, error) {
+	rows, err := s.db.Query(
+		`SELECT `+runSignatureColumns+`
+		 JOIN test_runs tr ON tr.id = rs.test_run_id
+		 WHERE tr.rma_id = ? ORDER BY rs.id ASC`,
+		rmaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := scanRunSignatures(rows)
+	if err != nil {
+		return nil, err
+	}
+	byRun := make(map[string][]RunSignature)
+	for _, sig := range sigs {
+		byRun[sig.TestRunID] = append(byRun[sig.TestRunID], sig)
+	}
+	return byRun, nil
+}
+
+func scanRunSignatures(rows *sql.Rows) ([]RunSignature, error) {
+	defer rows.Close()
+	sigs := []RunSignature{}
+	for rows.Next() {
+		var sig RunSignature
+		var timestamp string
+		if err := rows.Scan(&sig.ID, &sig.TestRunID, &sig.EmployeeID, &sig.EmployeeName, &sig.Meaning,
+			&sig.Reason, &sig.ContentHash, &timestamp); err != nil {
+			return nil, err
+		}
+		var err error
+		sig.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, rows.Err()
+}
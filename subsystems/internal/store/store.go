@@ -3,9 +3,9 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
-
-	_ "modernc.org/sqlite"
 )
 
 type TestRun struct {
@@ -21,6 +21,7 @@ type TestRun struct {
 	ScriptContent   *string
 	ReportType      *string
 	ReportVersion   *string
+	ScriptVersionID *string
 }
 
 type Measurement struct {
@@ -46,9 +47,19 @@ type DeviceEvent struct {
 type Employee struct {
 	ID        string
 	Name      string
+	Role      string // "operator", "engineer", "admin"
 	CreatedAt time.Time
 }
 
+// LoginFailure records a rejected login attempt.
+type LoginFailure struct {
+	ID         int64
+	EmployeeID string
+	RemoteAddr string
+	Reason     string // "unknown employee", "no credential", "bad credential"
+	Timestamp  time.Time
+}
+
 type RMA struct {
 	ID                string
 	RMANumber         string
@@ -108,197 +119,159 @@ type PumpStatusLogEntry struct {
 	Timestamp       time.Time
 }
 
-type Store struct {
-	db *sql.DB
+// TemperatureAggregate is one minute of temperature_log downsampled by the
+// retention job.
+type TemperatureAggregate struct {
+	StationInstance string
+	DeviceID        string
+	Stage           string
+	Bucket          time.Time // start of the minute
+	MinK            float64
+	MaxK            float64
+	AvgK            float64
+	Samples         int
 }
 
-func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// SQLite requires single-connection mode for :memory: databases
-	// (each pool connection gets its own in-memory DB otherwise).
-	// For file-based DBs this also avoids "database is locked" errors.
-	db.SetMaxOpenConns(1)
-
-	schema := `
-CREATE TABLE IF NOT EXISTS test_runs (
-    id TEXT PRIMARY KEY,
-    script_name TEXT NOT NULL,
-    started_at TEXT NOT NULL,
-    finished_at TEXT,
-    status TEXT NOT NULL,
-    summary TEXT DEFAULT ''
-);
-
-CREATE TABLE IF NOT EXISTS measurements (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
-    device_id TEXT NOT NULL,
-    command_name TEXT NOT NULL,
-    success INTEGER NOT NULL,
-    response TEXT DEFAULT '',
-    duration_ms INTEGER DEFAULT 0,
-    timestamp TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS device_history (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    device_id TEXT NOT NULL,
-    station_instance TEXT NOT NULL,
-    event_type TEXT NOT NULL,
-    details TEXT DEFAULT '',
-    timestamp TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS employees (
-    id TEXT PRIMARY KEY,
-    name TEXT NOT NULL,
-    created_at TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS rmas (
-    id TEXT PRIMARY KEY,
-    rma_number TEXT NOT NULL UNIQUE,
-    pump_serial_number TEXT NOT NULL,
-    customer_name TEXT NOT NULL,
-    pump_model TEXT NOT NULL,
-    employee_id TEXT NOT NULL REFERENCES employees(id),
-    status TEXT NOT NULL DEFAULT 'open',
-    created_at TEXT NOT NULL,
-    closed_at TEXT,
-    notes TEXT DEFAULT ''
-);
-
-CREATE TABLE IF NOT EXISTS station_states (
-    station_instance TEXT PRIMARY KEY,
-    state TEXT NOT NULL DEFAULT 'offline',
-    current_test_run_id TEXT,
-    updated_at TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS temperature_samples (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
-    station_instance TEXT NOT NULL,
-    device_id TEXT NOT NULL,
-    stage TEXT NOT NULL,
-    temperature_k REAL NOT NULL,
-    timestamp TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS test_events (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    test_run_id TEXT NOT NULL REFERENCES test_runs(id),
-    event_type TEXT NOT NULL,
-    employee_id TEXT DEFAULT '',
-    reason TEXT DEFAULT '',
-    timestamp TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS temperature_log (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    station_instance TEXT NOT NULL,
-    device_id TEXT NOT NULL,
-    stage TEXT NOT NULL,
-    temperature_k REAL NOT NULL,
-    timestamp TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS pump_status_log (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    station_instance TEXT NOT NULL,
-    device_id TEXT NOT NULL,
-    pump_on INTEGER NOT NULL,
-    rough_valve_open INTEGER NOT NULL,
-    purge_valve_open INTEGER NOT NULL,
-    regen_status TEXT NOT NULL,
-    timestamp TEXT NOT NULL
-);
-
-CREATE INDEX IF NOT EXISTS idx_temperature_samples_run ON temperature_samples(test_run_id);
-CREATE INDEX IF NOT EXISTS idx_temperature_samples_run_ts ON temperature_samples(test_run_id, timestamp);
-CREATE INDEX IF NOT EXISTS idx_test_events_run ON test_events(test_run_id);
-CREATE INDEX IF NOT EXISTS idx_temperature_log_station_ts ON temperature_log(station_instance, timestamp);
-CREATE INDEX IF NOT EXISTS idx_pump_status_log_station_ts ON pump_status_log(station_instance, timestamp);`
-
-	if _, err := db.Exec(schema); err != nil {
-		db.Close()
-		return nil, err
-	}
-
-	// Migrate existing test_runs table to add new columns
-	if err := migrateTestRuns(db); err != nil {
-		db.Close()
-		return nil, err
-	}
-
-	return &Store{db: db}, nil
+// ScriptVersion is one uploaded revision of a test script in the script
+// registry. Versions are numbered per script name starting at 1.
+type ScriptVersion struct {
+	ID            string
+	Name          string
+	Version       int
+	Content       string // empty in list results; use GetScriptVersion
+	SHA256        string
+	TestName      string
+	ReportType    string
+	ReportVersion string
+	Status        string // "pending", "approved"
+	UploadedBy    string
+	UploadedAt    time.Time
+	ApprovedBy    *string
+	ApprovedAt    *time.Time
 }
 
-// migrateTestRuns adds new columns to test_runs if they don't already exist.
-func migrateTestRuns(db *sql.DB) error {
-	columns := []struct {
-		name string
-		def  string
-	}{
-		{"rma_id", "TEXT"},
-		{"station_instance", "TEXT"},
-		{"script_sha256", "TEXT"},
-		{"script_content", "TEXT"},
-		{"report_type", "TEXT"},
-		{"report_version", "TEXT"},
-	}
-	for _, col := range columns {
-		_, err := db.Exec(fmt.Sprintf("ALTER TABLE test_runs ADD COLUMN %s %s", col.name, col.def))
-		if err != nil {
-			// Ignore "duplicate column" errors
-			if !isDuplicateColumnError(err) {
-				return fmt.Errorf("migrate test_runs add %s: %w", col.name, err)
-			}
-		}
-	}
-	return nil
+// Store is the persistence interface used by the controller. SQLStore
+// implements it for SQLite and PostgreSQL.
+type Store interface {
+	Close() error
+	CreateTestRun(id, scriptName string) error
+	CreateTestRunWithRMA(id, scriptName, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion string) error
+	CreateTestRunFromScriptVersion(id, scriptName, rmaID, stationInstance string, v *ScriptVersion) error
+	FinishTestRun(id, status, summary string) error
+	GetTestRun(id string) (*TestRun, error)
+	LatestTestRunForStation(stationInstance string) (*TestRun, error)
+	QueryTestRuns() ([]TestRun, error)
+	QueryTestRunsPage(f TestRunFilter) ([]TestRun, string, error)
+	QueryTestRunsByRMA(rmaID string) ([]TestRun, error)
+	DeleteTestRun(id string) error
+	RecordCommandResult(testRunID, deviceID, commandName string, success bool, response string, durationMs int) error
+	QueryMeasurements(testRunID string) ([]Measurement, error)
+	RecordDeviceEvent(deviceID, stationInstance, eventType, details string) error
+	CreateEmployee(id, name string) error
+	UpsertEmployee(id, name string) error
+	GetEmployee(id string) (*Employee, error)
+	ListEmployees() ([]Employee, error)
+	SetEmployeeRole(id, role string) error
+	SetEmployeeCredential(id, hash string) error
+	GetEmployeeCredential(id string) (string, error)
+	SetEmployeeBadgeHash(id, hash string) error
+	GetEmployeeByBadgeHash(hash string) (*Employee, error)
+	RecordLoginFailure(employeeID, remoteAddr, reason string) error
+	QueryLoginFailures(since time.Time) ([]LoginFailure, error)
+	CountLoginFailures(remoteAddr, reason string, since time.Time) (int, error)
+	AppendAudit(e *AuditEntry) error
+	QueryAuditLog(f AuditFilter) ([]AuditEntry, string, error)
+	VerifyAuditLog() (int, error)
+	RecordRunSignature(testRunID, employeeID, meaning, reason, contentHash string) (*RunSignature, error)
+	QueryRunSignatures(testRunID string) ([]RunSignature, error)
+	QueryRMARunSignatures(rmaID string) (map[string][]RunSignature, error)
+	CreateAPIKey(id, name, employeeID string, scopes []string, secretHash string) error
+	GetAPIKey(id string) (*APIKey, error)
+	GetAPIKeySecretHash(id string) (string, error)
+	ListAPIKeys() ([]APIKey, error)
+	TouchAPIKey(id string) error
+	RevokeAPIKey(id string) error
+	CreateRMA(id, rmaNumber, pumpSerialNumber, customerName, pumpModel, employeeID, notes string) error
+	GetRMA(id string) (*RMA, error)
+	GetRMAByNumber(rmaNumber string) (*RMA, error)
+	CloseRMA(id string) error
+	ListRMAs(status string) ([]RMA, error)
+	ListRMAsPage(f RMAFilter) ([]RMA, string, error)
+	SearchRMAs(query string) ([]RMA, error)
+	SearchRMAText(query string, limit int) ([]RMA, error)
+	SearchTestRuns(q RunSearch) ([]RunSearchHit, int, error)
+	CreateScriptVersion(id, name, content, sha256, testName, reportType, reportVersion, uploadedBy string) (int, error)
+	ApproveScriptVersion(id, employeeID string) error
+	GetScriptVersion(id string) (*ScriptVersion, error)
+	ListScriptVersions(name, status string) ([]ScriptVersion, error)
+	SetStationState(stationInstance, state string, testRunID *string) error
+	GetStationState(stationInstance string) (*StationState, error)
+	ListStationStates() ([]StationState, error)
+	RecordTemperature(testRunID, stationInstance, deviceID, stage string, temperatureK float64) error
+	QueryTemperatures(testRunID string) ([]TemperatureSample, error)
+	QueryTemperaturesSince(testRunID string, since time.Time) ([]TemperatureSample, error)
+	RecordTestEvent(testRunID, eventType, employeeID, reason string) error
+	RecordTestEventAt(testRunID, eventType, employeeID, reason string, ts time.Time) error
+	QueryTestEvents(testRunID string) ([]TestEvent, error)
+	QueryTestEventsPage(testRunID string, f TestEventFilter) ([]TestEvent, string, error)
+	RecordTemperatureLog(stationInstance, deviceID, stage string, temperatureK float64) error
+	QueryTemperatureLog(stationInstance string, since time.Time) ([]TemperatureLogEntry, error)
+	QueryTemperatureLogRange(stationInstance string, since, until time.Time) ([]TemperatureLogEntry, error)
+	PruneTemperatureLog(olderThan time.Time) (int64, error)
+	RecordPumpStatusLog(stationInstance, deviceID string, pumpOn, roughValveOpen, purgeValveOpen bool, regenStatus string) error
+	QueryPumpStatusLog(stationInstance string, since, until time.Time) ([]PumpStatusLogEntry, error)
+	PrunePumpStatusLog(olderThan time.Time) (int64, error)
+	AggregateTemperatureLog(before time.Time) (int64, error)
+	AggregatePumpStatusLog(before time.Time) (int64, error)
+	PruneTemperatureLogOutsideTests(before time.Time) (int64, error)
+	PrunePumpStatusLogOutsideTests(before time.Time) (int64, error)
+	PruneTelemetryAggregates(before time.Time) (int64, error)
+	QueryTemperatureAggregates(stationInstance string, since, until time.Time) ([]TemperatureAggregate, error)
 }
 
-func isDuplicateColumnError(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := err.Error()
-	// SQLite returns "duplicate column name: ..."
-	return len(msg) > 0 && (contains(msg, "duplicate column") || contains(msg, "already exists"))
+// SQLStore is a Store backed by database/sql.
+type SQLStore struct {
+	db      *sqlDB
+	auditMu sync.Mutex // serialises AppendAudit
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && searchString(s, substr)
-}
+var _ Store = (*SQLStore)(nil)
 
-func searchString(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+// New opens the database named by dsn and migrates it to the latest schema
+// version. See Open for the accepted DSN forms.
+func New(dsn string) (*SQLStore, error) {
+	s, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.MigrateTo(LatestSchemaVersion()); err != nil {
+		s.Close()
+		return nil, err
 	}
-	return false
+
+	return s, nil
 }
 
-func (s *Store) Close() error {
+func (s *SQLStore) Close() error {
 	return s.db.Close()
 }
 
 // DB returns the underlying *sql.DB for use by packages that need direct access.
-func (s *Store) DB() *sql.DB {
-	return s.db
+func (s *SQLStore) DB() *sql.DB {
+	return s.db.DB
+}
+
+// Dialect returns the database flavour: "sqlite" or "postgres".
+func (s *SQLStore) Dialect() string {
+	return s.db.dialect.String()
 }
 
 // ---------------------------------------------------------------------------
 // Test Runs
 // ---------------------------------------------------------------------------
 
-func (s *Store) CreateTestRun(id, scriptName string) error {
+func (s *SQLStore) CreateTestRun(id, scriptName string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO test_runs (id, script_name, started_at, status, summary) VALUES (?, ?, ?, ?, ?)`,
 		id, scriptName, time.Now().UTC().Format(time.RFC3339Nano), "running", "",
@@ -306,7 +279,7 @@ func (s *Store) CreateTestRun(id, scriptName string) error {
 	return err
 }
 
-func (s *Store) CreateTestRunWithRMA(id, scriptName, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion string) error {
+func (s *SQLStore) CreateTestRunWithRMA(id, scriptName, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO test_runs (id, script_name, started_at, status, summary, rma_id, station_instance, script_sha256, script_content, report_type, report_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		id, scriptName, time.Now().UTC().Format(time.RFC3339Nano), "running", "",
@@ -315,7 +288,18 @@ func (s *Store) CreateTestRunWithRMA(id, scriptName, rmaID, stationInstance, scr
 	return err
 }
 
-func (s *Store) FinishTestRun(id, status, summary string) error {
+// CreateTestRunFromScriptVersion creates a test run whose script content,
+// hash and report metadata come from a registered script version.
+func (s *SQLStore) CreateTestRunFromScriptVersion(id, scriptName, rmaID, stationInstance string, v *ScriptVersion) error {
+	_, err := s.db.Exec(
+		`INSERT INTO test_runs (id, script_name, started_at, status, summary, rma_id, station_instance, script_sha256, script_content, report_type, report_version, script_version_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, scriptName, time.Now().UTC().Format(time.RFC3339Nano), "running", "",
+		rmaID, stationInstance, v.SHA256, v.Content, v.ReportType, v.ReportVersion, v.ID,
+	)
+	return err
+}
+
+func (s *SQLStore) FinishTestRun(id, status, summary string) error {
 	_, err := s.db.Exec(
 		`UPDATE test_runs SET finished_at = ?, status = ?, summary = ? WHERE id = ?`,
 		time.Now().UTC().Format(time.RFC3339Nano), status, summary, id,
@@ -323,18 +307,18 @@ func (s *Store) FinishTestRun(id, status, summary string) error {
 	return err
 }
 
-func (s *Store) GetTestRun(id string) (*TestRun, error) {
+func (s *SQLStore) GetTestRun(id string) (*TestRun, error) {
 	var r TestRun
 	var startedAt string
-	var finishedAt, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion sql.NullString
+	var finishedAt, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion, scriptVersionID sql.NullString
 	err := s.db.QueryRow(
 		`SELECT id, script_name, started_at, finished_at, status, summary,
 		        rma_id, station_instance, script_sha256, script_content,
-		        report_type, report_version
+		        report_type, report_version, script_version_id
 		 FROM test_runs WHERE id = ?`, id,
 	).Scan(&r.ID, &r.ScriptName, &startedAt, &finishedAt, &r.Status, &r.Summary,
 		&rmaID, &stationInstance, &scriptSHA256, &scriptContent,
-		&reportType, &reportVersion)
+		&reportType, &reportVersion, &scriptVersionID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -370,22 +354,25 @@ func (s *Store) GetTestRun(id string) (*TestRun, error) {
 	if reportVersion.Valid {
 		r.ReportVersion = &reportVersion.String
 	}
+	if scriptVersionID.Valid {
+		r.ScriptVersionID = &scriptVersionID.String
+	}
 	return &r, nil
 }
 
-func (s *Store) LatestTestRunForStation(stationInstance string) (*TestRun, error) {
+func (s *SQLStore) LatestTestRunForStation(stationInstance string) (*TestRun, error) {
 	var r TestRun
 	var startedAt string
-	var finishedAt, rmaID, si, scriptSHA256, scriptContent, reportType, reportVersion sql.NullString
+	var finishedAt, rmaID, si, scriptSHA256, scriptContent, reportType, reportVersion, scriptVersionID sql.NullString
 	err := s.db.QueryRow(
 		`SELECT id, script_name, started_at, finished_at, status, summary,
 		        rma_id, station_instance, script_sha256, script_content,
-		        report_type, report_version
+		        report_type, report_version, script_version_id
 		 FROM test_runs WHERE station_instance = ? ORDER BY started_at DESC LIMIT 1`,
 		stationInstance,
 	).Scan(&r.ID, &r.ScriptName, &startedAt, &finishedAt, &r.Status, &r.Summary,
 		&rmaID, &si, &scriptSHA256, &scriptContent,
-		&reportType, &reportVersion)
+		&reportType, &reportVersion, &scriptVersionID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -421,14 +408,17 @@ func (s *Store) LatestTestRunForStation(stationInstance string) (*TestRun, error
 	if reportVersion.Valid {
 		r.ReportVersion = &reportVersion.String
 	}
+	if scriptVersionID.Valid {
+		r.ScriptVersionID = &scriptVersionID.String
+	}
 	return &r, nil
 }
 
-func (s *Store) QueryTestRuns() ([]TestRun, error) {
+func (s *SQLStore) QueryTestRuns() ([]TestRun, error) {
 	rows, err := s.db.Query(`SELECT id, script_name, started_at, finished_at, status, summary,
 	                                rma_id, station_instance, script_sha256, script_content,
-	                                report_type, report_version
-	                         FROM test_runs ORDER BY started_at DESC, _rowid_ DESC`)
+	                                report_type, report_version, script_version_id
+	                         FROM test_runs ORDER BY started_at DESC, id DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -438,10 +428,10 @@ func (s *Store) QueryTestRuns() ([]TestRun, error) {
 	for rows.Next() {
 		var r TestRun
 		var startedAt string
-		var finishedAt, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion sql.NullString
+		var finishedAt, rmaID, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion, scriptVersionID sql.NullString
 		if err := rows.Scan(&r.ID, &r.ScriptName, &startedAt, &finishedAt, &r.Status, &r.Summary,
 			&rmaID, &stationInstance, &scriptSHA256, &scriptContent,
-			&reportType, &reportVersion); err != nil {
+			&reportType, &reportVersion, &scriptVersionID); err != nil {
 			return nil, err
 		}
 		r.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt)
@@ -473,16 +463,19 @@ func (s *Store) QueryTestRuns() ([]TestRun, error) {
 		if reportVersion.Valid {
 			r.ReportVersion = &reportVersion.String
 		}
+		if scriptVersionID.Valid {
+			r.ScriptVersionID = &scriptVersionID.String
+		}
 		runs = append(runs, r)
 	}
 	return runs, rows.Err()
 }
 
-func (s *Store) QueryTestRunsByRMA(rmaID string) ([]TestRun, error) {
+func (s *SQLStore) QueryTestRunsByRMA(rmaID string) ([]TestRun, error) {
 	rows, err := s.db.Query(
 		`SELECT id, script_name, started_at, finished_at, status, summary,
 		        rma_id, station_instance, script_sha256, script_content,
-		        report_type, report_version
+		        report_type, report_version, script_version_id
 		 FROM test_runs WHERE rma_id = ? ORDER BY started_at ASC`,
 		rmaID,
 	)
@@ -495,10 +488,10 @@ func (s *Store) QueryTestRunsByRMA(rmaID string) ([]TestRun, error) {
 	for rows.Next() {
 		var r TestRun
 		var startedAt string
-		var finishedAt, rid, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion sql.NullString
+		var finishedAt, rid, stationInstance, scriptSHA256, scriptContent, reportType, reportVersion, scriptVersionID sql.NullString
 		if err := rows.Scan(&r.ID, &r.ScriptName, &startedAt, &finishedAt, &r.Status, &r.Summary,
 			&rid, &stationInstance, &scriptSHA256, &scriptContent,
-			&reportType, &reportVersion); err != nil {
+			&reportType, &reportVersion, &scriptVersionID); err != nil {
 			return nil, err
 		}
 		r.StartedAt, err = time.Parse(time.RFC3339Nano, startedAt)
@@ -530,12 +523,15 @@ func (s *Store) QueryTestRunsByRMA(rmaID string) ([]TestRun, error) {
 		if reportVersion.Valid {
 			r.ReportVersion = &reportVersion.String
 		}
+		if scriptVersionID.Valid {
+			r.ScriptVersionID = &scriptVersionID.String
+		}
 		runs = append(runs, r)
 	}
 	return runs, rows.Err()
 }
 
-func (s *Store) DeleteTestRun(id string) error {
+func (s *SQLStore) DeleteTestRun(id string) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
@@ -561,7 +557,7 @@ func (s *Store) DeleteTestRun(id string) error {
 // Measurements
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordCommandResult(testRunID, deviceID, commandName string, success bool, response string, durationMs int) error {
+func (s *SQLStore) RecordCommandResult(testRunID, deviceID, commandName string, success bool, response string, durationMs int) error {
 	successInt := 0
 	if success {
 		successInt = 1
@@ -573,7 +569,7 @@ func (s *Store) RecordCommandResult(testRunID, deviceID, commandName string, suc
 	return err
 }
 
-func (s *Store) QueryMeasurements(testRunID string) ([]Measurement, error) {
+func (s *SQLStore) QueryMeasurements(testRunID string) ([]Measurement, error) {
 	rows, err := s.db.Query(
 		`SELECT id, test_run_id, device_id, command_name, success, response, duration_ms, timestamp FROM measurements WHERE test_run_id = ? ORDER BY timestamp ASC`,
 		testRunID,
@@ -605,7 +601,7 @@ func (s *Store) QueryMeasurements(testRunID string) ([]Measurement, error) {
 // Device History
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordDeviceEvent(deviceID, stationInstance, eventType, details string) error {
+func (s *SQLStore) RecordDeviceEvent(deviceID, stationInstance, eventType, details string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO device_history (device_id, station_instance, event_type, details, timestamp) VALUES (?, ?, ?, ?, ?)`,
 		deviceID, stationInstance, eventType, details, time.Now().UTC().Format(time.RFC3339Nano),
@@ -617,7 +613,7 @@ func (s *Store) RecordDeviceEvent(deviceID, stationInstance, eventType, details
 // Employees
 // ---------------------------------------------------------------------------
 
-func (s *Store) CreateEmployee(id, name string) error {
+func (s *SQLStore) CreateEmployee(id, name string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO employees (id, name, created_at) VALUES (?, ?, ?)`,
 		id, name, time.Now().UTC().Format(time.RFC3339Nano),
@@ -625,7 +621,7 @@ func (s *Store) CreateEmployee(id, name string) error {
 	return err
 }
 
-func (s *Store) UpsertEmployee(id, name string) error {
+func (s *SQLStore) UpsertEmployee(id, name string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO employees (id, name, created_at) VALUES (?, ?, ?)
 		 ON CONFLICT(id) DO UPDATE SET name = excluded.name`,
@@ -634,12 +630,12 @@ func (s *Store) UpsertEmployee(id, name string) error {
 	return err
 }
 
-func (s *Store) GetEmployee(id string) (*Employee, error) {
+func (s *SQLStore) GetEmployee(id string) (*Employee, error) {
 	var e Employee
 	var createdAt string
 	err := s.db.QueryRow(
-		`SELECT id, name, created_at FROM employees WHERE id = ?`, id,
-	).Scan(&e.ID, &e.Name, &createdAt)
+		`SELECT id, name, role, created_at FROM employees WHERE id = ?`, id,
+	).Scan(&e.ID, &e.Name, &e.Role, &createdAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -653,8 +649,8 @@ func (s *Store) GetEmployee(id string) (*Employee, error) {
 	return &e, nil
 }
 
-func (s *Store) ListEmployees() ([]Employee, error) {
-	rows, err := s.db.Query(`SELECT id, name, created_at FROM employees ORDER BY name ASC`)
+func (s *SQLStore) ListEmployees() ([]Employee, error) {
+	rows, err := s.db.Query(`SELECT id, name, role, created_at FROM employees ORDER BY name ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -664,7 +660,7 @@ func (s *Store) ListEmployees() ([]Employee, error) {
 	for rows.Next() {
 		var e Employee
 		var createdAt string
-		if err := rows.Scan(&e.ID, &e.Name, &createdAt); err != nil {
+		if err := rows.Scan(&e.ID, &e.Name, &e.Role, &createdAt); err != nil {
 			return nil, err
 		}
 		e.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
@@ -676,11 +672,131 @@ func (s *Store) ListEmployees() ([]Employee, error) {
 	return employees, rows.Err()
 }
 
+// SetEmployeeRole changes an employee's role.
+func (s *SQLStore) SetEmployeeRole(id, role string) error {
+	res, err := s.db.Exec(`UPDATE employees SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("employee %q not found", id)
+	}
+	return nil
+}
+
+// SetEmployeeCredential stores the hash of an employee's PIN or password.
+// An empty hash removes the credential, which disables login.
+func (s *SQLStore) SetEmployeeCredential(id, hash string) error {
+	var val any
+	if hash != "" {
+		val = hash
+	}
+	res, err := s.db.Exec(`UPDATE employees SET credential_hash = ? WHERE id = ?`, val, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("employee %q not found", id)
+	}
+	return nil
+}
+
+// GetEmployeeCredential returns an employee's credential hash, or "" if the
+// employee does not exist or has no credential set.
+func (s *SQLStore) GetEmployeeCredential(id string) (string, error) {
+	var hash sql.NullString
+	err := s.db.QueryRow(`SELECT credential_hash FROM employees WHERE id = ?`, id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash.String, err
+}
+
+// SetEmployeeBadgeHash stores the hash of the code printed on an employee's
+// badge (see auth.HashBadge). Badges are unique; an empty hash removes the
+// badge.
+func (s *SQLStore) SetEmployeeBadgeHash(id, hash string) error {
+	var val any
+	if hash != "" {
+		val = hash
+	}
+	res, err := s.db.Exec(`UPDATE employees SET badge_hash = ? WHERE id = ?`, val, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("employee %q not found", id)
+	}
+	return nil
+}
+
+// GetEmployeeByBadgeHash returns the employee whose badge has the given
+// hash, or nil.
+func (s *SQLStore) GetEmployeeByBadgeHash(hash string) (*Employee, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT id FROM employees WHERE badge_hash = ?`, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEmployee(id)
+}
+
+// RecordLoginFailure logs a rejected login attempt.
+func (s *SQLStore) RecordLoginFailure(employeeID, remoteAddr, reason string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO login_failures (employee_id, remote_addr, reason, timestamp) VALUES (?, ?, ?, ?)`,
+		employeeID, remoteAddr, reason, time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	return err
+}
+
+// CountLoginFailures returns how many login failures with reason were
+// recorded from remoteAddr at or after since.
+func (s *SQLStore) CountLoginFailures(remoteAddr, reason string, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM login_failures WHERE remote_addr = ? AND reason = ? AND timestamp >= ?`,
+		remoteAddr, reason, since.UTC().Format(time.RFC3339Nano),
+	).Scan(&n)
+	return n, err
+}
+
+// QueryLoginFailures returns login failures at or after since, newest first.
+func (s *SQLStore) QueryLoginFailures(since time.Time) ([]LoginFailure, error) {
+	rows, err := s.db.Query(
+		`SELECT id, employee_id, remote_addr, reason, timestamp
+		 FROM login_failures WHERE timestamp >= ? ORDER BY timestamp DESC, id DESC`,
+		since.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []LoginFailure{}
+	for rows.Next() {
+		var f LoginFailure
+		var timestamp string
+		if err := rows.Scan(&f.ID, &f.EmployeeID, &f.RemoteAddr, &f.Reason, &timestamp); err != nil {
+			return nil, err
+		}
+		f.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
 // ---------------------------------------------------------------------------
 // RMAs
 // ---------------------------------------------------------------------------
 
-func (s *Store) CreateRMA(id, rmaNumber, pumpSerialNumber, customerName, pumpModel, employeeID, notes string) error {
+func (s *SQLStore) CreateRMA(id, rmaNumber, pumpSerialNumber, customerName, pumpModel, employeeID, notes string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO rmas (id, rma_number, pump_serial_number, customer_name, pump_model, employee_id, status, created_at, notes)
 		 VALUES (?, ?, ?, ?, ?, ?, 'open', ?, ?)`,
@@ -690,7 +806,7 @@ func (s *Store) CreateRMA(id, rmaNumber, pumpSerialNumber, customerName, pumpMod
 	return err
 }
 
-func (s *Store) GetRMA(id string) (*RMA, error) {
+func (s *SQLStore) GetRMA(id string) (*RMA, error) {
 	var r RMA
 	var createdAt string
 	var closedAt sql.NullString
@@ -719,7 +835,7 @@ func (s *Store) GetRMA(id string) (*RMA, error) {
 	return &r, nil
 }
 
-func (s *Store) GetRMAByNumber(rmaNumber string) (*RMA, error) {
+func (s *SQLStore) GetRMAByNumber(rmaNumber string) (*RMA, error) {
 	var r RMA
 	var createdAt string
 	var closedAt sql.NullString
@@ -748,7 +864,7 @@ func (s *Store) GetRMAByNumber(rmaNumber string) (*RMA, error) {
 	return &r, nil
 }
 
-func (s *Store) CloseRMA(id string) error {
+func (s *SQLStore) CloseRMA(id string) error {
 	_, err := s.db.Exec(
 		`UPDATE rmas SET status = 'closed', closed_at = ? WHERE id = ?`,
 		time.Now().UTC().Format(time.RFC3339Nano), id,
@@ -756,7 +872,7 @@ func (s *Store) CloseRMA(id string) error {
 	return err
 }
 
-func (s *Store) ListRMAs(status string) ([]RMA, error) {
+func (s *SQLStore) ListRMAs(status string) ([]RMA, error) {
 	var rows *sql.Rows
 	var err error
 	if status != "" {
@@ -798,11 +914,11 @@ func (s *Store) ListRMAs(status string) ([]RMA, error) {
 	return rmas, rows.Err()
 }
 
-func (s *Store) SearchRMAs(query string) ([]RMA, error) {
-	like := "%" + query + "%"
+func (s *SQLStore) SearchRMAs(query string) ([]RMA, error) {
+	like := "%" + strings.ToLower(query) + "%"
 	rows, err := s.db.Query(
 		`SELECT id, rma_number, pump_serial_number, customer_name, pump_model, employee_id, status, created_at, closed_at, notes
-		 FROM rmas WHERE rma_number LIKE ? OR pump_serial_number LIKE ? OR customer_name LIKE ?
+		 FROM rmas WHERE LOWER(rma_number) LIKE ? OR LOWER(pump_serial_number) LIKE ? OR LOWER(customer_name) LIKE ?
 		 ORDER BY rma_number ASC`,
 		like, like, like,
 	)
@@ -836,11 +952,140 @@ func (s *Store) SearchRMAs(query string) ([]RMA, error) {
 	return rmas, rows.Err()
 }
 
+// ---------------------------------------------------------------------------
+// Script Registry
+// ---------------------------------------------------------------------------
+
+// CreateScriptVersion stores a new pending revision of the named script and
+// returns its version number (one greater than the latest existing version).
+func (s *SQLStore) CreateScriptVersion(id, name, content, sha256, testName, reportType, reportVersion, uploadedBy string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM script_versions WHERE name = ?`, name,
+	).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO script_versions (id, name, version, content, sha256, test_name, report_type, report_version, status, uploaded_by, uploaded_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?)`,
+		id, name, version, content, sha256, testName, reportType, reportVersion, uploadedBy,
+		time.Now().UTC().Format(time.RFC3339Nano),
+	); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// ApproveScriptVersion marks a pending script version as approved for
+// production runs.
+func (s *SQLStore) ApproveScriptVersion(id, employeeID string) error {
+	result, err := s.db.Exec(
+		`UPDATE script_versions SET status = 'approved', approved_by = ?, approved_at = ?
+		 WHERE id = ? AND status = 'pending'`,
+		employeeID, time.Now().UTC().Format(time.RFC3339Nano), id,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("script version %s not found or not pending", id)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetScriptVersion(id string) (*ScriptVersion, error) {
+	var v ScriptVersion
+	var uploadedAt string
+	var approvedBy, approvedAt sql.NullString
+	err := s.db.QueryRow(
+		`SELECT id, name, version, content, sha256, test_name, report_type, report_version,
+		        status, uploaded_by, uploaded_at, approved_by, approved_at
+		 FROM script_versions WHERE id = ?`, id,
+	).Scan(&v.ID, &v.Name, &v.Version, &v.Content, &v.SHA256, &v.TestName, &v.ReportType, &v.ReportVersion,
+		&v.Status, &v.UploadedBy, &uploadedAt, &approvedBy, &approvedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.UploadedAt, err = time.Parse(time.RFC3339Nano, uploadedAt)
+	if err != nil {
+		return nil, err
+	}
+	if approvedBy.Valid {
+		v.ApprovedBy = &approvedBy.String
+	}
+	if approvedAt.Valid {
+		t, err := time.Parse(time.RFC3339Nano, approvedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		v.ApprovedAt = &t
+	}
+	return &v, nil
+}
+
+// ListScriptVersions returns script versions without their content, newest
+// version first within each name. Empty name or status means no filter.
+func (s *SQLStore) ListScriptVersions(name, status string) ([]ScriptVersion, error) {
+	rows, err := s.db.Query(
+		`SELECT id, name, version, sha256, test_name, report_type, report_version,
+		        status, uploaded_by, uploaded_at, approved_by, approved_at
+		 FROM script_versions
+		 WHERE (? = '' OR name = ?) AND (? = '' OR status = ?)
+		 ORDER BY name ASC, version DESC`,
+		name, name, status, status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []ScriptVersion{}
+	for rows.Next() {
+		var v ScriptVersion
+		var uploadedAt string
+		var approvedBy, approvedAt sql.NullString
+		if err := rows.Scan(&v.ID, &v.Name, &v.Version, &v.SHA256, &v.TestName, &v.ReportType, &v.ReportVersion,
+			&v.Status, &v.UploadedBy, &uploadedAt, &approvedBy, &approvedAt); err != nil {
+			return nil, err
+		}
+		v.UploadedAt, err = time.Parse(time.RFC3339Nano, uploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		if approvedBy.Valid {
+			v.ApprovedBy = &approvedBy.String
+		}
+		if approvedAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, approvedAt.String)
+			if err != nil {
+				return nil, err
+			}
+			v.ApprovedAt = &t
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // ---------------------------------------------------------------------------
 // Station States
 // ---------------------------------------------------------------------------
 
-func (s *Store) SetStationState(stationInstance, state string, testRunID *string) error {
+func (s *SQLStore) SetStationState(stationInstance, state string, testRunID *string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO station_states (station_instance, state, current_test_run_id, updated_at)
 		 VALUES (?, ?, ?, ?)
@@ -850,7 +1095,7 @@ func (s *Store) SetStationState(stationInstance, state string, testRunID *string
 	return err
 }
 
-func (s *Store) GetStationState(stationInstance string) (*StationState, error) {
+func (s *SQLStore) GetStationState(stationInstance string) (*StationState, error) {
 	var ss StationState
 	var updatedAt string
 	var testRunID sql.NullString
@@ -874,7 +1119,7 @@ func (s *Store) GetStationState(stationInstance string) (*StationState, error) {
 	return &ss, nil
 }
 
-func (s *Store) ListStationStates() ([]StationState, error) {
+func (s *SQLStore) ListStationStates() ([]StationState, error) {
 	rows, err := s.db.Query(`SELECT station_instance, state, current_test_run_id, updated_at FROM station_states ORDER BY station_instance ASC`)
 	if err != nil {
 		return nil, err
@@ -905,7 +1150,7 @@ func (s *Store) ListStationStates() ([]StationState, error) {
 // Temperature Samples
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordTemperature(testRunID, stationInstance, deviceID, stage string, temperatureK float64) error {
+func (s *SQLStore) RecordTemperature(testRunID, stationInstance, deviceID, stage string, temperatureK float64) error {
 	_, err := s.db.Exec(
 		`INSERT INTO temperature_samples (test_run_id, station_instance, device_id, stage, temperature_k, timestamp)
 		 VALUES (?, ?, ?, ?, ?, ?)`,
@@ -915,7 +1160,7 @@ func (s *Store) RecordTemperature(testRunID, stationInstance, deviceID, stage st
 	return err
 }
 
-func (s *Store) QueryTemperatures(testRunID string) ([]TemperatureSample, error) {
+func (s *SQLStore) QueryTemperatures(testRunID string) ([]TemperatureSample, error) {
 	rows, err := s.db.Query(
 		`SELECT id, test_run_id, station_instance, device_id, stage, temperature_k, timestamp
 		 FROM temperature_samples WHERE test_run_id = ? ORDER BY timestamp ASC`,
@@ -942,7 +1187,7 @@ func (s *Store) QueryTemperatures(testRunID string) ([]TemperatureSample, error)
 	return samples, rows.Err()
 }
 
-func (s *Store) QueryTemperaturesSince(testRunID string, since time.Time) ([]TemperatureSample, error) {
+func (s *SQLStore) QueryTemperaturesSince(testRunID string, since time.Time) ([]TemperatureSample, error) {
 	rows, err := s.db.Query(
 		`SELECT id, test_run_id, station_instance, device_id, stage, temperature_k, timestamp
 		 FROM temperature_samples WHERE test_run_id = ? AND timestamp > ? ORDER BY timestamp ASC`,
@@ -973,7 +1218,7 @@ func (s *Store) QueryTemperaturesSince(testRunID string, since time.Time) ([]Tem
 // Test Events
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordTestEvent(testRunID, eventType, employeeID, reason string) error {
+func (s *SQLStore) RecordTestEvent(testRunID, eventType, employeeID, reason string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO test_events (test_run_id, event_type, employee_id, reason, timestamp)
 		 VALUES (?, ?, ?, ?, ?)`,
@@ -984,7 +1229,7 @@ func (s *Store) RecordTestEvent(testRunID, eventType, employeeID, reason string)
 }
 
 // RecordTestEventAt is like RecordTestEvent but with an explicit timestamp.
-func (s *Store) RecordTestEventAt(testRunID, eventType, employeeID, reason string, ts time.Time) error {
+func (s *SQLStore) RecordTestEventAt(testRunID, eventType, employeeID, reason string, ts time.Time) error {
 	_, err := s.db.Exec(
 		`INSERT INTO test_events (test_run_id, event_type, employee_id, reason, timestamp)
 		 VALUES (?, ?, ?, ?, ?)`,
@@ -994,7 +1239,7 @@ func (s *Store) RecordTestEventAt(testRunID, eventType, employeeID, reason strin
 	return err
 }
 
-func (s *Store) QueryTestEvents(testRunID string) ([]TestEvent, error) {
+func (s *SQLStore) QueryTestEvents(testRunID string) ([]TestEvent, error) {
 	rows, err := s.db.Query(
 		`SELECT id, test_run_id, event_type, employee_id, reason, timestamp
 		 FROM test_events WHERE test_run_id = ? ORDER BY timestamp ASC`,
@@ -1025,7 +1270,7 @@ func (s *Store) QueryTestEvents(testRunID string) ([]TestEvent, error) {
 // Temperature Log (continuous, not test-bound)
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordTemperatureLog(stationInstance, deviceID, stage string, temperatureK float64) error {
+func (s *SQLStore) RecordTemperatureLog(stationInstance, deviceID, stage string, temperatureK float64) error {
 	_, err := s.db.Exec(
 		`INSERT INTO temperature_log (station_instance, device_id, stage, temperature_k, timestamp)
 		 VALUES (?, ?, ?, ?, ?)`,
@@ -1035,7 +1280,7 @@ func (s *Store) RecordTemperatureLog(stationInstance, deviceID, stage string, te
 	return err
 }
 
-func (s *Store) QueryTemperatureLog(stationInstance string, since time.Time) ([]TemperatureLogEntry, error) {
+func (s *SQLStore) QueryTemperatureLog(stationInstance string, since time.Time) ([]TemperatureLogEntry, error) {
 	rows, err := s.db.Query(
 		`SELECT id, station_instance, device_id, stage, temperature_k, timestamp
 		 FROM temperature_log WHERE station_instance = ? AND timestamp > ? ORDER BY timestamp ASC`,
@@ -1062,7 +1307,7 @@ func (s *Store) QueryTemperatureLog(stationInstance string, since time.Time) ([]
 	return entries, rows.Err()
 }
 
-func (s *Store) QueryTemperatureLogRange(stationInstance string, since, until time.Time) ([]TemperatureLogEntry, error) {
+func (s *SQLStore) QueryTemperatureLogRange(stationInstance string, since, until time.Time) ([]TemperatureLogEntry, error) {
 	rows, err := s.db.Query(
 		`SELECT id, station_instance, device_id, stage, temperature_k, timestamp
 		 FROM temperature_log
@@ -1093,7 +1338,7 @@ func (s *Store) QueryTemperatureLogRange(stationInstance string, since, until ti
 	return entries, rows.Err()
 }
 
-func (s *Store) PruneTemperatureLog(olderThan time.Time) (int64, error) {
+func (s *SQLStore) PruneTemperatureLog(olderThan time.Time) (int64, error) {
 	result, err := s.db.Exec(
 		`DELETE FROM temperature_log WHERE timestamp < ?`,
 		olderThan.UTC().Format(time.RFC3339Nano),
@@ -1108,7 +1353,7 @@ func (s *Store) PruneTemperatureLog(olderThan time.Time) (int64, error) {
 // Pump Status Log (continuous, not test-bound)
 // ---------------------------------------------------------------------------
 
-func (s *Store) RecordPumpStatusLog(stationInstance, deviceID string, pumpOn, roughValveOpen, purgeValveOpen bool, regenStatus string) error {
+func (s *SQLStore) RecordPumpStatusLog(stationInstance, deviceID string, pumpOn, roughValveOpen, purgeValveOpen bool, regenStatus string) error {
 	_, err := s.db.Exec(
 		`INSERT INTO pump_status_log (station_instance, device_id, pump_on, rough_valve_open, purge_valve_open, regen_status, timestamp)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
@@ -1120,7 +1365,7 @@ func (s *Store) RecordPumpStatusLog(stationInstance, deviceID string, pumpOn, ro
 	return err
 }
 
-func (s *Store) QueryPumpStatusLog(stationInstance string, since, until time.Time) ([]PumpStatusLogEntry, error) {
+func (s *SQLStore) QueryPumpStatusLog(stationInstance string, since, until time.Time) ([]PumpStatusLogEntry, error) {
 	rows, err := s.db.Query(
 		`SELECT id, station_instance, device_id, pump_on, rough_valve_open, purge_valve_open, regen_status, timestamp
 		 FROM pump_status_log
@@ -1155,7 +1400,7 @@ func (s *Store) QueryPumpStatusLog(stationInstance string, since, until time.Tim
 	return entries, rows.Err()
 }
 
-func (s *Store) PrunePumpStatusLog(olderThan time.Time) (int64, error) {
+func (s *SQLStore) PrunePumpStatusLog(olderThan time.Time) (int64, error) {
 	result, err := s.db.Exec(
 		`DELETE FROM pump_status_log WHERE timestamp < ?`,
 		olderThan.UTC().Format(time.RFC3339Nano),
@@ -1166,6 +1411,183 @@ func (s *Store) PrunePumpStatusLog(olderThan time.Time) (int64, error) {
 	return result.RowsAffected()
 }
 
+// ---------------------------------------------------------------------------
+// Telemetry Retention
+// ---------------------------------------------------------------------------
+
+// overlapsTestRun matches log rows recorded on a station while a test run was
+// in progress there. Those rows are kept raw forever as test evidence.
+const overlapsTestRun = `EXISTS (
+    SELECT 1 FROM test_runs tr
+    WHERE tr.station_instance = %[1]s.station_instance
+      AND tr.started_at <= %[1]s.timestamp
+      AND (tr.finished_at IS NULL OR tr.finished_at >= %[1]s.timestamp))`
+
+// minuteCutoff formats before, truncated to the minute, for comparing with
+// RFC 3339 UTC timestamps. A timestamp sorts below "2006-01-02T15:04"
+// exactly when its minute is earlier, so a cutoff always falls on a bucket
+// boundary: comparing with a whole RFC3339Nano string would order
+// "10:01:00.5Z" before "10:01:00Z" and aggregate part of the 10:01 bucket,
+// whose later rows ON CONFLICT DO NOTHING would then drop.
+func minuteCutoff(before time.Time) string {
+	return before.UTC().Truncate(time.Minute).Format("2006-01-02T15:04")
+}
+
+// AggregateTemperatureLog writes 1-minute min/max/avg buckets for
+// temperature_log rows older than before (truncated to the minute). Returns
+// the number of buckets written.
+func (s *SQLStore) AggregateTemperatureLog(before time.Time) (int64, error) {
+	return s.aggregateLog("temperature_log",
+		`INSERT INTO temperature_log_1m (station_instance, device_id, stage, bucket, min_k, max_k, avg_k, samples)
+		 SELECT station_instance, device_id, stage, substr(timestamp, 1, 16) || ':00Z',
+		        MIN(temperature_k), MAX(temperature_k), AVG(temperature_k), COUNT(*)
+		 FROM temperature_log
+		 WHERE timestamp >= ? AND timestamp < ?
+		 GROUP BY station_instance, device_id, stage, substr(timestamp, 1, 16)
+		 ON CONFLICT DO NOTHING`,
+		before)
+}
+
+// AggregatePumpStatusLog writes 1-minute buckets for pump_status_log rows
+// older than before (truncated to the minute): sample counts per state and
+// the last regen status seen in the minute. Returns the number of buckets
+// written.
+func (s *SQLStore) AggregatePumpStatusLog(before time.Time) (int64, error) {
+	return s.aggregateLog("pump_status_log",
+		`INSERT INTO pump_status_log_1m (station_instance, device_id, bucket, samples,
+		        pump_on_samples, rough_valve_open_samples, purge_valve_open_samples, last_regen_status)
+		 SELECT p.station_instance, p.device_id, substr(p.timestamp, 1, 16) || ':00Z',
+		        COUNT(*), SUM(p.pump_on), SUM(p.rough_valve_open), SUM(p.purge_valve_open),
+		        (SELECT l.regen_status FROM pump_status_log l
+		         WHERE l.station_instance = p.station_instance AND l.device_id = p.device_id
+		           AND substr(l.timestamp, 1, 16) = substr(p.timestamp, 1, 16)
+		         ORDER BY l.timestamp DESC, l.id DESC LIMIT 1)
+		 FROM pump_status_log p
+		 WHERE p.timestamp >= ? AND p.timestamp < ?
+		 GROUP BY p.station_instance, p.device_id, substr(p.timestamp, 1, 16)
+		 ON CONFLICT DO NOTHING`,
+		before)
+}
+
+// aggregateLog runs insert, an aggregation of the raw table source, over
+// the rows between source's high-water mark in telemetry_rollups and
+// before (truncated to the minute), then advances the mark. Each raw row is
+// therefore aggregated once, although rows overlapping a test run stay in
+// source forever.
+func (s *SQLStore) aggregateLog(source, insert string, before time.Time) (int64, error) {
+	cutoff := minuteCutoff(before)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var from string
+	err = tx.QueryRow(`SELECT aggregated_before FROM telemetry_rollups WHERE source = ?`, source).Scan(&from)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if from >= cutoff {
+		return 0, nil
+	}
+	result, err := tx.Exec(insert, from, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO telemetry_rollups (source, aggregated_before) VALUES (?, ?)
+		 ON CONFLICT (source) DO UPDATE SET aggregated_before = excluded.aggregated_before`,
+		source, cutoff,
+	); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// PruneTemperatureLogOutsideTests deletes raw temperature_log rows older than
+// before (truncated to the minute) that do not overlap a test run.
+func (s *SQLStore) PruneTemperatureLogOutsideTests(before time.Time) (int64, error) {
+	result, err := s.db.Exec(
+		`DELETE FROM temperature_log WHERE timestamp < ? AND NOT `+fmt.Sprintf(overlapsTestRun, "temperature_log"),
+		minuteCutoff(before),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PrunePumpStatusLogOutsideTests deletes raw pump_status_log rows older than
+// before (truncated to the minute) that do not overlap a test run.
+func (s *SQLStore) PrunePumpStatusLogOutsideTests(before time.Time) (int64, error) {
+	result, err := s.db.Exec(
+		`DELETE FROM pump_status_log WHERE timestamp < ? AND NOT `+fmt.Sprintf(overlapsTestRun, "pump_status_log"),
+		minuteCutoff(before),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PruneTelemetryAggregates deletes 1-minute buckets older than before from
+// both aggregate tables.
+func (s *SQLStore) PruneTelemetryAggregates(before time.Time) (int64, error) {
+	// Buckets are stored as "2006-01-02T15:04:00Z"; a bucket starts before
+	// before exactly when it starts before before rounded up to the minute.
+	cutoff := before.UTC().Add(time.Minute - time.Nanosecond).Truncate(time.Minute).Format(time.RFC3339)
+	var total int64
+	for _, table := range []string{"temperature_log_1m", "pump_status_log_1m"} {
+		result, err := s.db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE bucket < ?`, table), cutoff)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// QueryTemperatureAggregates returns 1-minute temperature buckets for a
+// station in [since, until), oldest first.
+func (s *SQLStore) QueryTemperatureAggregates(stationInstance string, since, until time.Time) ([]TemperatureAggregate, error) {
+	rows, err := s.db.Query(
+		`SELECT station_instance, device_id, stage, bucket, min_k, max_k, avg_k, samples
+		 FROM temperature_log_1m
+		 WHERE station_instance = ? AND bucket >= ? AND bucket < ?
+		 ORDER BY bucket ASC, stage ASC`,
+		stationInstance,
+		since.UTC().Format(time.RFC3339Nano),
+		until.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aggs := []TemperatureAggregate{}
+	for rows.Next() {
+		var a TemperatureAggregate
+		var bucket string
+		if err := rows.Scan(&a.StationInstance, &a.DeviceID, &a.Stage, &bucket, &a.MinK, &a.MaxK, &a.AvgK, &a.Samples); err != nil {
+			return nil, err
+		}
+		a.Bucket, err = time.Parse(time.RFC3339, bucket)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, a)
+	}
+	return aggs, rows.Err()
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
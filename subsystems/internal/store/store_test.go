@@ -1,13 +1,61 @@
 package store
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
-func newTestStore(t *testing.T) *Store {
+// testDSN returns the database the store tests run against. When
+// ARTURO_STORE_TEST_DSN names a PostgreSQL database, each test gets its own
+// schema there, dropped on cleanup; otherwise fallback (a SQLite path or
+// ":memory:") is used.
+func testDSN(t *testing.T, fallback string) string {
 	t.Helper()
-	s, err := New(":memory:")
+	base := os.Getenv("ARTURO_STORE_TEST_DSN")
+	if base == "" {
+		return fallback
+	}
+	if dialectForDSN(base) != dialectPostgres {
+		t.Fatalf("ARTURO_STORE_TEST_DSN must be a postgres:// URL, got %q", base)
+	}
+
+	admin, err := sql.Open("pgx", base)
+	if err != nil {
+		t.Fatalf("open %s: %v", base, err)
+	}
+	schema := fmt.Sprintf("arturo_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("parse %s: %v", base, err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func newTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	s, err := New(testDSN(t, ":memory:"))
 	if err != nil {
 		t.Fatalf("New(:memory:) failed: %v", err)
 	}
@@ -16,7 +64,7 @@ func newTestStore(t *testing.T) *Store {
 }
 
 func TestNewCreatesStore(t *testing.T) {
-	s, err := New(":memory:")
+	s, err := New(testDSN(t, ":memory:"))
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -326,6 +374,182 @@ func TestUpsertEmployee(t *testing.T) {
 	}
 }
 
+func TestEmployeeBadge(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("emp-1", "John Doe")
+	s.CreateEmployee("emp-2", "Jane Roe")
+
+	if err := s.SetEmployeeBadgeHash("emp-1", "hash-1001"); err != nil {
+		t.Fatalf("SetEmployeeBadgeHash failed: %v", err)
+	}
+	emp, err := s.GetEmployeeByBadgeHash("hash-1001")
+	if err != nil || emp == nil || emp.ID != "emp-1" {
+		t.Fatalf("expected emp-1 for badge, got %+v %v", emp, err)
+	}
+	if err := s.SetEmployeeBadgeHash("emp-2", "hash-1001"); err == nil {
+		t.Error("expected duplicate badge to be rejected")
+	}
+	if err := s.SetEmployeeBadgeHash("emp-missing", "hash-2000"); err == nil {
+		t.Error("expected error for unknown employee")
+	}
+
+	// Clearing badges leaves NULLs, which do not collide.
+	s.SetEmployeeBadgeHash("emp-1", "")
+	if err := s.SetEmployeeBadgeHash("emp-2", ""); err != nil {
+		t.Fatalf("clearing second badge failed: %v", err)
+	}
+	if emp, _ := s.GetEmployeeByBadgeHash("hash-1001"); emp != nil {
+		t.Errorf("expected cleared badge to resolve to nobody, got %+v", emp)
+	}
+
+	cols, err := s.db.tableColumns("employees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols["badge_code"] {
+		t.Error("badge codes must not be stored in the clear")
+	}
+}
+
+func TestCountLoginFailures(t *testing.T) {
+	s := newTestStore(t)
+	s.RecordLoginFailure("", "10.0.0.5", "unknown badge")
+	s.RecordLoginFailure("", "10.0.0.5", "unknown badge")
+	s.RecordLoginFailure("", "10.0.0.6", "unknown badge")
+	s.RecordLoginFailure("emp-1", "10.0.0.5", "bad credential")
+
+	if n, err := s.CountLoginFailures("10.0.0.5", "unknown badge", time.Now().Add(-time.Minute)); err != nil || n != 2 {
+		t.Errorf("expected 2 failures, got %d %v", n, err)
+	}
+	if n, _ := s.CountLoginFailures("10.0.0.5", "unknown badge", time.Now().Add(time.Minute)); n != 0 {
+		t.Errorf("expected no failures after since, got %d", n)
+	}
+}
+
+func TestAuditLogChain(t *testing.T) {
+	s := newTestStore(t)
+
+	base := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i, id := range []string{"emp-1", "emp-2", "emp-1"} {
+		e := &AuditEntry{
+			Timestamp:  base.Add(time.Duration(i) * time.Minute),
+			EmployeeID: id,
+			Method:     "POST",
+			Endpoint:   "POST /rmas",
+			Path:       "/rmas",
+			Params:     `{"body":{"rma_number":"RMA-` + strconv.Itoa(i) + `"}}`,
+			Status:     201,
+		}
+		if err := s.AppendAudit(e); err != nil {
+			t.Fatalf("AppendAudit failed: %v", err)
+		}
+		if e.ID == 0 || e.Hash == "" || (i > 0) == (e.PrevHash == "") {
+			t.Fatalf("entry %d not chained: %+v", i, e)
+		}
+	}
+
+	if n, err := s.VerifyAuditLog(); err != nil || n != 3 {
+		t.Fatalf("VerifyAuditLog = %d, %v; want 3, nil", n, err)
+	}
+
+	entries, next, err := s.QueryAuditLog(AuditFilter{EmployeeID: "emp-1", Page: Page{Limit: 1}})
+	if err != nil || len(entries) != 1 || next == "" {
+		t.Fatalf("expected first emp-1 page with cursor, got %d entries, %q, %v", len(entries), next, err)
+	}
+	entries, next, _ = s.QueryAuditLog(AuditFilter{EmployeeID: "emp-1", Page: Page{Limit: 1, Cursor: next}})
+	if len(entries) != 1 || next != "" || !entries[0].Timestamp.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("unexpected second page %+v, cursor %q", entries, next)
+	}
+	until := base.Add(time.Minute)
+	if entries, _, _ := s.QueryAuditLog(AuditFilter{Until: &until}); len(entries) != 1 {
+		t.Errorf("expected 1 entry before until, got %d", len(entries))
+	}
+
+	if _, err := s.db.Exec(`UPDATE audit_log SET status = 200 WHERE id = 2`); err == nil {
+		t.Fatal("expected audit_log to refuse updates")
+	}
+	if _, err := s.db.Exec(`DELETE FROM audit_log WHERE id = 2`); err == nil {
+		t.Fatal("expected audit_log to refuse deletes")
+	}
+
+	// Someone with direct database access can drop the triggers, but the
+	// edit still shows up in the chain.
+	s.db.Exec(`DROP TRIGGER audit_log_no_update`)
+	if _, err := s.db.Exec(`UPDATE audit_log SET employee_id = 'emp-9' WHERE id = 2`); err != nil {
+		t.Fatalf("tampering update failed: %v", err)
+	}
+	n, err := s.VerifyAuditLog()
+	var chainErr *AuditChainError
+	if !errors.As(err, &chainErr) || chainErr.ID != 2 || n != 1 {
+		t.Errorf("expected chain break at entry 2 after 1 good entry, got %d, %v", n, err)
+	}
+}
+
+func TestRunSignatures(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("emp-eng", "Eve Engineer")
+	s.CreateTestRun("run-1", "test.art")
+
+	if !ValidSignatureMeaning(SignatureApproved) || ValidSignatureMeaning("signed") {
+		t.Error("ValidSignatureMeaning accepts the wrong meanings")
+	}
+	sig, err := s.RecordRunSignature("run-1", "emp-eng", SignatureReviewed, "", "hash-1")
+	if err != nil {
+		t.Fatalf("RecordRunSignature failed: %v", err)
+	}
+	if sig.ID == 0 || sig.EmployeeName != "Eve Engineer" || sig.Timestamp.IsZero() {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+	s.RecordRunSignature("run-1", "emp-eng", SignatureApproved, "results ok", "hash-1")
+
+	sigs, err := s.QueryRunSignatures("run-1")
+	if err != nil {
+		t.Fatalf("QueryRunSignatures failed: %v", err)
+	}
+	if len(sigs) != 2 || sigs[0].Meaning != SignatureReviewed || sigs[1].Meaning != SignatureApproved ||
+		sigs[1].Reason != "results ok" || sigs[1].ContentHash != "hash-1" || sigs[1].EmployeeName != "Eve Engineer" {
+		t.Errorf("unexpected signatures %+v", sigs)
+	}
+	if sigs, _ := s.QueryRunSignatures("run-2"); len(sigs) != 0 {
+		t.Errorf("expected no signatures for unsigned run, got %+v", sigs)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("svc-mes", "MES integration")
+
+	if err := s.CreateAPIKey("k1", "MES", "svc-mes", []string{"rmas", "tests"}, "hash-1"); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	key, err := s.GetAPIKey("k1")
+	if err != nil || key == nil {
+		t.Fatalf("GetAPIKey failed: %v", err)
+	}
+	if key.Name != "MES" || key.EmployeeID != "svc-mes" || !reflect.DeepEqual(key.Scopes, []string{"rmas", "tests"}) ||
+		key.LastUsedAt != nil || key.RevokedAt != nil {
+		t.Errorf("unexpected key %+v", key)
+	}
+	if hash, _ := s.GetAPIKeySecretHash("k1"); hash != "hash-1" {
+		t.Errorf("expected stored hash, got %q", hash)
+	}
+	if k, _ := s.GetAPIKey("missing"); k != nil {
+		t.Errorf("expected nil for unknown key, got %+v", k)
+	}
+
+	s.TouchAPIKey("k1")
+	if err := s.RevokeAPIKey("k1"); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if err := s.RevokeAPIKey("missing"); err == nil {
+		t.Error("expected error revoking unknown key")
+	}
+	keys, err := s.ListAPIKeys()
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil || keys[0].RevokedAt == nil {
+		t.Errorf("expected one used, revoked key, got %+v %v", keys, err)
+	}
+}
+
 func TestGetEmployeeNotFound(t *testing.T) {
 	s := newTestStore(t)
 
@@ -730,14 +954,743 @@ func TestDeleteTestRun(t *testing.T) {
 
 func TestMigrationIdempotent(t *testing.T) {
 	// Creating a store twice on the same DB should not error
-	s1, err := New(":memory:")
+	s1, err := New(testDSN(t, ":memory:"))
 	if err != nil {
 		t.Fatalf("first New failed: %v", err)
 	}
 
 	// Run migration again on same DB
-	if err := migrateTestRuns(s1.db); err != nil {
+	steps, err := s1.MigrateTo(LatestSchemaVersion())
+	if err != nil {
 		t.Fatalf("second migration failed: %v", err)
 	}
+	if len(steps) != 0 {
+		t.Errorf("expected no steps on migrated DB, got %d", len(steps))
+	}
 	s1.Close()
 }
+
+// schemaSnapshot describes every table's columns and every index, for
+// comparing databases that reached the same version by different paths.
+func schemaSnapshot(t *testing.T, s *SQLStore) map[string]string {
+	t.Helper()
+	query := `SELECT type, name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' ORDER BY name`
+	if s.db.dialect == dialectPostgres {
+		query = `SELECT 'table', table_name FROM information_schema.tables WHERE table_schema = current_schema()
+		         UNION ALL
+		         SELECT 'index', indexname FROM pg_indexes WHERE schemaname = current_schema() AND indexname LIKE 'idx_%'`
+	}
+	rows, err := s.db.Query(query)
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	var tables []string
+	snap := make(map[string]string)
+	for rows.Next() {
+		var typ, name string
+		rows.Scan(&typ, &name)
+		snap[name] = typ
+		if typ == "table" {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+	for _, table := range tables {
+		cols, err := s.db.tableColumns(table)
+		if err != nil {
+			t.Fatalf("columns of %s: %v", table, err)
+		}
+		names := make([]string, 0, len(cols))
+		for c := range cols {
+			names = append(names, c)
+		}
+		sort.Strings(names)
+		snap[table] = "table(" + strings.Join(names, ",") + ")"
+	}
+	return snap
+}
+
+func openMigratedDB(t *testing.T, version int) *SQLStore {
+	t.Helper()
+	s, err := Open(testDSN(t, ":memory:"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, err := s.MigrateTo(version); err != nil {
+		t.Fatalf("MigrateTo(%d) failed: %v", version, err)
+	}
+	return s
+}
+
+func TestMigrateFromEveryVersion(t *testing.T) {
+	head := schemaSnapshot(t, openMigratedDB(t, LatestSchemaVersion()))
+
+	for v := 0; v <= LatestSchemaVersion(); v++ {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			s := openMigratedDB(t, v)
+			if v >= 1 {
+				if _, err := s.db.Exec(`INSERT INTO test_runs (id, script_name, started_at, status) VALUES ('run-old', 'old.art', '2025-01-01T00:00:00Z', 'passed')`); err != nil {
+					t.Fatalf("seed fixture: %v", err)
+				}
+			}
+
+			steps, err := s.MigrateTo(LatestSchemaVersion())
+			if err != nil {
+				t.Fatalf("migrate to head: %v", err)
+			}
+			if len(steps) != LatestSchemaVersion()-v {
+				t.Errorf("expected %d steps, got %d", LatestSchemaVersion()-v, len(steps))
+			}
+			if got := schemaSnapshot(t, s); !reflect.DeepEqual(got, head) {
+				t.Errorf("schema after migrating from v%d differs from head:\n got %v\nwant %v", v, got, head)
+			}
+
+			if v >= 1 {
+				run, err := s.GetTestRun("run-old")
+				if err != nil || run == nil || run.Status != "passed" {
+					t.Errorf("fixture run not preserved: %+v, %v", run, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	s := openMigratedDB(t, LatestSchemaVersion())
+	head := schemaSnapshot(t, s)
+
+	steps, err := s.MigrateTo(0)
+	if err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if len(steps) != LatestSchemaVersion() || steps[0].Direction != "down" || steps[0].Version != LatestSchemaVersion() {
+		t.Fatalf("unexpected down steps: %+v", steps)
+	}
+	if snap := schemaSnapshot(t, s); len(snap) != 1 {
+		t.Errorf("expected only schema_migrations at v0, got %v", snap)
+	}
+
+	if _, err := s.MigrateTo(LatestSchemaVersion()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if got := schemaSnapshot(t, s); !reflect.DeepEqual(got, head) {
+		t.Errorf("schema after down/up differs from head:\n got %v\nwant %v", got, head)
+	}
+}
+
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	// A database written by the old ad-hoc schema code: v3 tables and
+	// columns, no schema_migrations.
+	s := openMigratedDB(t, 3)
+	s.db.Exec(`DROP TABLE schema_migrations`)
+	s.db.Exec(`INSERT INTO test_runs (id, script_name, started_at, status, rma_id) VALUES ('run-old', 'old.art', '2025-01-01T00:00:00Z', 'passed', 'rma-1')`)
+
+	if v, err := s.SchemaVersion(); err != nil || v != 3 {
+		t.Fatalf("expected detected legacy version 3, got %d, %v", v, err)
+	}
+
+	steps, err := s.MigrateTo(LatestSchemaVersion())
+	if err != nil {
+		t.Fatalf("MigrateTo failed: %v", err)
+	}
+	if len(steps) != LatestSchemaVersion()-3 || steps[0].Name != "script_registry" {
+		t.Errorf("expected migrations from script_registry on applied, got %+v", steps)
+	}
+
+	statuses, err := s.SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus failed: %v", err)
+	}
+	for _, st := range statuses {
+		if !st.Applied {
+			t.Errorf("migration %d not applied", st.Version)
+		}
+		if adopted := st.Version <= 3; adopted != (st.AppliedAt == nil) {
+			t.Errorf("migration %d: adopted=%v but AppliedAt=%v", st.Version, adopted, st.AppliedAt)
+		}
+	}
+
+	run, _ := s.GetTestRun("run-old")
+	if run == nil || run.RMAID == nil || *run.RMAID != "rma-1" {
+		t.Errorf("legacy run not preserved: %+v", run)
+	}
+}
+
+func TestPlanMigrationDoesNotApply(t *testing.T) {
+	s := openMigratedDB(t, 1)
+
+	steps, err := s.PlanMigration(LatestSchemaVersion())
+	if err != nil {
+		t.Fatalf("PlanMigration failed: %v", err)
+	}
+	if len(steps) != LatestSchemaVersion()-1 || steps[0].Version != 2 {
+		t.Errorf("unexpected plan: %+v", steps)
+	}
+	if v, _ := s.SchemaVersion(); v != 1 {
+		t.Errorf("expected version still 1 after plan, got %d", v)
+	}
+}
+
+func TestNewRejectsNewerSchema(t *testing.T) {
+	path := testDSN(t, filepath.Join(t.TempDir(), "newer.db"))
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', '')`)
+	s.Close()
+
+	if _, err := New(path); err == nil {
+		t.Fatal("expected error opening a database newer than this build")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Script registry tests
+// ---------------------------------------------------------------------------
+
+func TestCreateScriptVersionIncrements(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("emp-1", "Test User")
+
+	v1, err := s.CreateScriptVersion("sv-1", "regen.art", "TEST \"a\"\nENDTEST", "hash1", "a", "regen", "1.0", "emp-1")
+	if err != nil {
+		t.Fatalf("CreateScriptVersion failed: %v", err)
+	}
+	v2, err := s.CreateScriptVersion("sv-2", "regen.art", "TEST \"b\"\nENDTEST", "hash2", "b", "regen", "1.1", "emp-1")
+	if err != nil {
+		t.Fatalf("CreateScriptVersion failed: %v", err)
+	}
+	other, err := s.CreateScriptVersion("sv-3", "status.art", "TEST \"c\"\nENDTEST", "hash3", "c", "standard", "1.0", "emp-1")
+	if err != nil {
+		t.Fatalf("CreateScriptVersion failed: %v", err)
+	}
+	if v1 != 1 || v2 != 2 || other != 1 {
+		t.Errorf("expected versions 1, 2, 1; got %d, %d, %d", v1, v2, other)
+	}
+
+	v, err := s.GetScriptVersion("sv-2")
+	if err != nil {
+		t.Fatalf("GetScriptVersion failed: %v", err)
+	}
+	if v == nil {
+		t.Fatal("expected script version, got nil")
+	}
+	if v.Status != "pending" {
+		t.Errorf("expected status pending, got %s", v.Status)
+	}
+	if v.Content != "TEST \"b\"\nENDTEST" {
+		t.Errorf("unexpected content %q", v.Content)
+	}
+	if v.ReportVersion != "1.1" {
+		t.Errorf("expected report version 1.1, got %s", v.ReportVersion)
+	}
+}
+
+func TestApproveScriptVersion(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("emp-1", "Test User")
+	s.CreateEmployee("emp-2", "Approver")
+	s.CreateScriptVersion("sv-1", "regen.art", "x", "hash1", "", "regen", "1.0", "emp-1")
+	s.CreateScriptVersion("sv-2", "regen.art", "y", "hash2", "", "regen", "1.0", "emp-1")
+
+	if err := s.ApproveScriptVersion("sv-1", "emp-2"); err != nil {
+		t.Fatalf("ApproveScriptVersion failed: %v", err)
+	}
+	if err := s.ApproveScriptVersion("sv-1", "emp-2"); err == nil {
+		t.Error("expected error approving an already approved version")
+	}
+	if err := s.ApproveScriptVersion("missing", "emp-2"); err == nil {
+		t.Error("expected error approving an unknown version")
+	}
+
+	v, _ := s.GetScriptVersion("sv-1")
+	if v.ApprovedBy == nil || *v.ApprovedBy != "emp-2" {
+		t.Error("expected ApprovedBy emp-2")
+	}
+	if v.ApprovedAt == nil {
+		t.Error("expected ApprovedAt to be set")
+	}
+
+	approved, err := s.ListScriptVersions("", "approved")
+	if err != nil {
+		t.Fatalf("ListScriptVersions failed: %v", err)
+	}
+	if len(approved) != 1 || approved[0].ID != "sv-1" {
+		t.Errorf("expected only sv-1 approved, got %+v", approved)
+	}
+	if approved[0].Content != "" {
+		t.Error("expected list results without content")
+	}
+
+	all, _ := s.ListScriptVersions("regen.art", "")
+	if len(all) != 2 || all[0].Version != 2 {
+		t.Errorf("expected 2 versions newest first, got %+v", all)
+	}
+}
+
+func TestCreateTestRunFromScriptVersion(t *testing.T) {
+	s := newTestStore(t)
+	s.CreateEmployee("emp-1", "Test User")
+	s.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+	s.CreateScriptVersion("sv-1", "regen.art", "TEST \"a\"\nENDTEST", "hash1", "a", "regen", "2.0", "emp-1")
+	v, _ := s.GetScriptVersion("sv-1")
+
+	if err := s.CreateTestRunFromScriptVersion("run-1", "a", "rma-1", "station-01", v); err != nil {
+		t.Fatalf("CreateTestRunFromScriptVersion failed: %v", err)
+	}
+
+	run, err := s.GetTestRun("run-1")
+	if err != nil {
+		t.Fatalf("GetTestRun failed: %v", err)
+	}
+	if run.ScriptVersionID == nil || *run.ScriptVersionID != "sv-1" {
+		t.Error("expected ScriptVersionID sv-1")
+	}
+	if run.ScriptSHA256 == nil || *run.ScriptSHA256 != "hash1" {
+		t.Error("expected ScriptSHA256 hash1")
+	}
+	if run.ReportVersion == nil || *run.ReportVersion != "2.0" {
+		t.Error("expected ReportVersion 2.0")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Telemetry retention tests
+// ---------------------------------------------------------------------------
+
+func insertTempLog(t *testing.T, s *SQLStore, station, stage string, k float64, ts time.Time) {
+	t.Helper()
+	_, err := s.db.Exec(
+		`INSERT INTO temperature_log (station_instance, device_id, stage, temperature_k, timestamp) VALUES (?, 'PUMP-01', ?, ?, ?)`,
+		station, stage, k, ts.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		t.Fatalf("insert temperature_log: %v", err)
+	}
+}
+
+func TestAggregateAndPruneTemperatureLog(t *testing.T) {
+	s := newTestStore(t)
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	insertTempLog(t, s, "station-01", "first_stage", 60, base.Add(5*time.Second))
+	insertTempLog(t, s, "station-01", "first_stage", 70, base.Add(35*time.Second))
+	insertTempLog(t, s, "station-01", "first_stage", 80, base.Add(65*time.Second))
+	// Sub-second timestamps in the cutoff minute must not open its bucket early.
+	insertTempLog(t, s, "station-01", "first_stage", 75, base.Add(60*time.Second+500*time.Millisecond))
+	insertTempLog(t, s, "station-02", "first_stage", 90, base.Add(10*time.Second))
+
+	// station-02 was testing during its sample; that raw row must survive.
+	s.db.Exec(`INSERT INTO test_runs (id, script_name, started_at, finished_at, status, station_instance) VALUES ('run-1', 'x', ?, ?, 'passed', 'station-02')`,
+		base.Format(time.RFC3339Nano), base.Add(time.Minute).Format(time.RFC3339Nano))
+
+	cutoff := base.Add(90 * time.Second) // truncates to 10:01
+	n, err := s.AggregateTemperatureLog(cutoff)
+	if err != nil {
+		t.Fatalf("AggregateTemperatureLog failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+	if n, _ := s.AggregateTemperatureLog(cutoff); n != 0 {
+		t.Errorf("expected re-aggregation to write nothing, got %d", n)
+	}
+
+	aggs, err := s.QueryTemperatureAggregates("station-01", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("QueryTemperatureAggregates failed: %v", err)
+	}
+	if len(aggs) != 1 {
+		t.Fatalf("expected 1 station-01 bucket, got %d", len(aggs))
+	}
+	a := aggs[0]
+	if !a.Bucket.Equal(base) || a.MinK != 60 || a.MaxK != 70 || a.AvgK != 65 || a.Samples != 2 {
+		t.Errorf("unexpected aggregate: %+v", a)
+	}
+
+	pruned, err := s.PruneTemperatureLogOutsideTests(cutoff)
+	if err != nil {
+		t.Fatalf("PruneTemperatureLogOutsideTests failed: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("expected 2 rows pruned, got %d", pruned)
+	}
+	if entries, _ := s.QueryTemperatureLog("station-01", base); len(entries) != 2 {
+		t.Errorf("expected the 10:01 station-01 rows kept, got %d rows", len(entries))
+	}
+	if entries, _ := s.QueryTemperatureLog("station-02", base); len(entries) != 1 {
+		t.Errorf("expected test-run row kept on station-02, got %d rows", len(entries))
+	}
+
+	if removed, _ := s.PruneTelemetryAggregates(base); removed != 0 {
+		t.Errorf("expected no buckets removed before 10:00, got %d", removed)
+	}
+	removed, err := s.PruneTelemetryAggregates(base.Add(500 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("PruneTelemetryAggregates failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 aggregate buckets removed, got %d", removed)
+	}
+
+	// The raw row kept for the test run is not aggregated again on later
+	// passes, even though its bucket has since been pruned.
+	if n, _ := s.AggregateTemperatureLog(cutoff.Add(time.Minute)); n != 1 {
+		t.Errorf("expected only the station-01 10:01 bucket on the next pass, got %d", n)
+	}
+}
+
+func TestAggregatePumpStatusLog(t *testing.T) {
+	s := newTestStore(t)
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, regen := range []string{"A", "B", "C"} {
+		_, err := s.db.Exec(
+			`INSERT INTO pump_status_log (station_instance, device_id, pump_on, rough_valve_open, purge_valve_open, regen_status, timestamp)
+			 VALUES ('station-01', 'PUMP-01', 1, ?, 0, ?, ?)`,
+			i%2, regen, base.Add(time.Duration(i*10)*time.Second).Format(time.RFC3339Nano),
+		)
+		if err != nil {
+			t.Fatalf("insert pump_status_log: %v", err)
+		}
+	}
+
+	n, err := s.AggregatePumpStatusLog(base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("AggregatePumpStatusLog failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 bucket, got %d", n)
+	}
+
+	var samples, pumpOn, rough int
+	var last string
+	s.db.QueryRow(`SELECT samples, pump_on_samples, rough_valve_open_samples, last_regen_status FROM pump_status_log_1m`).
+		Scan(&samples, &pumpOn, &rough, &last)
+	if samples != 3 || pumpOn != 3 || rough != 1 || last != "C" {
+		t.Errorf("unexpected bucket: samples=%d pump_on=%d rough=%d last=%s", samples, pumpOn, rough, last)
+	}
+
+	if pruned, _ := s.PrunePumpStatusLogOutsideTests(base.Add(time.Minute)); pruned != 3 {
+		t.Errorf("expected 3 rows pruned, got %d", pruned)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Search tests
+// ---------------------------------------------------------------------------
+
+func seedSearchData(t *testing.T, s *SQLStore) {
+	t.Helper()
+	s.CreateEmployee("emp-1", "Alice")
+	s.CreateEmployee("emp-2", "Bob")
+	s.CreateRMA("rma-1", "RMA-2024-001", "SN-AAA", "ACME Corp", "CT-8", "emp-1", "cold head rebuilt")
+	s.CreateRMA("rma-2", "RMA-2024-002", "SN-BBB", "Beta Inc", "CT-10", "emp-1", "customer reports leak")
+
+	base := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	runs := []struct {
+		id, script, rma, station, reportType, status, employee string
+		day                                                    int
+	}{
+		{"run-1", "regen.art", "rma-1", "station-01", "regen", "passed", "emp-1", 0},
+		{"run-2", "cooldown.art", "rma-1", "station-02", "cooldown", "failed", "emp-2", 1},
+		{"run-3", "regen.art", "rma-2", "station-01", "regen", "passed", "emp-2", 2},
+	}
+	for _, r := range runs {
+		if err := s.CreateTestRunWithRMA(r.id, r.script, r.rma, r.station, "sha", "content", r.reportType, "1.0"); err != nil {
+			t.Fatalf("create %s: %v", r.id, err)
+		}
+		started := base.AddDate(0, 0, r.day).Format(time.RFC3339Nano)
+		s.db.Exec(`UPDATE test_runs SET started_at = ? WHERE id = ?`, started, r.id)
+		s.RecordTestEvent(r.id, "started", r.employee, "")
+		s.FinishTestRun(r.id, r.status, r.script+" "+r.status)
+	}
+	s.RecordTestEvent("run-2", "terminated", "emp-2", "second stage never reached 20K")
+}
+
+func searchIDs(hits []RunSearchHit) []string {
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func TestSearchTestRunsFilters(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		q    RunSearch
+		want []string
+	}{
+		{"all newest first", RunSearch{}, []string{"run-3", "run-2", "run-1"}},
+		{"status", RunSearch{Status: "passed"}, []string{"run-3", "run-1"}},
+		{"from", RunSearch{From: &from}, []string{"run-3", "run-2"}},
+		{"to", RunSearch{To: &from}, []string{"run-1"}},
+		{"station", RunSearch{Station: "station-01", Sort: "started_at"}, []string{"run-1", "run-3"}},
+		{"script", RunSearch{Script: "cooldown.art"}, []string{"run-2"}},
+		{"report type", RunSearch{ReportType: "regen"}, []string{"run-3", "run-1"}},
+		{"employee", RunSearch{EmployeeID: "emp-2"}, []string{"run-3", "run-2"}},
+		{"pump serial", RunSearch{PumpSerial: "SN-AAA"}, []string{"run-2", "run-1"}},
+		{"pump model", RunSearch{PumpModel: "CT-10"}, []string{"run-3"}},
+		{"rma", RunSearch{RMAID: "rma-1", Status: "failed"}, []string{"run-2"}},
+		{"event text", RunSearch{Query: "stage 20K"}, []string{"run-2"}},
+		{"event prefix", RunSearch{Query: "nev"}, []string{"run-2"}},
+		{"rma notes", RunSearch{Query: "leak"}, []string{"run-3"}},
+		{"rma number", RunSearch{Query: "RMA-2024-001"}, []string{"run-2", "run-1"}},
+		{"summary", RunSearch{Query: "cooldown"}, []string{"run-2"}},
+		{"quotes are literal", RunSearch{Query: `"leak`}, []string{"run-3"}},
+		{"no match", RunSearch{Query: "nonexistent"}, []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hits, total, err := s.SearchTestRuns(tc.q)
+			if err != nil {
+				t.Fatalf("SearchTestRuns failed: %v", err)
+			}
+			if got := searchIDs(hits); !reflect.DeepEqual(got, tc.want) || total != len(tc.want) {
+				t.Errorf("got %v (total %d), want %v", got, total, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchTestRunsPagingAndSort(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+
+	hits, total, err := s.SearchTestRuns(RunSearch{Sort: "script", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchTestRuns failed: %v", err)
+	}
+	if total != 3 || !reflect.DeepEqual(searchIDs(hits), []string{"run-2", "run-1"}) {
+		t.Errorf("page 1: got %v (total %d)", searchIDs(hits), total)
+	}
+	hits, _, _ = s.SearchTestRuns(RunSearch{Sort: "script", Limit: 2, Offset: 2})
+	if !reflect.DeepEqual(searchIDs(hits), []string{"run-3"}) {
+		t.Errorf("page 2: got %v", searchIDs(hits))
+	}
+
+	h := hits[0]
+	if h.RMANumber != "RMA-2024-002" || h.PumpSerialNumber != "SN-BBB" || h.EmployeeID != "emp-2" || h.ScriptContent != nil {
+		t.Errorf("unexpected hit details: %+v", h)
+	}
+
+	if _, _, err := s.SearchTestRuns(RunSearch{Sort: "id; DROP TABLE test_runs"}); err == nil {
+		t.Error("expected error for invalid sort")
+	}
+}
+
+func TestSearchIndexFollowsUpdates(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+
+	if err := s.DeleteTestRun("run-2"); err != nil {
+		t.Fatalf("DeleteTestRun failed: %v", err)
+	}
+	if hits, _, _ := s.SearchTestRuns(RunSearch{Query: "20K"}); len(hits) != 0 {
+		t.Errorf("expected deleted run's events to leave the index, got %v", searchIDs(hits))
+	}
+
+	s.db.Exec(`UPDATE rmas SET notes = 'replaced compressor' WHERE id = 'rma-1'`)
+	rmas, err := s.SearchRMAText("compressor", 0)
+	if err != nil {
+		t.Fatalf("SearchRMAText failed: %v", err)
+	}
+	if len(rmas) != 1 || rmas[0].ID != "rma-1" {
+		t.Errorf("expected rma-1 for updated notes, got %+v", rmas)
+	}
+	if rmas, _ := s.SearchRMAText("rebuilt", 0); len(rmas) != 0 {
+		t.Errorf("expected old notes to leave the index, got %+v", rmas)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Paged list tests
+// ---------------------------------------------------------------------------
+
+func TestQueryTestRunsPageCursor(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+	// run-4 shares run-3's start time, so the cursor must break the tie.
+	s.CreateTestRun("run-4", "leak.art")
+	s.db.Exec(`UPDATE test_runs SET started_at = (SELECT started_at FROM test_runs WHERE id = 'run-3') WHERE id = 'run-4'`)
+
+	var ids []string
+	f := TestRunFilter{Page: Page{Limit: 2}}
+	for pages := 0; ; pages++ {
+		runs, next, err := s.QueryTestRunsPage(f)
+		if err != nil {
+			t.Fatalf("QueryTestRunsPage failed: %v", err)
+		}
+		for _, r := range runs {
+			ids = append(ids, r.ID)
+		}
+		if next == "" {
+			break
+		}
+		if pages > 2 {
+			t.Fatal("paging did not terminate")
+		}
+		f.Cursor = next
+	}
+	if got := strings.Join(ids, ","); got != "run-4,run-3,run-2,run-1" {
+		t.Errorf("unexpected page order: %s", got)
+	}
+
+	since := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	runs, next, err := s.QueryTestRunsPage(TestRunFilter{Station: "station-01", Since: &since})
+	if err != nil || next != "" || len(runs) != 1 || runs[0].ID != "run-3" {
+		t.Errorf("expected run-3 only, got %v %q %v", runs, next, err)
+	}
+
+	runs, _, _ = s.QueryTestRunsPage(TestRunFilter{Page: Page{Offset: 3}})
+	if len(runs) != 1 || runs[0].ID != "run-1" {
+		t.Errorf("expected offset without limit to return run-1, got %v", runs)
+	}
+
+	if _, _, err := s.QueryTestRunsPage(TestRunFilter{Page: Page{Cursor: "not-a-cursor"}}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestListRMAsPageFilters(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+	s.CreateRMA("rma-3", "RMA-2024-003", "SN-CCC", "ACME Corp", "CT-8", "emp-2", "")
+	s.CloseRMA("rma-1")
+
+	rmas, next, err := s.ListRMAsPage(RMAFilter{Customer: "ACME Corp", Page: Page{Limit: 1}})
+	if err != nil || len(rmas) != 1 || rmas[0].ID != "rma-1" || next == "" {
+		t.Fatalf("unexpected first page: %v %q %v", rmas, next, err)
+	}
+	rmas, next, _ = s.ListRMAsPage(RMAFilter{Customer: "ACME Corp", Page: Page{Limit: 1, Cursor: next}})
+	if len(rmas) != 1 || rmas[0].ID != "rma-3" || next != "" {
+		t.Errorf("unexpected last page: %v %q", rmas, next)
+	}
+
+	rmas, _, _ = s.ListRMAsPage(RMAFilter{Status: "open", PumpModel: "CT-8"})
+	if len(rmas) != 1 || rmas[0].ID != "rma-3" {
+		t.Errorf("expected open CT-8 rma-3, got %v", rmas)
+	}
+}
+
+func TestQueryTestEventsPage(t *testing.T) {
+	s := newTestStore(t)
+	seedSearchData(t, s)
+
+	events, next, err := s.QueryTestEventsPage("run-2", TestEventFilter{Page: Page{Limit: 1}})
+	if err != nil || len(events) != 1 || events[0].EventType != "started" || next == "" {
+		t.Fatalf("unexpected first page: %v %q %v", events, next, err)
+	}
+	events, next, _ = s.QueryTestEventsPage("run-2", TestEventFilter{Page: Page{Cursor: next}})
+	if len(events) != 1 || events[0].EventType != "terminated" || next != "" {
+		t.Errorf("unexpected remaining events: %v %q", events, next)
+	}
+
+	events, _, _ = s.QueryTestEventsPage("run-2", TestEventFilter{EventType: "terminated"})
+	if len(events) != 1 || events[0].Reason != "second stage never reached 20K" {
+		t.Errorf("expected terminated event, got %v", events)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Backup tests
+// ---------------------------------------------------------------------------
+
+func TestBackupAndCheckIntegrity(t *testing.T) {
+	s := newTestStore(t)
+	if s.db.dialect != dialectSQLite {
+		t.Skip("online backup is SQLite-only")
+	}
+	s.CreateTestRun("run-1", "test.art")
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := s.Backup(path); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := s.Backup(path); err == nil {
+		t.Error("expected error backing up over an existing file")
+	}
+	if v, err := CheckIntegrity(path); err != nil || v != LatestSchemaVersion() {
+		t.Fatalf("CheckIntegrity = %d, %v", v, err)
+	}
+
+	garbage := filepath.Join(t.TempDir(), "garbage.db")
+	os.WriteFile(garbage, []byte("not a database at all, just some bytes"), 0o644)
+	if _, err := CheckIntegrity(garbage); err == nil {
+		t.Error("expected CheckIntegrity to reject a non-database file")
+	}
+	if _, err := CheckIntegrity(filepath.Join(t.TempDir(), "missing.db")); err == nil {
+		t.Error("expected CheckIntegrity to reject a missing file")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	e, _ := Open(empty)
+	e.db.Exec(`CREATE TABLE other (id INTEGER)`)
+	e.Close()
+	if _, err := CheckIntegrity(empty); err == nil {
+		t.Error("expected CheckIntegrity to reject a database without the arturo schema")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Dialect tests
+// ---------------------------------------------------------------------------
+
+func TestDialectForDSN(t *testing.T) {
+	cases := map[string]dialect{
+		":memory:":                      dialectSQLite,
+		"/var/lib/arturo/arturo.db":     dialectSQLite,
+		"postgres://arturo@db/arturo":   dialectPostgres,
+		"postgresql://arturo@db/arturo": dialectPostgres,
+	}
+	for dsn, want := range cases {
+		if got := dialectForDSN(dsn); got != want {
+			t.Errorf("dialectForDSN(%q) = %v, want %v", dsn, got, want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	q := `SELECT * FROM t WHERE a = ? AND b = '?' AND c LIKE ?`
+	if got := dialectSQLite.rebind(q); got != q {
+		t.Errorf("sqlite rebind changed query: %s", got)
+	}
+	want := `SELECT * FROM t WHERE a = $1 AND b = '?' AND c LIKE $2`
+	if got := dialectPostgres.rebind(q); got != want {
+		t.Errorf("postgres rebind:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	cases := map[string]string{
+		"SN-100":   `%sn-100%`,
+		"100%":     `%100\%%`,
+		"a_b":      `%a\_b%`,
+		`C:\pumps`: `%c:\\pumps%`,
+	}
+	for text, want := range cases {
+		if got := likePattern(text); got != want {
+			t.Errorf("likePattern(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	// The escape clause's quoted backslash does not hide later placeholders.
+	q := `a LIKE ? ESCAPE '\' OR b LIKE ? ESCAPE '\'`
+	if got, want := dialectPostgres.rebind(q), `a LIKE $1 ESCAPE '\' OR b LIKE $2 ESCAPE '\'`; got != want {
+		t.Errorf("postgres rebind:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPostgresDDL(t *testing.T) {
+	got := dialectPostgres.ddl(`CREATE TABLE x (id INTEGER PRIMARY KEY AUTOINCREMENT, k REAL NOT NULL, ts TEXT NOT NULL)`)
+	want := `CREATE TABLE x (id BIGSERIAL PRIMARY KEY, k DOUBLE PRECISION NOT NULL, ts TEXT COLLATE "C" NOT NULL)`
+	if got != want {
+		t.Errorf("ddl:\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,343 @@
+// Package streams carries protocol messages over Redis Streams. Commands
+// are appended to a per-station stream that the station reads as a consumer
+// group member, so a command sent while the station is reconnecting waits
+// for it instead of being lost, and one it was handling when it restarted
+// is delivered again. Responses are appended to the requester's stream,
+// where every reader sees them in order.
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Field is the stream entry field holding the JSON message.
+	Field = "message"
+	// StationGroup is the consumer group stations read their command
+	// stream with; the consumer name is the station instance.
+	StationGroup = "station"
+	// ControllerGroup is the consumer group requesters (the controller, the
+	// engine CLI) read their response stream with.
+	ControllerGroup = "controller"
+	// MaxLen bounds each stream to about this many entries.
+	MaxLen = 1000
+	// DedupTTL is how long a station remembers a correlation ID it has
+	// executed.
+	DedupTTL = 10 * time.Minute
+)
+
+// expiryGrace allows for clock skew between the sender and the station,
+// and for the one-second resolution of envelope timestamps.
+const expiryGrace = 2 * time.Second
+
+// CommandStream returns a station's command stream.
+func CommandStream(instance string) string { return "commands:" + instance }
+
+// ResponseStream returns the response stream of a requester instance.
+func ResponseStream(instance string) string { return "responses:" + instance }
+
+// DedupKey returns the key marking that a station executed a command.
+func DedupKey(instance, correlationID string) string {
+	return "dedup:" + instance + ":" + correlationID
+}
+
+// Message is one stream entry.
+type Message struct {
+	ID   string
+	Data []byte
+}
+
+// Send appends a message to a station's command stream. It creates the
+// stations' consumer group first, in the same round trip, so the entry is
+// delivered even if the station has never read the stream.
+func Send(ctx context.Context, rdb redis.Cmdable, stream string, data []byte) (string, error) {
+	pipe := rdb.Pipeline()
+	create := pipe.XGroupCreateMkStream(ctx, stream, StationGroup, "0")
+	add := pipe.XAdd(ctx, xaddArgs(stream, data))
+	pipe.Exec(ctx)
+	if err := create.Err(); err != nil && !isBusyGroup(err) {
+		return "", fmt.Errorf("XGROUP CREATE %s: %w", stream, err)
+	}
+	id, err := add.Result()
+	if err != nil {
+		return "", fmt.Errorf("XADD %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+// Reply appends a response to a requester's stream.
+func Reply(ctx context.Context, rdb redis.Cmdable, stream string, data []byte) (string, error) {
+	id, err := rdb.XAdd(ctx, xaddArgs(stream, data)).Result()
+	if err != nil {
+		return "", fmt.Errorf("XADD %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+func xaddArgs(stream string, data []byte) *redis.XAddArgs {
+	return &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: MaxLen,
+		Approx: true,
+		Values: []any{Field, string(data)},
+	}
+}
+
+func isBusyGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP")
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+// Consumer reads a stream as one member of a consumer group. Entries are
+// pending until acknowledged; after a restart or reconnect the consumer
+// first re-reads its own pending entries.
+type Consumer struct {
+	rdb    redis.Cmdable
+	stream string
+	group  string
+	name   string
+	start  string
+
+	// Block is how long Read waits for new entries.
+	Block time.Duration
+	// Count is the most entries Read returns.
+	Count int64
+
+	recovering bool
+}
+
+// NewConsumer returns a consumer of stream. If the group does not exist it
+// is created to start at start: "0" for the whole stream, "$" for entries
+// added from now on.
+func NewConsumer(rdb redis.Cmdable, stream, group, name, start string) *Consumer {
+	return &Consumer{
+		rdb:        rdb,
+		stream:     stream,
+		group:      group,
+		name:       name,
+		start:      start,
+		Block:      5 * time.Second,
+		Count:      10,
+		recovering: true,
+	}
+}
+
+// Stream returns the name of the stream the consumer reads.
+func (c *Consumer) Stream() string {
+	return c.stream
+}
+
+// Recover makes the next Read return this consumer's pending entries
+// before new ones. Call it after a connection error.
+func (c *Consumer) Recover() {
+	c.recovering = true
+}
+
+// Read returns the next entries, or none if Block elapses. Entries that
+// were trimmed from the stream while pending are acknowledged and skipped.
+func (c *Consumer) Read(ctx context.Context) ([]Message, error) {
+	if c.recovering {
+		msgs, err := c.read(ctx, "0", -1)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+		c.recovering = false
+	}
+	return c.read(ctx, ">", c.Block)
+}
+
+func (c *Consumer) read(ctx context.Context, id string, block time.Duration) ([]Message, error) {
+	args := &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.name,
+		Streams:  []string{c.stream, id},
+		Count:    c.Count,
+		Block:    block,
+	}
+	res, err := c.rdb.XReadGroup(ctx, args).Result()
+	if isNoGroup(err) {
+		if err := CreateGroup(ctx, c.rdb, c.stream, c.group, c.start); err != nil {
+			return nil, err
+		}
+		res, err = c.rdb.XReadGroup(ctx, args).Result()
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("XREADGROUP %s: %w", c.stream, err)
+	}
+
+	var msgs []Message
+	for _, s := range res {
+		for _, m := range s.Messages {
+			data, ok := m.Values[Field].(string)
+			if !ok {
+				// Trimmed while pending, or not ours: nothing to deliver.
+				c.Ack(ctx, m.ID)
+				continue
+			}
+			msgs = append(msgs, Message{ID: m.ID, Data: []byte(data)})
+		}
+	}
+	return msgs, nil
+}
+
+// CreateGroup creates group on stream (and the stream itself) starting at
+// start, unless it already exists. Consumers create their group on first
+// read; a short-lived requester calls this before sending its first command
+// so a response added before the listener's first read is not skipped.
+func CreateGroup(ctx context.Context, rdb redis.Cmdable, stream, group, start string) error {
+	if err := rdb.XGroupCreateMkStream(ctx, stream, group, start).Err(); err != nil && !isBusyGroup(err) {
+		return fmt.Errorf("XGROUP CREATE %s: %w", stream, err)
+	}
+	return nil
+}
+
+// Ack marks an entry as processed.
+func (c *Consumer) Ack(ctx context.Context, id string) error {
+	return c.rdb.XAck(ctx, c.stream, c.group, id).Err()
+}
+
+// Tail reads every entry added to a stream after a starting ID, without a
+// consumer group, so any number of readers each see every entry.
+type Tail struct {
+	rdb    redis.Cmdable
+	stream string
+	last   string
+
+	// Block is how long Read waits for new entries.
+	Block time.Duration
+}
+
+// NewTail returns a reader of the entries of stream after ID after ("$"
+// for entries added from now on).
+func NewTail(rdb redis.Cmdable, stream, after string) *Tail {
+	return &Tail{rdb: rdb, stream: stream, last: after, Block: 5 * time.Second}
+}
+
+// Read returns the next entries, or none if Block elapses.
+func (t *Tail) Read(ctx context.Context) ([]Message, error) {
+	res, err := t.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{t.stream, t.last},
+		Count:   100,
+		Block:   t.Block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("XREAD %s: %w", t.stream, err)
+	}
+	var msgs []Message
+	for _, s := range res {
+		for _, m := range s.Messages {
+			t.last = m.ID
+			if data, ok := m.Values[Field].(string); ok {
+				msgs = append(msgs, Message{ID: m.ID, Data: []byte(data)})
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// Request sends a command to a station's command stream and waits up to
+// timeout for the response with its correlation ID on its reply_to stream.
+func Request(ctx context.Context, rdb redis.Cmdable, stream string, msg *protocol.Message, timeout time.Duration) (*protocol.Message, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message: %w", err)
+	}
+	id, err := Send(ctx, rdb, stream, data)
+	if err != nil {
+		return nil, err
+	}
+
+	replyTo := msg.Envelope.ReplyTo
+	correlationID := msg.Envelope.CorrelationID
+	tail := NewTail(rdb, replyTo, Before(id))
+	deadline := time.Now().Add(timeout)
+	for {
+		// BLOCK 0 would wait forever, so stop short of a millisecond.
+		remaining := time.Until(deadline)
+		if remaining < time.Millisecond {
+			return nil, fmt.Errorf("timeout waiting for response on %s (correlation_id=%s)", replyTo, correlationID)
+		}
+		tail.Block = min(remaining, time.Second)
+		msgs, err := tail.Read(ctx)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			resp, err := protocol.Parse(m.Data)
+			if err == nil && resp.Envelope.CorrelationID == correlationID {
+				return resp, nil
+			}
+		}
+	}
+}
+
+// Before returns the stream ID just before the millisecond of id. Entry
+// IDs come from the server clock, so reading another stream on the same
+// server from Before(id) sees every entry added since id was.
+func Before(id string) string {
+	msPart, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil || ms == 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("%d-%d", ms-1, uint64(math.MaxUint64))
+}
+
+// Claim records that a station is executing a command, reporting false if
+// it already has: a redelivered command is then acknowledged without being
+// executed again.
+func Claim(ctx context.Context, rdb redis.Cmdable, instance, correlationID string) (bool, error) {
+	return rdb.SetNX(ctx, DedupKey(instance, correlationID), "1", DedupTTL).Result()
+}
+
+// Expired reports whether the sender of a command or batch request has
+// stopped waiting for its response. Stations drop such commands rather than
+// act on them late, for example after being offline.
+func Expired(msg *protocol.Message, now time.Time) bool {
+	var timeoutMs *int
+	switch msg.Envelope.Type {
+	case protocol.TypeDeviceCommandRequest:
+		req, err := protocol.ParseCommandRequest(msg)
+		if err != nil {
+			return false
+		}
+		timeoutMs = req.TimeoutMs
+	case protocol.TypeDeviceCommandBatchRequest:
+		req, err := protocol.ParseBatchRequest(msg)
+		if err != nil {
+			return false
+		}
+		timeoutMs = req.TimeoutMs
+	default:
+		return false
+	}
+	if timeoutMs == nil || *timeoutMs <= 0 {
+		return false
+	}
+	deadline := time.Unix(msg.Envelope.Timestamp, 0).
+		Add(time.Duration(*timeoutMs) * time.Millisecond).
+		Add(expiryGrace)
+	return now.After(deadline)
+}
@@ -0,0 +1,160 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBefore(t *testing.T) {
+	cases := map[string]string{
+		"1700000000123-0": "1700000000122-18446744073709551615",
+		"1700000000123-7": "1700000000122-18446744073709551615",
+		"0-1":             "0-0",
+		"garbage":         "0-0",
+	}
+	for id, want := range cases {
+		if got := Before(id); got != want {
+			t.Errorf("Before(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	src := protocol.Source{Service: "test", Instance: "t-01", Version: "1.0.0"}
+	msg, err := protocol.BuildCommandRequest(src, "pump-01", "get_status", nil, 5000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := time.Unix(msg.Envelope.Timestamp, 0)
+	if Expired(msg, sent.Add(4*time.Second)) {
+		t.Error("command expired before its timeout")
+	}
+	if !Expired(msg, sent.Add(time.Minute)) {
+		t.Error("command not expired a minute after a 5s timeout")
+	}
+
+	batch, err := protocol.BuildBatchRequest(src, []protocol.BatchCommand{{DeviceID: "pump-01", CommandName: "get_status"}}, 15000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent = time.Unix(batch.Envelope.Timestamp, 0)
+	if Expired(batch, sent.Add(10*time.Second)) {
+		t.Error("batch expired before its timeout")
+	}
+	if !Expired(batch, sent.Add(time.Minute)) {
+		t.Error("batch not expired a minute after a 15s timeout")
+	}
+
+	// Messages without a timeout, such as test state updates, never expire.
+	other := &protocol.Message{Envelope: protocol.Envelope{Type: "test.state.update", Timestamp: 1}, Payload: json.RawMessage(`{}`)}
+	if Expired(other, time.Now()) {
+		t.Error("test.state.update should not expire")
+	}
+}
+
+// newTestClient returns a client for a local Redis, skipping the test if
+// none is running.
+func newTestClient(t *testing.T) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DialTimeout: 200 * time.Millisecond})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		t.Skip("Redis not available at localhost:6379")
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestCommandDelivery(t *testing.T) {
+	rdb := newTestClient(t)
+	ctx := context.Background()
+	instance := "test-" + uuid.NewString()[:8]
+	stream := CommandStream(instance)
+	defer rdb.Del(ctx, stream)
+
+	// Sent before the station ever connected: still delivered.
+	for i := 0; i < 3; i++ {
+		if _, err := Send(ctx, rdb, stream, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewConsumer(rdb, stream, StationGroup, instance, "0")
+	c.Block = 100 * time.Millisecond
+	msgs, err := c.Read(ctx)
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("first read: %v, %d messages", err, len(msgs))
+	}
+	c.Ack(ctx, msgs[0].ID)
+
+	// A restarted station gets back the two it did not acknowledge.
+	restarted := NewConsumer(rdb, stream, StationGroup, instance, "0")
+	restarted.Block = 100 * time.Millisecond
+	msgs, err = restarted.Read(ctx)
+	if err != nil || len(msgs) != 2 || string(msgs[0].Data) != `{"n":1}` {
+		t.Fatalf("recovery read: %v, %+v", err, msgs)
+	}
+	for _, m := range msgs {
+		restarted.Ack(ctx, m.ID)
+	}
+	if msgs, err = restarted.Read(ctx); err != nil || len(msgs) != 0 {
+		t.Fatalf("expected nothing left, got %v, %+v", err, msgs)
+	}
+}
+
+func TestReplyAndTail(t *testing.T) {
+	rdb := newTestClient(t)
+	ctx := context.Background()
+	instance := "test-" + uuid.NewString()[:8]
+	cmds, resps := CommandStream(instance), ResponseStream(instance)
+	defer rdb.Del(ctx, cmds, resps)
+
+	Reply(ctx, rdb, resps, []byte(`{"old":true}`))
+	id, err := Send(ctx, rdb, cmds, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Reply(ctx, rdb, resps, []byte(`{"new":true}`))
+
+	tail := NewTail(rdb, resps, Before(id))
+	tail.Block = 100 * time.Millisecond
+	msgs, err := tail.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reply added before the command may or may not share its
+	// millisecond; the one after must be seen.
+	if len(msgs) == 0 || string(msgs[len(msgs)-1].Data) != `{"new":true}` {
+		t.Fatalf("unexpected tail %+v", msgs)
+	}
+}
+
+func TestTrimAndClaim(t *testing.T) {
+	rdb := newTestClient(t)
+	ctx := context.Background()
+	instance := "test-" + uuid.NewString()[:8]
+	stream := CommandStream(instance)
+	defer rdb.Del(ctx, stream, DedupKey(instance, "corr-1"))
+
+	for i := 0; i < MaxLen*3/2; i++ {
+		Send(ctx, rdb, stream, []byte(`{}`))
+	}
+	// Approximate trimming removes whole nodes, so allow some slack.
+	if n := rdb.XLen(ctx, stream).Val(); n > MaxLen+200 {
+		t.Errorf("stream not trimmed: %d entries", n)
+	}
+
+	if first, err := Claim(ctx, rdb, instance, "corr-1"); err != nil || !first {
+		t.Fatalf("first claim = %v, %v", first, err)
+	}
+	if again, _ := Claim(ctx, rdb, instance, "corr-1"); again {
+		t.Error("second claim of the same correlation ID succeeded")
+	}
+}
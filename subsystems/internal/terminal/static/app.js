@@ -20,14 +20,18 @@ var App = (function() {
         detailRMA: null,      // currently viewing RMA ID
         startTestStation: null,
         startTestRMAId: null,
+        startTestScripts: [],  // GET /scripts result backing the script picker
         tempChartData: { timestamps: [], first: [], second: [] },
         tempWindowHours: loadTempWindowHours(), // hours preset: 1, 2, 4, 8, or null = autorange (persisted in localStorage)
         userZoom: null,         // {x0, x1, y0, y1} when user drags a zoom region
         rmaRunSelections: {},   // runID -> boolean (include in report)
-        rmaStatusFilter: 'open' // RMA filter: '', 'open', 'closed'
+        rmaStatusFilter: 'open', // RMA filter: '', 'open', 'closed'
+        historyOffset: 0,       // GET /search offset for the history view
+        historySeq: 0           // discards responses from superseded searches
     };
 
     var MAX_CHART_POINTS = 17280; // 12 hours at 5s intervals, 2 stages interleaved
+    var HISTORY_PAGE_SIZE = 50;
 
     // =================================================================
     // Theme
@@ -224,12 +228,22 @@ var App = (function() {
     // =================================================================
     // API
     // =================================================================
+    // withToken adds the session token to a download URL opened in a new
+    // tab, which cannot carry the Authorization header.
+    function withToken(url) {
+        if (!state.employee || !state.employee.token) return url;
+        return url + (url.indexOf('?') < 0 ? '?' : '&') + 'token=' + encodeURIComponent(state.employee.token);
+    }
+
     function api(method, url, body, cb) {
         var xhr = new XMLHttpRequest();
         xhr.open(method, url, true);
         xhr.setRequestHeader('Accept', 'application/json');
         if (state.employee) {
             xhr.setRequestHeader('X-Employee-ID', state.employee.id);
+            if (state.employee.token) {
+                xhr.setRequestHeader('Authorization', 'Bearer ' + state.employee.token);
+            }
         }
         if (body) {
             xhr.setRequestHeader('Content-Type', 'application/json');
@@ -242,6 +256,10 @@ var App = (function() {
                         cb(null, data);
                     } catch(e) { cb(null, null); }
                 } else {
+                    // Session expired or revoked: back to the login screen.
+                    if (xhr.status === 401 && state.employee && url !== '/auth/login') {
+                        logout();
+                    }
                     var errMsg = 'HTTP ' + xhr.status;
                     try {
                         var ed = JSON.parse(xhr.responseText);
@@ -275,6 +293,8 @@ var App = (function() {
             loadRMAs();
         } else if (name === 'rma-detail' && state.detailRMA) {
             loadRMADetail(state.detailRMA);
+        } else if (name === 'history') {
+            loadHistory();
         }
     }
 
@@ -283,25 +303,33 @@ var App = (function() {
     // =================================================================
     function login() {
         var empId = document.getElementById('login-employee-id').value.trim();
-        var name = document.getElementById('login-name').value.trim();
-        if (!empId || !name) {
-            showError('login-error', 'Employee ID and Name are required');
+        var pwEl = document.getElementById('login-password');
+        if (!empId || !pwEl.value) {
+            showError('login-error', 'Employee ID and PIN are required');
             return;
         }
-        api('POST', '/auth/login', { employee_id: empId, name: name }, function(err, data) {
-            if (err) {
-                showError('login-error', err.message);
+        api('POST', '/auth/login', { employee_id: empId, password: pwEl.value }, function(err, data) {
+            pwEl.value = '';
+            if (err || !data || !data.employee) {
+                showError('login-error', err ? err.message : 'Login failed');
                 return;
             }
-            state.employee = { id: empId, name: name };
-            document.getElementById('employee-name').textContent = name;
-            showView('stations');
-            connectWebSocket();
+            startSession(data);
         });
     }
 
+    // startSession records a login response from /auth/login or a badge scan.
+    function startSession(data) {
+        showError('login-error', '');
+        state.employee = { id: data.employee.ID, name: data.employee.Name, role: data.employee.Role, token: data.token || '' };
+        document.getElementById('employee-name').textContent = data.employee.Name;
+        showView('stations');
+        connectWebSocket();
+    }
+
     function logout() {
         state.employee = null;
+        if (ws) ws.close();
         showView('login');
     }
 
@@ -873,7 +901,7 @@ var App = (function() {
         }
         if (params.length) url += '?' + params.join('&');
 
-        window.open(url, '_blank');
+        window.open(withToken(url), '_blank');
     }
 
     // =================================================================
@@ -924,27 +952,34 @@ var App = (function() {
                 grid.innerHTML = '<div class="empty-state">No scripts found</div>';
                 return;
             }
+            state.startTestScripts = data;
             var html = '';
             for (var i = 0; i < data.length; i++) {
-                html += '<button class="start-test-btn" onclick="App.selectScriptForTest(\'' + escapeHtml(data[i].path) + '\')">';
-                html += '<div class="start-test-btn-title">' + escapeHtml(scriptLabel(data[i].name)) + '</div>';
+                var label = scriptLabel(data[i].name);
+                if (data[i].version) label += ' v' + data[i].version;
+                html += '<button class="start-test-btn" onclick="App.selectScriptForTest(' + i + ')">';
+                html += '<div class="start-test-btn-title">' + escapeHtml(label) + '</div>';
+                if (data[i].report_type) {
+                    html += '<div class="start-test-btn-detail">' + escapeHtml(data[i].report_type + ' ' + (data[i].report_version || '')) + '</div>';
+                }
                 html += '</button>';
             }
             grid.innerHTML = html;
         });
     }
 
-    function selectScriptForTest(scriptPath) {
+    function selectScriptForTest(index) {
         var instance = state.startTestStation;
         var rmaId = state.startTestRMA;
+        var script = state.startTestScripts[index];
+        if (!script) return;
 
         var ps = state.stationPumpStatus[instance];
         var deviceId = ps ? ps.device_id : '';
-        api('POST', '/stations/' + encodeURIComponent(instance) + '/test/start', {
-            rma_id: rmaId,
-            script_path: scriptPath,
-            device_id: deviceId
-        }, function(err) {
+        var body = { rma_id: rmaId, device_id: deviceId };
+        if (script.version_id) body.script_version_id = script.version_id;
+        else body.script_path = script.path;
+        api('POST', '/stations/' + encodeURIComponent(instance) + '/test/start', body, function(err) {
             if (err) { showError('start-test-error', err.message); backToRMASelect(); return; }
             closeModal('start-test-modal');
             loadStationDetail(instance);
@@ -1009,7 +1044,12 @@ var App = (function() {
         if (ps) { ps.pump_on = !ps.pump_on; handlePumpStatus(ps); }
         api('POST', '/stations/' + encodeURIComponent(instance) + '/command', {
             device_id: deviceId, command: cmd
-        }, function(){});
+        }, function(err) {
+            if (!err) return;
+            // Refused (operators may only query) or failed: undo the toggle.
+            if (ps) { ps.pump_on = !ps.pump_on; handlePumpStatus(ps); }
+            showToast(cmd + ': ' + err.message, 'error');
+        });
     }
 
     function toggleRoughValve(instance, deviceId) {
@@ -1018,7 +1058,12 @@ var App = (function() {
         if (ps) { ps.rough_valve_open = !ps.rough_valve_open; handlePumpStatus(ps); }
         api('POST', '/stations/' + encodeURIComponent(instance) + '/command', {
             device_id: deviceId, command: cmd
-        }, function(){});
+        }, function(err) {
+            if (!err) return;
+            // Refused (operators may only query) or failed: undo the toggle.
+            if (ps) { ps.rough_valve_open = !ps.rough_valve_open; handlePumpStatus(ps); }
+            showToast(cmd + ': ' + err.message, 'error');
+        });
     }
 
     function togglePurgeValve(instance, deviceId) {
@@ -1027,7 +1072,12 @@ var App = (function() {
         if (ps) { ps.purge_valve_open = !ps.purge_valve_open; handlePumpStatus(ps); }
         api('POST', '/stations/' + encodeURIComponent(instance) + '/command', {
             device_id: deviceId, command: cmd
-        }, function(){});
+        }, function(err) {
+            if (!err) return;
+            // Refused (operators may only query) or failed: undo the toggle.
+            if (ps) { ps.purge_valve_open = !ps.purge_valve_open; handlePumpStatus(ps); }
+            showToast(cmd + ': ' + err.message, 'error');
+        });
     }
 
     function toggleRegen(instance, deviceId) {
@@ -1036,7 +1086,12 @@ var App = (function() {
         if (ps) { ps.regen = !ps.regen; handlePumpStatus(ps); }
         api('POST', '/stations/' + encodeURIComponent(instance) + '/command', {
             device_id: deviceId, command: cmd
-        }, function(){});
+        }, function(err) {
+            if (!err) return;
+            // Refused (operators may only query) or failed: undo the toggle.
+            if (ps) { ps.regen = !ps.regen; handlePumpStatus(ps); }
+            showToast(cmd + ': ' + err.message, 'error');
+        });
     }
 
     // CTI OnBoard command vocabulary grouped for touch grid
@@ -1284,11 +1339,11 @@ var App = (function() {
             // API returns {"rma": {...}, "runs": [...]}
             var rma = data && data.rma ? data.rma : data;
             var runs = data && data.runs ? data.runs : [];
-            renderRMADetail(rma, runs);
+            renderRMADetail(rma, runs, (data && data.reviews) || {});
         });
     }
 
-    function renderRMADetail(rma, runs) {
+    function renderRMADetail(rma, runs, reviews) {
         if (!rma) return;
         document.getElementById('rma-detail-number').textContent = rma.RMANumber || '--';
 
@@ -1343,6 +1398,11 @@ var App = (function() {
                     ' onchange="App.toggleRunInclude(\'' + escapeHtml(run.ID) + '\', this.checked)">';
                 html += '<span class="check-label">Include in report</span>';
                 html += '</label>';
+                var review = reviews[run.ID] || 'pending';
+                if (status === 'open' && run.Status !== 'running' && canSign()) {
+                    html += '<button class="btn-csv" onclick="event.stopPropagation(); App.signRun(\'' + escapeHtml(rma.ID) + '\', \'' + escapeHtml(run.ID) + '\')" title="Sign">Sign</button>';
+                }
+                html += '<span class="run-review ' + escapeHtml(review) + '" title="Review">' + escapeHtml(review) + '</span>';
                 html += '<span class="test-run-status ' + escapeHtml(statusClass) + '">' + (statusClass.charAt(0).toUpperCase() + statusClass.slice(1)) + '</span>';
                 html += '</div>';
                 html += '<div class="test-run-events" id="run-events-' + escapeHtml(run.ID) + '" style="display:none"></div>';
@@ -1355,8 +1415,10 @@ var App = (function() {
     }
 
     function toggleTestRunEvents(el, testRunId) {
-        var eventsDiv = document.getElementById('run-events-' + testRunId);
-        if (!eventsDiv) return;
+        // The events panel follows its run row; the same run can be listed
+        // in both the RMA detail and history views.
+        var eventsDiv = el.nextElementSibling;
+        if (!eventsDiv || !eventsDiv.classList.contains('test-run-events')) return;
         if (eventsDiv.style.display !== 'none') {
             eventsDiv.style.display = 'none';
             return;
@@ -1385,6 +1447,88 @@ var App = (function() {
         });
     }
 
+    // =================================================================
+    // Test History
+    // =================================================================
+    function searchHistory() {
+        state.historyOffset = 0;
+        loadHistory();
+    }
+
+    function historyPage(dir) {
+        state.historyOffset = Math.max(0, state.historyOffset + dir * HISTORY_PAGE_SIZE);
+        loadHistory();
+    }
+
+    function loadHistory() {
+        var fields = {
+            status: 'history-status', from: 'history-from', station: 'history-station',
+            pump_serial: 'history-serial', pump_model: 'history-model', sort: 'history-sort'
+        };
+        var params = [];
+        for (var key in fields) {
+            var v = document.getElementById(fields[key]).value.trim();
+            if (v) params.push(key + '=' + encodeURIComponent(v));
+        }
+        var q = document.getElementById('history-q').value.trim();
+        if (q.length >= 2) params.push('q=' + encodeURIComponent(q));
+        // The date picker's "to" day is inclusive; the API's is exclusive.
+        var to = document.getElementById('history-to').value;
+        if (to) {
+            var d = new Date(to + 'T00:00:00Z');
+            d.setUTCDate(d.getUTCDate() + 1);
+            params.push('to=' + d.toISOString().slice(0, 10));
+        }
+        params.push('limit=' + HISTORY_PAGE_SIZE, 'offset=' + state.historyOffset);
+
+        var seq = ++state.historySeq;
+        api('GET', '/search?' + params.join('&'), null, function(err, data) {
+            if (seq !== state.historySeq) return;
+            if (err || !data || !Array.isArray(data.runs)) {
+                document.getElementById('history-runs').innerHTML = '<div class="empty-state">Search failed</div>';
+                return;
+            }
+            renderHistory(data);
+        });
+    }
+
+    function renderHistory(data) {
+        var listEl = document.getElementById('history-runs');
+        var first = data.total === 0 ? 0 : data.offset + 1;
+        var last = data.offset + data.runs.length;
+        document.getElementById('history-count').textContent = data.total + ' runs';
+        document.getElementById('history-page').textContent = first + '\u2013' + last + ' of ' + data.total;
+        document.getElementById('history-prev').disabled = data.offset === 0;
+        document.getElementById('history-next').disabled = last >= data.total;
+
+        if (data.runs.length === 0) {
+            listEl.innerHTML = '<div class="empty-state">No test runs found</div>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < data.runs.length; i++) {
+            var run = data.runs[i];
+            var statusClass = run.Status || 'error';
+            html += '<div class="test-run-item ' + escapeHtml(statusClass) + '" onclick="App.toggleTestRunEvents(this, \'' + escapeHtml(run.ID) + '\')" style="cursor:pointer">';
+            html += '<div class="test-run-info">';
+            html += '<div class="test-run-script">' + escapeHtml(scriptLabel(run.ScriptName)) + '</div>';
+            html += '<div class="test-run-meta">';
+            html += '<span>' + formatDateTime(run.StartedAt) + '</span>';
+            if (run.StationInstance) html += '<span>' + escapeHtml(run.StationInstance) + '</span>';
+            if (run.RMANumber) {
+                html += '<span class="test-run-rma" onclick="event.stopPropagation(); App.openRMA(\'' + escapeHtml(run.RMAID) + '\')">' + escapeHtml(run.RMANumber) + '</span>';
+            }
+            if (run.PumpSerialNumber) html += '<span>' + escapeHtml(run.PumpSerialNumber) + '</span>';
+            if (run.EmployeeID) html += '<span>' + escapeHtml(run.EmployeeID) + '</span>';
+            if (run.Summary) html += '<span>' + escapeHtml(run.Summary) + '</span>';
+            html += '</div></div>';
+            html += '<span class="test-run-status ' + escapeHtml(statusClass) + '">' + (statusClass.charAt(0).toUpperCase() + statusClass.slice(1)) + '</span>';
+            html += '</div>';
+            html += '<div class="test-run-events" style="display:none"></div>';
+        }
+        listEl.innerHTML = html;
+    }
+
     function createRMA() {
         var rmaNumber = document.getElementById('rma-rma-number').value.trim();
         var serial = document.getElementById('rma-serial').value.trim();
@@ -1443,6 +1587,41 @@ var App = (function() {
         );
     }
 
+    // canSign reports whether the logged-in employee may sign test runs.
+    function canSign() {
+        var role = state.employee && state.employee.role;
+        return role === 'engineer' || role === 'admin';
+    }
+
+    function signRun(rmaId, runId) {
+        state.signRun = { rma: rmaId, run: runId };
+        document.getElementById('sign-run-label').textContent = 'Test ID ' + runId + '. Your signature is recorded with a hash of the results.';
+        document.getElementById('sign-meaning').value = 'approved';
+        document.getElementById('sign-reason').value = '';
+        document.getElementById('sign-password').value = '';
+        openModal('sign-modal');
+        document.getElementById('sign-password').focus();
+    }
+
+    function confirmSignRun() {
+        var target = state.signRun;
+        if (!target) return;
+        api('POST', '/test-runs/' + encodeURIComponent(target.run) + '/signatures', {
+            meaning: document.getElementById('sign-meaning').value,
+            reason: document.getElementById('sign-reason').value.trim(),
+            password: document.getElementById('sign-password').value
+        }, function(err) {
+            document.getElementById('sign-password').value = '';
+            if (err) {
+                showToast('Signature failed: ' + err.message, 'error');
+                return;
+            }
+            closeModal('sign-modal');
+            showToast('Signature recorded', 'success');
+            loadRMADetail(target.rma);
+        });
+    }
+
     function toggleRunInclude(runId, checked) {
         state.rmaRunSelections[runId] = checked;
     }
@@ -1475,17 +1654,17 @@ var App = (function() {
     function downloadArtifact(id) {
         var ids = getSelectedRunIDs();
         var url = '/rmas/' + encodeURIComponent(id) + '/artifact?runs=' + ids.map(encodeURIComponent).join(',');
-        window.open(url, '_blank');
+        window.open(withToken(url), '_blank');
     }
 
     function downloadPDF(id) {
         var ids = getSelectedRunIDs();
         var url = '/rmas/' + encodeURIComponent(id) + '/pdf?runs=' + ids.map(encodeURIComponent).join(',');
-        window.open(url, '_blank');
+        window.open(withToken(url), '_blank');
     }
 
     function downloadRunCSV(rmaId, runId) {
-        window.open('/rmas/' + encodeURIComponent(rmaId) + '/runs/' + encodeURIComponent(runId) + '/csv', '_blank');
+        window.open(withToken('/rmas/' + encodeURIComponent(rmaId) + '/runs/' + encodeURIComponent(runId) + '/csv'), '_blank');
     }
 
 
@@ -1535,6 +1714,70 @@ var App = (function() {
         openModal('confirm-dialog');
     }
 
+    // =================================================================
+    // Barcode Scanner
+    // =================================================================
+    // The scanner is a keyboard wedge: it types the barcode much faster than
+    // a person and ends with Enter. Bursts like that are sent to POST /scan
+    // instead of the focused field.
+    var SCAN_MAX_GAP_MS = 50;
+    var SCAN_MIN_LENGTH = 4;
+    var scanBuffer = '';
+    var scanLastKey = 0;
+
+    function onScanKey(e) {
+        var now = Date.now();
+        if (now - scanLastKey > SCAN_MAX_GAP_MS) scanBuffer = '';
+        scanLastKey = now;
+
+        if (e.key === 'Enter') {
+            var payload = scanBuffer;
+            scanBuffer = '';
+            if (payload.length < SCAN_MIN_LENGTH) return;
+            e.preventDefault();
+            e.stopImmediatePropagation();
+            // Take back what the scanner typed into the focused field.
+            var el = document.activeElement;
+            if (el && (el.tagName === 'INPUT' || el.tagName === 'TEXTAREA') && el.value.slice(-payload.length) === payload) {
+                el.value = el.value.slice(0, -payload.length);
+            }
+            submitScan(payload);
+        } else if (e.key.length === 1) {
+            scanBuffer += e.key;
+        }
+    }
+
+    function submitScan(payload) {
+        api('POST', '/scan', { payload: payload }, function(err, data) {
+            if (err || !data) {
+                if (state.currentView === 'login') showError('login-error', err ? err.message : 'Scan failed');
+                else showToast('Scan: ' + (err ? err.message : 'failed'), 'error');
+                return;
+            }
+            if (data.kind === 'badge') {
+                startSession(data);
+                return;
+            }
+            if (!state.employee) {
+                showError('login-error', 'Scan your badge to log in first');
+                return;
+            }
+            if (data.rma) {
+                if (data.created) showToast('Created ' + data.rma.RMANumber + ' from work order', 'success');
+                openRMA(data.rma.ID);
+            } else if (data.kind === 'pump_serial') {
+                var rmas = data.rmas || [];
+                if (rmas.length === 1) {
+                    openRMA(rmas[0].ID);
+                } else {
+                    showView('rma-list');
+                    document.getElementById('rma-search-input').value = data.fields.serial;
+                    renderRMAList(rmas);
+                }
+            }
+        });
+    }
+
     // =================================================================
     // Toast Notifications (replaces native alert())
     // =================================================================
@@ -1563,9 +1806,15 @@ var App = (function() {
 
     function connectWebSocket() {
         if (ws && (ws.readyState === WebSocket.CONNECTING || ws.readyState === WebSocket.OPEN)) return;
+        if (!state.employee) return;
 
         var protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
         var url = protocol + '//' + window.location.host + '/ws';
+        // Browsers cannot set headers on a WebSocket, so the session
+        // token goes in the query string.
+        if (state.employee.token) {
+            url += '?token=' + encodeURIComponent(state.employee.token);
+        }
 
         try { ws = new WebSocket(url); } catch(e) { scheduleReconnect(); return; }
 
@@ -1820,8 +2069,8 @@ var App = (function() {
     // Initialize theme from localStorage
     initTheme();
 
-    // Auto-login with pre-filled credentials
-    login();
+    // Scanner input is caught before the other key handlers
+    window.addEventListener('keydown', onScanKey, true);
 
     // Handle enter key on login
     document.addEventListener('keydown', function(e) {
@@ -1895,7 +2144,11 @@ var App = (function() {
         openRMA: openRMA,
         createRMA: createRMA,
         closeRMA: closeRMA,
+        signRun: signRun,
+        confirmSignRun: confirmSignRun,
         toggleTestRunEvents: toggleTestRunEvents,
+        searchHistory: searchHistory,
+        historyPage: historyPage,
         toggleRunInclude: toggleRunInclude,
         toggleAllRuns: toggleAllRuns,
         openModal: openModal,
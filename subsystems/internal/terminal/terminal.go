@@ -23,12 +23,14 @@ var embedded embed.FS
 // reverse-proxies all other requests to the controller at controllerURL.
 // When devMode is true, static files are served from disk and an SSE
 // endpoint at /dev/reload pushes change notifications to the browser.
-func Handler(controllerURL string, devMode bool) http.Handler {
+// transport carries proxied requests; nil uses http.DefaultTransport.
+func Handler(controllerURL string, devMode bool, transport http.RoundTripper) http.Handler {
 	target, err := url.Parse(controllerURL)
 	if err != nil {
 		panic("terminal: invalid controller URL: " + err.Error())
 	}
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
 
 	// Choose filesystem: embed or disk.
 	var staticFS http.FileSystem
@@ -8,9 +8,10 @@ import (
 
 	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/script/executor"
+	"github.com/holla2040/arturo/internal/script/profile"
 	"github.com/holla2040/arturo/internal/script/redisrouter"
 	"github.com/holla2040/arturo/internal/store"
-	"github.com/redis/go-redis/v9"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 // Broadcaster sends events to connected clients (e.g., WebSocket).
@@ -24,33 +25,49 @@ type RouterFactory func(station string) executor.DeviceRouter
 
 // TestManager manages all active test sessions across stations.
 type TestManager struct {
-	mu            sync.RWMutex
-	sessions      map[string]*TestSession // keyed by station instance
-	store         *store.Store
-	hub           Broadcaster
-	routerFactory RouterFactory
-	rdb           *redis.Client
-	source        protocol.Source
-	ctx           context.Context
+	mu              sync.RWMutex
+	sessions        map[string]*TestSession // keyed by station instance
+	store           store.Store
+	hub             Broadcaster
+	routerFactory   RouterFactory
+	requireApproved bool // production mode: only approved registry scripts may run
+	pausePolicy     PausePolicy
+	safeStates      map[string]*profile.SafeStateConfig // by device ID or station/device
+	locks           *ResourceLocks                      // shared resources; nil until SetResources
+	bus             transport.Streams
+	source          protocol.Source
+	ctx             context.Context
+
+	// stationFeatures reports whether a station advertised a service.hello
+	// feature; nil means none. Read by the default router factory.
+	stationFeatures func(station, feature string) bool
 }
 
-// New creates a new TestManager.
-func New(ctx context.Context, st *store.Store, hub Broadcaster, rdb *redis.Client, source protocol.Source) *TestManager {
-	return &TestManager{
+// New creates a new TestManager. Script routers send commands with sender
+// and receive responses through dispatcher, which the caller's response
+// stream listener feeds; bus carries test state notifications.
+func New(ctx context.Context, st store.Store, hub Broadcaster, bus transport.Streams, sender redisrouter.Sender, dispatcher redisrouter.Dispatcher, source protocol.Source) *TestManager {
+	m := &TestManager{
 		sessions: make(map[string]*TestSession),
 		store:    st,
 		hub:      hub,
-		rdb:      rdb,
+		bus:      bus,
 		source:   source,
 		ctx:      ctx,
-		routerFactory: func(station string) executor.DeviceRouter {
-			return redisrouter.New(rdb, source, station)
-		},
 	}
+	// Called from startLocked with m.mu held.
+	m.routerFactory = func(station string) executor.DeviceRouter {
+		r := redisrouter.New(sender, dispatcher, source, station)
+		if supports := m.stationFeatures; supports != nil {
+			r.SetFeatureCheck(func(feature string) bool { return supports(station, feature) })
+		}
+		return r
+	}
+	return m
 }
 
 // NewWithFactory creates a TestManager with a custom router factory (for testing).
-func NewWithFactory(ctx context.Context, st *store.Store, hub Broadcaster, factory RouterFactory) *TestManager {
+func NewWithFactory(ctx context.Context, st store.Store, hub Broadcaster, factory RouterFactory) *TestManager {
 	return &TestManager{
 		sessions:      make(map[string]*TestSession),
 		store:         st,
@@ -60,30 +77,139 @@ func NewWithFactory(ctx context.Context, st *store.Store, hub Broadcaster, facto
 	}
 }
 
-// StartTest starts a test on the given station.
-func (m *TestManager) StartTest(stationInstance, deviceID, scriptPath, rmaID, testRunID, employeeID string) error {
+// SetRequireApprovedScripts enables production mode, in which tests may only
+// be started from approved script registry versions.
+func (m *TestManager) SetRequireApprovedScripts(require bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.requireApproved = require
+}
 
-	if _, exists := m.sessions[stationInstance]; exists {
-		return fmt.Errorf("station %s already has an active test", stationInstance)
+// RequireApprovedScripts reports whether production mode is enabled.
+func (m *TestManager) RequireApprovedScripts() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.requireApproved
+}
+
+// SetStationFeatures sets the function script routers use to ask whether a
+// station supports a protocol feature, typically registry.Supports. Without
+// it, scripts never send batch commands.
+func (m *TestManager) SetStationFeatures(supports func(station, feature string) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stationFeatures = supports
+}
+
+// SetPausePolicy sets the maximum pause duration and timeout action applied
+// to sessions started after the call.
+func (m *TestManager) SetPausePolicy(policy PausePolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pausePolicy = policy
+}
+
+// SetSafeStates sets the profile safe-state commands sent to the device
+// under test on pause, terminate and abort, keyed by device ID or by
+// station/device (see LoadSafeStates). Devices without an entry get none.
+// Applies to sessions started after the call.
+func (m *TestManager) SetSafeStates(configs map[string]*profile.SafeStateConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.safeStates = configs
+}
+
+// SetResources declares the shared resources scripts may ACQUIRE. Every
+// change in holders or waiters is broadcast as a "resource_locks" event.
+// Must be called before any test starts.
+func (m *TestManager) SetResources(configs []ResourceConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hub := m.hub
+	m.locks = NewResourceLocks(configs, func(status []ResourceStatus) {
+		if hub != nil {
+			hub.BroadcastEvent("resource_locks", map[string]interface{}{
+				"resources": status,
+			})
+		}
+	})
+}
+
+// ResourceStatus returns the holders and waiters of every shared resource.
+func (m *TestManager) ResourceStatus() []ResourceStatus {
+	m.mu.RLock()
+	locks := m.locks
+	m.mu.RUnlock()
+	if locks == nil {
+		return []ResourceStatus{}
 	}
+	return locks.Status()
+}
 
-	rawRouter := m.routerFactory(stationInstance)
+// StartTest starts a test on the given station from a script file on disk.
+// Rejected in production mode.
+func (m *TestManager) StartTest(stationInstance, deviceID, scriptPath, rmaID, testRunID, employeeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.requireApproved {
+		return fmt.Errorf("production mode requires an approved script version, not a script path")
+	}
 
-	session, err := NewSession(m.ctx, StartSessionParams{
+	return m.startLocked(StartSessionParams{
 		TestRunID:       testRunID,
 		RMAID:           rmaID,
 		StationInstance: stationInstance,
 		DeviceID:        deviceID,
 		ScriptPath:      scriptPath,
 		EmployeeID:      employeeID,
-		RawRouter:       rawRouter,
-		Store:           m.store,
-		Hub:             m.hub,
-		Rdb:             m.rdb,
-		Source:          m.source,
 	})
+}
+
+// StartTestVersion starts a test on the given station from a script registry
+// version. In production mode the version must be approved.
+func (m *TestManager) StartTestVersion(stationInstance, deviceID, scriptVersionID, rmaID, testRunID, employeeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	version, err := m.store.GetScriptVersion(scriptVersionID)
+	if err != nil {
+		return fmt.Errorf("get script version: %w", err)
+	}
+	if version == nil {
+		return fmt.Errorf("script version %s not found", scriptVersionID)
+	}
+	if m.requireApproved && version.Status != "approved" {
+		return fmt.Errorf("script %s v%d is %s, not approved for production runs", version.Name, version.Version, version.Status)
+	}
+
+	return m.startLocked(StartSessionParams{
+		TestRunID:       testRunID,
+		RMAID:           rmaID,
+		StationInstance: stationInstance,
+		DeviceID:        deviceID,
+		ScriptVersion:   version,
+		EmployeeID:      employeeID,
+	})
+}
+
+// startLocked creates the session and registers it. Caller holds m.mu.
+func (m *TestManager) startLocked(params StartSessionParams) error {
+	stationInstance := params.StationInstance
+	if _, exists := m.sessions[stationInstance]; exists {
+		return fmt.Errorf("station %s already has an active test", stationInstance)
+	}
+
+	params.RawRouter = m.routerFactory(stationInstance)
+	params.Store = m.store
+	params.Hub = m.hub
+	params.Bus = m.bus
+	params.Source = m.source
+	params.PausePolicy = m.pausePolicy
+	params.SafeState = safeStateFor(m.safeStates, stationInstance, params.DeviceID)
+	params.Locks = m.locks
+
+	session, err := NewSession(m.ctx, params)
 	if err != nil {
 		return err
 	}
@@ -153,6 +279,57 @@ func (m *TestManager) AbortTest(stationInstance, employeeID string) error {
 	return session.Abort(employeeID)
 }
 
+// stationUIEmployee is recorded as the employee for actions taken on a
+// station's own UI.
+const stationUIEmployee = "station-ui"
+
+// HandleControlRequest validates a test.control.request from a station UI
+// and applies its action to that station's test. The returned payload is
+// the reply for the sending station: Success, or an Error saying why the
+// request was rejected or failed. A station may only control its own test.
+func (m *TestManager) HandleControlRequest(msg *protocol.Message) protocol.TestControlResponsePayload {
+	reply := protocol.TestControlResponsePayload{StationInstance: msg.Envelope.Source.Instance}
+	reject := func(code, format string, args ...any) protocol.TestControlResponsePayload {
+		reply.Error = &protocol.Error{Code: code, Message: fmt.Sprintf(format, args...)}
+		return reply
+	}
+
+	if err := protocol.Validate(msg); err != nil {
+		return reject(protocol.ErrCodeValidationFailed, "%v", err)
+	}
+	if msg.Envelope.Type != protocol.TypeTestControlRequest {
+		return reject(protocol.ErrCodeValidationFailed, "unexpected type %q", msg.Envelope.Type)
+	}
+	p, err := protocol.ParseTestControlRequest(msg)
+	if err != nil {
+		return reject(protocol.ErrCodeValidationFailed, "%v", err)
+	}
+	reply.Action = p.Action
+	if err := protocol.ValidateTestControlRequest(p); err != nil {
+		return reject(protocol.ErrCodeValidationFailed, "%v", err)
+	}
+	if p.StationInstance != msg.Envelope.Source.Instance {
+		return reject(protocol.ErrCodeInvalidParameter, "station %s may not control station %s", msg.Envelope.Source.Instance, p.StationInstance)
+	}
+
+	station := p.StationInstance
+	switch p.Action {
+	case protocol.TestActionPause:
+		err = m.PauseTest(station, stationUIEmployee)
+	case protocol.TestActionContinue:
+		err = m.ResumeTest(station, stationUIEmployee)
+	case protocol.TestActionTerminate:
+		err = m.TerminateTest(station, stationUIEmployee, "station UI")
+	case protocol.TestActionAbort:
+		err = m.AbortTest(station, stationUIEmployee)
+	}
+	if err != nil {
+		return reject(protocol.ErrCodeCommandFailed, "%s: %v", p.Action, err)
+	}
+	reply.Success = true
+	return reply
+}
+
 // GetStationState returns the current state of a station.
 func (m *TestManager) GetStationState(stationInstance string) string {
 	m.mu.RLock()
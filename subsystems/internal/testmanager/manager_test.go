@@ -2,13 +2,16 @@ package testmanager
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/holla2040/arturo/internal/protocol"
 	"github.com/holla2040/arturo/internal/script/executor"
+	"github.com/holla2040/arturo/internal/script/profile"
 	"github.com/holla2040/arturo/internal/store"
 )
 
@@ -64,7 +67,7 @@ func (m *mockRouter) getCalls() []mockCall {
 	return calls
 }
 
-func newTestStore(t *testing.T) *store.Store {
+func newTestStore(t *testing.T) store.Store {
 	t.Helper()
 	s, err := store.New(":memory:")
 	if err != nil {
@@ -127,6 +130,49 @@ func TestPausableRouterBlocksWhenPaused(t *testing.T) {
 	}
 }
 
+// batchMockRouter is a mockRouter that can also send batches.
+type batchMockRouter struct {
+	*mockRouter
+	batches int
+}
+
+func (b *batchMockRouter) SendBatch(ctx context.Context, cmds []executor.BatchCommand, timeoutMs int) ([]executor.BatchResult, error) {
+	b.batches++
+	results := make([]executor.BatchResult, len(cmds))
+	for i, c := range cmds {
+		results[i].Result, results[i].Err = b.SendCommand(ctx, c.DeviceID, c.Command, c.Params, c.TimeoutMs)
+	}
+	return results, nil
+}
+
+func TestPausableRouterSendBatch(t *testing.T) {
+	cmds := []executor.BatchCommand{{DeviceID: "PUMP-01", Command: "get_temp_1st_stage"}}
+
+	if _, err := NewPausableRouter(newMockRouter()).SendBatch(context.Background(), cmds, 0); !errors.Is(err, executor.ErrBatchUnsupported) {
+		t.Fatalf("err = %v, want ErrBatchUnsupported for a plain router", err)
+	}
+
+	inner := &batchMockRouter{mockRouter: newMockRouter()}
+	pr := NewPausableRouter(inner)
+	results, err := pr.SendBatch(context.Background(), cmds, 0)
+	if err != nil {
+		t.Fatalf("SendBatch failed: %v", err)
+	}
+	if inner.batches != 1 || results[0].Result.Response != "77.5" {
+		t.Errorf("batches = %d, results = %+v", inner.batches, results)
+	}
+
+	pr.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pr.SendBatch(ctx, cmds, 0); err == nil {
+		t.Error("expected timeout error when paused")
+	}
+	if inner.batches != 1 {
+		t.Errorf("batch sent while paused")
+	}
+}
+
 func TestPausableRouterResumeUnblocks(t *testing.T) {
 	inner := newMockRouter()
 	pr := NewPausableRouter(inner)
@@ -162,8 +208,11 @@ func TestManagerStartAndComplete(t *testing.T) {
 	st := newTestStore(t)
 	router := newMockRouter()
 
-	script := writeTestScript(t, `TEST "Simple Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Simple Test"
+    QUERY "pump_status" status TIMEOUT 5000
     PASS "pump responded"
 ENDTEST`)
 
@@ -218,8 +267,11 @@ func TestManagerDuplicateStartRejected(t *testing.T) {
 	router := newMockRouter()
 	router.delay = 2 * time.Second // Keep test running
 
-	script := writeTestScript(t, `TEST "Long Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    QUERY "pump_status" status TIMEOUT 5000
     DELAY 5000
     PASS "done"
 ENDTEST`)
@@ -250,10 +302,13 @@ func TestManagerPauseResume(t *testing.T) {
 	router := newMockRouter()
 	router.delay = 200 * time.Millisecond // Slow down commands
 
-	script := writeTestScript(t, `TEST "Slow Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Slow Test"
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
     PASS "done"
 ENDTEST`)
 
@@ -315,8 +370,11 @@ func TestManagerTerminate(t *testing.T) {
 	router := newMockRouter()
 	router.delay = 500 * time.Millisecond
 
-	script := writeTestScript(t, `TEST "Long Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    QUERY "pump_status" status TIMEOUT 5000
     DELAY 10000
     PASS "done"
 ENDTEST`)
@@ -366,8 +424,11 @@ func TestManagerAbort(t *testing.T) {
 	router := newMockRouter()
 	router.delay = 500 * time.Millisecond
 
-	script := writeTestScript(t, `TEST "Long Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    QUERY "pump_status" status TIMEOUT 5000
     DELAY 10000
     PASS "done"
 ENDTEST`)
@@ -402,8 +463,11 @@ func TestManagerEmergencyStopAll(t *testing.T) {
 	router := newMockRouter()
 	router.delay = 500 * time.Millisecond
 
-	script := writeTestScript(t, `TEST "Long Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    QUERY "pump_status" status TIMEOUT 5000
     DELAY 10000
     PASS "done"
 ENDTEST`)
@@ -453,13 +517,94 @@ func TestManagerNoSessionErrors(t *testing.T) {
 	}
 }
 
+func TestManagerHandleControlRequest(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 200 * time.Millisecond
+
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Slow Test"
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    PASS "done"
+ENDTEST`)
+
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1")
+	time.Sleep(100 * time.Millisecond)
+
+	src := protocol.Source{Service: "arturo_station", Instance: "station-01", Version: "1.0.0"}
+	request := func(station, action string) *protocol.Message {
+		msg, err := protocol.NewMessage(src, protocol.TypeTestControlRequest,
+			protocol.TestControlRequestPayload{StationInstance: station, Action: action})
+		if err != nil {
+			t.Fatalf("NewMessage: %v", err)
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		msg      *protocol.Message
+		wantCode string
+	}{
+		{"unknown_action", request("station-01", "explode"), protocol.ErrCodeValidationFailed},
+		{"other_station", request("station-02", protocol.TestActionPause), protocol.ErrCodeInvalidParameter},
+		{"resume_while_running", request("station-01", protocol.TestActionContinue), protocol.ErrCodeCommandFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := mgr.HandleControlRequest(tt.msg)
+			if reply.Success || reply.Error == nil {
+				t.Fatalf("expected error reply, got %+v", reply)
+			}
+			if reply.Error.Code != tt.wantCode {
+				t.Errorf("Code = %q, want %q (%s)", reply.Error.Code, tt.wantCode, reply.Error.Message)
+			}
+			if reply.StationInstance != "station-01" {
+				t.Errorf("StationInstance = %q, want the sender", reply.StationInstance)
+			}
+		})
+	}
+
+	bad := request("station-01", protocol.TestActionPause)
+	bad.Envelope.SchemaVersion = "v2.0.0"
+	if reply := mgr.HandleControlRequest(bad); reply.Error == nil || reply.Error.Code != protocol.ErrCodeValidationFailed {
+		t.Errorf("incompatible schema_version: got %+v", reply)
+	}
+
+	reply := mgr.HandleControlRequest(request("station-01", protocol.TestActionPause))
+	if !reply.Success || reply.Error != nil {
+		t.Fatalf("pause: expected success, got %+v", reply.Error)
+	}
+	if reply.Action != protocol.TestActionPause {
+		t.Errorf("Action = %q, want pause", reply.Action)
+	}
+	if s := mgr.GetSession("station-01"); s == nil || s.State != StatePaused {
+		t.Errorf("expected paused session, got %+v", s)
+	}
+}
+
 func TestManagerHasActiveTestForRMA(t *testing.T) {
 	st := newTestStore(t)
 	router := newMockRouter()
 	router.delay = 500 * time.Millisecond
 
-	script := writeTestScript(t, `TEST "Long Test"
-    QUERY "PUMP-01" "pump_status" status TIMEOUT 5000
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    QUERY "pump_status" status TIMEOUT 5000
     DELAY 10000
     PASS "done"
 ENDTEST`)
@@ -488,3 +633,493 @@ ENDTEST`)
 		t.Error("expected no active test for rma-2")
 	}
 }
+
+func TestManagerStartTestVersion(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+	st.CreateScriptVersion("sv-1", "status.art", `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Versioned Test"
+    QUERY "pump_status" status TIMEOUT 5000
+    PASS "pump responded"
+ENDTEST`, "hash1", "Versioned Test", "standard", "1.0", "emp-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+
+	if err := mgr.StartTestVersion("station-01", "PUMP-01", "sv-1", "rma-1", "run-1", "emp-1"); err != nil {
+		t.Fatalf("StartTestVersion failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	run, err := st.GetTestRun("run-1")
+	if err != nil {
+		t.Fatalf("GetTestRun failed: %v", err)
+	}
+	if run == nil {
+		t.Fatal("expected non-nil test run")
+	}
+	if run.ScriptVersionID == nil || *run.ScriptVersionID != "sv-1" {
+		t.Error("expected test run linked to script version sv-1")
+	}
+	if run.Status != "passed" {
+		t.Errorf("expected status passed, got %s", run.Status)
+	}
+
+	if err := mgr.StartTestVersion("station-01", "PUMP-01", "missing", "rma-1", "run-2", "emp-1"); err == nil {
+		t.Error("expected error for unknown script version")
+	}
+}
+
+func TestManagerProductionModeRequiresApproval(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Simple Test"
+    PASS "ok"
+ENDTEST`)
+
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+	st.CreateScriptVersion("sv-1", "simple.art", `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Simple Test"
+    PASS "ok"
+ENDTEST`, "hash1", "Simple Test", "standard", "1.0", "emp-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetRequireApprovedScripts(true)
+
+	if err := mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1"); err == nil {
+		t.Error("expected script path start to be rejected in production mode")
+	}
+	if err := mgr.StartTestVersion("station-01", "PUMP-01", "sv-1", "rma-1", "run-1", "emp-1"); err == nil {
+		t.Error("expected unapproved version to be rejected in production mode")
+	}
+
+	if err := st.ApproveScriptVersion("sv-1", "emp-1"); err != nil {
+		t.Fatalf("ApproveScriptVersion failed: %v", err)
+	}
+	if err := mgr.StartTestVersion("station-01", "PUMP-01", "sv-1", "rma-1", "run-1", "emp-1"); err != nil {
+		t.Fatalf("expected approved version to start, got %v", err)
+	}
+}
+
+func hasCall(calls []mockCall, command string) bool {
+	for _, c := range calls {
+		if c.Command == command {
+			return true
+		}
+	}
+	return false
+}
+
+func countEvents(events []store.TestEvent, eventType string) int {
+	n := 0
+	for _, e := range events {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+const slowPauseScript = `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Slow Test"
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    PASS "done"
+ENDTEST`
+
+func TestManagerPauseTimeoutTerminates(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 100 * time.Millisecond
+
+	script := writeTestScript(t, slowPauseScript)
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetPausePolicy(PausePolicy{MaxDuration: 200 * time.Millisecond, OnTimeout: PauseTimeoutTerminate})
+	mgr.SetSafeStates(map[string]*profile.SafeStateConfig{"PUMP-01": {
+		Pause:     []string{"close_rough_valve"},
+		Terminate: []string{"close_purge_valve"},
+	}})
+
+	mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := mgr.PauseTest("station-01", "emp-1"); err != nil {
+		t.Fatalf("PauseTest failed: %v", err)
+	}
+	session := mgr.GetSession("station-01")
+	if session == nil || session.PauseDeadline == nil {
+		t.Fatal("expected pause deadline on paused session")
+	}
+
+	time.Sleep(600 * time.Millisecond)
+
+	if mgr.HasActiveSession("station-01") {
+		t.Error("expected session terminated after pause timeout")
+	}
+
+	run, _ := st.GetTestRun("run-1")
+	if run == nil || run.Status != "terminated" {
+		t.Errorf("expected terminated run, got %+v", run)
+	}
+
+	events, _ := st.QueryTestEvents("run-1")
+	if countEvents(events, "pause_timeout") != 1 {
+		t.Error("expected one pause_timeout event")
+	}
+	if countEvents(events, "safe_state") != 2 {
+		t.Errorf("expected 2 safe_state events, got %d", countEvents(events, "safe_state"))
+	}
+
+	calls := router.getCalls()
+	if !hasCall(calls, "close_rough_valve") {
+		t.Error("expected close_rough_valve sent on pause")
+	}
+	if !hasCall(calls, "close_purge_valve") {
+		t.Error("expected close_purge_valve sent on terminate")
+	}
+}
+
+func TestManagerTerminateSafeStatePerDevice(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 300 * time.Millisecond // slow safe-state commands
+
+	script := writeTestScript(t, `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Long Test"
+    DELAY 10000
+    PASS "done"
+ENDTEST`)
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetSafeStates(map[string]*profile.SafeStateConfig{
+		"PUMP-01":            {Terminate: []string{"close_rough_valve"}},
+		"station-01/PUMP-01": {Terminate: []string{"close_purge_valve"}},
+		"PUMP-02":            {Terminate: []string{"pump_off"}},
+	})
+
+	mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1")
+	time.Sleep(50 * time.Millisecond)
+
+	// Status reads must not wait for the safe-state commands.
+	done := make(chan error, 1)
+	go func() { done <- mgr.TerminateTest("station-01", "emp-1", "operator stop") }()
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	session := mgr.GetSession("station-01")
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("GetSession blocked %s during terminate", d)
+	}
+	if session != nil && session.State != StateStopping {
+		t.Errorf("expected state %s during terminate, got %s", StateStopping, session.State)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("TerminateTest failed: %v", err)
+	}
+
+	calls := router.getCalls()
+	if !hasCall(calls, "close_purge_valve") {
+		t.Error("expected the station-01/PUMP-01 safe state sent")
+	}
+	if hasCall(calls, "close_rough_valve") || hasCall(calls, "pump_off") {
+		t.Errorf("unexpected safe-state commands: %+v", calls)
+	}
+	run, _ := st.GetTestRun("run-1")
+	if run == nil || run.Status != "terminated" {
+		t.Errorf("expected terminated run, got %+v", run)
+	}
+}
+
+func TestLoadSafeStates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pump.yaml")
+	os.WriteFile(path, []byte(`commands:
+  close_rough_valve: "D0"
+safe_state:
+  abort: [close_rough_valve]
+`), 0644)
+
+	configs, err := LoadSafeStates("PUMP-01=" + path + ", station-02/PUMP-01=" + path)
+	if err != nil {
+		t.Fatalf("LoadSafeStates failed: %v", err)
+	}
+	if got := safeStateFor(configs, "station-02", "PUMP-01").Commands("abort"); len(got) != 1 || got[0] != "close_rough_valve" {
+		t.Errorf("abort commands = %v", got)
+	}
+	if safeStateFor(configs, "station-01", "PUMP-02") != nil {
+		t.Error("expected no safe state for an unlisted device")
+	}
+
+	for _, spec := range []string{"PUMP-01", "=" + path, "PUMP-01=" + path + ",PUMP-01=" + path, "PUMP-01=" + filepath.Join(dir, "missing.yaml")} {
+		if _, err := LoadSafeStates(spec); err == nil {
+			t.Errorf("LoadSafeStates(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestManagerPauseTimeoutResumes(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 100 * time.Millisecond
+
+	script := writeTestScript(t, slowPauseScript)
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetPausePolicy(PausePolicy{MaxDuration: 150 * time.Millisecond, OnTimeout: PauseTimeoutResume})
+
+	mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := mgr.PauseTest("station-01", "emp-1"); err != nil {
+		t.Fatalf("PauseTest failed: %v", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	events, _ := st.QueryTestEvents("run-1")
+	if countEvents(events, "pause_timeout") != 1 {
+		t.Error("expected one pause_timeout event")
+	}
+	if countEvents(events, "resumed") != 1 {
+		t.Error("expected automatic resumed event")
+	}
+
+	// Test runs to completion after the automatic resume
+	time.Sleep(800 * time.Millisecond)
+	run, _ := st.GetTestRun("run-1")
+	if run == nil || run.Status != "passed" {
+		t.Errorf("expected passed run after auto-resume, got %+v", run)
+	}
+}
+
+func TestManagerResumeCancelsPauseTimeout(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 100 * time.Millisecond
+
+	script := writeTestScript(t, slowPauseScript)
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetPausePolicy(PausePolicy{MaxDuration: 200 * time.Millisecond, OnTimeout: PauseTimeoutTerminate})
+
+	mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1")
+	time.Sleep(50 * time.Millisecond)
+
+	mgr.PauseTest("station-01", "emp-1")
+	time.Sleep(50 * time.Millisecond)
+	if err := mgr.ResumeTest("station-01", "emp-1"); err != nil {
+		t.Fatalf("ResumeTest failed: %v", err)
+	}
+
+	time.Sleep(900 * time.Millisecond)
+
+	events, _ := st.QueryTestEvents("run-1")
+	if countEvents(events, "pause_timeout") != 0 {
+		t.Error("expected no pause_timeout after manual resume")
+	}
+	run, _ := st.GetTestRun("run-1")
+	if run == nil || run.Status != "passed" {
+		t.Errorf("expected passed run, got %+v", run)
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	configs, err := ParseResources("rough_line, purge_gas=2,")
+	if err != nil {
+		t.Fatalf("ParseResources failed: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(configs))
+	}
+	if configs[0] != (ResourceConfig{Name: "rough_line", Capacity: 1}) {
+		t.Errorf("unexpected first resource: %+v", configs[0])
+	}
+	if configs[1] != (ResourceConfig{Name: "purge_gas", Capacity: 2}) {
+		t.Errorf("unexpected second resource: %+v", configs[1])
+	}
+
+	for _, bad := range []string{"rough_line=0", "=2", "rough_line,rough_line", "purge_gas=x"} {
+		if _, err := ParseResources(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestResourceLocksFIFO(t *testing.T) {
+	locks := NewResourceLocks([]ResourceConfig{{Name: "rough_line", Capacity: 1}}, nil)
+	ctx := context.Background()
+
+	if err := locks.Acquire(ctx, "rough_line", LockHolder{StationInstance: "station-01", TestRunID: "run-1"}, 0); err != nil {
+		t.Fatalf("first Acquire failed: %v", err)
+	}
+
+	granted := make(chan string, 2)
+	for _, id := range []string{"run-2", "run-3"} {
+		id := id
+		go func() {
+			if err := locks.Acquire(ctx, "rough_line", LockHolder{TestRunID: id}, 0); err == nil {
+				granted <- id
+			}
+		}()
+		time.Sleep(20 * time.Millisecond) // enqueue in order
+	}
+
+	status := locks.Status()
+	if len(status[0].Holders) != 1 || status[0].Holders[0].TestRunID != "run-1" {
+		t.Fatalf("expected run-1 holding, got %+v", status[0].Holders)
+	}
+	if len(status[0].Waiters) != 2 || status[0].Waiters[0].TestRunID != "run-2" {
+		t.Fatalf("expected run-2 then run-3 waiting, got %+v", status[0].Waiters)
+	}
+
+	locks.Release("rough_line", "run-1")
+	if got := <-granted; got != "run-2" {
+		t.Errorf("expected run-2 granted first, got %s", got)
+	}
+	locks.ReleaseAll("run-2")
+	if got := <-granted; got != "run-3" {
+		t.Errorf("expected run-3 granted second, got %s", got)
+	}
+
+	if err := locks.Release("rough_line", "run-1"); err == nil {
+		t.Error("expected error releasing a resource not held")
+	}
+	if err := locks.Acquire(ctx, "nitrogen", LockHolder{TestRunID: "run-1"}, 0); err == nil {
+		t.Error("expected error for unknown resource")
+	}
+}
+
+func TestResourceLocksTimeout(t *testing.T) {
+	locks := NewResourceLocks([]ResourceConfig{{Name: "purge_gas", Capacity: 1}}, nil)
+	ctx := context.Background()
+
+	locks.Acquire(ctx, "purge_gas", LockHolder{TestRunID: "run-1"}, 0)
+	err := locks.Acquire(ctx, "purge_gas", LockHolder{TestRunID: "run-2"}, 50*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+
+	status := locks.Status()
+	if len(status[0].Waiters) != 0 {
+		t.Errorf("expected timed-out waiter removed, got %+v", status[0].Waiters)
+	}
+}
+
+const roughLineScript = `CONST REPORT_TYPE "standard"
+CONST REPORT_VERSION "1.0"
+
+TEST "Rough Phase"
+    ACQUIRE "rough_line" TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    QUERY "pump_status" status TIMEOUT 5000
+    PASS "done"
+ENDTEST`
+
+func TestManagerResourceLockSerializesStations(t *testing.T) {
+	st := newTestStore(t)
+	router := newMockRouter()
+	router.delay = 100 * time.Millisecond
+
+	script := writeTestScript(t, roughLineScript)
+	st.CreateEmployee("emp-1", "Test User")
+	st.CreateRMA("rma-1", "RMA-001", "SN1", "Customer", "CT-8", "emp-1", "")
+	st.CreateRMA("rma-2", "RMA-002", "SN2", "Customer", "CT-8", "emp-1", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mgr := NewWithFactory(ctx, st, nil, func(station string) executor.DeviceRouter {
+		return router
+	})
+	mgr.SetResources([]ResourceConfig{{Name: "rough_line", Capacity: 1}})
+
+	if err := mgr.StartTest("station-01", "PUMP-01", script, "rma-1", "run-1", "emp-1"); err != nil {
+		t.Fatalf("StartTest station-01 failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := mgr.StartTest("station-02", "PUMP-02", script, "rma-2", "run-2", "emp-1"); err != nil {
+		t.Fatalf("StartTest station-02 failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	status := mgr.ResourceStatus()
+	if len(status) != 1 {
+		t.Fatalf("expected 1 resource, got %d", len(status))
+	}
+	if len(status[0].Holders) != 1 || status[0].Holders[0].StationInstance != "station-01" {
+		t.Errorf("expected station-01 holding rough_line, got %+v", status[0].Holders)
+	}
+	if len(status[0].Waiters) != 1 || status[0].Waiters[0].StationInstance != "station-02" {
+		t.Errorf("expected station-02 waiting for rough_line, got %+v", status[0].Waiters)
+	}
+
+	// station-01 never RELEASEs; the lock is returned when its session ends.
+	time.Sleep(900 * time.Millisecond)
+
+	for _, id := range []string{"run-1", "run-2"} {
+		run, _ := st.GetTestRun(id)
+		if run == nil || run.Status != "passed" {
+			t.Errorf("expected %s passed, got %+v", id, run)
+		}
+	}
+	status = mgr.ResourceStatus()
+	if len(status[0].Holders) != 0 || len(status[0].Waiters) != 0 {
+		t.Errorf("expected rough_line free after both tests, got %+v", status[0])
+	}
+}
@@ -3,6 +3,7 @@ package testmanager
 
 import (
 	"context"
+	"sync"
 
 	"github.com/holla2040/arturo/internal/script/executor"
 )
@@ -10,6 +11,7 @@ import (
 // PausableRouter wraps a DeviceRouter and blocks SendCommand calls while paused.
 // The executor is unaware of the pause — it simply blocks between device commands.
 type PausableRouter struct {
+	mu      sync.Mutex
 	inner   executor.DeviceRouter
 	pauseCh chan struct{} // closed = running, created = paused
 	paused  bool
@@ -26,21 +28,48 @@ func NewPausableRouter(inner executor.DeviceRouter) *PausableRouter {
 
 // SendCommand delegates to the inner router, but blocks if the session is paused.
 func (p *PausableRouter) SendCommand(ctx context.Context, deviceID, command string, params map[string]string, timeoutMs int) (*executor.CommandResult, error) {
-	// If paused, wait until resumed or context cancelled
-	if p.paused && p.pauseCh != nil {
+	if err := p.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+	return p.inner.SendCommand(ctx, deviceID, command, params, timeoutMs)
+}
+
+// SendBatch implements executor.BatchRouter. Like SendCommand it blocks while
+// paused; it reports executor.ErrBatchUnsupported if the inner router cannot
+// send batches.
+func (p *PausableRouter) SendBatch(ctx context.Context, cmds []executor.BatchCommand, timeoutMs int) ([]executor.BatchResult, error) {
+	br, ok := p.inner.(executor.BatchRouter)
+	if !ok {
+		return nil, executor.ErrBatchUnsupported
+	}
+	if err := p.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+	return br.SendBatch(ctx, cmds, timeoutMs)
+}
+
+// waitResumed returns once the router is not paused, or with ctx's error if
+// ctx is cancelled first.
+func (p *PausableRouter) waitResumed(ctx context.Context) error {
+	p.mu.Lock()
+	pauseCh := p.pauseCh
+	paused := p.paused
+	p.mu.Unlock()
+	if paused && pauseCh != nil {
 		select {
-		case <-p.pauseCh:
+		case <-pauseCh:
 			// Resumed
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
-
-	return p.inner.SendCommand(ctx, deviceID, command, params, timeoutMs)
+	return nil
 }
 
 // Pause blocks future SendCommand calls until Resume is called.
 func (p *PausableRouter) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.paused {
 		return
 	}
@@ -50,6 +79,8 @@ func (p *PausableRouter) Pause() {
 
 // Resume unblocks paused SendCommand calls.
 func (p *PausableRouter) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if !p.paused {
 		return
 	}
@@ -59,5 +90,7 @@ func (p *PausableRouter) Resume() {
 
 // IsPaused returns whether the router is currently paused.
 func (p *PausableRouter) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.paused
 }
@@ -0,0 +1,288 @@
+package testmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceConfig declares a named resource shared between stations, such as
+// a roughing pump or purge-gas line. Capacity is the number of tests that
+// may hold the resource at once.
+type ResourceConfig struct {
+	Name     string
+	Capacity int
+}
+
+// ParseResources parses a comma-separated resource list of the form
+// "rough_line,purge_gas=2". A resource without "=N" has capacity 1.
+func ParseResources(spec string) ([]ResourceConfig, error) {
+	var configs []ResourceConfig
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, capStr, hasCap := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("resource %q: missing name", item)
+		}
+		capacity := 1
+		if hasCap {
+			n, err := strconv.Atoi(strings.TrimSpace(capStr))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("resource %q: capacity must be a positive integer", name)
+			}
+			capacity = n
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("resource %q declared twice", name)
+		}
+		seen[name] = true
+		configs = append(configs, ResourceConfig{Name: name, Capacity: capacity})
+	}
+	return configs, nil
+}
+
+// LockHolder identifies a test holding or waiting for a resource.
+type LockHolder struct {
+	StationInstance string    `json:"station_instance"`
+	TestRunID       string    `json:"test_run_id"`
+	Since           time.Time `json:"since"`
+}
+
+// ResourceStatus is a snapshot of one shared resource.
+type ResourceStatus struct {
+	Name     string       `json:"name"`
+	Capacity int          `json:"capacity"`
+	Holders  []LockHolder `json:"holders"`
+	Waiters  []LockHolder `json:"waiters"`
+}
+
+type lockWaiter struct {
+	holder  LockHolder
+	granted chan struct{} // closed when the waiter is moved to holders
+}
+
+type resourceState struct {
+	capacity int
+	holders  []LockHolder
+	waiters  []*lockWaiter // FIFO
+}
+
+// ResourceLocks grants shared resources to test sessions. Waiters are served
+// in arrival order so a busy resource cannot starve a station.
+type ResourceLocks struct {
+	mu        sync.Mutex
+	resources map[string]*resourceState
+	notifyMu  sync.Mutex
+	onChange  func([]ResourceStatus)
+}
+
+// NewResourceLocks creates a lock table for the given resources. onChange,
+// if non-nil, is called with a fresh snapshot after every grant, release,
+// or change to the wait queue.
+func NewResourceLocks(configs []ResourceConfig, onChange func([]ResourceStatus)) *ResourceLocks {
+	l := &ResourceLocks{
+		resources: make(map[string]*resourceState),
+		onChange:  onChange,
+	}
+	for _, cfg := range configs {
+		l.resources[cfg.Name] = &resourceState{capacity: cfg.Capacity}
+	}
+	return l
+}
+
+// Acquire blocks until holder is granted the resource, ctx is done, or
+// timeout elapses (0 = no timeout). Acquiring a resource the test already
+// holds is a no-op.
+func (l *ResourceLocks) Acquire(ctx context.Context, name string, holder LockHolder, timeout time.Duration) error {
+	l.mu.Lock()
+	r, ok := l.resources[name]
+	if !ok {
+		l.mu.Unlock()
+		return fmt.Errorf("unknown resource %q", name)
+	}
+	if r.heldBy(holder.TestRunID) {
+		l.mu.Unlock()
+		return nil
+	}
+
+	holder.Since = time.Now()
+	if len(r.holders) < r.capacity && len(r.waiters) == 0 {
+		r.holders = append(r.holders, holder)
+		l.mu.Unlock()
+		l.notify()
+		return nil
+	}
+
+	w := &lockWaiter{holder: holder, granted: make(chan struct{})}
+	r.waiters = append(r.waiters, w)
+	l.mu.Unlock()
+	l.notify()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+		if l.cancelWait(r, w) {
+			// Granted just as the test stopped; hand it straight back.
+			l.Release(name, holder.TestRunID)
+		}
+		return ctx.Err()
+	case <-timeoutCh:
+		if l.cancelWait(r, w) {
+			return nil
+		}
+		return fmt.Errorf("timed out after %s waiting for resource %q", timeout, name)
+	}
+}
+
+// cancelWait removes w from the wait queue. It reports true if w was
+// granted before it could be removed, in which case w now holds the resource.
+func (l *ResourceLocks) cancelWait(r *resourceState, w *lockWaiter) bool {
+	l.mu.Lock()
+	select {
+	case <-w.granted:
+		l.mu.Unlock()
+		return true
+	default:
+	}
+	for i, other := range r.waiters {
+		if other == w {
+			r.waiters = append(r.waiters[:i], r.waiters[i+1:]...)
+			break
+		}
+	}
+	r.grantLocked()
+	l.mu.Unlock()
+	l.notify()
+	return false
+}
+
+// Release returns a resource held by the given test run.
+func (l *ResourceLocks) Release(name, testRunID string) error {
+	l.mu.Lock()
+	r, ok := l.resources[name]
+	if !ok {
+		l.mu.Unlock()
+		return fmt.Errorf("unknown resource %q", name)
+	}
+	if !r.removeHolder(testRunID) {
+		l.mu.Unlock()
+		return fmt.Errorf("resource %q is not held by this test", name)
+	}
+	r.grantLocked()
+	l.mu.Unlock()
+	l.notify()
+	return nil
+}
+
+// ReleaseAll returns every resource held by the given test run. Called when
+// a session ends so a finished, terminated, or aborted test never keeps a
+// shared line locked.
+func (l *ResourceLocks) ReleaseAll(testRunID string) {
+	l.mu.Lock()
+	changed := false
+	for _, r := range l.resources {
+		if r.removeHolder(testRunID) {
+			r.grantLocked()
+			changed = true
+		}
+	}
+	l.mu.Unlock()
+	if changed {
+		l.notify()
+	}
+}
+
+// Status returns a snapshot of all resources, sorted by name.
+func (l *ResourceLocks) Status() []ResourceStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	statuses := make([]ResourceStatus, 0, len(l.resources))
+	for name, r := range l.resources {
+		st := ResourceStatus{
+			Name:     name,
+			Capacity: r.capacity,
+			Holders:  append([]LockHolder{}, r.holders...),
+			Waiters:  make([]LockHolder, 0, len(r.waiters)),
+		}
+		for _, w := range r.waiters {
+			st.Waiters = append(st.Waiters, w.holder)
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// notify publishes a fresh snapshot. notifyMu keeps snapshots from
+// concurrent changes from being delivered out of order.
+func (l *ResourceLocks) notify() {
+	if l.onChange == nil {
+		return
+	}
+	l.notifyMu.Lock()
+	defer l.notifyMu.Unlock()
+	l.onChange(l.Status())
+}
+
+func (r *resourceState) heldBy(testRunID string) bool {
+	for _, h := range r.holders {
+		if h.TestRunID == testRunID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resourceState) removeHolder(testRunID string) bool {
+	for i, h := range r.holders {
+		if h.TestRunID == testRunID {
+			r.holders = append(r.holders[:i], r.holders[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// grantLocked moves waiters to holders while capacity allows. Caller holds l.mu.
+func (r *resourceState) grantLocked() {
+	for len(r.waiters) > 0 && len(r.holders) < r.capacity {
+		w := r.waiters[0]
+		r.waiters = r.waiters[1:]
+		w.holder.Since = time.Now()
+		r.holders = append(r.holders, w.holder)
+		close(w.granted)
+	}
+}
+
+// sessionLocker adapts ResourceLocks to executor.ResourceLocker for one
+// session.
+type sessionLocker struct {
+	locks  *ResourceLocks
+	holder LockHolder
+}
+
+func (sl *sessionLocker) Acquire(ctx context.Context, resource string, timeout time.Duration) error {
+	return sl.locks.Acquire(ctx, resource, sl.holder, timeout)
+}
+
+func (sl *sessionLocker) Release(resource string) error {
+	return sl.locks.Release(resource, sl.holder.TestRunID)
+}
@@ -0,0 +1,46 @@
+package testmanager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/holla2040/arturo/internal/script/profile"
+)
+
+// LoadSafeStates parses a comma-separated list of device profiles of the
+// form "PUMP-01=profiles/pumps/cti_onboard.yaml,station-02/PUMP-01=other.yaml"
+// and returns each profile's safe_state commands keyed by device. A key
+// may be a device ID, which applies on every station, or station/device,
+// which overrides it on one station.
+func LoadSafeStates(spec string) (map[string]*profile.SafeStateConfig, error) {
+	configs := make(map[string]*profile.SafeStateConfig)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		device, path, ok := strings.Cut(item, "=")
+		device, path = strings.TrimSpace(device), strings.TrimSpace(path)
+		if !ok || device == "" || path == "" {
+			return nil, fmt.Errorf("device profile %q: want DEVICE=profile.yaml", item)
+		}
+		if _, dup := configs[device]; dup {
+			return nil, fmt.Errorf("device profile for %s given twice", device)
+		}
+		p, err := profile.LoadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		configs[device] = p.SafeState
+	}
+	return configs, nil
+}
+
+// safeStateFor returns the safe-state commands for a device on a station,
+// preferring a station/device entry over a device entry. nil means none.
+func safeStateFor(configs map[string]*profile.SafeStateConfig, station, device string) *profile.SafeStateConfig {
+	if cfg, ok := configs[station+"/"+device]; ok {
+		return cfg
+	}
+	return configs[device]
+}
@@ -12,23 +12,43 @@ import (
 	"time"
 
 	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/scheduler"
 	"github.com/holla2040/arturo/internal/script/ast"
 	"github.com/holla2040/arturo/internal/script/executor"
 	"github.com/holla2040/arturo/internal/script/lexer"
 	"github.com/holla2040/arturo/internal/script/parser"
+	"github.com/holla2040/arturo/internal/script/profile"
+	"github.com/holla2040/arturo/internal/script/redisrouter"
 	"github.com/holla2040/arturo/internal/script/result"
 	"github.com/holla2040/arturo/internal/store"
-	"github.com/redis/go-redis/v9"
+	"github.com/holla2040/arturo/internal/transport"
 )
 
 // SessionState represents the state of a test session.
 type SessionState string
 
 const (
-	StateRunning SessionState = "testing"
-	StatePaused  SessionState = "paused"
+	StateRunning  SessionState = "testing"
+	StatePaused   SessionState = "paused"
+	StateStopping SessionState = "stopping" // terminate or abort in progress
 )
 
+// Pause timeout actions for PausePolicy.OnTimeout.
+const (
+	PauseTimeoutResume    = "resume"
+	PauseTimeoutTerminate = "terminate"
+)
+
+// PausePolicy bounds how long a session may stay paused. When MaxDuration
+// elapses the session is automatically resumed or terminated.
+type PausePolicy struct {
+	MaxDuration time.Duration // 0 = pause indefinitely
+	OnTimeout   string        // PauseTimeoutResume or PauseTimeoutTerminate
+}
+
+// safeStateTimeout bounds each safe-state command sent on pause/terminate/abort.
+const safeStateTimeout = 5 * time.Second
+
 // TestSession manages a single test execution on a station.
 type TestSession struct {
 	mu              sync.RWMutex
@@ -38,17 +58,25 @@ type TestSession struct {
 	stationInstance string
 	deviceID        string
 	scriptPath      string
+	scriptVersionID string
 	displayName     string
 	state           SessionState
 	startedAt       time.Time
 	employeeID      string
+	pausedAt        time.Time
+
+	pausePolicy     PausePolicy
+	safeState       *profile.SafeStateConfig
+	pauseTimer      *time.Timer
+	pauseGen        int // bumped on every pause/unpause so stale timers no-op
 
-	store           *store.Store
+	store           store.Store
 	hub             Broadcaster
 	pausableRouter  *PausableRouter
 	rawRouter       executor.DeviceRouter
 	collector       *result.Collector
-	rdb             *redis.Client
+	locks           *ResourceLocks
+	bus             transport.Streams
 	source          protocol.Source
 
 	cancel          context.CancelFunc
@@ -58,16 +86,25 @@ type TestSession struct {
 
 // SessionInfo provides read-only info about a session.
 type SessionInfo struct {
-	TestRunID       string       `json:"test_run_id"`
-	RMAID           string       `json:"rma_id"`
-	RMANumber       string       `json:"rma_number"`
-	StationInstance string       `json:"station_instance"`
-	DeviceID        string       `json:"device_id"`
-	ScriptPath      string       `json:"script_path"`
-	TestName        string       `json:"test_name"`
-	State           SessionState `json:"state"`
-	StartedAt       time.Time    `json:"started_at"`
-	EmployeeID      string       `json:"employee_id"`
+	TestRunID       string               `json:"test_run_id"`
+	RMAID           string               `json:"rma_id"`
+	RMANumber       string               `json:"rma_number"`
+	StationInstance string               `json:"station_instance"`
+	DeviceID        string               `json:"device_id"`
+	ScriptPath      string               `json:"script_path"`
+	ScriptVersionID string               `json:"script_version_id,omitempty"`
+	TestName        string               `json:"test_name"`
+	State           SessionState         `json:"state"`
+	StartedAt       time.Time            `json:"started_at"`
+	EmployeeID      string               `json:"employee_id"`
+	PausedAt        *time.Time           `json:"paused_at,omitempty"`
+	PauseDeadline   *time.Time           `json:"pause_deadline,omitempty"`
+	Commands        *redisrouter.Metrics `json:"commands,omitempty"` // device commands sent by this session
+}
+
+// metricsReporter is implemented by routers that count their commands.
+type metricsReporter interface {
+	Metrics() redisrouter.Metrics
 }
 
 // StartSessionParams contains everything needed to start a test.
@@ -76,61 +113,106 @@ type StartSessionParams struct {
 	RMAID           string
 	StationInstance string
 	DeviceID        string
-	ScriptPath      string
+	ScriptPath      string               // used when ScriptVersion is nil
+	ScriptVersion   *store.ScriptVersion // registry version; content is run instead of ScriptPath
 	EmployeeID      string
+	PausePolicy     PausePolicy
+	SafeState       *profile.SafeStateConfig // commands sent on pause/terminate/abort; nil = none
 	RawRouter       executor.DeviceRouter // bypasses pause for temp monitor
-	Store           *store.Store
+	Locks           *ResourceLocks        // shared resources for ACQUIRE/RELEASE; nil = none
+	Store           store.Store
 	Hub             Broadcaster
-	Rdb             *redis.Client
+	Bus             transport.Streams
 	Source          protocol.Source
 }
 
-// NewSession creates and starts a test session. It launches the executor
-// and temperature monitor as goroutines.
-func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, error) {
-	// Read and parse the script
-	source, err := os.ReadFile(params.ScriptPath)
-	if err != nil {
-		return nil, fmt.Errorf("read script: %w", err)
-	}
-
-	scriptContent := string(source)
-	scriptHash := fmt.Sprintf("%x", sha256.Sum256(source))
+// ScriptMeta is the metadata extracted from a parsed test script.
+type ScriptMeta struct {
+	TestName      string
+	ReportType    string
+	ReportVersion string
+}
 
-	tokens, lexErrors := lexer.New(scriptContent).Tokenize()
+// ParseScriptMeta lexes and parses a script and returns its TEST title and
+// the REPORT_TYPE / REPORT_VERSION constants, which every runnable script
+// must declare.
+func ParseScriptMeta(source string) (ScriptMeta, error) {
+	tokens, lexErrors := lexer.New(source).Tokenize()
 	if len(lexErrors) > 0 {
-		return nil, fmt.Errorf("script lex errors: %v", lexErrors[0].Error())
+		return ScriptMeta{}, fmt.Errorf("script lex errors: %v", lexErrors[0].Error())
 	}
 
 	program, parseErrors := parser.New(tokens).Parse()
 	if len(parseErrors) > 0 {
-		return nil, fmt.Errorf("script parse errors: %v", parseErrors[0].Error())
+		return ScriptMeta{}, fmt.Errorf("script parse errors: %v", parseErrors[0].Error())
 	}
 
-	// Extract descriptive test title from the AST
-	testTitle := extractTestTitle(program)
-	displayName := testTitle
-	if displayName == "" {
-		displayName = filepath.Base(params.ScriptPath)
-	}
-
-	// Extract and enforce report metadata
 	reportType, reportVersion := extractScriptMeta(program)
 	if reportType == "" || reportVersion == "" {
-		return nil, fmt.Errorf("script missing required CONST: REPORT_TYPE and REPORT_VERSION")
+		return ScriptMeta{}, fmt.Errorf("script missing required CONST: REPORT_TYPE and REPORT_VERSION")
+	}
+
+	return ScriptMeta{
+		TestName:      extractTestTitle(program),
+		ReportType:    reportType,
+		ReportVersion: reportVersion,
+	}, nil
+}
+
+// NewSession creates and starts a test session. It launches the executor
+// and temperature monitor as goroutines.
+func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, error) {
+	// Read the script from the registry version or from disk
+	scriptPath := params.ScriptPath
+	var scriptContent, scriptFile, scriptVersionID string
+	if params.ScriptVersion != nil {
+		scriptPath = params.ScriptVersion.Name
+		scriptVersionID = params.ScriptVersion.ID
+		scriptContent = params.ScriptVersion.Content
+		scriptFile = fmt.Sprintf("%s v%d", params.ScriptVersion.Name, params.ScriptVersion.Version)
+	} else {
+		source, err := os.ReadFile(params.ScriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("read script: %w", err)
+		}
+		scriptContent = string(source)
+		scriptFile = filepath.Base(params.ScriptPath)
+	}
+
+	// Parse the script and enforce report metadata
+	meta, err := ParseScriptMeta(scriptContent)
+	if err != nil {
+		return nil, err
+	}
+
+	// Descriptive test title, falling back to the file name
+	testTitle := meta.TestName
+	displayName := testTitle
+	if displayName == "" {
+		displayName = scriptFile
 	}
 
 	// Create test run in SQLite (store display name, not full path)
-	if err := params.Store.CreateTestRunWithRMA(
-		params.TestRunID, displayName, params.RMAID,
-		params.StationInstance, scriptHash, scriptContent,
-		reportType, reportVersion,
-	); err != nil {
-		return nil, fmt.Errorf("create test run: %w", err)
+	if params.ScriptVersion != nil {
+		if err := params.Store.CreateTestRunFromScriptVersion(
+			params.TestRunID, displayName, params.RMAID,
+			params.StationInstance, params.ScriptVersion,
+		); err != nil {
+			return nil, fmt.Errorf("create test run: %w", err)
+		}
+	} else {
+		scriptHash := fmt.Sprintf("%x", sha256.Sum256([]byte(scriptContent)))
+		if err := params.Store.CreateTestRunWithRMA(
+			params.TestRunID, displayName, params.RMAID,
+			params.StationInstance, scriptHash, scriptContent,
+			meta.ReportType, meta.ReportVersion,
+		); err != nil {
+			return nil, fmt.Errorf("create test run: %w", err)
+		}
 	}
 
 	// Record started event with both filename and title
-	startedDesc := filepath.Base(params.ScriptPath)
+	startedDesc := scriptFile
 	if testTitle != "" {
 		startedDesc += " - " + testTitle
 	}
@@ -140,7 +222,7 @@ func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, e
 	pausable := NewPausableRouter(params.RawRouter)
 
 	// Create result collector
-	collector := result.NewCollector(params.ScriptPath)
+	collector := result.NewCollector(scriptPath)
 
 	// Create cancellable contexts
 	execCtx, execCancel := context.WithCancel(ctx)
@@ -158,17 +240,21 @@ func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, e
 		rmaNumber:       rmaNumber,
 		stationInstance: params.StationInstance,
 		deviceID:        params.DeviceID,
-		scriptPath:      params.ScriptPath,
+		scriptPath:      scriptPath,
+		scriptVersionID: scriptVersionID,
 		displayName:     displayName,
 		state:           StateRunning,
 		startedAt:       time.Now(),
 		employeeID:      params.EmployeeID,
+		pausePolicy:     params.PausePolicy,
+		safeState:       params.SafeState,
 		store:           params.Store,
 		hub:             params.Hub,
 		pausableRouter:  pausable,
 		rawRouter:       params.RawRouter,
 		collector:       collector,
-		rdb:             params.Rdb,
+		locks:           params.Locks,
+		bus:             params.Bus,
 		source:          params.Source,
 		cancel:          execCancel,
 		tempCancel:      tempCancel,
@@ -184,13 +270,13 @@ func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, e
 			"test_run_id":      params.TestRunID,
 			"rma_id":           params.RMAID,
 			"rma_number":       rmaNumber,
-			"script_name":      params.ScriptPath,
+			"script_name":      scriptPath,
 			"started_at":       session.startedAt.Format(time.RFC3339Nano),
 		})
 	}
 
 	// Notify station display: test is running
-	session.notifyStation("running")
+	session.notifyStation(protocol.TestStateRunning)
 
 	// Start periodic test state updates to station display
 	go session.runStatusTicker(execCtx)
@@ -202,7 +288,7 @@ func NewSession(ctx context.Context, params StartSessionParams) (*TestSession, e
 	go tempMon.Run(tempCtx)
 
 	// Start executor in background
-	go session.runExecutor(execCtx, string(source))
+	go session.runExecutor(execCtx, scriptContent)
 
 	return session, nil
 }
@@ -212,7 +298,7 @@ type sessionEventEmitter struct {
 	testRunID       string
 	stationInstance string
 	employeeID      string
-	store           *store.Store
+	store           store.Store
 	hub             Broadcaster
 }
 
@@ -271,6 +357,9 @@ func extractTestTitle(program *ast.Program) string {
 func (s *TestSession) runExecutor(ctx context.Context, scriptSource string) {
 	defer close(s.doneCh)
 	defer s.tempCancel()
+	if s.locks != nil {
+		defer s.locks.ReleaseAll(s.testRunID)
+	}
 
 	tokens, _ := lexer.New(scriptSource).Tokenize()
 	program, _ := parser.New(tokens).Parse()
@@ -283,12 +372,19 @@ func (s *TestSession) runExecutor(ctx context.Context, scriptSource string) {
 		hub:             s.hub,
 	}
 
-	exec := executor.New(ctx,
+	opts := []executor.Option{
 		executor.WithRouter(s.pausableRouter),
 		executor.WithCollector(s.collector),
 		executor.WithEmitter(emitter),
 		executor.WithDeviceID(s.deviceID),
-	)
+	}
+	if s.locks != nil {
+		opts = append(opts, executor.WithLocker(&sessionLocker{
+			locks:  s.locks,
+			holder: LockHolder{StationInstance: s.stationInstance, TestRunID: s.testRunID},
+		}))
+	}
+	exec := executor.New(ctx, opts...)
 
 	execErr := exec.Execute(program)
 	report := s.collector.Finalize()
@@ -347,25 +443,39 @@ func (s *TestSession) finish(status, summary string) {
 		})
 	}
 
-	s.notifyStation("completed")
+	s.notifyStation(protocol.TestStateCompleted)
 }
 
 // Info returns a snapshot of the session state.
 func (s *TestSession) Info() SessionInfo {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return SessionInfo{
+	info := SessionInfo{
 		TestRunID:       s.testRunID,
 		RMAID:           s.rmaID,
 		RMANumber:       s.rmaNumber,
 		StationInstance: s.stationInstance,
 		DeviceID:        s.deviceID,
 		ScriptPath:      s.scriptPath,
+		ScriptVersionID: s.scriptVersionID,
 		TestName:        s.displayName,
 		State:           s.state,
 		StartedAt:       s.startedAt,
 		EmployeeID:      s.employeeID,
 	}
+	if mr, ok := s.rawRouter.(metricsReporter); ok {
+		m := mr.Metrics()
+		info.Commands = &m
+	}
+	if s.state == StatePaused {
+		pausedAt := s.pausedAt
+		info.PausedAt = &pausedAt
+		if s.pausePolicy.MaxDuration > 0 {
+			deadline := pausedAt.Add(s.pausePolicy.MaxDuration)
+			info.PauseDeadline = &deadline
+		}
+	}
+	return info
 }
 
 // Pause pauses the test execution (temperature monitoring continues).
@@ -379,6 +489,8 @@ func (s *TestSession) Pause(employeeID string) error {
 
 	s.pausableRouter.Pause()
 	s.state = StatePaused
+	s.pausedAt = time.Now()
+	s.startPauseTimer()
 
 	s.store.RecordTestEvent(s.testRunID, "paused", employeeID, "")
 	s.store.SetStationState(s.stationInstance, "paused", &s.testRunID)
@@ -401,7 +513,12 @@ func (s *TestSession) Pause(employeeID string) error {
 		})
 	}
 
-	s.notifyStation("paused")
+	s.notifyStation(protocol.TestStatePaused)
+
+	// Executor is blocked at its next command; make the pump safe meanwhile
+	if cmds := s.safeState.Commands("pause"); len(cmds) > 0 {
+		go s.applySafeState("pause", cmds, true)
+	}
 
 	return nil
 }
@@ -415,6 +532,7 @@ func (s *TestSession) Resume(employeeID string) error {
 		return fmt.Errorf("cannot resume: session is %s", s.state)
 	}
 
+	s.stopPauseTimer()
 	s.pausableRouter.Resume()
 	s.state = StateRunning
 
@@ -439,33 +557,24 @@ func (s *TestSession) Resume(employeeID string) error {
 		})
 	}
 
-	s.notifyStation("running")
+	s.notifyStation(protocol.TestStateRunning)
 
 	return nil
 }
 
 // Terminate stops the test but preserves all data.
 func (s *TestSession) Terminate(employeeID, reason string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.state != StateRunning && s.state != StatePaused {
-		return fmt.Errorf("cannot terminate: session is %s", s.state)
+	if err := s.stop("terminate"); err != nil {
+		return err
 	}
 
-	// If paused, resume first so the executor can exit cleanly
-	if s.state == StatePaused {
-		s.pausableRouter.Resume()
-	}
-
-	// Cancel the executor context
-	s.cancel()
-
-	// Wait for executor to finish
-	<-s.doneCh
-
 	// Record terminate event and update state
 	s.store.RecordTestEvent(s.testRunID, "terminated", employeeID, reason)
+	s.applySafeState("terminate", s.safeState.Commands("terminate"), true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.store.FinishTestRun(s.testRunID, "terminated", reason)
 	s.store.SetStationState(s.stationInstance, "idle", nil)
 
@@ -484,30 +593,22 @@ func (s *TestSession) Terminate(employeeID, reason string) error {
 		})
 	}
 
-	s.notifyStation("completed")
+	s.notifyStation(protocol.TestStateCompleted)
 
 	return nil
 }
 
 // Abort stops the test and discards all data.
 func (s *TestSession) Abort(employeeID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.state != StateRunning && s.state != StatePaused {
-		return fmt.Errorf("cannot abort: session is %s", s.state)
+	if err := s.stop("abort"); err != nil {
+		return err
 	}
 
-	// If paused, resume first
-	if s.state == StatePaused {
-		s.pausableRouter.Resume()
-	}
-
-	// Cancel the executor context
-	s.cancel()
+	// Test run data is discarded, so safe-state results are only broadcast
+	s.applySafeState("abort", s.safeState.Commands("abort"), false)
 
-	// Wait for executor to finish
-	<-s.doneCh
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// Delete test run data
 	if err := s.store.DeleteTestRun(s.testRunID); err != nil {
@@ -530,11 +631,126 @@ func (s *TestSession) Abort(employeeID string) error {
 		})
 	}
 
-	s.notifyStation("aborted")
+	s.notifyStation(protocol.TestStateAborted)
 
 	return nil
 }
 
+// stop moves a running or paused session to StateStopping, cancels the
+// executor and waits for it to exit. s.mu is released before waiting so
+// Info and the status endpoints are not held up by the executor or by the
+// safe-state commands the caller sends next.
+func (s *TestSession) stop(action string) error {
+	s.mu.Lock()
+	if s.state != StateRunning && s.state != StatePaused {
+		state := s.state
+		s.mu.Unlock()
+		return fmt.Errorf("cannot %s: session is %s", action, state)
+	}
+
+	// If paused, resume first so the executor can exit cleanly
+	s.stopPauseTimer()
+	if s.state == StatePaused {
+		s.pausableRouter.Resume()
+	}
+	s.state = StateStopping
+
+	// Cancel the executor context
+	s.cancel()
+	s.mu.Unlock()
+
+	// Wait for executor to finish
+	<-s.doneCh
+	return nil
+}
+
+// startPauseTimer arms the pause timeout, if any. Caller holds s.mu.
+func (s *TestSession) startPauseTimer() {
+	s.pauseGen++
+	if s.pausePolicy.MaxDuration <= 0 {
+		return
+	}
+	gen := s.pauseGen
+	s.pauseTimer = time.AfterFunc(s.pausePolicy.MaxDuration, func() {
+		s.pauseExpired(gen)
+	})
+}
+
+// stopPauseTimer disarms the pause timeout. Caller holds s.mu.
+func (s *TestSession) stopPauseTimer() {
+	s.pauseGen++
+	if s.pauseTimer != nil {
+		s.pauseTimer.Stop()
+		s.pauseTimer = nil
+	}
+}
+
+// pauseExpired is called when a pause outlives PausePolicy.MaxDuration. It
+// records the automatic action and then resumes or terminates the session.
+func (s *TestSession) pauseExpired(gen int) {
+	s.mu.RLock()
+	stale := gen != s.pauseGen || s.state != StatePaused
+	s.mu.RUnlock()
+	if stale {
+		return
+	}
+
+	action := s.pausePolicy.OnTimeout
+	if action != PauseTimeoutResume {
+		action = PauseTimeoutTerminate
+	}
+	detail := fmt.Sprintf("paused longer than %s, auto-%s", s.pausePolicy.MaxDuration, action)
+	s.recordAutoEvent("pause_timeout", detail, true)
+
+	var err error
+	if action == PauseTimeoutResume {
+		err = s.Resume("system")
+	} else {
+		err = s.Terminate("system", "pause timeout exceeded")
+	}
+	if err != nil {
+		log.Printf("testmanager: pause timeout %s on %s: %v", action, s.stationInstance, err)
+	}
+}
+
+// applySafeState sends the given safe-state commands to the session's device
+// over the raw router (bypassing pause) and records one event per command.
+// When persist is false (abort) the events are only broadcast.
+func (s *TestSession) applySafeState(action string, commands []string, persist bool) {
+	for _, cmd := range commands {
+		ctx, cancel := context.WithTimeout(scheduler.WithLane(context.Background(), scheduler.LaneSafety), safeStateTimeout)
+		res, err := s.rawRouter.SendCommand(ctx, s.deviceID, cmd, nil, int(safeStateTimeout/time.Millisecond))
+		cancel()
+
+		detail := fmt.Sprintf("%s: %s ok", action, cmd)
+		if err != nil {
+			detail = fmt.Sprintf("%s: %s failed: %v", action, cmd, err)
+		} else if !res.Success {
+			detail = fmt.Sprintf("%s: %s failed: %s", action, cmd, res.Response)
+		}
+		s.recordAutoEvent("safe_state", detail, persist)
+	}
+}
+
+// recordAutoEvent records an event for an action the controller took on its
+// own (no operator), and broadcasts it to the terminal.
+func (s *TestSession) recordAutoEvent(eventType, detail string, persist bool) {
+	log.Printf("testmanager: %s %s: %s", s.stationInstance, eventType, detail)
+	if persist {
+		s.store.RecordTestEvent(s.testRunID, eventType, "system", detail)
+	}
+	if s.hub != nil {
+		s.hub.BroadcastEvent("test_event", map[string]interface{}{
+			"test_run_id":      s.testRunID,
+			"event_type":       eventType,
+			"station_instance": s.stationInstance,
+			"employee_id":      "system",
+			"reason":           detail,
+			"timestamp":        time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+}
+
 // Done returns a channel that's closed when the session completes.
 func (s *TestSession) Done() <-chan struct{} {
 	return s.doneCh
@@ -561,29 +777,22 @@ func (s *TestSession) runStatusTicker(ctx context.Context) {
 			s.mu.RUnlock()
 
 			if state == StateRunning && ctx.Err() == nil {
-				s.notifyStation("running")
+				s.notifyStation(protocol.TestStateRunning)
 			}
 		}
 	}
 }
 
-// notifyStation publishes a test.state.update message to the station's command
-// channel so the station display can show test status and lock out manual controls.
+// notifyStation sends a test.state.update message on the station's command
+// stream so the station display can show test status and lock out manual controls.
 func (s *TestSession) notifyStation(state string) {
-	if s.rdb == nil {
+	if s.bus == nil {
 		return
 	}
 
 	elapsed := uint32(time.Since(s.startedAt).Seconds())
 
-	payload := map[string]interface{}{
-		"state":           state,
-		"test_id":         s.testRunID,
-		"test_name":       s.displayName,
-		"elapsed_seconds": elapsed,
-	}
-
-	msg, err := protocol.NewMessage(s.source, protocol.TypeTestStateUpdate, payload)
+	msg, err := protocol.BuildTestStateUpdate(s.source, state, s.testRunID, s.displayName, elapsed)
 	if err != nil {
 		log.Printf("testmanager: build test.state.update: %v", err)
 		return
@@ -595,8 +804,8 @@ func (s *TestSession) notifyStation(state string) {
 		return
 	}
 
-	channel := "commands:" + s.stationInstance
-	if err := s.rdb.Publish(context.Background(), channel, string(data)).Err(); err != nil {
-		log.Printf("testmanager: publish test.state.update to %s: %v", channel, err)
+	stream := transport.CommandStream(s.stationInstance)
+	if err := s.bus.Send(context.Background(), stream, data); err != nil {
+		log.Printf("testmanager: send test.state.update to %s: %v", stream, err)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/holla2040/arturo/internal/regen"
+	"github.com/holla2040/arturo/internal/scheduler"
 	"github.com/holla2040/arturo/internal/script/executor"
 	"github.com/holla2040/arturo/internal/store"
 )
@@ -30,7 +31,7 @@ type tempTelemetry struct {
 // docs/architecture/TEST_EVENTS.md.
 type TempMonitor struct {
 	router          executor.DeviceRouter // raw router, NOT PausableRouter
-	store           *store.Store
+	store           store.Store
 	hub             Broadcaster
 	testRunID       string
 	stationInstance string
@@ -44,7 +45,7 @@ type TempMonitor struct {
 
 // NewTempMonitor creates a temperature monitor. startedAt is used to format
 // the elapsed-time field in emitted regen_state events.
-func NewTempMonitor(router executor.DeviceRouter, st *store.Store, hub Broadcaster, testRunID, stationInstance, deviceID, employeeID string, startedAt time.Time) *TempMonitor {
+func NewTempMonitor(router executor.DeviceRouter, st store.Store, hub Broadcaster, testRunID, stationInstance, deviceID, employeeID string, startedAt time.Time) *TempMonitor {
 	return &TempMonitor{
 		router:          router,
 		store:           st,
@@ -79,7 +80,7 @@ func (tm *TempMonitor) Run(ctx context.Context) {
 func (tm *TempMonitor) sample(ctx context.Context) {
 	// One cache-served get_telemetry query replaces two individual temp
 	// queries. See docs/architecture/ARCHITECTURE.md §4.6.
-	result, err := tm.router.SendCommand(ctx, tm.deviceID, "get_telemetry", nil, 5000)
+	result, err := tm.router.SendCommand(scheduler.WithLane(ctx, scheduler.LaneTelemetry), tm.deviceID, "get_telemetry", nil, 5000)
 	if err != nil {
 		if ctx.Err() != nil {
 			return // Context cancelled, shutting down
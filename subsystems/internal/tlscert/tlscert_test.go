@@ -0,0 +1,60 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	created, err := LoadOrCreate(certFile, keyFile, []string{"localhost", "127.0.0.1"})
+	if err != nil || !created {
+		t.Fatalf("LoadOrCreate = %v, %v; want created", created, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file should be private, got %v %v", info.Mode(), err)
+	}
+	before, _ := os.ReadFile(certFile)
+	if created, err := LoadOrCreate(certFile, keyFile, nil); err != nil || created {
+		t.Fatalf("second LoadOrCreate = %v, %v; want existing pair", created, err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Error("existing certificate was replaced")
+	}
+
+	// A client trusting the certificate can reach a server using it.
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool, err := LoadCertPool(certFile)
+	if err != nil {
+		t.Fatalf("LoadCertPool failed: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("TLS request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestLoadOrCreateMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	os.WriteFile(certFile, []byte("not a cert"), 0o644)
+	if _, err := LoadOrCreate(certFile, filepath.Join(dir, "tls.key"), nil); err == nil {
+		t.Error("expected error when only one of the pair exists")
+	}
+}
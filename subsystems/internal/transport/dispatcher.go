@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"sync"
+
+	"github.com/holla2040/arturo/internal/protocol"
+)
+
+// Dispatcher routes responses read by ListenResponses to the callers
+// waiting for them, by correlation ID. One Dispatcher serves every waiter
+// in a process (API handlers, pollers, script routers).
+type Dispatcher struct {
+	mu      sync.Mutex
+	waiters map[string]chan *protocol.Message
+	// Waiters whose request was coalesced into another's (see Follow),
+	// keyed by the leader's correlation ID, and the reverse.
+	followers map[string][]string
+	leaders   map[string]string
+}
+
+// NewDispatcher creates a new dispatcher.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		waiters:   make(map[string]chan *protocol.Message),
+		followers: make(map[string][]string),
+		leaders:   make(map[string]string),
+	}
+}
+
+// Register creates a buffered channel for the given correlation ID
+// and returns it. The caller should select on this channel with a timeout.
+func (d *Dispatcher) Register(correlationID string) chan *protocol.Message {
+	ch := make(chan *protocol.Message, 1)
+	d.mu.Lock()
+	d.waiters[correlationID] = ch
+	d.mu.Unlock()
+	return ch
+}
+
+// Follow makes the registered waiter for correlationID also receive the
+// response to leader, as a copy carrying its own correlation ID, so an
+// identical request need not be sent twice. It reports false, and changes
+// nothing, if either has no waiter or leader's response has already come.
+func (d *Dispatcher) Follow(correlationID, leader string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.waiters[correlationID]; !ok {
+		return false
+	}
+	if _, ok := d.waiters[leader]; !ok && len(d.followers[leader]) == 0 {
+		return false
+	}
+	d.followers[leader] = append(d.followers[leader], correlationID)
+	d.leaders[correlationID] = leader
+	return true
+}
+
+// Awaited reports whether a response to correlationID is still wanted, by
+// its own waiter or by one following it.
+func (d *Dispatcher) Awaited(correlationID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.waiters[correlationID]
+	return ok || len(d.followers[correlationID]) > 0
+}
+
+// Dispatch sends a response message to the waiter registered for its
+// correlation ID, and a copy to each waiter following it. Returns true if
+// a waiter was found.
+func (d *Dispatcher) Dispatch(msg *protocol.Message) bool {
+	cid := msg.Envelope.CorrelationID
+	d.mu.Lock()
+	ch, ok := d.waiters[cid]
+	if ok {
+		delete(d.waiters, cid)
+	}
+	copies := make(map[chan *protocol.Message]*protocol.Message)
+	for _, f := range d.followers[cid] {
+		delete(d.leaders, f)
+		if fch, found := d.waiters[f]; found {
+			delete(d.waiters, f)
+			dup := *msg
+			dup.Envelope.CorrelationID = f
+			copies[fch] = &dup
+		}
+	}
+	delete(d.followers, cid)
+	d.mu.Unlock()
+
+	if ok {
+		ch <- msg
+	}
+	for fch, dup := range copies {
+		fch <- dup
+	}
+	return ok || len(copies) > 0
+}
+
+// Deregister removes a waiter without sending a response.
+// Used for cleanup after timeout.
+func (d *Dispatcher) Deregister(correlationID string) {
+	d.mu.Lock()
+	ch, ok := d.waiters[correlationID]
+	if ok {
+		delete(d.waiters, correlationID)
+		close(ch)
+	}
+	if leader, following := d.leaders[correlationID]; following {
+		delete(d.leaders, correlationID)
+		d.followers[leader] = without(d.followers[leader], correlationID)
+		if len(d.followers[leader]) == 0 {
+			delete(d.followers, leader)
+		}
+	}
+	d.mu.Unlock()
+}
+
+// PendingCount returns the number of active waiters (for diagnostics).
+func (d *Dispatcher) PendingCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.waiters)
+}
+
+func without(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
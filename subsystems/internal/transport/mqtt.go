@@ -0,0 +1,473 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/holla2040/arturo/internal/streams"
+)
+
+// DefaultTopicPrefix is prepended to every MQTT topic.
+const DefaultTopicPrefix = "arturo/"
+
+// mqttTimeout bounds connect, subscribe and publish round trips.
+const mqttTimeout = 10 * time.Second
+
+// MQTTOptions configures an MQTT transport.
+type MQTTOptions struct {
+	Broker   string // e.g. tcp://localhost:1883 or ssl://broker:8883
+	ClientID string // must be stable: the broker keeps undelivered commands for this session
+	Username string
+	Password string
+	// TopicPrefix namespaces every topic (default DefaultTopicPrefix).
+	TopicPrefix string
+}
+
+// MQTT is the MQTT backend. Names map to topics by replacing ":" with "/"
+// under a prefix, so "commands:station-01" is "arturo/commands/station-01"
+// and "events:*" subscribes to "arturo/events/+".
+//
+// Streams are QoS 1 topics read over a persistent session (clean session
+// off) with manual acknowledgement: a command published while a station is
+// disconnected is queued by the broker, and one received but not
+// acknowledged is delivered again when it reconnects. Unlike Redis Streams
+// there is no history, so a station only receives commands published after
+// its session first subscribed, and each stream should have one consumer.
+// Presence is a retained message holding the expiry time, and Claim
+// remembers correlation IDs in this process only: the broker has no atomic
+// set-if-absent, so a command redelivered to another process, or to this
+// one after a restart, is executed again.
+type MQTT struct {
+	opts   MQTTOptions
+	client paho.Client
+
+	mu       sync.Mutex
+	queues   map[string]*mqttQueue // by topic
+	subRefs  map[string]int        // pub/sub filter subscription counts
+	alive    map[string]time.Time  // presence expiry by instance
+	claimed  map[string]time.Time  // correlation ID claim expiry
+	nextID   uint64
+	inflight map[string]paho.Message // delivered stream entries awaiting Ack
+}
+
+// mqttQueue buffers the entries of one stream topic until a consumer reads
+// them.
+type mqttQueue struct {
+	ch         chan Message
+	subscribed bool
+}
+
+// NewMQTT connects to the broker in opts.
+func NewMQTT(opts MQTTOptions) (*MQTT, error) {
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = DefaultTopicPrefix
+	}
+	if opts.ClientID == "" {
+		return nil, errors.New("mqtt: client ID is required")
+	}
+	m := &MQTT{
+		opts:     opts,
+		queues:   map[string]*mqttQueue{},
+		subRefs:  map[string]int{},
+		alive:    map[string]time.Time{},
+		claimed:  map[string]time.Time{},
+		inflight: map[string]paho.Message{},
+	}
+
+	co := m.clientOptions(opts.ClientID).
+		SetCleanSession(false).
+		SetAutoAckDisabled(true).
+		SetDefaultPublishHandler(m.unrouted).
+		SetOnConnectHandler(func(c paho.Client) { m.resubscribe(c) })
+	m.client = paho.NewClient(co)
+	if err := wait(m.client.Connect()); err != nil {
+		return nil, fmt.Errorf("mqtt connect %s: %w", opts.Broker, err)
+	}
+	return m, nil
+}
+
+func (m *MQTT) clientOptions(clientID string) *paho.ClientOptions {
+	return paho.NewClientOptions().
+		AddBroker(m.opts.Broker).
+		SetClientID(clientID).
+		SetUsername(m.opts.Username).
+		SetPassword(m.opts.Password).
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetConnectTimeout(mqttTimeout)
+}
+
+// resubscribe restores the presence subscription after every (re)connect.
+// Stream and pub/sub subscriptions are kept by the broker's session.
+func (m *MQTT) resubscribe(c paho.Client) {
+	c.Subscribe(m.topic(PresenceKey("*")), 1, func(_ paho.Client, msg paho.Message) {
+		msg.Ack()
+		instance := InstanceFromName(m.name(msg.Topic()))
+		expires, err := strconv.ParseInt(string(msg.Payload()), 10, 64)
+		m.mu.Lock()
+		if err != nil || len(msg.Payload()) == 0 {
+			delete(m.alive, instance)
+		} else {
+			m.alive[instance] = time.UnixMilli(expires)
+		}
+		m.mu.Unlock()
+	})
+}
+
+// unrouted handles messages no subscription in this process routes:
+// stream entries queued for the persistent session, which arrive before
+// Consume subscribes again, and events on subscriptions a previous run of
+// the process left in the session, which are dropped.
+func (m *MQTT) unrouted(_ paho.Client, msg paho.Message) {
+	name := m.name(msg.Topic())
+	if strings.HasPrefix(name, "commands:") || strings.HasPrefix(name, "responses:") {
+		m.deliver(msg)
+		return
+	}
+	msg.Ack()
+}
+
+// topic maps a name to an MQTT topic or filter.
+func (m *MQTT) topic(name string) string {
+	parts := strings.Split(name, ":")
+	for i, p := range parts {
+		if p == "*" {
+			parts[i] = "+"
+		}
+	}
+	return m.opts.TopicPrefix + strings.Join(parts, "/")
+}
+
+// name maps an MQTT topic back to a name.
+func (m *MQTT) name(topic string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(topic, m.opts.TopicPrefix), "/", ":")
+}
+
+// wait waits for a paho token, bounded by mqttTimeout.
+func wait(t paho.Token) error {
+	if !t.WaitTimeout(mqttTimeout) {
+		return errors.New("mqtt: timed out")
+	}
+	return t.Error()
+}
+
+// Ping implements Transport.
+func (m *MQTT) Ping(ctx context.Context) error {
+	if !m.client.IsConnectionOpen() {
+		return errors.New("mqtt: not connected")
+	}
+	return nil
+}
+
+// Close implements Transport.
+func (m *MQTT) Close() error {
+	m.client.Disconnect(250)
+	return nil
+}
+
+// Publish implements PubSub.
+func (m *MQTT) Publish(ctx context.Context, channel string, data []byte) error {
+	return wait(m.client.Publish(m.topic(channel), 1, false, data))
+}
+
+// Subscribe implements PubSub.
+func (m *MQTT) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	sub := &mqttSubscription{m: m, sink: newSink()}
+	for _, c := range channels {
+		filter := m.topic(c)
+		err := wait(m.client.Subscribe(filter, 1, func(_ paho.Client, msg paho.Message) {
+			msg.Ack()
+			sub.send(Message{Channel: m.name(msg.Topic()), Data: msg.Payload()})
+		}))
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("mqtt subscribe %s: %w", filter, err)
+		}
+		m.mu.Lock()
+		m.subRefs[filter]++
+		m.mu.Unlock()
+		sub.filters = append(sub.filters, filter)
+	}
+	return sub, nil
+}
+
+// sink is a message channel fed by paho handlers, which may still be
+// running when the subscription is closed.
+type sink struct {
+	ch     chan Message
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+	once   sync.Once
+}
+
+func newSink() *sink {
+	return &sink{ch: make(chan Message, 100), done: make(chan struct{})}
+}
+
+func (s *sink) Messages() <-chan Message { return s.ch }
+
+// send delivers msg unless the sink is closed first.
+func (s *sink) send(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- msg:
+	case <-s.done:
+	}
+}
+
+// close releases blocked senders, then closes the channel. It reports
+// whether this call did so.
+func (s *sink) close() bool {
+	first := false
+	s.once.Do(func() {
+		first = true
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+	return first
+}
+
+type mqttSubscription struct {
+	*sink
+	m       *MQTT
+	filters []string
+}
+
+// Close unsubscribes filters no other subscription of this transport
+// still uses.
+func (s *mqttSubscription) Close() error {
+	if s.close() {
+		var unused []string
+		s.m.mu.Lock()
+		for _, f := range s.filters {
+			if s.m.subRefs[f]--; s.m.subRefs[f] <= 0 {
+				delete(s.m.subRefs, f)
+				unused = append(unused, f)
+			}
+		}
+		s.m.mu.Unlock()
+		if len(unused) > 0 {
+			s.m.client.Unsubscribe(unused...).WaitTimeout(mqttTimeout)
+		}
+	}
+	return nil
+}
+
+// Send implements Streams.
+func (m *MQTT) Send(ctx context.Context, stream string, data []byte) error {
+	return wait(m.client.Publish(m.topic(stream), 1, false, data))
+}
+
+// Reply implements Streams.
+func (m *MQTT) Reply(ctx context.Context, stream string, data []byte) error {
+	return m.Send(ctx, stream, data)
+}
+
+// queue returns the queue for a stream topic, creating it if needed.
+func (m *MQTT) queue(topic string) *mqttQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[topic]
+	if !ok {
+		q = &mqttQueue{ch: make(chan Message, 100)}
+		m.queues[topic] = q
+	}
+	return q
+}
+
+// deliver hands a stream entry to its queue. It blocks while the queue is
+// full, leaving the entry unacknowledged with the broker.
+func (m *MQTT) deliver(msg paho.Message) {
+	q := m.queue(msg.Topic())
+	m.mu.Lock()
+	m.nextID++
+	id := strconv.FormatUint(m.nextID, 10)
+	m.inflight[id] = msg
+	m.mu.Unlock()
+	q.ch <- Message{Channel: m.name(msg.Topic()), ID: id, Data: msg.Payload()}
+}
+
+// CreateGroup implements Streams by subscribing this client's persistent
+// session to the stream, so the broker queues its entries from now on.
+func (m *MQTT) CreateGroup(ctx context.Context, stream, group, start string) error {
+	topic := m.topic(stream)
+	q := m.queue(topic)
+	m.mu.Lock()
+	subscribed := q.subscribed
+	m.mu.Unlock()
+	if subscribed {
+		return nil
+	}
+	if err := wait(m.client.Subscribe(topic, 1, func(_ paho.Client, msg paho.Message) { m.deliver(msg) })); err != nil {
+		return fmt.Errorf("mqtt subscribe %s: %w", topic, err)
+	}
+	m.mu.Lock()
+	q.subscribed = true
+	m.mu.Unlock()
+	return nil
+}
+
+// Consume implements Streams. group and start only matter to Redis: the
+// broker session is the group, and it starts when first subscribed.
+func (m *MQTT) Consume(stream, group, name, start string, block time.Duration) Consumer {
+	if block <= 0 {
+		block = 5 * time.Second
+	}
+	return &mqttConsumer{m: m, stream: stream, group: group, block: block}
+}
+
+type mqttConsumer struct {
+	m      *MQTT
+	stream string
+	group  string
+	block  time.Duration
+}
+
+func (c *mqttConsumer) Read(ctx context.Context) ([]Message, error) {
+	if err := c.m.CreateGroup(ctx, c.stream, c.group, ""); err != nil {
+		return nil, err
+	}
+	q := c.m.queue(c.m.topic(c.stream))
+
+	timer := time.NewTimer(c.block)
+	defer timer.Stop()
+	var msgs []Message
+	select {
+	case msg := <-q.ch:
+		msgs = append(msgs, msg)
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for len(msgs) < 10 {
+		select {
+		case msg := <-q.ch:
+			msgs = append(msgs, msg)
+		default:
+			return msgs, nil
+		}
+	}
+	return msgs, nil
+}
+
+// Ack sends the PUBACK for an entry; until then the broker redelivers it
+// after a reconnect.
+func (c *mqttConsumer) Ack(ctx context.Context, id string) error {
+	c.m.mu.Lock()
+	msg, ok := c.m.inflight[id]
+	delete(c.m.inflight, id)
+	c.m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("mqtt: unknown entry %s", id)
+	}
+	msg.Ack()
+	return nil
+}
+
+// Recover is a no-op: the broker redelivers unacknowledged entries itself.
+func (c *mqttConsumer) Recover() {}
+
+// Claim implements Streams. Claims are kept in memory for
+// streams.DedupTTL, which covers redelivery within one process only;
+// unlike the Redis backend it does not stop another consumer of the same
+// station, or this process once restarted, from executing the command
+// again.
+func (m *MQTT) Claim(ctx context.Context, instance, correlationID string) (bool, error) {
+	key := streams.DedupKey(instance, correlationID)
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, exp := range m.claimed {
+		if now.After(exp) {
+			delete(m.claimed, k)
+		}
+	}
+	if _, ok := m.claimed[key]; ok {
+		return false, nil
+	}
+	m.claimed[key] = now.Add(streams.DedupTTL)
+	return true, nil
+}
+
+// Watch implements Streams with a separate clean-session connection that
+// receives copies of commands and responses without acknowledging them
+// for the real consumers.
+func (m *MQTT) Watch(ctx context.Context) (Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &mqttWatch{sink: newSink(), cancel: cancel}
+
+	id := fmt.Sprintf("%s-watch-%d", m.opts.ClientID, time.Now().UnixNano())
+	client := paho.NewClient(m.clientOptions(id).SetCleanSession(true))
+	if err := wait(client.Connect()); err != nil {
+		cancel()
+		return nil, fmt.Errorf("mqtt connect %s: %w", m.opts.Broker, err)
+	}
+	handler := func(_ paho.Client, msg paho.Message) {
+		sub.send(Message{Channel: m.name(msg.Topic()), Data: msg.Payload()})
+	}
+	filters := map[string]byte{m.topic("commands:*"): 0, m.topic("responses:*"): 0}
+	if err := wait(client.SubscribeMultiple(filters, handler)); err != nil {
+		cancel()
+		client.Disconnect(0)
+		return nil, fmt.Errorf("mqtt subscribe: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		sub.close()
+		client.Disconnect(250)
+	}()
+	return sub, nil
+}
+
+// mqttWatch is a Watch subscription; its connection closes with it.
+type mqttWatch struct {
+	*sink
+	cancel context.CancelFunc
+}
+
+func (w *mqttWatch) Close() error {
+	w.cancel()
+	return nil
+}
+
+// SetAlive implements Presence with a retained message holding the expiry
+// time, so a station that vanishes without clearing it still expires.
+func (m *MQTT) SetAlive(ctx context.Context, instance string, ttl time.Duration) error {
+	expires := strconv.FormatInt(time.Now().Add(ttl).UnixMilli(), 10)
+	return wait(m.client.Publish(m.topic(PresenceKey(instance)), 1, true, expires))
+}
+
+// ClearAlive implements Presence by deleting the retained message.
+func (m *MQTT) ClearAlive(ctx context.Context, instance string) error {
+	return wait(m.client.Publish(m.topic(PresenceKey(instance)), 1, true, []byte{}))
+}
+
+// Alive implements Presence from the retained presence messages this
+// client has received.
+func (m *MQTT) Alive(ctx context.Context) (map[string]time.Duration, error) {
+	now := time.Now()
+	alive := map[string]time.Duration{}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for instance, exp := range m.alive {
+		if ttl := exp.Sub(now); ttl > 0 {
+			alive[instance] = ttl
+		}
+	}
+	return alive, nil
+}
@@ -0,0 +1,278 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holla2040/arturo/internal/streams"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is the Redis backend: Pub/Sub for events, Streams with consumer
+// groups for commands and responses, and keys with a TTL for presence.
+type Redis struct {
+	rdb *redis.Client
+}
+
+// NewRedis returns a transport over a connected go-redis client. Closing
+// the transport closes the client.
+func NewRedis(rdb *redis.Client) *Redis {
+	return &Redis{rdb: rdb}
+}
+
+// Client returns the underlying go-redis client, for Redis-only features
+// such as health monitoring and ACL administration.
+func (r *Redis) Client() *redis.Client {
+	return r.rdb
+}
+
+// Ping implements Transport.
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
+
+// Close implements Transport.
+func (r *Redis) Close() error {
+	return r.rdb.Close()
+}
+
+// Publish implements PubSub.
+func (r *Redis) Publish(ctx context.Context, channel string, data []byte) error {
+	return r.rdb.Publish(ctx, channel, data).Err()
+}
+
+// Subscribe implements PubSub. Channels containing "*" are subscribed as
+// patterns.
+func (r *Redis) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	var exact, patterns []string
+	for _, c := range channels {
+		if strings.Contains(c, "*") {
+			patterns = append(patterns, c)
+		} else {
+			exact = append(exact, c)
+		}
+	}
+
+	ps := r.rdb.Subscribe(ctx)
+	if len(exact) > 0 {
+		if err := ps.Subscribe(ctx, exact...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+	if len(patterns) > 0 {
+		if err := ps.PSubscribe(ctx, patterns...); err != nil {
+			ps.Close()
+			return nil, err
+		}
+	}
+
+	sub := &redisSubscription{ps: ps, ch: make(chan Message, 100), done: make(chan struct{})}
+	go func() {
+		defer close(sub.ch)
+		for m := range ps.Channel() {
+			select {
+			case sub.ch <- Message{Channel: m.Channel, Data: []byte(m.Payload)}:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+type redisSubscription struct {
+	ps   *redis.PubSub
+	ch   chan Message
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *redisSubscription) Messages() <-chan Message { return s.ch }
+
+func (s *redisSubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.ps.Close()
+}
+
+// Send implements Streams.
+func (r *Redis) Send(ctx context.Context, stream string, data []byte) error {
+	_, err := streams.Send(ctx, r.rdb, stream, data)
+	return err
+}
+
+// Reply implements Streams.
+func (r *Redis) Reply(ctx context.Context, stream string, data []byte) error {
+	_, err := streams.Reply(ctx, r.rdb, stream, data)
+	return err
+}
+
+// Consume implements Streams.
+func (r *Redis) Consume(stream, group, name, start string, block time.Duration) Consumer {
+	c := streams.NewConsumer(r.rdb, stream, group, name, start)
+	if block > 0 {
+		c.Block = block
+	}
+	return redisConsumer{c}
+}
+
+type redisConsumer struct {
+	c *streams.Consumer
+}
+
+func (c redisConsumer) Read(ctx context.Context) ([]Message, error) {
+	entries, err := c.c.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]Message, len(entries))
+	for i, e := range entries {
+		msgs[i] = Message{Channel: c.c.Stream(), ID: e.ID, Data: e.Data}
+	}
+	return msgs, nil
+}
+
+func (c redisConsumer) Ack(ctx context.Context, id string) error { return c.c.Ack(ctx, id) }
+func (c redisConsumer) Recover()                                 { c.c.Recover() }
+
+// CreateGroup implements Streams.
+func (r *Redis) CreateGroup(ctx context.Context, stream, group, start string) error {
+	return streams.CreateGroup(ctx, r.rdb, stream, group, start)
+}
+
+// Claim implements Streams.
+func (r *Redis) Claim(ctx context.Context, instance, correlationID string) (bool, error) {
+	return streams.Claim(ctx, r.rdb, instance, correlationID)
+}
+
+// Watch implements Streams. It follows every commands:* and responses:*
+// stream with XREAD, picking up new streams as they appear.
+func (r *Redis) Watch(ctx context.Context) (Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &watchSubscription{ch: make(chan Message, 100), cancel: cancel}
+	go func() {
+		defer close(sub.ch)
+		r.watch(ctx, sub.ch)
+	}()
+	return sub, nil
+}
+
+func (r *Redis) watch(ctx context.Context, out chan<- Message) {
+	lastIDs := map[string]string{}
+	for ctx.Err() == nil {
+		for _, pattern := range []string{"commands:*", "responses:*"} {
+			iter := r.rdb.ScanType(ctx, 0, pattern, 100, "stream").Iterator()
+			for iter.Next(ctx) {
+				if _, ok := lastIDs[iter.Val()]; !ok {
+					lastIDs[iter.Val()] = "$"
+				}
+			}
+		}
+		if len(lastIDs) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		args := &redis.XReadArgs{Count: 100, Block: time.Second}
+		keys := make([]string, 0, len(lastIDs))
+		for key := range lastIDs {
+			keys = append(keys, key)
+		}
+		args.Streams = append(args.Streams, keys...)
+		for _, key := range keys {
+			args.Streams = append(args.Streams, lastIDs[key])
+		}
+
+		results, err := r.rdb.XRead(ctx, args).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("watch: command/response stream read: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(2 * time.Second):
+				}
+			}
+			continue
+		}
+
+		for _, stream := range results {
+			for _, xmsg := range stream.Messages {
+				lastIDs[stream.Stream] = xmsg.ID
+				data, ok := entryData(xmsg.Values)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- Message{Channel: stream.Stream, ID: xmsg.ID, Data: []byte(data)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// entryData returns the message held by a stream entry: the streams.Field
+// value, or for entries written by older tools "data" or any other field.
+func entryData(values map[string]interface{}) (string, bool) {
+	for _, field := range []string{streams.Field, "data"} {
+		if s, ok := values[field].(string); ok {
+			return s, true
+		}
+	}
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// watchSubscription is a Subscription fed by a goroutine that stops when
+// it is closed.
+type watchSubscription struct {
+	ch     chan Message
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (s *watchSubscription) Messages() <-chan Message { return s.ch }
+
+func (s *watchSubscription) Close() error {
+	s.once.Do(s.cancel)
+	return nil
+}
+
+// SetAlive implements Presence.
+func (r *Redis) SetAlive(ctx context.Context, instance string, ttl time.Duration) error {
+	return r.rdb.Set(ctx, PresenceKey(instance), "1", ttl).Err()
+}
+
+// ClearAlive implements Presence.
+func (r *Redis) ClearAlive(ctx context.Context, instance string) error {
+	return r.rdb.Del(ctx, PresenceKey(instance)).Err()
+}
+
+// Alive implements Presence.
+func (r *Redis) Alive(ctx context.Context) (map[string]time.Duration, error) {
+	alive := map[string]time.Duration{}
+	iter := r.rdb.Scan(ctx, 0, PresenceKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		ttl, err := r.rdb.TTL(ctx, iter.Val()).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			alive[InstanceFromName(iter.Val())] = ttl
+		}
+	}
+	return alive, iter.Err()
+}
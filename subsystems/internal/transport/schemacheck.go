@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+)
+
+// CheckSchema wraps t so that every message received through it (events
+// from Subscribe, entries from a Consumer or Watch) is checked with
+// protocol.ValidateSchema. Messages that do not conform are passed to
+// report and then delivered as usual: checking flags traffic, it never
+// drops it.
+func CheckSchema(t Transport, report func(Message, error)) Transport {
+	return &schemaChecked{Transport: t, report: report}
+}
+
+type schemaChecked struct {
+	Transport
+	report func(Message, error)
+}
+
+func (s *schemaChecked) check(m Message) {
+	if err := protocol.ValidateSchema(m.Data); err != nil {
+		s.report(m, err)
+	}
+}
+
+func (s *schemaChecked) Subscribe(ctx context.Context, channels ...string) (Subscription, error) {
+	sub, err := s.Transport.Subscribe(ctx, channels...)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(sub), nil
+}
+
+func (s *schemaChecked) Watch(ctx context.Context) (Subscription, error) {
+	sub, err := s.Transport.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(sub), nil
+}
+
+func (s *schemaChecked) Consume(stream, group, name, start string, block time.Duration) Consumer {
+	return &checkedConsumer{Consumer: s.Transport.Consume(stream, group, name, start, block), check: s.check}
+}
+
+func (s *schemaChecked) wrap(sub Subscription) Subscription {
+	c := &checkedSubscription{inner: sub, out: make(chan Message), done: make(chan struct{})}
+	go func() {
+		defer close(c.out)
+		for m := range sub.Messages() {
+			s.check(m)
+			select {
+			case c.out <- m:
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+type checkedSubscription struct {
+	inner     Subscription
+	out       chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *checkedSubscription) Messages() <-chan Message { return c.out }
+
+func (c *checkedSubscription) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.inner.Close()
+}
+
+type checkedConsumer struct {
+	Consumer
+	check func(Message)
+}
+
+func (c *checkedConsumer) Read(ctx context.Context) ([]Message, error) {
+	msgs, err := c.Consumer.Read(ctx)
+	for _, m := range msgs {
+		c.check(m)
+	}
+	return msgs, err
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/holla2040/arturo/internal/protocol"
+)
+
+// SignMessages wraps t so that protocol messages it sends are signed with
+// protocol.Sign. key returns a station's current signing key, or nil to send
+// unsigned. A command for a station is signed with that station's key;
+// replies and published events with the key of the message's source
+// instance. Data that is not a protocol message is sent unchanged.
+func SignMessages(t Transport, key func(station string) []byte) Transport {
+	return &signing{Transport: t, key: key}
+}
+
+type signing struct {
+	Transport
+	key func(station string) []byte
+}
+
+func (s *signing) Send(ctx context.Context, stream string, data []byte) error {
+	return s.Transport.Send(ctx, stream, s.sign(data, InstanceFromName(stream)))
+}
+
+func (s *signing) Reply(ctx context.Context, stream string, data []byte) error {
+	return s.Transport.Reply(ctx, stream, s.sign(data, ""))
+}
+
+func (s *signing) Publish(ctx context.Context, channel string, data []byte) error {
+	return s.Transport.Publish(ctx, channel, s.sign(data, ""))
+}
+
+// sign returns data signed with station's key, or with its source
+// instance's key if station is empty.
+func (s *signing) sign(data []byte, station string) []byte {
+	msg, err := protocol.Parse(data)
+	if err != nil {
+		return data
+	}
+	if station == "" {
+		station = msg.Envelope.Source.Instance
+	}
+	key := s.key(station)
+	if key == nil {
+		return data
+	}
+	if err := protocol.Sign(msg, key); err != nil {
+		return data
+	}
+	signed, err := json.Marshal(msg)
+	if err != nil {
+		return data
+	}
+	return signed
+}
@@ -0,0 +1,229 @@
+// Package transport abstracts the message bus between the controller,
+// stations and tools. Three kinds of traffic cross it:
+//
+//   - publish/subscribe events (heartbeats, E-stop, test control), fire and forget;
+//   - command and response streams, delivered reliably and acknowledged;
+//   - presence, a per-station liveness marker that expires on its own.
+//
+// Redis (Pub/Sub, Streams and keys with a TTL) is the primary backend. MQTT
+// lets off-the-shelf instruments and gateways that speak MQTT take part
+// without a Redis client. Names are written the Redis way ("events:heartbeat",
+// "commands:station-01"); each backend maps them to its own addressing.
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/streams"
+)
+
+// Message is a message received on a publish/subscribe channel, or an entry
+// read from a command or response stream.
+type Message struct {
+	Channel string // channel or stream name, e.g. "events:heartbeat"
+	ID      string // stream entry ID; empty for publish/subscribe messages
+	Data    []byte
+}
+
+// Subscription delivers messages until it is closed. The channel returned
+// by Messages is closed when the subscription ends.
+type Subscription interface {
+	Messages() <-chan Message
+	Close() error
+}
+
+// PubSub carries fire-and-forget events to every current subscriber.
+type PubSub interface {
+	Publish(ctx context.Context, channel string, data []byte) error
+	// Subscribe listens on channels. A "*" segment matches any single
+	// name segment, e.g. "events:*".
+	Subscribe(ctx context.Context, channels ...string) (Subscription, error)
+}
+
+// Consumer reads a stream as one member of a consumer group. Entries stay
+// pending until acknowledged and are delivered again after a reconnect.
+type Consumer interface {
+	// Read returns the next entries, or none if the consumer's block
+	// time elapses.
+	Read(ctx context.Context) ([]Message, error)
+	Ack(ctx context.Context, id string) error
+	// Recover makes the next Read return this consumer's pending entries
+	// first. Call it after a connection error.
+	Recover()
+}
+
+// Streams carries command requests to stations and responses back,
+// reliably and in order.
+type Streams interface {
+	// Send appends a command to a station's command stream.
+	Send(ctx context.Context, stream string, data []byte) error
+	// Reply appends a response to a requester's response stream.
+	Reply(ctx context.Context, stream string, data []byte) error
+	// Consume returns a consumer of stream. The group is created on first
+	// read to start at start ("0" for the whole stream, "$" for new
+	// entries). block bounds each Read; 0 means 5 seconds.
+	Consume(stream, group, name, start string, block time.Duration) Consumer
+	// CreateGroup creates group on stream unless it exists. A short-lived
+	// requester calls it before its first command so no response is missed.
+	CreateGroup(ctx context.Context, stream, group, start string) error
+	// Claim records that a station is executing a command, reporting
+	// false if it already did (a redelivery). Redis shares claims between
+	// processes; MQTT keeps them in the claiming process only.
+	Claim(ctx context.Context, instance, correlationID string) (bool, error)
+	// Watch delivers every command and response as it is added, without
+	// consuming them, for monitoring tools.
+	Watch(ctx context.Context) (Subscription, error)
+}
+
+// Presence marks stations alive for a limited time.
+type Presence interface {
+	SetAlive(ctx context.Context, instance string, ttl time.Duration) error
+	ClearAlive(ctx context.Context, instance string) error
+	// Alive returns the time left for every station currently marked alive.
+	Alive(ctx context.Context) (map[string]time.Duration, error)
+}
+
+// Transport is a complete message bus backend.
+type Transport interface {
+	PubSub
+	Streams
+	Presence
+	// Ping checks the connection to the backend.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Well-known names, shared by every backend.
+const (
+	ChannelHeartbeat     = "events:heartbeat"
+	ChannelHello         = "events:hello"
+	ChannelEmergencyStop = "events:emergency_stop"
+	ChannelTestControl   = "events:test.control"
+	ChannelEvents        = "events:*"
+
+	// StationGroup and ControllerGroup are the consumer groups stations
+	// read their command stream with and requesters read their response
+	// stream with.
+	StationGroup    = streams.StationGroup
+	ControllerGroup = streams.ControllerGroup
+)
+
+// CommandStream returns a station's command stream.
+func CommandStream(instance string) string { return streams.CommandStream(instance) }
+
+// ResponseStream returns the response stream of a requester instance.
+func ResponseStream(instance string) string { return streams.ResponseStream(instance) }
+
+// PresenceKey returns the name of a station's presence marker.
+func PresenceKey(instance string) string { return "device:" + instance + ":alive" }
+
+// InstanceFromName extracts the station instance from a presence key or a
+// command or response stream name.
+func InstanceFromName(name string) string {
+	parts := strings.Split(name, ":")
+	if len(parts) >= 3 && parts[0] == "device" && parts[len(parts)-1] == "alive" {
+		return strings.Join(parts[1:len(parts)-1], ":")
+	}
+	if len(parts) >= 2 && (parts[0] == "commands" || parts[0] == "responses") {
+		return strings.Join(parts[1:], ":")
+	}
+	return name
+}
+
+// Sender appends command requests to station command streams. It
+// satisfies api.CommandSender and redisrouter.Sender.
+type Sender struct {
+	t Streams
+}
+
+// NewSender returns a Sender using t.
+func NewSender(t Streams) *Sender {
+	return &Sender{t: t}
+}
+
+// SendCommand appends msg to stream.
+func (s *Sender) SendCommand(ctx context.Context, stream string, msg *protocol.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal command: %w", err)
+	}
+	return s.t.Send(ctx, stream, data)
+}
+
+// ListenResponses reads the response stream of instance as ControllerGroup
+// until ctx is cancelled, passing every parsed response to handle and then
+// acknowledging it. This is the single long-lived reader a process needs;
+// callers waiting for a particular response register with a Dispatcher
+// that handle feeds. After a connection error it resumes with any responses
+// left pending.
+func ListenResponses(ctx context.Context, t Streams, instance string, handle func(*protocol.Message)) {
+	consumer := t.Consume(ResponseStream(instance), ControllerGroup, instance, "$", 0)
+
+	for ctx.Err() == nil {
+		msgs, err := consumer.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("response listener: %v; retrying", err)
+			consumer.Recover()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+		for _, m := range msgs {
+			parsed, err := protocol.Parse(m.Data)
+			if err != nil {
+				log.Printf("response listener: parse error on %s: %v", m.ID, err)
+			} else {
+				handle(parsed)
+			}
+			if err := consumer.Ack(ctx, m.ID); err != nil {
+				log.Printf("response listener: ack %s: %v", m.ID, err)
+			}
+		}
+	}
+}
+
+// Listen subscribes to channels and passes every message to handle until
+// ctx is cancelled, subscribing again two seconds after the subscription
+// fails or ends.
+func Listen(ctx context.Context, t PubSub, handle func(Message), channels ...string) {
+	for ctx.Err() == nil {
+		sub, err := t.Subscribe(ctx, channels...)
+		if err != nil {
+			log.Printf("subscribe %s: %v; retrying", strings.Join(channels, ","), err)
+		} else {
+			func() {
+				defer sub.Close()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case m, ok := <-sub.Messages():
+						if !ok {
+							log.Printf("%s: subscription closed, reconnecting...", strings.Join(channels, ","))
+							return
+						}
+						handle(m)
+					}
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/holla2040/arturo/internal/protocol"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDispatcher(t *testing.T) {
+	d := NewDispatcher()
+	a := d.Register("corr-a")
+	b := d.Register("corr-b")
+	if n := d.PendingCount(); n != 2 {
+		t.Fatalf("PendingCount = %d, want 2", n)
+	}
+
+	resp := &protocol.Message{Envelope: protocol.Envelope{CorrelationID: "corr-b"}}
+	if !d.Dispatch(resp) {
+		t.Fatal("Dispatch found no waiter for corr-b")
+	}
+	if got := <-b; got != resp {
+		t.Error("corr-b waiter got the wrong message")
+	}
+	if d.Dispatch(resp) {
+		t.Error("second Dispatch for corr-b should find no waiter")
+	}
+
+	d.Deregister("corr-a")
+	if _, ok := <-a; ok {
+		t.Error("deregistered channel should be closed")
+	}
+	if n := d.PendingCount(); n != 0 {
+		t.Errorf("PendingCount = %d, want 0", n)
+	}
+}
+
+func TestDispatcherFollow(t *testing.T) {
+	d := NewDispatcher()
+	leader := d.Register("corr-a")
+	follower := d.Register("corr-b")
+	gone := d.Register("corr-c")
+	if d.Follow("corr-b", "corr-x") {
+		t.Error("followed a correlation ID with no waiter")
+	}
+	if !d.Follow("corr-b", "corr-a") || !d.Follow("corr-c", "corr-a") {
+		t.Fatal("Follow failed")
+	}
+	d.Deregister("corr-c")
+	if _, ok := <-gone; ok {
+		t.Error("deregistered follower should be closed")
+	}
+
+	resp := &protocol.Message{Envelope: protocol.Envelope{CorrelationID: "corr-a"}}
+	if !d.Dispatch(resp) {
+		t.Fatal("Dispatch found no waiter")
+	}
+	if got := <-leader; got != resp {
+		t.Error("leader got the wrong message")
+	}
+	if got := <-follower; got.Envelope.CorrelationID != "corr-b" {
+		t.Errorf("follower got correlation ID %q, want corr-b", got.Envelope.CorrelationID)
+	}
+	if resp.Envelope.CorrelationID != "corr-a" {
+		t.Error("Dispatch changed the leader's message")
+	}
+	if n := d.PendingCount(); n != 0 || len(d.followers) != 0 || len(d.leaders) != 0 {
+		t.Errorf("%d waiters, %d followed, %d following left", n, len(d.followers), len(d.leaders))
+	}
+
+	// A follower still gets the response after the leader's caller gives up.
+	d.Register("corr-d")
+	late := d.Register("corr-e")
+	d.Follow("corr-e", "corr-d")
+	d.Deregister("corr-d")
+	d.Register("corr-f")
+	if !d.Follow("corr-f", "corr-d") {
+		t.Error("could not follow a request whose leader gave up but still has followers")
+	}
+	if !d.Dispatch(&protocol.Message{Envelope: protocol.Envelope{CorrelationID: "corr-d"}}) {
+		t.Fatal("Dispatch found no follower")
+	}
+	if got := <-late; got.Envelope.CorrelationID != "corr-e" {
+		t.Errorf("follower got correlation ID %q", got.Envelope.CorrelationID)
+	}
+}
+
+func TestInstanceFromName(t *testing.T) {
+	tests := map[string]string{
+		"device:station-01:alive": "station-01",
+		"commands:station-02":     "station-02",
+		"responses:controller-01": "controller-01",
+		"events:heartbeat":        "events:heartbeat",
+	}
+	for name, want := range tests {
+		if got := InstanceFromName(name); got != want {
+			t.Errorf("InstanceFromName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestEntryData(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   string
+		ok     bool
+	}{
+		{"message field", map[string]interface{}{"message": `{"a":1}`, "data": "x"}, `{"a":1}`, true},
+		{"data field", map[string]interface{}{"data": `{"b":2}`}, `{"b":2}`, true},
+		{"other field", map[string]interface{}{"payload": `{"c":3}`}, `{"c":3}`, true},
+		{"empty", map[string]interface{}{}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := entryData(tt.values)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: entryData = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMQTTTopics(t *testing.T) {
+	m := &MQTT{opts: MQTTOptions{TopicPrefix: DefaultTopicPrefix}}
+	if got := m.topic("commands:station-01"); got != "arturo/commands/station-01" {
+		t.Errorf("topic = %q", got)
+	}
+	if got := m.topic(ChannelEvents); got != "arturo/events/+" {
+		t.Errorf("topic = %q", got)
+	}
+	if got := m.name("arturo/events/heartbeat"); got != ChannelHeartbeat {
+		t.Errorf("name = %q", got)
+	}
+}
+
+// startBroker runs an embedded MQTT broker for the test and returns its
+// URL.
+func startBroker(t *testing.T) string {
+	t.Helper()
+	server := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+func newMQTT(t *testing.T, broker, clientID string) *MQTT {
+	t.Helper()
+	m, err := NewMQTT(MQTTOptions{Broker: broker, ClientID: clientID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMQTTPubSub(t *testing.T) {
+	broker := startBroker(t)
+	ctx := context.Background()
+	pub := newMQTT(t, broker, "pub")
+	defer pub.Close()
+	sub := newMQTT(t, broker, "sub")
+	defer sub.Close()
+
+	s, err := sub.Subscribe(ctx, ChannelEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := pub.Publish(ctx, ChannelHeartbeat, []byte("beat")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-s.Messages():
+		if m.Channel != ChannelHeartbeat || string(m.Data) != "beat" {
+			t.Errorf("got %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	broker := startBroker(t)
+	ctx := context.Background()
+	pub := newMQTT(t, broker, "pub")
+	defer pub.Close()
+
+	reported := make(chan Message, 2)
+	sub := CheckSchema(newMQTT(t, broker, "sub"), func(m Message, err error) {
+		reported <- m
+	})
+	defer sub.Close()
+
+	s, err := sub.Subscribe(ctx, ChannelEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	hb, err := protocol.NewMessage(protocol.Source{Service: "dmm_station", Instance: "dmm-station-01", Version: "1.0.0"},
+		protocol.TypeServiceHeartbeat, protocol.HeartbeatPayload{Status: "running", Devices: []string{}, FirmwareVersion: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, _ := json.Marshal(hb)
+	for _, data := range [][]byte{good, []byte("beat")} {
+		if err := pub.Publish(ctx, ChannelHeartbeat, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both are delivered; only the non-conforming one is reported.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-s.Messages():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d not delivered", i+1)
+		}
+	}
+	select {
+	case m := <-reported:
+		if string(m.Data) != "beat" {
+			t.Errorf("reported %q, want the malformed message", m.Data)
+		}
+	default:
+		t.Fatal("malformed message not reported")
+	}
+	if len(reported) != 0 {
+		t.Errorf("conforming heartbeat was reported")
+	}
+}
+
+// recordingTransport keeps what is sent, replied and published.
+type recordingTransport struct {
+	Transport
+	sent map[string][]byte
+}
+
+func (r *recordingTransport) Send(_ context.Context, stream string, data []byte) error {
+	r.sent[stream] = data
+	return nil
+}
+
+func (r *recordingTransport) Reply(_ context.Context, stream string, data []byte) error {
+	r.sent[stream] = data
+	return nil
+}
+
+func (r *recordingTransport) Publish(_ context.Context, channel string, data []byte) error {
+	r.sent[channel] = data
+	return nil
+}
+
+func TestSignMessages(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	rec := &recordingTransport{sent: map[string][]byte{}}
+	bus := SignMessages(rec, func(station string) []byte {
+		if station == "station-01" {
+			return key
+		}
+		return nil
+	})
+
+	ctrl := protocol.Source{Service: "controller", Instance: "ctrl-01", Version: "1.0.0"}
+	station := protocol.Source{Service: "dmm_station", Instance: "station-01", Version: "1.0.0"}
+	cmd, _ := protocol.BuildCommandRequest(ctrl, "PUMP-01", "pump_status", nil, 5000, false)
+	hb, _ := protocol.NewMessage(station, protocol.TypeServiceHeartbeat, protocol.HeartbeatPayload{Status: "running"})
+	for _, send := range []func() error{
+		func() error { data, _ := json.Marshal(cmd); return bus.Send(ctx, CommandStream("station-01"), data) },
+		func() error { data, _ := json.Marshal(cmd); return bus.Send(ctx, CommandStream("station-02"), data) },
+		func() error { data, _ := json.Marshal(hb); return bus.Publish(ctx, ChannelHeartbeat, data) },
+		func() error { return bus.Reply(ctx, ResponseStream("ctrl-01"), []byte("not json")) },
+	} {
+		if err := send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Commands carry the receiving station's key, events the sender's.
+	for _, name := range []string{"commands:station-01", ChannelHeartbeat} {
+		msg, err := protocol.Parse(rec.sent[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := protocol.VerifySignature(msg, key); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if msg, _ := protocol.Parse(rec.sent["commands:station-02"]); msg.Envelope.Signature != "" {
+		t.Error("signed a command for a station without a key")
+	}
+	if string(rec.sent["responses:ctrl-01"]) != "not json" {
+		t.Errorf("non-protocol data changed: %q", rec.sent["responses:ctrl-01"])
+	}
+}
+
+func TestMQTTCommandRedelivery(t *testing.T) {
+	broker := startBroker(t)
+	ctx := context.Background()
+	stream := CommandStream("station-01")
+
+	ctrl := newMQTT(t, broker, "controller-01")
+	defer ctrl.Close()
+
+	station := newMQTT(t, broker, "station-01")
+	if err := station.CreateGroup(ctx, stream, StationGroup, "$"); err != nil {
+		t.Fatal(err)
+	}
+	station.Close()
+
+	// Sent while the station is disconnected: queued by the broker.
+	if err := ctrl.Send(ctx, stream, []byte("cmd-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	station = newMQTT(t, broker, "station-01")
+	c := station.Consume(stream, StationGroup, "station-01", "0", 2*time.Second)
+	msgs, err := c.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Data) != "cmd-1" || msgs[0].Channel != stream {
+		t.Fatalf("first read = %+v", msgs)
+	}
+	// Not acknowledged before the station goes away: delivered again.
+	station.Close()
+
+	station = newMQTT(t, broker, "station-01")
+	defer station.Close()
+	c = station.Consume(stream, StationGroup, "station-01", "0", 2*time.Second)
+	msgs, err = c.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Data) != "cmd-1" {
+		t.Fatalf("redelivery = %+v", msgs)
+	}
+	if err := c.Ack(ctx, msgs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Ack(ctx, msgs[0].ID); err == nil {
+		t.Error("second Ack of the same entry should fail")
+	}
+}
+
+func TestMQTTPresence(t *testing.T) {
+	broker := startBroker(t)
+	ctx := context.Background()
+	station := newMQTT(t, broker, "station-01")
+	defer station.Close()
+	if err := station.SetAlive(ctx, "station-01", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client connecting later sees the retained marker.
+	console := newMQTT(t, broker, "console")
+	defer console.Close()
+	waitAlive := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			alive, err := console.Alive(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ttl, ok := alive["station-01"]
+			if ok == want && (!ok || ttl > 0 && ttl <= time.Minute) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("alive = %v, want station-01 present=%v", alive, want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitAlive(true)
+
+	if err := station.ClearAlive(ctx, "station-01"); err != nil {
+		t.Fatal(err)
+	}
+	waitAlive(false)
+}
+
+func TestMQTTClaim(t *testing.T) {
+	m := &MQTT{claimed: map[string]time.Time{}}
+	ctx := context.Background()
+	if ok, _ := m.Claim(ctx, "station-01", "corr-1"); !ok {
+		t.Error("first claim should succeed")
+	}
+	if ok, _ := m.Claim(ctx, "station-01", "corr-1"); ok {
+		t.Error("second claim of the same command should fail")
+	}
+	if ok, _ := m.Claim(ctx, "station-02", "corr-1"); !ok {
+		t.Error("claims are per station")
+	}
+}
+
+func TestRedisStreams(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DialTimeout: 200 * time.Millisecond})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		t.Skip("Redis not available at localhost:6379")
+	}
+	r := NewRedis(rdb)
+	defer r.Close()
+	ctx := context.Background()
+	instance := "test-" + uuid.NewString()[:8]
+	stream := CommandStream(instance)
+	defer rdb.Del(ctx, stream, PresenceKey(instance))
+
+	if err := r.Send(ctx, stream, []byte("cmd-1")); err != nil {
+		t.Fatal(err)
+	}
+	c := r.Consume(stream, StationGroup, instance, "0", 100*time.Millisecond)
+	msgs, err := c.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Data) != "cmd-1" || msgs[0].Channel != stream {
+		t.Fatalf("read = %+v", msgs)
+	}
+	if err := c.Ack(ctx, msgs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SetAlive(ctx, instance, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	alive, err := r.Alive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alive[instance]; !ok {
+		t.Errorf("alive = %v, want %s", alive, instance)
+	}
+}
@@ -2,6 +2,7 @@
 #include "../config.h"
 #include "../time_utils.h"
 #include "device_registry.h"
+#include "../messaging/hello.h"
 #include <cstring>
 
 #ifdef ARDUINO
@@ -84,23 +85,67 @@ bool buildCommandResponse(JsonDocument& doc, const Source& source,
 #ifdef ARDUINO
 CommandHandler::CommandHandler(RedisClient& subRedis, RedisClient& pubRedis, const char* instance)
     : _subRedis(subRedis), _pubRedis(pubRedis), _instance(instance) {
-    snprintf(_channelName, sizeof(_channelName), "%s%s",
+    snprintf(_streamName, sizeof(_streamName), "%s%s",
              CHANNEL_COMMANDS_PREFIX, _instance);
-    LOG_INFO("CMD", "Listening on channel: %s", _channelName);
+    LOG_INFO("CMD", "Reading stream: %s (group %s)", _streamName, STREAM_GROUP_STATION);
 }
 
 bool CommandHandler::poll(unsigned long timeoutMs) {
+    char id[32];
     char value[2048];
 
-    int result = _subRedis.readMessage(value, sizeof(value), timeoutMs);
-    if (result <= 0) {
+    // Own pending entries first (delivered but never acked, e.g. we rebooted
+    // mid-command), then new ones.
+    const char* start = _readPending ? "0" : ">";
+    int result = _subRedis.readGroup(_streamName, STREAM_GROUP_STATION, _instance,
+                                     start, _readPending ? 0 : timeoutMs,
+                                     id, sizeof(id), value, sizeof(value));
+    if (result < 0) {
+        if (_subRedis.lastErrorNoGroup()) {
+            // Stream was deleted or never created; recreate and start over.
+            _subRedis.xgroupCreate(_streamName, STREAM_GROUP_STATION);
+            _readPending = true;
+        }
+        return false;
+    }
+    if (result == 0) {
+        _readPending = false;
         return false;
     }
 
-    handleMessage(value);
+    if (value[0] != '\0') {
+        handleMessage(value);
+    } else {
+        LOG_ERROR("CMD", "Entry %s has no %s field, skipping", id, STREAM_FIELD);
+    }
+
+    if (!_pubRedis.xack(_streamName, STREAM_GROUP_STATION, id)) {
+        LOG_ERROR("CMD", "Failed to XACK %s", id);
+    }
     return true;
 }
 
+bool CommandHandler::isExpired(JsonDocument& doc) {
+    // The sender stops waiting after timeout_ms; acting on the command later
+    // (e.g. after being offline) would surprise whoever sent it. Without a
+    // synced clock we can't compare, so run it.
+    int timeoutMs = doc["payload"]["timeout_ms"] | 0;
+    int64_t sent = doc["envelope"]["timestamp"] | (int64_t)0;
+    if (timeoutMs <= 0 || sent <= 0 || !hasValidTime()) {
+        return false;
+    }
+    int64_t deadlineMs = sent * 1000 + timeoutMs + COMMAND_EXPIRY_GRACE_MS;
+    return getTimestamp() * 1000 > deadlineMs;
+}
+
+bool CommandHandler::claim(const char* correlationId) {
+    // Marks the command as executed so a redelivery (after a lost XACK) is
+    // skipped. If Redis can't answer, err on the side of not running twice.
+    char key[128];
+    snprintf(key, sizeof(key), "%s%s:%s", DEDUP_KEY_PREFIX, _instance, correlationId);
+    return _pubRedis.setNX(key, DEDUP_TTL_SECONDS) == 1;
+}
+
 void CommandHandler::handleMessage(const char* messageJson) {
     // Extract envelope.type to route to the correct handler
     JsonDocument doc;
@@ -118,12 +163,37 @@ void CommandHandler::handleMessage(const char* messageJson) {
         return;
     }
 
+    // A controller on another major version may mean something different by
+    // the same fields. Command requests still get an error response (see
+    // handleDeviceCommand) so the sender isn't left waiting.
+    const char* schemaVersion = doc["envelope"]["schema_version"];
+    if (!schemaVersionCompatible(schemaVersion) && strcmp(type, "device.command.request") != 0) {
+        LOG_ERROR("CMD", "Dropping %s with incompatible schema_version %s",
+                  type, schemaVersion ? schemaVersion : "(null)");
+        _failed++;
+        return;
+    }
+
+    const char* correlationId = doc["envelope"]["correlation_id"];
+    if (strcmp(type, "device.command.request") == 0 && isExpired(doc)) {
+        LOG_ERROR("CMD", "Dropping expired command (corr=%s)", correlationId ? correlationId : "");
+        return;
+    }
+    if (correlationId != nullptr && correlationId[0] != '\0' && !claim(correlationId)) {
+        LOG_INFO("CMD", "Skipping already executed command (corr=%s)", correlationId);
+        return;
+    }
+
     if (strcmp(type, "device.command.request") == 0) {
         handleDeviceCommand(messageJson);
     } else if (strcmp(type, "test.state.update") == 0) {
         handleTestStateUpdate(doc);
     } else if (strcmp(type, "system.ota.request") == 0) {
         handleOTARequest(doc);
+    } else if (strcmp(type, "service.hello") == 0) {
+        handleHello(doc);
+    } else if (strcmp(type, "test.control.response") == 0) {
+        handleTestControlResponse(doc);
     } else {
         LOG_ERROR("CMD", "Unknown message type: %s", type);
         _failed++;
@@ -264,8 +334,8 @@ bool CommandHandler::publishTestControl(const char* action) {
     JsonDocument doc;
     Source src = { STATION_SERVICE, STATION_INSTANCE, STATION_VERSION };
 
-    char msgId[48];
-    snprintf(msgId, sizeof(msgId), "tc-%s-%lu", _instance, (unsigned long)millis());
+    char msgId[37];
+    generateUUID(msgId, sizeof(msgId));
 
     if (!buildEnvelope(doc, src, "test.control.request", msgId, arturo::getTimestamp())) {
         LOG_ERROR("CMD", "Failed to build test.control.request envelope");
@@ -279,8 +349,8 @@ bool CommandHandler::publishTestControl(const char* action) {
     char buffer[1024];
     serializeJson(doc, buffer, sizeof(buffer));
 
-    if (!_pubRedis.publish("events:test.control", buffer)) {
-        LOG_ERROR("CMD", "Failed to PUBLISH test.control to events:test.control");
+    if (!_pubRedis.publish(CHANNEL_TEST_CONTROL, buffer)) {
+        LOG_ERROR("CMD", "Failed to PUBLISH test.control.request to %s", CHANNEL_TEST_CONTROL);
         return false;
     }
 
@@ -288,6 +358,60 @@ bool CommandHandler::publishTestControl(const char* action) {
     return true;
 }
 
+bool CommandHandler::publishHello(bool request) {
+    JsonDocument doc;
+    Source src = { STATION_SERVICE, STATION_INSTANCE, STATION_VERSION };
+
+    char msgId[37];
+    generateUUID(msgId, sizeof(msgId));
+
+    if (!buildHello(doc, src, msgId, arturo::getTimestamp(), FIRMWARE_VERSION, request)) {
+        LOG_ERROR("CMD", "Failed to build service.hello");
+        return false;
+    }
+
+    char buffer[768];
+    serializeJson(doc, buffer, sizeof(buffer));
+
+    if (!_pubRedis.publish(CHANNEL_HELLO, buffer)) {
+        LOG_ERROR("CMD", "Failed to PUBLISH service.hello to %s", CHANNEL_HELLO);
+        return false;
+    }
+
+    LOG_INFO("CMD", "Hello published (request=%d)", request ? 1 : 0);
+    return true;
+}
+
+void CommandHandler::handleHello(JsonDocument& doc) {
+    const char* schemaVersion = doc["envelope"]["schema_version"] | "(null)";
+    const char* sender = doc["envelope"]["source"]["instance"] | "(null)";
+    bool request = doc["payload"]["request"] | false;
+
+    LOG_INFO("CMD", "Hello from %s (schema_version=%s request=%d)",
+             sender, schemaVersion, request ? 1 : 0);
+
+    // Only answer requests, so two hellos can never bounce back and forth.
+    if (request) {
+        publishHello(false);
+    }
+}
+
+void CommandHandler::handleTestControlResponse(JsonDocument& doc) {
+    const char* action = doc["payload"]["action"] | "";
+    bool success = doc["payload"]["success"] | false;
+
+    if (success) {
+        LOG_INFO("CMD", "Test control %s accepted", action);
+        return;
+    }
+
+    // The new state, if any, arrives separately as test.state.update; a
+    // rejected press only needs to be visible in the log.
+    const char* code = doc["payload"]["error"]["code"] | "(none)";
+    const char* message = doc["payload"]["error"]["message"] | "";
+    LOG_ERROR("CMD", "Test control %s rejected: %s %s", action, code, message);
+}
+
 void CommandHandler::handleTestStateUpdate(JsonDocument& doc) {
     JsonObjectConst payload = doc["payload"];
     if (payload.isNull()) {
@@ -350,9 +474,17 @@ void CommandHandler::handleDeviceCommand(const char* messageJson) {
     char responseBuf[512] = {0};
     const char* errorCode = nullptr;
     const char* errorMessage = nullptr;
-    bool success = dispatchToDevice(req.deviceId, req.commandName, req.raw,
-                                    responseBuf, sizeof(responseBuf),
-                                    errorCode, errorMessage);
+    bool success = false;
+    if (!schemaVersionCompatible(reqDoc["envelope"]["schema_version"].as<const char*>())) {
+        errorCode = "incompatible_version";
+        errorMessage = "Unsupported schema_version major version";
+        LOG_ERROR("CMD", "Rejecting command with schema_version %s",
+                  reqDoc["envelope"]["schema_version"] | "(null)");
+    } else {
+        success = dispatchToDevice(req.deviceId, req.commandName, req.raw,
+                                   responseBuf, sizeof(responseBuf),
+                                   errorCode, errorMessage);
+    }
 
     unsigned long durationMs = millis() - startMs;
 
@@ -360,8 +492,8 @@ void CommandHandler::handleDeviceCommand(const char* messageJson) {
     JsonDocument respDoc;
     Source src = { STATION_SERVICE, STATION_INSTANCE, STATION_VERSION };
 
-    char respId[48];
-    snprintf(respId, sizeof(respId), "resp-%s-%d", _instance, _processed);
+    char respId[37];
+    generateUUID(respId, sizeof(respId));
 
     int64_t timestamp = arturo::getTimestamp();
 
@@ -379,15 +511,15 @@ void CommandHandler::handleDeviceCommand(const char* messageJson) {
     char buffer[2048];
     serializeJson(respDoc, buffer, sizeof(buffer));
 
-    // PUBLISH response to reply_to channel
-    if (!_pubRedis.publish(req.replyTo, buffer)) {
-        LOG_ERROR("CMD", "Failed to PUBLISH response to %s", req.replyTo);
+    // XADD response to the reply_to stream
+    if (!_pubRedis.xadd(req.replyTo, buffer)) {
+        LOG_ERROR("CMD", "Failed to XADD response to %s", req.replyTo);
         _failed++;
         return;
     }
 
     _processed++;
-    LOG_INFO("CMD", "Response published to %s", req.replyTo);
+    LOG_INFO("CMD", "Response added to %s", req.replyTo);
 }
 
 void CommandHandler::handleOTARequest(JsonDocument& doc) {
@@ -457,8 +589,8 @@ void CommandHandler::sendOTAResponse(const char* correlationId, const char* repl
     JsonDocument respDoc;
     Source src = { STATION_SERVICE, STATION_INSTANCE, STATION_VERSION };
 
-    char respId[48];
-    snprintf(respId, sizeof(respId), "resp-%s-%d", _instance, _processed);
+    char respId[37];
+    generateUUID(respId, sizeof(respId));
     int64_t timestamp = arturo::getTimestamp();
 
     if (!buildCommandResponse(respDoc, src, respId, timestamp,
@@ -471,12 +603,12 @@ void CommandHandler::sendOTAResponse(const char* correlationId, const char* repl
     char buffer[2048];
     serializeJson(respDoc, buffer, sizeof(buffer));
 
-    if (!_pubRedis.publish(replyTo, buffer)) {
-        LOG_ERROR("OTA", "Failed to PUBLISH OTA response to %s", replyTo);
+    if (!_pubRedis.xadd(replyTo, buffer)) {
+        LOG_ERROR("OTA", "Failed to XADD OTA response to %s", replyTo);
         return;
     }
 
-    LOG_INFO("OTA", "OTA response published to %s", replyTo);
+    LOG_INFO("OTA", "OTA response added to %s", replyTo);
 }
 #endif
 
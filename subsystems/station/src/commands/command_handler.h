@@ -43,12 +43,15 @@ class OTAUpdateHandler;   // forward declare
 
 class CommandHandler {
 public:
-    // subRedis: subscribed client for reading commands
-    // pubRedis: general client for publishing responses
+    // subRedis: dedicated client for reading the command stream (XREADGROUP)
+    // pubRedis: general client for responses, acks and dedup keys
     CommandHandler(RedisClient& subRedis, RedisClient& pubRedis, const char* instance);
-    // Poll for one command with given timeout.
-    // Returns true if a command was processed.
+    // Poll for one command, blocking up to timeoutMs (0 = don't block).
+    // Entries left unacknowledged by a previous connection or reboot are
+    // read first. Returns true if an entry was consumed.
     bool poll(unsigned long timeoutMs = 100);
+    // Re-read unacknowledged entries on the next poll (call after reconnecting).
+    void resetStream() { _readPending = true; }
     int commandsProcessed() const { return _processed; }
     int commandsFailed() const { return _failed; }
 
@@ -57,6 +60,10 @@ public:
     // CTI serialization is handled inside CtiWorker; no external mutex required.
     bool executeLocal(const char* commandName, char* responseBuf, size_t responseBufLen);
 
+    // Publish service.hello to CHANNEL_HELLO. request asks the controller to
+    // answer with its own hello (sent on connect).
+    bool publishHello(bool request);
+
     // Current test state (updated from test.state.update messages)
     const TestState& testState() const { return _testState; }
 
@@ -80,7 +87,8 @@ private:
     const char* _instance;
     int _processed = 0;
     int _failed = 0;
-    char _channelName[64];
+    char _streamName[64];
+    bool _readPending = true;
     CtiOnBoardDevice* _ctiOnBoardDevice = nullptr;
     OTAUpdateHandler* _otaHandler = nullptr;
     PumpTelemetry* _pumpTelemetry = nullptr;
@@ -88,8 +96,12 @@ private:
     TestState _testState;
 
     void handleMessage(const char* messageJson);
+    bool isExpired(JsonDocument& doc);
+    bool claim(const char* correlationId);
     void handleDeviceCommand(const char* messageJson);
     void handleTestStateUpdate(JsonDocument& doc);
+    void handleHello(JsonDocument& doc);
+    void handleTestControlResponse(JsonDocument& doc);
     void handleOTARequest(JsonDocument& doc);
     void sendOTAResponse(const char* correlationId, const char* replyTo,
                          bool success, const char* response,
@@ -59,11 +59,22 @@ static const char* DEVICE_IDS[] = {PUMP_ID};
 
 // Redis channels (from ARCHITECTURE.md section 2.3)
 #define CHANNEL_HEARTBEAT        "events:heartbeat"
+#define CHANNEL_HELLO            "events:hello"
+#define CHANNEL_TEST_CONTROL     "events:test.control"
 #define CHANNEL_COMMANDS_PREFIX  "commands:"
 #define CHANNEL_RESPONSES_PREFIX "responses:"
 #define PRESENCE_KEY_PREFIX      "device:"
 #define PRESENCE_KEY_SUFFIX      ":alive"
 
+// Command/response streams (ARCHITECTURE.md section 2.3). Must match
+// subsystems/internal/streams on the controller side.
+#define STREAM_FIELD             "message"
+#define STREAM_MAXLEN            "1000"
+#define STREAM_GROUP_STATION     "station"
+#define DEDUP_KEY_PREFIX         "dedup:"
+#define DEDUP_TTL_SECONDS        600
+#define COMMAND_EXPIRY_GRACE_MS  2000
+
 // Pump polling interval (ms between CTI commands in pumpPollTask)
 #define PUMP_POLL_INTERVAL_MS  200
 
@@ -1,19 +1,30 @@
 #include "envelope.h"
+#include <cstdio>
 #include <cstring>
 
+#ifdef ARDUINO
+#include <esp_random.h>
+#else
+#include <random>
+#endif
+
 namespace arturo {
 
-static const char* SCHEMA_VERSION = "v1.0.0";
+static const char* SCHEMA_VERSION = "v1.1.0";
 
 static const char* VALID_TYPES[] = {
     "device.command.request",
     "device.command.response",
     "service.heartbeat",
+    "service.hello",
     "system.emergency_stop",
-    "system.ota.request"
+    "system.ota.request",
+    "test.state.update",
+    "test.control.request",
+    "test.control.response"
 };
 
-static const int NUM_VALID_TYPES = 5;
+static const int NUM_VALID_TYPES = 9;
 
 bool buildEnvelope(JsonDocument& doc, const Source& source, const char* type,
                    const char* id, int64_t timestamp,
@@ -83,4 +94,47 @@ bool validateEnvelopeType(const char* type) {
     return false;
 }
 
+// Accepts "v1.MINOR.PATCH": minor versions only add optional fields and
+// message types, so any v1.x.y peer can be understood.
+bool schemaVersionCompatible(const char* schemaVersion) {
+    if (schemaVersion == nullptr || strncmp(schemaVersion, "v1.", 3) != 0) {
+        return false;
+    }
+
+    const char* p = schemaVersion + 3;
+    for (int part = 0; part < 2; part++) {
+        if (*p < '0' || *p > '9') return false;
+        while (*p >= '0' && *p <= '9') p++;
+        if (part == 0) {
+            if (*p != '.') return false;
+            p++;
+        }
+    }
+    return *p == '\0';
+}
+
+static uint32_t randomWord() {
+#ifdef ARDUINO
+    return esp_random();
+#else
+    static std::mt19937 rng(std::random_device{}());
+    return rng();
+#endif
+}
+
+void generateUUID(char* buf, size_t len) {
+    uint32_t r1 = randomWord();
+    uint32_t r2 = randomWord();
+    uint32_t r3 = randomWord();
+    uint32_t r4 = randomWord();
+
+    snprintf(buf, len, "%08lx-%04lx-4%03lx-%04lx-%04lx%08lx",
+             (unsigned long)r1,
+             (unsigned long)(r2 >> 16),
+             (unsigned long)(r2 & 0x0FFF),
+             (unsigned long)(((r3 >> 16) & 0x3FFF) | 0x8000),
+             (unsigned long)(r3 & 0xFFFF),
+             (unsigned long)r4);
+}
+
 } // namespace arturo
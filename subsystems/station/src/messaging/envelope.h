@@ -26,4 +26,11 @@ bool parseEnvelope(JsonObjectConst envelope, const char*& id,
 // Validate that an envelope has correct schema_version and valid type
 bool validateEnvelopeType(const char* type);
 
+// Check that a peer's schema_version has the same major version as ours
+bool schemaVersionCompatible(const char* schemaVersion);
+
+// Write a random UUIDv4 string (36 chars + NUL) for envelope id fields.
+// len must be at least 37.
+void generateUUID(char* buf, size_t len);
+
 } // namespace arturo
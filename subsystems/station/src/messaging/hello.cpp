@@ -0,0 +1,58 @@
+#include "hello.h"
+
+namespace arturo {
+
+// Message types this firmware sends or handles.
+static const char* HELLO_MESSAGE_TYPES[] = {
+    "device.command.request",
+    "device.command.response",
+    "service.heartbeat",
+    "service.hello",
+    "system.emergency_stop",
+    "system.ota.request",
+    "test.state.update",
+    "test.control.request",
+    "test.control.response"
+};
+
+static const int NUM_HELLO_MESSAGE_TYPES = 9;
+
+// Command features (see schemas/v1.1.0/service-hello): raw passthrough,
+// skipping redelivered commands, dropping expired commands, OTA.
+static const char* HELLO_FEATURES[] = {
+    "raw_commands",
+    "command_dedup",
+    "command_expiry",
+    "ota"
+};
+
+static const int NUM_HELLO_FEATURES = 4;
+
+bool buildHello(JsonDocument& doc, const Source& source,
+                const char* id, int64_t timestamp,
+                const char* firmwareVersion, bool request) {
+    if (!buildEnvelope(doc, source, "service.hello", id, timestamp)) {
+        return false;
+    }
+
+    JsonObject payload = doc["payload"].to<JsonObject>();
+
+    JsonArray types = payload["message_types"].to<JsonArray>();
+    for (int i = 0; i < NUM_HELLO_MESSAGE_TYPES; i++) {
+        types.add(HELLO_MESSAGE_TYPES[i]);
+    }
+
+    JsonArray features = payload["features"].to<JsonArray>();
+    for (int i = 0; i < NUM_HELLO_FEATURES; i++) {
+        features.add(HELLO_FEATURES[i]);
+    }
+
+    payload["firmware_version"] = firmwareVersion;
+    if (request) {
+        payload["request"] = true;
+    }
+
+    return true;
+}
+
+} // namespace arturo
@@ -0,0 +1,14 @@
+#pragma once
+#include <ArduinoJson.h>
+#include "envelope.h"
+
+namespace arturo {
+
+// Build a service.hello message advertising the message types and command
+// features this firmware supports. Set request to ask the receiver to answer
+// with its own hello. id and timestamp are passed in for testability.
+bool buildHello(JsonDocument& doc, const Source& source,
+                const char* id, int64_t timestamp,
+                const char* firmwareVersion, bool request);
+
+} // namespace arturo
@@ -1,4 +1,5 @@
 #include "redis_client.h"
+#include "../config.h"
 #include "../debug_log.h"
 #include <cstring>
 #include <cstdlib>
@@ -75,6 +76,146 @@ bool RedisClient::publish(const char* channel, const char* message) {
     return true;
 }
 
+int RedisClient::setNX(const char* key, int exSeconds) {
+    char exStr[12];
+    snprintf(exStr, sizeof(exStr), "%d", exSeconds);
+
+    const char* argv[] = { "SET", key, "1", "NX", "EX", exStr };
+    if (!sendCommand(argv, 6) || !readLine()) {
+        return -1;
+    }
+    if (_buf[0] == '+') {
+        return 1;
+    }
+    if (_buf[0] == '$' && _buf[1] == '-') {
+        return 0; // nil: key already exists
+    }
+    noteError();
+    return -1;
+}
+
+bool RedisClient::xadd(const char* stream, const char* message) {
+    const char* argv[] = { "XADD", stream, "MAXLEN", "~", STREAM_MAXLEN, "*",
+                           STREAM_FIELD, message };
+    if (!sendCommand(argv, 8)) {
+        return false;
+    }
+    char id[32];
+    if (readBulkString(id, sizeof(id)) < 0) {
+        LOG_ERROR("REDIS", "XADD to %s failed", stream);
+        return false;
+    }
+    LOG_DEBUG("REDIS", "XADD to %s, id %s", stream, id);
+    return true;
+}
+
+bool RedisClient::xgroupCreate(const char* stream, const char* group) {
+    const char* argv[] = { "XGROUP", "CREATE", stream, group, "0", "MKSTREAM" };
+    if (!sendCommand(argv, 6) || !readLine()) {
+        return false;
+    }
+    if (_buf[0] == '+' || strncmp(_buf, "-BUSYGROUP", 10) == 0) {
+        return true;
+    }
+    noteError();
+    return false;
+}
+
+bool RedisClient::xack(const char* stream, const char* group, const char* id) {
+    const char* argv[] = { "XACK", stream, group, id };
+    if (!sendCommand(argv, 4)) {
+        return false;
+    }
+    return readInteger() >= 0;
+}
+
+int RedisClient::readGroup(const char* stream, const char* group, const char* consumer,
+                           const char* startId, unsigned long blockMs,
+                           char* idBuf, size_t idLen, char* buf, size_t bufLen) {
+    _noGroup = false;
+    idBuf[0] = '\0';
+    buf[0] = '\0';
+
+    char blockStr[12];
+    snprintf(blockStr, sizeof(blockStr), "%lu", blockMs);
+
+    // BLOCK 0 would wait forever, so a zero timeout leaves BLOCK out.
+    if (blockMs > 0) {
+        const char* argv[] = { "XREADGROUP", "GROUP", group, consumer, "COUNT", "1",
+                               "BLOCK", blockStr, "STREAMS", stream, startId };
+        if (!sendCommand(argv, 11)) return -1;
+    } else {
+        const char* argv[] = { "XREADGROUP", "GROUP", group, consumer, "COUNT", "1",
+                               "STREAMS", stream, startId };
+        if (!sendCommand(argv, 9)) return -1;
+    }
+
+    // Reply: *1 [ *2 [ $stream, *N [ *2 [ $id, *2k [ $field, $value, ... ] ] ] ] ]
+    // or *-1 when BLOCK timed out with nothing new.
+    if (!readLineWithTimeout(blockMs + RESP_TIMEOUT_MS)) {
+        return -1;
+    }
+    if (_buf[0] == '-') {
+        noteError();
+        return -1;
+    }
+    if (_buf[0] != '*') {
+        LOG_ERROR("REDIS", "XREADGROUP: unexpected reply %s", _buf);
+        return -1;
+    }
+    if (strtol(_buf + 1, nullptr, 10) < 1) {
+        return 0;
+    }
+
+    char scratch[64];
+    if (readArrayLen() != 2 || readBulkString(scratch, sizeof(scratch)) < 0) {
+        LOG_ERROR("REDIS", "XREADGROUP: malformed stream reply");
+        return -1;
+    }
+    int entries = readArrayLen();
+    if (entries < 0) {
+        LOG_ERROR("REDIS", "XREADGROUP: malformed entry list");
+        return -1;
+    }
+    if (entries == 0) {
+        return 0; // own pending list is empty
+    }
+
+    if (readArrayLen() != 2 || readBulkString(idBuf, idLen) < 0) {
+        LOG_ERROR("REDIS", "XREADGROUP: malformed entry");
+        return -1;
+    }
+
+    // A pending entry trimmed by MAXLEN comes back with nil fields.
+    if (!readLine()) {
+        return -1;
+    }
+    if (_buf[0] != '*') {
+        LOG_ERROR("REDIS", "XREADGROUP: malformed fields for %s", idBuf);
+        return -1;
+    }
+    int fields = (int)strtol(_buf + 1, nullptr, 10);
+    for (int i = 0; i + 1 < fields; i += 2) {
+        if (readBulkString(scratch, sizeof(scratch)) < 0) {
+            return -1;
+        }
+        if (strcmp(scratch, STREAM_FIELD) == 0) {
+            if (readBulkString(buf, bufLen) < 0) return -1;
+        } else if (readBulkString(scratch, sizeof(scratch)) < 0) {
+            return -1;
+        }
+    }
+
+    LOG_DEBUG("REDIS", "XREADGROUP %s entry %s (%u bytes)", stream, idBuf, (unsigned)strlen(buf));
+    return 1;
+}
+
+void RedisClient::noteError() {
+    if (_buf[0] != '-') return;
+    _noGroup = strncmp(_buf + 1, "NOGROUP", 7) == 0;
+    LOG_ERROR("REDIS", "Error response: %s", _buf + 1);
+}
+
 bool RedisClient::subscribe(const char* channel) {
     const char* argv[] = { "SUBSCRIBE", channel };
     if (!sendCommand(argv, 2)) {
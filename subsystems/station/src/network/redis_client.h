@@ -14,6 +14,26 @@ public:
     bool set(const char* key, const char* value, int exSeconds);
     bool publish(const char* channel, const char* message);
 
+    // SET key 1 NX EX. Returns 1 if the key was set, 0 if it already existed, -1 on error.
+    int setNX(const char* key, int exSeconds);
+
+    // Streams: XADD stream MAXLEN ~ STREAM_MAXLEN * message <message>
+    bool xadd(const char* stream, const char* message);
+    // XGROUP CREATE stream group 0 MKSTREAM. An existing group counts as success.
+    bool xgroupCreate(const char* stream, const char* group);
+    bool xack(const char* stream, const char* group, const char* id);
+
+    // Read one entry with XREADGROUP from startId ("0" = own pending entries,
+    // ">" = new entries), blocking up to blockMs (0 = don't block).
+    // Returns 1 and fills idBuf/buf if an entry was read, 0 if none, -1 on error.
+    // buf is empty for pending entries that were trimmed from the stream.
+    int readGroup(const char* stream, const char* group, const char* consumer,
+                  const char* startId, unsigned long blockMs,
+                  char* idBuf, size_t idLen, char* buf, size_t bufLen);
+
+    // True if the last error reply was NOGROUP (stream or group missing).
+    bool lastErrorNoGroup() const { return _noGroup; }
+
     // Pub/Sub subscribe
     bool subscribe(const char* channel);
 
@@ -32,6 +52,7 @@ private:
     int _reconnects = 0;
     bool _hasConnected = false;
     char _buf[256];
+    bool _noGroup = false;
 
     bool sendCommand(const char** argv, int argc);
     bool readLine();
@@ -43,6 +64,7 @@ private:
     int readArrayLen();
     int readArrayLenWithTimeout(unsigned long timeoutMs);
     bool skipBulkString();
+    void noteError();
 };
 
 } // namespace arturo
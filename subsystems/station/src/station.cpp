@@ -8,7 +8,6 @@
 #include "safety/power_recovery.h"
 #include <WiFi.h>
 #include <esp_wifi.h>
-#include <esp_random.h>
 #include <ArduinoOTA.h>
 #include <time.h>
 
@@ -110,6 +109,9 @@ bool Station::begin() {
     // 5a. Register OTA update handler
     handler.setOTAHandler(&_otaHandler);
 
+    // 5a.1 Announce protocol version and capabilities (ARCHITECTURE.md §2.3)
+    handler.publishHello(true);
+
     // 5b. Initialize CTI OnBoard serial port + worker
     if (_ctiSerial.begin(SERIAL_CONFIG_CTI)) {
         LOG_INFO("MAIN", "CTI serial ready: UART%d (default pins)", CTI_UART_NUM);
@@ -245,10 +247,12 @@ void Station::commTask() {
         // Check main Redis client, reconnect if needed
         if (_wifi.isConnected() && !_redis.isConnected()) {
             LOG_ERROR("MAIN", "Redis (main) disconnected, reconnecting...");
-            connectRedis();
+            if (connectRedis() && _cmdHandler) {
+                _cmdHandler->publishHello(true);
+            }
         }
 
-        // Check subscribe Redis client, reconnect + re-subscribe if needed
+        // Check command stream Redis client, reconnect if needed
         if (_wifi.isConnected() && !_redisSub.isConnected()) {
             LOG_ERROR("MAIN", "Redis (sub) disconnected, reconnecting...");
             connectRedisSub();
@@ -256,9 +260,9 @@ void Station::commTask() {
 
         // Poll for incoming commands. CtiWorker serializes CTI access, so no
         // mutex is needed here — the worker's request queue is the ordering.
-        if (_cmdHandler && _redisSub.available()) {
-            if (_cmdHandler->poll(100)) {
-                while (_cmdHandler->poll(1)) {
+        if (_cmdHandler && _redisSub.isConnected()) {
+            if (_cmdHandler->poll(50)) {
+                while (_cmdHandler->poll(0)) {
                     _watchdog.feed();
                 }
             }
@@ -449,13 +453,17 @@ bool Station::connectRedisSub() {
     if (!_redisSub.connect(user, pass)) {
         return false;
     }
-    char channel[64];
-    snprintf(channel, sizeof(channel), "%s%s", CHANNEL_COMMANDS_PREFIX, STATION_INSTANCE);
-    if (!_redisSub.subscribe(channel)) {
-        LOG_ERROR("MAIN", "Failed to subscribe to %s", channel);
+    char stream[64];
+    snprintf(stream, sizeof(stream), "%s%s", CHANNEL_COMMANDS_PREFIX, STATION_INSTANCE);
+    if (!_redisSub.xgroupCreate(stream, STREAM_GROUP_STATION)) {
+        LOG_ERROR("MAIN", "Failed to create consumer group on %s", stream);
         _redisSub.disconnect();
         return false;
     }
+    // Pick up anything delivered to us but not acked before the disconnect.
+    if (_cmdHandler) {
+        _cmdHandler->resetStream();
+    }
     return true;
 }
 
@@ -520,21 +528,6 @@ bool Station::publishHeartbeat(const char* status) {
     return true;
 }
 
-void Station::generateUUID(char* buf, size_t len) {
-    uint32_t r1 = esp_random();
-    uint32_t r2 = esp_random();
-    uint32_t r3 = esp_random();
-    uint32_t r4 = esp_random();
-
-    snprintf(buf, len, "%08lx-%04lx-4%03lx-%04lx-%04lx%08lx",
-             (unsigned long)r1,
-             (unsigned long)(r2 >> 16),
-             (unsigned long)(r2 & 0x0FFF),
-             (unsigned long)(((r3 >> 16) & 0x3FFF) | 0x8000),
-             (unsigned long)(r3 & 0xFFFF),
-             (unsigned long)r4);
-}
-
 void Station::buildPresenceKey(char* buf, size_t len) {
     snprintf(buf, len, "%s%s%s", PRESENCE_KEY_PREFIX, STATION_INSTANCE, PRESENCE_KEY_SUFFIX);
 }
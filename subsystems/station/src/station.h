@@ -78,7 +78,6 @@ private:
     bool publishHeartbeat(const char* status);
 
     // Utility
-    static void generateUUID(char* buf, size_t len);
     void buildPresenceKey(char* buf, size_t len);
 };
 
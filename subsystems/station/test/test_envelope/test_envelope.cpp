@@ -1,5 +1,6 @@
 #include <unity.h>
 #include <ArduinoJson.h>
+#include <cstring>
 #include "messaging/envelope.h"
 
 using namespace arturo;
@@ -33,7 +34,7 @@ void test_build_envelope_schema_version(void) {
 
     buildEnvelope(doc, src, "service.heartbeat", "test-id", 1700000000);
 
-    TEST_ASSERT_EQUAL_STRING("v1.0.0", doc["envelope"]["schema_version"].as<const char*>());
+    TEST_ASSERT_EQUAL_STRING("v1.1.0", doc["envelope"]["schema_version"].as<const char*>());
 }
 
 void test_build_envelope_with_correlation(void) {
@@ -124,8 +125,12 @@ void test_validate_envelope_type_valid(void) {
     TEST_ASSERT_TRUE(validateEnvelopeType("device.command.request"));
     TEST_ASSERT_TRUE(validateEnvelopeType("device.command.response"));
     TEST_ASSERT_TRUE(validateEnvelopeType("service.heartbeat"));
+    TEST_ASSERT_TRUE(validateEnvelopeType("service.hello"));
     TEST_ASSERT_TRUE(validateEnvelopeType("system.emergency_stop"));
     TEST_ASSERT_TRUE(validateEnvelopeType("system.ota.request"));
+    TEST_ASSERT_TRUE(validateEnvelopeType("test.state.update"));
+    TEST_ASSERT_TRUE(validateEnvelopeType("test.control.request"));
+    TEST_ASSERT_TRUE(validateEnvelopeType("test.control.response"));
 }
 
 void test_validate_envelope_type_invalid(void) {
@@ -133,6 +138,41 @@ void test_validate_envelope_type_invalid(void) {
     TEST_ASSERT_FALSE(validateEnvelopeType(nullptr));
 }
 
+void test_schema_version_compatible(void) {
+    TEST_ASSERT_TRUE(schemaVersionCompatible("v1.0.0"));
+    TEST_ASSERT_TRUE(schemaVersionCompatible("v1.1.0"));
+    TEST_ASSERT_TRUE(schemaVersionCompatible("v1.12.3"));
+}
+
+void test_schema_version_incompatible(void) {
+    TEST_ASSERT_FALSE(schemaVersionCompatible("v2.0.0"));
+    TEST_ASSERT_FALSE(schemaVersionCompatible("v10.0.0"));
+    TEST_ASSERT_FALSE(schemaVersionCompatible("1.1.0"));
+    TEST_ASSERT_FALSE(schemaVersionCompatible("v1.1"));
+    TEST_ASSERT_FALSE(schemaVersionCompatible("v1.1.0-rc1"));
+    TEST_ASSERT_FALSE(schemaVersionCompatible(""));
+    TEST_ASSERT_FALSE(schemaVersionCompatible(nullptr));
+}
+
+void test_generate_uuid_is_v4(void) {
+    char a[37];
+    char b[37];
+    generateUUID(a, sizeof(a));
+    generateUUID(b, sizeof(b));
+
+    TEST_ASSERT_EQUAL(36, strlen(a));
+    for (int i = 0; i < 36; i++) {
+        if (i == 8 || i == 13 || i == 18 || i == 23) {
+            TEST_ASSERT_EQUAL_CHAR('-', a[i]);
+        } else {
+            TEST_ASSERT_TRUE((a[i] >= '0' && a[i] <= '9') || (a[i] >= 'a' && a[i] <= 'f'));
+        }
+    }
+    TEST_ASSERT_EQUAL_CHAR('4', a[14]);
+    TEST_ASSERT_NOT_NULL(strchr("89ab", a[19]));
+    TEST_ASSERT_TRUE(strcmp(a, b) != 0);
+}
+
 void test_roundtrip_build_parse(void) {
     // Build
     JsonDocument buildDoc;
@@ -168,7 +208,7 @@ void test_roundtrip_build_parse(void) {
     TEST_ASSERT_EQUAL_STRING("station", service);
     TEST_ASSERT_EQUAL_STRING("station-01", instance);
     TEST_ASSERT_EQUAL_STRING("1.0.0", version);
-    TEST_ASSERT_EQUAL_STRING("v1.0.0", schemaVersion);
+    TEST_ASSERT_EQUAL_STRING("v1.1.0", schemaVersion);
     TEST_ASSERT_EQUAL_STRING("device.command.request", type);
 
     // Verify optional fields survived roundtrip
@@ -187,6 +227,9 @@ int main(int argc, char **argv) {
     RUN_TEST(test_parse_envelope_missing_field);
     RUN_TEST(test_validate_envelope_type_valid);
     RUN_TEST(test_validate_envelope_type_invalid);
+    RUN_TEST(test_schema_version_compatible);
+    RUN_TEST(test_schema_version_incompatible);
+    RUN_TEST(test_generate_uuid_is_v4);
     RUN_TEST(test_roundtrip_build_parse);
     UNITY_END();
     return 0;
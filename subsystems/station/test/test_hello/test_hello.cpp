@@ -0,0 +1,75 @@
+#include <unity.h>
+#include <ArduinoJson.h>
+#include <cstring>
+#include "messaging/hello.h"
+#include "messaging/envelope.h"
+
+using namespace arturo;
+
+void setUp(void) {}
+void tearDown(void) {}
+
+static Source makeTestSource() {
+    Source src;
+    src.service = "station";
+    src.instance = "station-001";
+    src.version = "1.1.0";
+    return src;
+}
+
+void test_build_hello_has_envelope(void) {
+    JsonDocument doc;
+    Source src = makeTestSource();
+
+    bool result = buildHello(doc, src, "msg-001", 1700000000, "1.1.0", true);
+    TEST_ASSERT_TRUE(result);
+    TEST_ASSERT_EQUAL_STRING("service.hello",
+                             doc["envelope"]["type"].as<const char*>());
+    TEST_ASSERT_EQUAL_STRING("v1.1.0",
+                             doc["envelope"]["schema_version"].as<const char*>());
+    TEST_ASSERT_TRUE(doc["envelope"]["correlation_id"].isNull());
+}
+
+void test_build_hello_payload(void) {
+    JsonDocument doc;
+    Source src = makeTestSource();
+
+    buildHello(doc, src, "msg-002", 1700000000, "1.1.0", true);
+
+    JsonObject payload = doc["payload"];
+    TEST_ASSERT_FALSE(payload.isNull());
+    TEST_ASSERT_EQUAL_STRING("1.1.0", payload["firmware_version"].as<const char*>());
+    TEST_ASSERT_TRUE(payload["request"].as<bool>());
+
+    JsonArray types = payload["message_types"];
+    bool hasCommand = false;
+    bool hasHello = false;
+    for (JsonVariant t : types) {
+        if (strcmp(t.as<const char*>(), "device.command.request") == 0) hasCommand = true;
+        if (strcmp(t.as<const char*>(), "service.hello") == 0) hasHello = true;
+    }
+    TEST_ASSERT_TRUE(hasCommand);
+    TEST_ASSERT_TRUE(hasHello);
+
+    JsonArray features = payload["features"];
+    TEST_ASSERT_EQUAL(4, features.size());
+    TEST_ASSERT_EQUAL_STRING("raw_commands", features[0].as<const char*>());
+}
+
+void test_build_hello_reply_omits_request(void) {
+    JsonDocument doc;
+    Source src = makeTestSource();
+
+    buildHello(doc, src, "msg-003", 1700000000, "1.1.0", false);
+
+    TEST_ASSERT_TRUE(doc["payload"]["request"].isNull());
+}
+
+int main(int argc, char **argv) {
+    UNITY_BEGIN();
+    RUN_TEST(test_build_hello_has_envelope);
+    RUN_TEST(test_build_hello_payload);
+    RUN_TEST(test_build_hello_reply_omits_request);
+    UNITY_END();
+    return 0;
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/holla2040/arturo/internal/script/redisrouter"
 	"github.com/holla2040/arturo/internal/script/result"
 	"github.com/holla2040/arturo/internal/script/validate"
+	"github.com/holla2040/arturo/internal/transport"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -49,7 +50,7 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "Usage:")
 	fmt.Fprintln(os.Stderr, "  engine validate <file.art>                           Validate a script")
 	fmt.Fprintln(os.Stderr, "  engine devices --profiles <dir>                      List device profiles")
-	fmt.Fprintln(os.Stderr, "  engine run [--redis addr] [--station id] [--device id] <file.art>  Execute a script")
+	fmt.Fprintln(os.Stderr, "  engine run [--redis addr | --mqtt url] [--station id] [--device id] <file.art>  Execute a script")
 }
 
 // ---------------------------------------------------------------------------
@@ -112,8 +113,9 @@ func cmdDevices(args []string) {
 // ---------------------------------------------------------------------------
 
 func cmdRun(args []string) {
-	// Parse flags: --redis <addr> --station <id> --device <id> <file.art>
+	// Parse flags: --redis <addr> --mqtt <url> --station <id> --device <id> <file.art>
 	redisAddr := "localhost:6379"
+	mqttBroker := ""
 	station := "station-01"
 	device := ""
 	var scriptPath string
@@ -127,6 +129,13 @@ func cmdRun(args []string) {
 			}
 			i++
 			redisAddr = args[i]
+		case "--mqtt":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "--mqtt requires a broker URL")
+				os.Exit(1)
+			}
+			i++
+			mqttBroker = args[i]
 		case "--station":
 			if i+1 >= len(args) {
 				fmt.Fprintln(os.Stderr, "--station requires an id")
@@ -179,21 +188,45 @@ func cmdRun(args []string) {
 		os.Exit(1)
 	}
 
-	// Connect to Redis and create router.
-	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
-	defer rdb.Close()
-
 	engineSource := protocol.Source{
 		Service:  "engine",
 		Instance: "engine-01",
 		Version:  "1.0.0",
 	}
-	router := redisrouter.New(rdb, engineSource, station)
+
+	// Connect to the message bus (Redis unless --mqtt) and create router.
+	var bus transport.Transport
+	if mqttBroker != "" {
+		m, err := transport.NewMQTT(transport.MQTTOptions{Broker: mqttBroker, ClientID: engineSource.Instance})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		bus = m
+	} else {
+		bus = transport.NewRedis(redis.NewClient(&redis.Options{Addr: redisAddr}))
+	}
+	defer bus.Close()
+
+	// One listener on our response stream feeds every command's waiter,
+	// the same way the controller runs scripts.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	responses := transport.ResponseStream(engineSource.Instance)
+	if err := bus.CreateGroup(ctx, responses, transport.ControllerGroup, "$"); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	dispatcher := transport.NewDispatcher()
+	go transport.ListenResponses(ctx, bus, engineSource.Instance, func(msg *protocol.Message) {
+		dispatcher.Dispatch(msg)
+	})
+	router := redisrouter.New(transport.NewSender(bus), dispatcher, engineSource, station)
 
 	// Execute.
 	collector := result.NewCollector(scriptPath)
 	exec := executor.New(
-		context.Background(),
+		ctx,
 		executor.WithCollector(collector),
 		executor.WithRouter(router),
 		executor.WithLogger(os.Stderr),
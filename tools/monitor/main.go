@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/holla2040/arturo/internal/protocol"
+	"github.com/holla2040/arturo/internal/transport"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -26,6 +27,8 @@ func main() {
 	corr := flag.String("corr", "", "track one correlation ID")
 	jsonOut := flag.Bool("json", false, "raw JSON output")
 	logFile := flag.String("log", "", "path to JSONL log file")
+	validate := flag.Bool("validate", false, "check messages against the JSON schemas and flag non-conforming ones")
+	mqttBroker := flag.String("mqtt", os.Getenv("MQTT_URL"), "watch an MQTT broker (e.g. tcp://localhost:1883) instead of Redis")
 	flag.Parse()
 
 	// If no mode flags set, show everything
@@ -34,22 +37,34 @@ func main() {
 	showPubSub := showAll || *pubsub
 	showPresence := showAll || *presence
 
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "localhost:6379"
-	}
-
-	rdb := redis.NewClient(&redis.Options{
-		Addr: redisURL,
-	})
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Verify Redis connection
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("cannot connect to Redis at %s: %v", redisURL, err)
+	var bus transport.Transport
+	if *mqttBroker != "" {
+		clientID := fmt.Sprintf("monitor-%d", os.Getpid())
+		m, err := transport.NewMQTT(transport.MQTTOptions{Broker: *mqttBroker, ClientID: clientID})
+		if err != nil {
+			log.Fatalf("cannot connect to MQTT broker at %s: %v", *mqttBroker, err)
+		}
+		bus = m
+	} else {
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			redisURL = "localhost:6379"
+		}
+
+		rdb := redis.NewClient(&redis.Options{
+			Addr: redisURL,
+		})
+
+		// Verify Redis connection
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Fatalf("cannot connect to Redis at %s: %v", redisURL, err)
+		}
+		bus = transport.NewRedis(rdb)
 	}
+	defer bus.Close()
 
 	// Open log file if requested
 	var logWriter *os.File
@@ -83,97 +98,40 @@ func main() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// Track last IDs per stream
-			lastIDs := make(map[string]string)
-
-			for {
-				if ctx.Err() != nil {
-					return
-				}
+			sub, err := bus.Watch(ctx)
+			if err != nil {
+				log.Printf("stream watch error: %v", err)
+				return
+			}
+			defer sub.Close()
 
-				// SCAN for command and response streams
-				var streamKeys []string
-				iter := rdb.Scan(ctx, 0, "commands:*", 100).Iterator()
-				for iter.Next(ctx) {
-					streamKeys = append(streamKeys, iter.Val())
-				}
-				iter = rdb.Scan(ctx, 0, "responses:*", 100).Iterator()
-				for iter.Next(ctx) {
-					streamKeys = append(streamKeys, iter.Val())
+			for m := range sub.Messages() {
+				var msg protocol.Message
+				if err := json.Unmarshal(m.Data, &msg); err != nil {
+					log.Printf("parse error on %s/%s: %v", m.Channel, m.ID, err)
+					continue
 				}
 
-				if len(streamKeys) == 0 {
-					select {
-					case <-ctx.Done():
-						return
-					case <-time.After(time.Second):
-						continue
-					}
+				direction := "\u2192"
+				if strings.HasPrefix(m.Channel, "responses:") {
+					direction = "\u2190"
 				}
 
-				// Build XREAD args
-				args := &redis.XReadArgs{
-					Block:   time.Second,
-					Count:   100,
-					Streams: make([]string, 0, len(streamKeys)*2),
+				dm := &DisplayMessage{
+					Timestamp: time.Now(),
+					Channel:   m.Channel,
+					Direction: direction,
+					Message:   &msg,
+					StreamID:  m.ID,
 				}
-				for _, key := range streamKeys {
-					args.Streams = append(args.Streams, key)
-				}
-				for _, key := range streamKeys {
-					id, ok := lastIDs[key]
-					if !ok {
-						id = "$"
-					}
-					_ = key
-					args.Streams = append(args.Streams, id)
+				if *validate {
+					dm.SchemaErr = protocol.ValidateSchema(m.Data)
 				}
 
-				results, err := rdb.XRead(ctx, args).Result()
-				if err != nil {
-					if err == redis.Nil || ctx.Err() != nil {
-						continue
-					}
-					log.Printf("stream read error: %v", err)
-					continue
-				}
-
-				for _, stream := range results {
-					for _, xmsg := range stream.Messages {
-						lastIDs[stream.Stream] = xmsg.ID
-
-						fields := make(map[string]string)
-						for k, v := range xmsg.Values {
-							if s, ok := v.(string); ok {
-								fields[k] = s
-							}
-						}
-
-						msg, err := ParseStreamFields(fields)
-						if err != nil {
-							log.Printf("parse error on %s/%s: %v", stream.Stream, xmsg.ID, err)
-							continue
-						}
-
-						direction := "\u2192"
-						if strings.HasPrefix(stream.Stream, "responses:") {
-							direction = "\u2190"
-						}
-
-						dm := &DisplayMessage{
-							Timestamp: time.Now(),
-							Channel:   stream.Stream,
-							Direction: direction,
-							Message:   msg,
-							StreamID:  xmsg.ID,
-						}
-
-						select {
-						case displayCh <- dm:
-						case <-ctx.Done():
-							return
-						}
-					}
+				select {
+				case displayCh <- dm:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}()
@@ -184,22 +142,26 @@ func main() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			sub := rdb.PSubscribe(ctx, "events:*")
+			sub, err := bus.Subscribe(ctx, transport.ChannelEvents)
+			if err != nil {
+				log.Printf("pubsub subscribe error: %v", err)
+				return
+			}
 			defer sub.Close()
 
-			ch := sub.Channel()
+			ch := sub.Messages()
 			for {
 				select {
 				case <-ctx.Done():
 					return
-				case redisMsg, ok := <-ch:
+				case busMsg, ok := <-ch:
 					if !ok {
 						return
 					}
 
 					var msg protocol.Message
-					if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
-						log.Printf("pubsub parse error on %s: %v", redisMsg.Channel, err)
+					if err := json.Unmarshal(busMsg.Data, &msg); err != nil {
+						log.Printf("pubsub parse error on %s: %v", busMsg.Channel, err)
 						continue
 					}
 
@@ -209,10 +171,13 @@ func main() {
 
 					dm := &DisplayMessage{
 						Timestamp: time.Now(),
-						Channel:   redisMsg.Channel,
+						Channel:   busMsg.Channel,
 						Direction: "\u2190",
 						Message:   &msg,
 					}
+					if *validate {
+						dm.SchemaErr = protocol.ValidateSchema(busMsg.Data)
+					}
 
 					select {
 					case displayCh <- dm:
@@ -233,14 +198,14 @@ func main() {
 			defer ticker.Stop()
 
 			// Run once immediately, then on ticker
-			pollPresence(ctx, rdb, tracker)
+			pollPresence(ctx, bus, tracker)
 
 			for {
 				select {
 				case <-ctx.Done():
 					return
 				case <-ticker.C:
-					pollPresence(ctx, rdb, tracker)
+					pollPresence(ctx, bus, tracker)
 				}
 			}
 		}()
@@ -279,6 +244,9 @@ func main() {
 				continue
 			}
 			fmt.Println(string(data))
+			if dm.SchemaErr != nil {
+				log.Printf("schema: %s: %v", dm.Message.Envelope.ID, dm.SchemaErr)
+			}
 		} else {
 			fmt.Println(FormatMessage(dm))
 		}
@@ -304,23 +272,18 @@ func matchTypeFilter(msgType, filter string) bool {
 	return msgType == filter
 }
 
-// pollPresence scans for device:*:alive keys and prints their status.
-// It also checks tracker for stations that have vanished from Redis but were previously seen.
-func pollPresence(ctx context.Context, rdb *redis.Client, tracker *StationTracker) {
+// pollPresence lists the stations marked alive and prints their status.
+// It also checks tracker for stations that have vanished from the bus but were previously seen.
+func pollPresence(ctx context.Context, bus transport.Presence, tracker *StationTracker) {
 	seen := make(map[string]bool)
 
-	iter := rdb.Scan(ctx, 0, "device:*:alive", 100).Iterator()
-	for iter.Next(ctx) {
-		key := iter.Val()
-		instance := extractInstance(key)
+	alive, err := bus.Alive(ctx)
+	if err != nil {
+		log.Printf("presence error: %v", err)
+	}
+	for instance, ttl := range alive {
 		seen[instance] = true
-
-		ttl, err := rdb.TTL(ctx, key).Result()
-		if err != nil {
-			log.Printf("presence TTL error for %s: %v", key, err)
-			continue
-		}
-
+		key := transport.PresenceKey(instance)
 		state, lastSeen := tracker.GetState(instance, ttl)
 		fmt.Println(FormatPresence(key, int64(ttl.Seconds()), state, lastSeen))
 	}
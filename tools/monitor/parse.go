@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +15,7 @@ type DisplayMessage struct {
 	Direction string // "→" for outgoing/requests, "←" for incoming/responses
 	Message   *protocol.Message
 	StreamID  string
+	SchemaErr error // set with -validate when the message does not conform to its JSON schema
 }
 
 // extractInstance extracts the station instance name from a Redis key.
@@ -70,6 +70,39 @@ func FormatMessage(dm *DisplayMessage) string {
 			detail = fmt.Sprintf("corr=%s  (parse error)", corrID)
 		}
 
+	case protocol.TypeDeviceCommandBatchRequest:
+		tag = "batch"
+		req, err := protocol.ParseBatchRequest(dm.Message)
+		if err == nil {
+			names := make([]string, len(req.Commands))
+			for i, c := range req.Commands {
+				names[i] = c.CommandName
+			}
+			detail = fmt.Sprintf("%-20s  %s", fmt.Sprintf("cmds=%d", len(req.Commands)), strings.Join(names, ","))
+		} else {
+			detail = fmt.Sprintf("corr=%s  (parse error)", corrID)
+		}
+
+	case protocol.TypeDeviceCommandBatchResponse:
+		tag = "batch-rsp"
+		resp, err := protocol.ParseBatchResponse(dm.Message)
+		if err == nil {
+			failed := 0
+			for _, r := range resp.Results {
+				if !r.Success {
+					failed++
+				}
+			}
+			detail = fmt.Sprintf("%-20s  failed=%d", fmt.Sprintf("results=%d", len(resp.Results)), failed)
+			if failed == 0 {
+				color = colorGreen
+			} else {
+				color = colorRed
+			}
+		} else {
+			detail = fmt.Sprintf("corr=%s  (parse error)", corrID)
+		}
+
 	case protocol.TypeServiceHeartbeat:
 		tag = "heartbeat"
 		color = colorCyan
@@ -84,6 +117,49 @@ func FormatMessage(dm *DisplayMessage) string {
 			detail = "(parse error)"
 		}
 
+	case protocol.TypeServiceHello:
+		tag = "hello"
+		hello, err := protocol.ParseHello(dm.Message)
+		if err == nil {
+			detail = fmt.Sprintf("%-20s  features=%s", dm.Message.Envelope.SchemaVersion, strings.Join(hello.Features, ","))
+			if hello.Request {
+				detail += "  (request)"
+			}
+		} else {
+			detail = "(parse error)"
+		}
+
+	case protocol.TypeTestStateUpdate:
+		tag = "test"
+		ts, err := protocol.ParseTestStateUpdate(dm.Message)
+		if err == nil {
+			detail = fmt.Sprintf("%-20s  test=%s  elapsed=%ds", "state="+ts.State, ts.TestID, ts.ElapsedSeconds)
+		} else {
+			detail = "(parse error)"
+		}
+
+	case protocol.TypeTestControlRequest:
+		tag = "control"
+		req, err := protocol.ParseTestControlRequest(dm.Message)
+		if err == nil {
+			detail = fmt.Sprintf("%-20s  station=%s", "action="+req.Action, req.StationInstance)
+		} else {
+			detail = "(parse error)"
+		}
+
+	case protocol.TypeTestControlResponse:
+		tag = "control"
+		resp, err := protocol.ParseTestControlResponse(dm.Message)
+		if err == nil {
+			detail = fmt.Sprintf("%-20s  station=%s  success=%t", "action="+resp.Action, resp.StationInstance, resp.Success)
+			if resp.Error != nil {
+				detail += fmt.Sprintf("  %s: %s", resp.Error.Code, resp.Error.Message)
+				color = colorRed
+			}
+		} else {
+			detail = "(parse error)"
+		}
+
 	case protocol.TypeSystemEmergencyStop:
 		tag = "estop"
 		color = colorRed
@@ -99,6 +175,14 @@ func FormatMessage(dm *DisplayMessage) string {
 		detail = fmt.Sprintf("corr=%s", corrID)
 	}
 
+	if dm.SchemaErr != nil {
+		restore := color
+		if restore == "" {
+			restore = colorReset
+		}
+		detail += fmt.Sprintf("  %s[schema: %v]%s", colorYellow, dm.SchemaErr, restore)
+	}
+
 	body := fmt.Sprintf("[%-9s]  %-12s  %s", tag, instance, detail)
 	if color != "" {
 		return color + body + colorReset
@@ -146,28 +230,6 @@ func FormatPresence(key string, ttl int64, state StationState, lastSeen time.Tim
 	return color + line + colorReset
 }
 
-// ParseStreamFields extracts a protocol.Message from Redis stream fields.
-// The stream stores JSON as a single "data" field, or falls back to the first field value.
-func ParseStreamFields(fields map[string]string) (*protocol.Message, error) {
-	data, ok := fields["data"]
-	if !ok {
-		// Fall back to first field value
-		for _, v := range fields {
-			data = v
-			break
-		}
-	}
-	if data == "" {
-		return nil, fmt.Errorf("no message data in stream fields")
-	}
-
-	var msg protocol.Message
-	if err := json.Unmarshal([]byte(data), &msg); err != nil {
-		return nil, fmt.Errorf("parse stream message: %w", err)
-	}
-	return &msg, nil
-}
-
 // HealthWarnings returns warning strings for concerning heartbeat values.
 func HealthWarnings(hb *protocol.HeartbeatPayload) []string {
 	var warnings []string
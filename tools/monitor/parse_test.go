@@ -137,6 +137,50 @@ func TestFormatMessage(t *testing.T) {
 				"initiator=estop-01",
 			},
 		},
+		{
+			name: "batch request",
+			dm: &DisplayMessage{
+				Timestamp: ts,
+				Channel:   "commands:station-01",
+				Direction: "\u2192",
+				Message: &protocol.Message{
+					Envelope: makeEnvelope(protocol.TypeDeviceCommandBatchRequest, "7c9e6679-7425-40de-944b-e07fc1f90ae7"),
+					Payload: mustMarshal(t, protocol.BatchRequestPayload{
+						Commands: []protocol.BatchCommand{
+							{DeviceID: "PUMP-01", CommandName: "get_temp_1st_stage"},
+							{DeviceID: "PUMP-01", CommandName: "get_temp_2nd_stage"},
+						},
+					}),
+				},
+			},
+			contains: []string{
+				"[batch    ]",
+				"cmds=2",
+				"get_temp_1st_stage,get_temp_2nd_stage",
+			},
+		},
+		{
+			name: "batch response",
+			dm: &DisplayMessage{
+				Timestamp: ts,
+				Channel:   "responses:ctrl-01",
+				Direction: "\u2190",
+				Message: &protocol.Message{
+					Envelope: makeEnvelope(protocol.TypeDeviceCommandBatchResponse, "7c9e6679-7425-40de-944b-e07fc1f90ae7"),
+					Payload: mustMarshal(t, protocol.BatchResponsePayload{
+						Results: []protocol.CommandResponsePayload{
+							{DeviceID: "PUMP-01", CommandName: "get_temp_1st_stage", Success: true},
+							{DeviceID: "PUMP-01", CommandName: "get_temp_2nd_stage", Error: &protocol.Error{Code: protocol.ErrCodeDeviceTimeout, Message: "no answer"}},
+						},
+					}),
+				},
+			},
+			contains: []string{
+				"[batch-rsp]",
+				"results=2",
+				"failed=1",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -492,55 +536,6 @@ func TestStationTracker(t *testing.T) {
 	})
 }
 
-func TestParseStreamFields(t *testing.T) {
-	t.Run("valid JSON in data field", func(t *testing.T) {
-		fields := map[string]string{
-			"data": `{"envelope":{"id":"550e8400-e29b-41d4-a716-446655440000","timestamp":1771329600,"source":{"service":"controller","instance":"ctrl-01","version":"1.0.0"},"schema_version":"v1.0.0","type":"device.command.request","correlation_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","reply_to":"responses:controller:ctrl-01"},"payload":{"device_id":"fluke-8846a","command_name":"measure_dc_voltage"}}`,
-		}
-		msg, err := ParseStreamFields(fields)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if msg.Envelope.Type != protocol.TypeDeviceCommandRequest {
-			t.Errorf("type = %q, want %q", msg.Envelope.Type, protocol.TypeDeviceCommandRequest)
-		}
-		if msg.Envelope.Source.Instance != "ctrl-01" {
-			t.Errorf("instance = %q, want %q", msg.Envelope.Source.Instance, "ctrl-01")
-		}
-	})
-
-	t.Run("valid JSON in first field (no data key)", func(t *testing.T) {
-		fields := map[string]string{
-			"message": `{"envelope":{"id":"550e8400-e29b-41d4-a716-446655440000","timestamp":1771329600,"source":{"service":"controller","instance":"ctrl-01","version":"1.0.0"},"schema_version":"v1.0.0","type":"service.heartbeat"},"payload":{"status":"running","uptime_seconds":3600,"devices":[],"free_heap":245000,"wifi_rssi":-42,"firmware_version":"1.0.0"}}`,
-		}
-		msg, err := ParseStreamFields(fields)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
-		}
-		if msg.Envelope.Type != protocol.TypeServiceHeartbeat {
-			t.Errorf("type = %q, want %q", msg.Envelope.Type, protocol.TypeServiceHeartbeat)
-		}
-	})
-
-	t.Run("bad JSON returns error", func(t *testing.T) {
-		fields := map[string]string{
-			"data": `{not valid json`,
-		}
-		_, err := ParseStreamFields(fields)
-		if err == nil {
-			t.Fatal("expected error for bad JSON, got nil")
-		}
-	})
-
-	t.Run("empty fields returns error", func(t *testing.T) {
-		fields := map[string]string{}
-		_, err := ParseStreamFields(fields)
-		if err == nil {
-			t.Fatal("expected error for empty fields, got nil")
-		}
-	})
-}
-
 func TestHealthWarnings(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -659,3 +654,35 @@ func TestStripANSI(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatMessageSchemaError(t *testing.T) {
+	msg := &protocol.Message{
+		Envelope: makeEnvelope(protocol.TypeTestControlRequest, ""),
+		Payload:  json.RawMessage(`{"station_instance":"station-01","action":"stop"}`),
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemaErr := protocol.ValidateSchema(data)
+	if schemaErr == nil {
+		t.Fatal("ValidateSchema accepted action \"stop\"")
+	}
+
+	dm := &DisplayMessage{Channel: "events:test.control", Message: msg}
+	if out := FormatMessage(dm); strings.Contains(out, "[schema") {
+		t.Errorf("no -validate result, got %q", out)
+	}
+
+	dm.SchemaErr = schemaErr
+	out := FormatMessage(dm)
+	if !strings.Contains(out, colorYellow+"[schema: ") {
+		t.Errorf("missing yellow schema warning: %q", out)
+	}
+	if !strings.Contains(stripANSI(out), "/payload/action") {
+		t.Errorf("warning does not name the bad field: %q", stripANSI(out))
+	}
+	if !strings.HasSuffix(out, colorReset) {
+		t.Errorf("line does not end with a color reset: %q", out)
+	}
+}